@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"strings"
+	"time"
 )
 
 // ErrorType 代表错误类型。
@@ -22,11 +23,55 @@ const (
 )
 
 // CrawlerError 代表爬虫错误的接口类型。
+// 它支持标准库中的errors.Is和errors.As函数。
 type CrawlerError interface {
 	// Type 用于获得错误的类型。
 	Type() ErrorType
 	// Error 用于获得错误提示信息。
 	Error() string
+	// Unwrap 用于获得导致该错误的错误值。若结果值为nil，则说明没有更深层的原因。
+	Unwrap() error
+	// Context 用于获得错误发生时的上下文。
+	Context() ErrorContext
+}
+
+// ErrorContext 代表爬虫错误的上下文。
+type ErrorContext struct {
+	// URL 代表相关请求的URL。
+	URL string `json:"url,omitempty"`
+	// MID 代表出错的组件实例的ID。
+	MID string `json:"mid,omitempty"`
+	// Stage 代表出错时所处的调度阶段。
+	Stage string `json:"stage,omitempty"`
+	// Depth 代表相关请求的深度。
+	Depth uint32 `json:"depth,omitempty"`
+	// Attempt 代表相关请求的下载尝试次数。
+	Attempt uint32 `json:"attempt,omitempty"`
+	// Time 代表错误发生的时间。
+	Time time.Time `json:"time"`
+}
+
+// merge 用于以另一个上下文中的非零值填补当前上下文中的零值。
+func (ctx ErrorContext) merge(another ErrorContext) ErrorContext {
+	if ctx.URL == "" {
+		ctx.URL = another.URL
+	}
+	if ctx.MID == "" {
+		ctx.MID = another.MID
+	}
+	if ctx.Stage == "" {
+		ctx.Stage = another.Stage
+	}
+	if ctx.Depth == 0 {
+		ctx.Depth = another.Depth
+	}
+	if ctx.Attempt == 0 {
+		ctx.Attempt = another.Attempt
+	}
+	if ctx.Time.IsZero() {
+		ctx.Time = another.Time
+	}
+	return ctx
 }
 
 // myCrawlerError 代表爬虫错误的实现类型。
@@ -37,6 +82,10 @@ type myCrawlerError struct {
 	errMsg string
 	// fullErrMsg 代表完整的错误提示信息。
 	fullErrMsg string
+	// cause 代表导致该错误的错误值。
+	cause error
+	// ctx 代表错误发生时的上下文。
+	ctx ErrorContext
 }
 
 // NewCrawlerError 用于创建一个新的爬虫错误值。
@@ -44,18 +93,56 @@ func NewCrawlerError(errType ErrorType, errMsg string) CrawlerError {
 	return &myCrawlerError{
 		errType: errType,
 		errMsg:  strings.TrimSpace(errMsg),
+		ctx:     ErrorContext{Time: time.Now()},
 	}
 }
 
 // NewCrawlerErrorBy 用于根据给定的错误值创建一个新的爬虫错误值。
+// 给定的错误值会被作为新错误值的原因。
 func NewCrawlerErrorBy(errType ErrorType, err error) CrawlerError {
-	return NewCrawlerError(errType, err.Error())
+	return &myCrawlerError{
+		errType: errType,
+		errMsg:  strings.TrimSpace(err.Error()),
+		cause:   err,
+		ctx:     ErrorContext{Time: time.Now()},
+	}
+}
+
+// WithContext 用于为给定的错误值附加上下文。
+// 若给定的错误值是爬虫错误，则会得到它的一个副本，
+// 其上下文中原有的非零值会被保留，其余的值会取自参数ctx。
+// 否则，会以参数errType作为类型并以给定的错误值作为原因创建一个新的爬虫错误值。
+func WithContext(err error, errType ErrorType, ctx ErrorContext) CrawlerError {
+	if ctx.Time.IsZero() {
+		ctx.Time = time.Now()
+	}
+	switch ce := err.(type) {
+	case *myCrawlerError:
+		newCE := *ce
+		newCE.ctx = ce.ctx.merge(ctx)
+		return &newCE
+	case CrawlerError:
+		newCE := NewCrawlerErrorBy(ce.Type(), ce).(*myCrawlerError)
+		newCE.ctx = ce.Context().merge(ctx)
+		return newCE
+	}
+	newCE := NewCrawlerErrorBy(errType, err).(*myCrawlerError)
+	newCE.ctx = ctx
+	return newCE
 }
 
 func (ce *myCrawlerError) Type() ErrorType {
 	return ce.errType
 }
 
+func (ce *myCrawlerError) Unwrap() error {
+	return ce.cause
+}
+
+func (ce *myCrawlerError) Context() ErrorContext {
+	return ce.ctx
+}
+
 func (ce *myCrawlerError) Error() string {
 	if ce.fullErrMsg == "" {
 		ce.genFullErrMsg()
@@ -0,0 +1,96 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestCrawlerErrorNew(t *testing.T) {
+	ce := NewCrawlerError(ERROR_TYPE_DOWNLOADER, " timeout ")
+	expectedMsg := "crawler error: downloader error: timeout"
+	if ce.Error() != expectedMsg {
+		t.Fatalf("Inconsistent error message: expected: %q, actual: %q",
+			expectedMsg, ce.Error())
+	}
+	if ce.Type() != ERROR_TYPE_DOWNLOADER {
+		t.Fatalf("Inconsistent error type: expected: %q, actual: %q",
+			ERROR_TYPE_DOWNLOADER, ce.Type())
+	}
+	if ce.Unwrap() != nil {
+		t.Fatalf("Inconsistent cause: expected: %v, actual: %v", nil, ce.Unwrap())
+	}
+	if ce.Context().Time.IsZero() {
+		t.Fatal("The error time is not set!")
+	}
+}
+
+func TestCrawlerErrorUnwrap(t *testing.T) {
+	cause := fmt.Errorf("download: %w", context.DeadlineExceeded)
+	ce := NewCrawlerErrorBy(ERROR_TYPE_DOWNLOADER, cause)
+	expectedMsg := "crawler error: downloader error: download: context deadline exceeded"
+	if ce.Error() != expectedMsg {
+		t.Fatalf("Inconsistent error message: expected: %q, actual: %q",
+			expectedMsg, ce.Error())
+	}
+	if !stderrors.Is(ce, context.DeadlineExceeded) {
+		t.Fatal("The crawler error is not context.DeadlineExceeded!")
+	}
+	ce = NewCrawlerErrorBy(ERROR_TYPE_PIPELINE, NewIllegalParameterError("nil item"))
+	var ipe IllegalParameterError
+	if !stderrors.As(ce, &ipe) || ipe.Error() != "illegal parameter: nil item" {
+		t.Fatalf("Couldn't get the illegal parameter error from %v!", ce)
+	}
+	// 被包装的爬虫错误也可以被取出。
+	wrapped := fmt.Errorf("stage: %w", ce)
+	var target CrawlerError
+	if !stderrors.As(wrapped, &target) || target.Type() != ERROR_TYPE_PIPELINE {
+		t.Fatalf("Couldn't get the crawler error from %v!", wrapped)
+	}
+}
+
+func TestCrawlerErrorWithContext(t *testing.T) {
+	errTime := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	ctx := ErrorContext{
+		URL:     "http://example.com/",
+		MID:     "D1",
+		Stage:   "download",
+		Depth:   2,
+		Attempt: 3,
+		Time:    errTime,
+	}
+	// 非爬虫错误。
+	cause := stderrors.New("refused")
+	ce := WithContext(cause, ERROR_TYPE_DOWNLOADER, ctx)
+	if ce.Type() != ERROR_TYPE_DOWNLOADER || ce.Unwrap() != cause {
+		t.Fatalf("Inconsistent crawler error: type: %s, cause: %v", ce.Type(), ce.Unwrap())
+	}
+	if ce.Context() != ctx {
+		t.Fatalf("Inconsistent error context: expected: %#v, actual: %#v",
+			ctx, ce.Context())
+	}
+	// 爬虫错误的类型、提示信息和已有的上下文都会被保留。
+	original := WithContext(NewCrawlerError(ERROR_TYPE_ANALYZER, "bad page"),
+		ERROR_TYPE_SCHEDULER, ErrorContext{MID: "A2"})
+	ce = WithContext(original, ERROR_TYPE_SCHEDULER, ctx)
+	if ce.Type() != ERROR_TYPE_ANALYZER || ce.Error() != original.Error() {
+		t.Fatalf("Inconsistent crawler error: %v", ce)
+	}
+	expectedCtx := ctx
+	expectedCtx.MID = "A2"
+	expectedCtx.Time = original.Context().Time
+	if ce.Context() != expectedCtx {
+		t.Fatalf("Inconsistent error context: expected: %#v, actual: %#v",
+			expectedCtx, ce.Context())
+	}
+	if original.Context().URL != "" {
+		t.Fatal("The original crawler error has been modified!")
+	}
+	// 未指定时间的上下文。
+	ce = WithContext(cause, ERROR_TYPE_DOWNLOADER, ErrorContext{})
+	if ce.Context().Time.IsZero() {
+		t.Fatal("The error time is not set!")
+	}
+}
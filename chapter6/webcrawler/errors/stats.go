@@ -0,0 +1,163 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RootCause 用于获得导致给定错误值的最深层的错误值。
+// 若给定的错误值没有更深层的原因，则返回它本身。
+func RootCause(err error) error {
+	for err != nil {
+		cause := stderrors.Unwrap(err)
+		if cause == nil {
+			return err
+		}
+		err = cause
+	}
+	return nil
+}
+
+// wellKnownCauses 代表以提示信息作为原因类别的常见错误值的列表。
+var wellKnownCauses = []error{
+	context.Canceled,
+	context.DeadlineExceeded,
+	io.EOF,
+	io.ErrUnexpectedEOF,
+}
+
+// CauseKind 用于获得给定错误值的原因类别。
+// 对于常见的错误值和系统调用错误，结果值是其提示信息，否则是最深层原因的类型名称。
+// 没有更深层原因的爬虫错误的原因类别为空字符串。
+func CauseKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, known := range wellKnownCauses {
+		if stderrors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	var errno syscall.Errno
+	if stderrors.As(err, &errno) {
+		return errno.Error()
+	}
+	root := RootCause(err)
+	if _, ok := root.(CrawlerError); ok {
+		return ""
+	}
+	return fmt.Sprintf("%T", root)
+}
+
+// ErrorStat 代表一组类型和原因类别都相同的错误的统计信息。
+type ErrorStat struct {
+	// Type 代表错误的类型。
+	Type ErrorType `json:"type"`
+	// Cause 代表错误的原因类别。
+	Cause string `json:"cause,omitempty"`
+	// Count 代表错误的数量。
+	Count uint64 `json:"count"`
+	// LastError 代表最近一个错误的提示信息。
+	LastError string `json:"last_error"`
+	// LastContext 代表最近一个错误的上下文。
+	LastContext ErrorContext `json:"last_context"`
+}
+
+// Aggregator 代表错误聚合器的接口类型。
+// 它会按照类型和原因类别对错误进行分组计数。
+// 该接口的实现类型必须是并发安全的！
+type Aggregator interface {
+	// Add 用于添加一个错误值。
+	// 不是爬虫错误的错误值会被归为类型为空的一组。
+	Add(err error)
+	// Stats 用于获得各组错误的统计信息。
+	// 结果值会按照数量从多到少排序，数量相同时按照类型和原因类别排序。
+	Stats() []ErrorStat
+	// Total 用于获得已添加的错误值的总数。
+	Total() uint64
+	// Clear 用于清除所有的统计信息。
+	Clear()
+}
+
+// statKey 代表错误分组的键的类型。
+type statKey struct {
+	errType ErrorType
+	cause   string
+}
+
+// myAggregator 代表错误聚合器的实现类型。
+type myAggregator struct {
+	// lock 代表互斥锁。
+	lock sync.Mutex
+	// statMap 代表错误分组与其统计信息的映射。
+	statMap map[statKey]*ErrorStat
+	// total 代表已添加的错误值的总数。
+	total uint64
+}
+
+// NewAggregator 用于创建一个错误聚合器。
+func NewAggregator() Aggregator {
+	return &myAggregator{statMap: map[statKey]*ErrorStat{}}
+}
+
+func (aggregator *myAggregator) Add(err error) {
+	if err == nil {
+		return
+	}
+	key := statKey{cause: CauseKind(err)}
+	ctx := ErrorContext{Time: time.Now()}
+	var ce CrawlerError
+	if stderrors.As(err, &ce) {
+		key.errType = ce.Type()
+		ctx = ce.Context()
+	}
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	stat, ok := aggregator.statMap[key]
+	if !ok {
+		stat = &ErrorStat{Type: key.errType, Cause: key.cause}
+		aggregator.statMap[key] = stat
+	}
+	stat.Count++
+	stat.LastError = err.Error()
+	stat.LastContext = ctx
+	aggregator.total++
+}
+
+func (aggregator *myAggregator) Stats() []ErrorStat {
+	aggregator.lock.Lock()
+	stats := make([]ErrorStat, 0, len(aggregator.statMap))
+	for _, stat := range aggregator.statMap {
+		stats = append(stats, *stat)
+	}
+	aggregator.lock.Unlock()
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		if stats[i].Type != stats[j].Type {
+			return stats[i].Type < stats[j].Type
+		}
+		return stats[i].Cause < stats[j].Cause
+	})
+	return stats
+}
+
+func (aggregator *myAggregator) Total() uint64 {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	return aggregator.total
+}
+
+func (aggregator *myAggregator) Clear() {
+	aggregator.lock.Lock()
+	defer aggregator.lock.Unlock()
+	aggregator.statMap = map[statKey]*ErrorStat{}
+	aggregator.total = 0
+}
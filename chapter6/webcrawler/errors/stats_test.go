@@ -0,0 +1,92 @@
+package errors
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+func TestCauseKind(t *testing.T) {
+	urlErr := &url.Error{Op: "Get", URL: "http://example.com", Err: stderrors.New("x")}
+	cases := []struct {
+		err  error
+		kind string
+	}{
+		{nil, ""},
+		{NewCrawlerError(ERROR_TYPE_SCHEDULER, "plain"), ""},
+		{NewCrawlerErrorBy(ERROR_TYPE_DOWNLOADER, fmt.Errorf("a: %w", context.Canceled)), "context canceled"},
+		{NewCrawlerErrorBy(ERROR_TYPE_DOWNLOADER, io.ErrUnexpectedEOF), "unexpected EOF"},
+		{NewCrawlerErrorBy(ERROR_TYPE_DOWNLOADER, &url.Error{Err: syscall.ECONNREFUSED}),
+			syscall.ECONNREFUSED.Error()},
+		{NewCrawlerErrorBy(ERROR_TYPE_PIPELINE, NewIllegalParameterError("p")),
+			"errors.IllegalParameterError"},
+		{urlErr, "*errors.errorString"},
+	}
+	for _, c := range cases {
+		if kind := CauseKind(c.err); kind != c.kind {
+			t.Fatalf("Inconsistent cause kind of %v: expected: %q, actual: %q",
+				c.err, c.kind, kind)
+		}
+	}
+	if RootCause(nil) != nil {
+		t.Fatal("The root cause of nil is not nil!")
+	}
+	if RootCause(urlErr) != urlErr.Err {
+		t.Fatalf("Inconsistent root cause: expected: %v, actual: %v",
+			urlErr.Err, RootCause(urlErr))
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	aggregator := NewAggregator()
+	aggregator.Add(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := ErrorContext{URL: fmt.Sprintf("http://example.com/%d", i)}
+			err := WithContext(context.DeadlineExceeded, ERROR_TYPE_DOWNLOADER, ctx)
+			aggregator.Add(err)
+		}(i)
+	}
+	wg.Wait()
+	aggregator.Add(NewCrawlerError(ERROR_TYPE_ANALYZER, "bad page"))
+	aggregator.Add(NewCrawlerError(ERROR_TYPE_ANALYZER, "bad page again"))
+	aggregator.Add(stderrors.New("unknown"))
+	if aggregator.Total() != 13 {
+		t.Fatalf("Inconsistent total: expected: %d, actual: %d", 13, aggregator.Total())
+	}
+	stats := aggregator.Stats()
+	expected := []ErrorStat{
+		{Type: ERROR_TYPE_DOWNLOADER, Cause: "context deadline exceeded", Count: 10},
+		{Type: ERROR_TYPE_ANALYZER, Count: 2, LastError: "crawler error: analyzer error: bad page again"},
+		{Type: "", Cause: "*errors.errorString", Count: 1, LastError: "unknown"},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("Inconsistent stat number: expected: %d, actual: %d (stats: %#v)",
+			len(expected), len(stats), stats)
+	}
+	for i, stat := range stats {
+		if stat.Type != expected[i].Type || stat.Cause != expected[i].Cause ||
+			stat.Count != expected[i].Count {
+			t.Fatalf("Inconsistent stat[%d]: expected: %#v, actual: %#v", i, expected[i], stat)
+		}
+		if expected[i].LastError != "" && stat.LastError != expected[i].LastError {
+			t.Fatalf("Inconsistent last error of stat[%d]: expected: %q, actual: %q",
+				i, expected[i].LastError, stat.LastError)
+		}
+	}
+	if stats[0].LastContext.URL == "" {
+		t.Fatal("The context of the last error is not recorded!")
+	}
+	aggregator.Clear()
+	if aggregator.Total() != 0 || len(aggregator.Stats()) != 0 {
+		t.Fatal("The aggregator has not been cleared!")
+	}
+}
@@ -5,20 +5,54 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
 	"time"
 	lib "gopcp.v2/chapter6/webcrawler/examples/finder/internal"
-	"gopcp.v2/chapter6/webcrawler/examples/finder/monitor"
+	"gopcp.v2/chapter6/webcrawler/frontier"
+	"gopcp.v2/chapter6/webcrawler/monitor"
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/module/local/analyzer"
+	"gopcp.v2/chapter6/webcrawler/module/local/downloader"
+	"gopcp.v2/chapter6/webcrawler/toolkit/cookie"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
 	sched "gopcp.v2/chapter6/webcrawler/scheduler"
 	"gopcp.v2/helper/log"
 )
 
 // 命令参数。
 var (
-	firstURL string
-	domains  string
-	depth    uint
-	dirPath  string
+	firstURL      string
+	domains       string
+	depth         uint
+	dirPath       string
+	proxies       string
+	proxyStrategy string
+	stickyProxy   bool
+	userAgents    string
+	cookieDir     string
+	cookieSession string
+	cookiesTxt    string
+	bootstrapFile string
+	balancerName  string
+	healthCheck   bool
+	scoreName     string
+	maxRespSize   int64
+	resumeSize    int64
+	rulesFile     string
+	dedupDistance int
+	deadLetters   string
+	maxAttempts   uint
+	replayFile    string
+	spillDir      string
+	fingerprints  string
+	recrawlFile   string
+	recrawlMin    time.Duration
+	recrawlMax    time.Duration
+	minSize       int
+	frontierAddr  string
+	frontierServe string
+	workerName    string
 )
 
 // 日志记录器。
@@ -34,6 +68,164 @@ func init() {
 		"The depth for crawling.")
 	flag.StringVar(&dirPath, "dir", "./pictures",
 		"The path which you want to save the image files.")
+	flag.IntVar(&minSize, "min-size", 0,
+		"The minimum width and height in pixels of the images to save. "+
+			"Smaller images (e.g. thumbnails) are skipped. No image is skipped if it is 0.")
+	flag.StringVar(&proxies, "proxies", "",
+		"The proxies which you want to use. "+
+			"Please using comma-separated multiple proxy URLs.")
+	flag.StringVar(&proxyStrategy, "proxy-strategy",
+		string(downloader.PROXY_STRATEGY_ROUND_ROBIN),
+		"The strategy for selecting proxies: round_robin, random or least_failures.")
+	flag.BoolVar(&stickyProxy, "sticky-proxy", false,
+		"Use the same proxy for the same host.")
+	flag.StringVar(&userAgents, "user-agents", "",
+		"The User-Agent values which you want to rotate. "+
+			"Please using '|'-separated multiple values.")
+	flag.StringVar(&cookieDir, "cookie-dir", "",
+		"The directory for saving and loading cookies. "+
+			"The cookies will not be persisted if it is empty.")
+	flag.StringVar(&cookieSession, "cookie-session", "finder",
+		"The name of the crawl session (or identity) which the cookies belong to.")
+	flag.StringVar(&cookiesTxt, "cookies", "",
+		"The path of a Netscape cookies.txt file which you want to import.")
+	flag.StringVar(&bootstrapFile, "bootstrap", "",
+		"The path of a JSON file which declares the steps (e.g. login) "+
+			"to run before crawling.")
+	flag.StringVar(&balancerName, "balancer", module.BALANCER_SCORE,
+		"The load-balancing strategy for selecting modules: score, round_robin, "+
+			"weighted_random, least_handling, power_of_two or consistent_hash.")
+	flag.BoolVar(&healthCheck, "health-check", false,
+		"Quarantine the downloaders which keep failing or responding slowly.")
+	flag.StringVar(&scoreName, "score", module.SCORE_SIMPLE,
+		"The score calculator of downloaders for the score balancer: "+
+			"simple, reliability, latency or adaptive.")
+	flag.Int64Var(&maxRespSize, "max-response-size", 0,
+		"The maximum size in bytes of each response body. "+
+			"There is no limit if it is not greater than 0, "+
+			"except that saved images are limited to 32 MiB.")
+	flag.Int64Var(&resumeSize, "resume-size", 0,
+		"The minimum size in bytes of response bodies which are downloaded "+
+			"resumably via temporary files. It is disabled if not greater than 0.")
+	flag.StringVar(&rulesFile, "rules", "",
+		"The path of a JSON file which contains the extraction rules of analyzers. "+
+			"The built-in parsers are used if it is empty.")
+	flag.IntVar(&dedupDistance, "dedup-distance", -1,
+		"The max hamming distance between the fingerprints of near-duplicate pages. "+
+			"Content dedup is disabled if it is negative.")
+	flag.StringVar(&deadLetters, "dead-letters", "",
+		"The path of a JSON Lines file which the permanently failed requests and items "+
+			"are appended to. Failed requests are not retried if it is empty.")
+	flag.UintVar(&maxAttempts, "max-attempts", 3,
+		"The maximum number of download attempts of each request. "+
+			"It only works with -dead-letters.")
+	flag.StringVar(&replayFile, "replay", "",
+		"The path of a dead letter file whose requests and items "+
+			"you want to re-inject after the crawl starts.")
+	flag.StringVar(&spillDir, "spill-dir", "",
+		"The directory which the requests are spilled to when the request buffer pool is full. "+
+			"The analyzers will wait for the downloaders if it is empty.")
+	flag.StringVar(&fingerprints, "fingerprints", "",
+		"The path of a JSON Lines file which the fingerprints of the crawled pages "+
+			"are written to when the crawl finishes. No fingerprint is recorded if it is empty.")
+	flag.StringVar(&recrawlFile, "recrawl", "",
+		"The path of a fingerprint file written by a previous crawl. "+
+			"Only the pages which are due are revisited and the changes are reported. "+
+			"It only works with -fingerprints.")
+	flag.DurationVar(&recrawlMin, "recrawl-min", time.Hour,
+		"The minimum interval for revisiting a page.")
+	flag.DurationVar(&recrawlMax, "recrawl-max", 7*24*time.Hour,
+		"The maximum interval for revisiting a page.")
+	flag.StringVar(&frontierAddr, "frontier", "",
+		"The TCP address of a shared frontier service. "+
+			"All the finders using the same frontier service crawl together.")
+	flag.StringVar(&frontierServe, "frontier-serve", "",
+		"The TCP address which a shared frontier service listens on. "+
+			"If it is not empty, the finder only serves the frontier until it is interrupted.")
+	flag.StringVar(&workerName, "worker", "",
+		"The unique name of this finder among all the frontier workers. "+
+			"The host name and the process ID are used if it is empty.")
+}
+
+// prepareCookieJar 用于根据命令参数准备cookie jar。
+func prepareCookieJar() (cookie.Manager, cookie.Jar, error) {
+	manager, err := cookie.NewManager(cookieDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	jar, err := manager.Jar(cookieSession)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cookiesTxt != "" {
+		file, err := os.Open(cookiesTxt)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+		n, err := cookie.ImportNetscape(jar, file)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Infof("Imported %d cookies from %s.", n, cookiesTxt)
+	}
+	return manager, jar, nil
+}
+
+// splitFlag 用于按照给定的分隔符拆分命令参数，并去除空的部分。
+func splitFlag(value string, sep string) []string {
+	result := []string{}
+	for _, part := range strings.Split(value, sep) {
+		part = strings.TrimSpace(part)
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// getWorkerName 用于获取当前程序作为共享爬取边界的工作者时的名称。
+func getWorkerName() string {
+	if workerName != "" {
+		return workerName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "finder"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// serveFrontier 用于在给定的地址上提供共享爬取边界服务，直到程序被中断。
+func serveFrontier(addr string) {
+	f, err := frontier.New(frontier.Options{})
+	if err != nil {
+		logger.Fatalf("An error occurs when creating frontier: %s", err)
+	}
+	server, err := frontier.Listen(addr, f)
+	if err != nil {
+		logger.Fatalf("An error occurs when starting frontier service: %s", err)
+	}
+	logger.Infof("The frontier service is listening on %s.", server.Addr())
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sigChan:
+			if stats, err := f.Stats(); err == nil {
+				logger.Infof("Frontier stats: %+v", stats)
+			}
+			server.Close()
+			f.Close()
+			return
+		case <-ticker.C:
+			if stats, err := f.Stats(); err == nil {
+				logger.Infof("Frontier stats: %+v", stats)
+			}
+		}
+	}
 }
 
 func Usage() {
@@ -46,6 +238,10 @@ func Usage() {
 func main() {
 	flag.Usage = Usage
 	flag.Parse()
+	if frontierServe != "" {
+		serveFrontier(frontierServe)
+		return
+	}
 	// 创建调度器。
 	scheduler := sched.NewScheduler()
 	// 准备调度器的初始化参数。
@@ -62,6 +258,38 @@ func main() {
 		AcceptedDomains: acceptedDomains,
 		MaxDepth:        uint32(depth),
 	}
+	if dedupDistance >= 0 {
+		requestArgs.Dedup = &sched.DedupArgs{MaxDistance: dedupDistance}
+	}
+	if deadLetters != "" {
+		requestArgs.DeadLetter = &sched.DeadLetterArgs{
+			Path:        deadLetters,
+			MaxAttempts: uint32(maxAttempts),
+		}
+	}
+	if fingerprints != "" {
+		requestArgs.Recrawl = &sched.RecrawlArgs{
+			Input:       recrawlFile,
+			Output:      fingerprints,
+			MinInterval: recrawlMin,
+			MaxInterval: recrawlMax,
+		}
+	}
+	if frontierAddr != "" {
+		requestArgs.Frontier = &sched.FrontierArgs{
+			Addr:   frontierAddr,
+			Worker: getWorkerName(),
+		}
+	}
+	// 在打开死信文件之前读出需要重新注入的死信，以免读到本次追加的死信。
+	var replayLetters []sched.DeadLetter
+	if replayFile != "" {
+		var err error
+		replayLetters, err = sched.ReadDeadLetters(replayFile)
+		if err != nil {
+			logger.Fatalf("An error occurs when reading dead letters: %s", err)
+		}
+	}
 	dataArgs := sched.DataArgs{
 		ReqBufferCap:         50,
 		ReqMaxBufferNumber:   1000,
@@ -71,23 +299,73 @@ func main() {
 		ItemMaxBufferNumber:  100,
 		ErrorBufferCap:       50,
 		ErrorMaxBufferNumber: 1,
+		ReqSpillDir:          spillDir,
+	}
+	downloaderOpts := downloader.Options{
+		Proxies:          splitFlag(proxies, ","),
+		ProxyStrategy:    downloader.ProxyStrategy(proxyStrategy),
+		MaxProxyFailures: 3,
+		StickyProxy:      stickyProxy,
+		UserAgents:       splitFlag(userAgents, "|"),
 	}
-	downloaders, err := lib.GetDownloaders(2)
+	if maxRespSize > 0 {
+		downloaderOpts.Middlewares = append(downloaderOpts.Middlewares,
+			downloader.MaxResponseSizeMiddleware(maxRespSize))
+	}
+	if resumeSize > 0 {
+		downloaderOpts.Middlewares = append(downloaderOpts.Middlewares,
+			downloader.ResumableMiddleware(downloader.ResumeOptions{
+				MinSize:    resumeSize,
+				RetryDelay: time.Second,
+			}))
+	}
+	cookieManager, jar, err := prepareCookieJar()
+	if err != nil {
+		logger.Fatalf("An error occurs when preparing cookies: %s", err)
+	}
+	if bootstrapFile != "" {
+		requestArgs.Bootstrap, err = lib.LoadBootstrapArgs(bootstrapFile, jar)
+		if err != nil {
+			logger.Fatalf("An error occurs when loading bootstrap steps: %s", err)
+		}
+	}
+	scoreCalculator, err := module.GetScoreCalculator(scoreName)
+	if err != nil {
+		logger.Fatalf("An error occurs when getting score calculator: %s", err)
+	}
+	downloaders, err := lib.GetDownloaders(2, jar, downloaderOpts, scoreCalculator)
 	if err != nil {
 		logger.Fatalf("An error occurs when creating downloaders: %s", err)
 	}
-	analyzers, err := lib.GetAnalyzers(2)
+	var ruleSet *analyzer.RuleSet
+	if rulesFile != "" {
+		ruleSet, err = lib.LoadRuleSet(rulesFile)
+		if err != nil {
+			logger.Fatalf("An error occurs when loading extraction rules: %s", err)
+		}
+	}
+	analyzers, err := lib.GetAnalyzers(2, ruleSet)
 	if err != nil {
 		logger.Fatalf("An error occurs when creating analyzers: %s", err)
 	}
-	pipelines, err := lib.GetPipelines(2, dirPath)
+	pipelines, err := lib.GetPipelines(2, dirPath, minSize, maxRespSize)
 	if err != nil {
 		logger.Fatalf("An error occurs when creating pipelines: %s", err)
 	}
+	balancer, err := module.NewBalancer(balancerName)
+	if err != nil {
+		logger.Fatalf("An error occurs when creating balancer: %s", err)
+	}
 	moduleArgs := sched.ModuleArgs{
 		Downloaders: downloaders,
 		Analyzers:   analyzers,
 		Pipelines:   pipelines,
+		Balancer:    balancer,
+		// 调度器读取响应体时与下载器使用同样的最大尺寸。
+		BodyReader: reader.Options{MaxSize: maxRespSize},
+	}
+	if healthCheck {
+		moduleArgs.Health = &module.HealthOptions{}
 	}
 	// 初始化调度器。
 	err = scheduler.Init(
@@ -102,7 +380,7 @@ func main() {
 	summarizeInterval := 100 * time.Millisecond
 	maxIdleCount := uint(5)
 	// 开始监控。
-	checkCountChan := monitor.Monitor(
+	schedMonitor := monitor.Start(
 		scheduler,
 		checkInterval,
 		summarizeInterval,
@@ -120,6 +398,17 @@ func main() {
 	if err != nil {
 		logger.Fatalf("An error occurs when starting scheduler: %s", err)
 	}
+	if len(replayLetters) > 0 {
+		count, err := scheduler.Replay(replayLetters)
+		if err != nil {
+			logger.Errorf("An error occurs when replaying dead letters: %s", err)
+		}
+		logger.Infof("Replayed %d of %d dead letters.", count, len(replayLetters))
+	}
 	// 等待监控结束。
-	<-checkCountChan
+	<-schedMonitor.Done()
+	// 保存cookie以便下次运行时沿用。
+	if err := cookieManager.SaveAll(); err != nil {
+		logger.Errorf("An error occurs when saving cookies: %s", err)
+	}
 }
@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	sched "gopcp.v2/chapter6/webcrawler/scheduler"
+)
+
+// bootstrapFileStruct 代表会话引导文件的内容结构。
+type bootstrapFileStruct struct {
+	// Variables 代表可在步骤中引用的变量。
+	// 以“$”开头的值会被替换为同名的环境变量的值，以免在文件中保存密码。
+	Variables map[string]string `json:"variables"`
+	// Timeout 代表单个步骤的超时时间，例如“10s”。
+	Timeout string `json:"timeout"`
+	// Steps 代表需要依次执行的步骤。
+	Steps []sched.BootstrapStep `json:"steps"`
+}
+
+// LoadBootstrapArgs 用于从JSON文件中载入会话引导参数。
+// 参数jar代表执行步骤时使用的cookie jar，应该与下载器共用。
+func LoadBootstrapArgs(path string, jar http.CookieJar) (*sched.BootstrapArgs, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file bootstrapFileStruct
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	args := &sched.BootstrapArgs{
+		Client:    genHTTPClient(jar),
+		Variables: map[string]string{},
+		Steps:     file.Steps,
+	}
+	if file.Timeout != "" {
+		args.Timeout, err = time.ParseDuration(file.Timeout)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range file.Variables {
+		if strings.HasPrefix(value, "$") {
+			value = os.Getenv(value[1:])
+		}
+		args.Variables[name] = value
+	}
+	return args, nil
+}
@@ -7,8 +7,10 @@ import (
 )
 
 // genHTTPClient 用于生成HTTP客户端。
-func genHTTPClient() *http.Client {
+// 参数jar代表HTTP客户端使用的cookie jar，可以为nil。
+func genHTTPClient(jar http.CookieJar) *http.Client {
 	return &http.Client{
+		Jar: jar,
 		Transport: &http.Transport{
 			Proxy: http.ProxyFromEnvironment,
 			DialContext: (&net.Dialer{
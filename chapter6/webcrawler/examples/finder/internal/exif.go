@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// exifTagNames 代表需要提取的EXIF标签与其名称的映射。
+var exifTagNames = map[uint16]string{
+	0x010F: "make",
+	0x0110: "model",
+	0x0112: "orientation",
+	0x0131: "software",
+	0x0132: "date_time",
+	0x9003: "date_time_original",
+}
+
+// exifIFDPointerTag 代表指向EXIF子IFD的标签。
+const exifIFDPointerTag = 0x8769
+
+// EXIF字段类型的常量。
+const (
+	exifTypeASCII = 2
+	exifTypeShort = 3
+	exifTypeLong  = 4
+)
+
+// readEXIF 用于从JPEG图片中提取常用的EXIF信息。
+// 若图片不是JPEG格式或不包含EXIF信息，则返回nil。
+func readEXIF(data []byte) map[string]string {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		// SOS段之后是图像数据，不会再有EXIF信息。
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return parseTIFF(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return nil
+}
+
+// parseTIFF 用于从TIFF格式的EXIF数据中提取常用的信息。
+func parseTIFF(tiff []byte) map[string]string {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return nil
+	}
+	result := make(map[string]string)
+	exifOffset := readIFD(tiff, order, order.Uint32(tiff[4:]), result)
+	if exifOffset > 0 {
+		readIFD(tiff, order, exifOffset, result)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// readIFD 用于读取给定偏移量处的IFD，并把其中需要的标签值放入result。
+// 结果值代表EXIF子IFD的偏移量。若没有，则为0。
+func readIFD(tiff []byte, order binary.ByteOrder, offset uint32, result map[string]string) uint32 {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[offset:]))
+	var exifOffset uint32
+	for i := 0; i < count; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(tiff) {
+			break
+		}
+		entry := tiff[start : start+12]
+		tag := order.Uint16(entry)
+		fieldType := order.Uint16(entry[2:])
+		valueCount := order.Uint32(entry[4:])
+		if tag == exifIFDPointerTag && fieldType == exifTypeLong {
+			exifOffset = order.Uint32(entry[8:])
+			continue
+		}
+		name, ok := exifTagNames[tag]
+		if !ok {
+			continue
+		}
+		switch fieldType {
+		case exifTypeASCII:
+			value := entry[8:12]
+			if valueCount > 4 {
+				valueOffset := uint64(order.Uint32(entry[8:]))
+				if valueOffset+uint64(valueCount) > uint64(len(tiff)) {
+					continue
+				}
+				value = tiff[valueOffset : valueOffset+uint64(valueCount)]
+			} else {
+				value = value[:valueCount]
+			}
+			text := strings.TrimSpace(strings.TrimRight(string(value), "\x00"))
+			if text != "" {
+				result[name] = text
+			}
+		case exifTypeShort:
+			result[name] = strconv.Itoa(int(order.Uint16(entry[8:])))
+		case exifTypeLong:
+			result[name] = strconv.FormatUint(uint64(order.Uint32(entry[8:])), 10)
+		}
+	}
+	return exifOffset
+}
@@ -0,0 +1,203 @@
+package internal
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+// tiffEntry 代表测试用的IFD条目。
+type tiffEntry struct {
+	// tag 代表标签。
+	tag uint16
+	// fieldType 代表字段类型。
+	fieldType uint16
+	// count 代表值的个数。
+	count uint32
+	// value 代表值或值的偏移量。
+	value uint32
+	// inline 代表直接存放在条目中的不超过4个字节的ASCII值。
+	inline string
+}
+
+// genIFD 用于生成测试用的IFD。
+func genIFD(order binary.ByteOrder, entries []tiffEntry) []byte {
+	ifd := make([]byte, 2+len(entries)*12+4)
+	order.PutUint16(ifd, uint16(len(entries)))
+	for i, entry := range entries {
+		field := ifd[2+i*12:]
+		order.PutUint16(field, entry.tag)
+		order.PutUint16(field[2:], entry.fieldType)
+		order.PutUint32(field[4:], entry.count)
+		switch {
+		case entry.inline != "":
+			copy(field[8:12], entry.inline)
+		case entry.fieldType == exifTypeShort:
+			order.PutUint16(field[8:], uint16(entry.value))
+		default:
+			order.PutUint32(field[8:], entry.value)
+		}
+	}
+	return ifd
+}
+
+// genTIFF 用于生成测试用的TIFF数据。
+// IFD0紧跟在头部之后，参数tail会被追加在IFD0之后，其偏移量可由tiffTailOffset得到。
+func genTIFF(order binary.ByteOrder, ifd0 []tiffEntry, tail []byte) []byte {
+	header := make([]byte, 8)
+	if order == binary.LittleEndian {
+		copy(header, "II")
+	} else {
+		copy(header, "MM")
+	}
+	order.PutUint16(header[2:], 42)
+	order.PutUint32(header[4:], 8)
+	tiff := append(header, genIFD(order, ifd0)...)
+	return append(tiff, tail...)
+}
+
+// tiffTailOffset 用于获取IFD0包含n个条目时其后数据的偏移量。
+func tiffTailOffset(n int) uint32 {
+	return uint32(8 + 2 + n*12 + 4)
+}
+
+// genJPEG 用于生成包含给定的段的JPEG数据。
+func genJPEG(segments ...[]byte) []byte {
+	data := []byte{0xFF, 0xD8}
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, 0xFF, 0xDA, 0x00, 0x02)
+}
+
+// genSegment 用于生成给定标记和内容的JPEG段。
+func genSegment(marker byte, content []byte) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(content)+2))
+	return append(segment, content...)
+}
+
+// genAPP1 用于生成包含给定TIFF数据的EXIF段。
+func genAPP1(tiff []byte) []byte {
+	return genSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// genFullTIFF 用于生成包含IFD0和EXIF子IFD的完整的TIFF数据。
+func genFullTIFF(order binary.ByteOrder) []byte {
+	model := "Camera Model X\x00"
+	tailOffset := tiffTailOffset(4)
+	exifOffset := tailOffset + uint32(len(model))
+	ifd0 := []tiffEntry{
+		{tag: 0x010F, fieldType: exifTypeASCII, count: 4, inline: "ACM\x00"},
+		{tag: 0x0110, fieldType: exifTypeASCII, count: uint32(len(model)), value: tailOffset},
+		{tag: 0x0112, fieldType: exifTypeShort, count: 1, value: 6},
+		{tag: exifIFDPointerTag, fieldType: exifTypeLong, count: 1, value: exifOffset},
+	}
+	date := "2020:01:02 03:04:05\x00"
+	exifIFD := []tiffEntry{
+		{tag: 0x9003, fieldType: exifTypeASCII, count: uint32(len(date)),
+			value: exifOffset + uint32(len(genIFD(order, make([]tiffEntry, 1))))},
+	}
+	tail := append([]byte(model), genIFD(order, exifIFD)...)
+	tail = append(tail, date...)
+	return genTIFF(order, ifd0, tail)
+}
+
+func TestReadEXIF(t *testing.T) {
+	full := map[string]string{
+		"make":               "ACM",
+		"model":              "Camera Model X",
+		"orientation":        "6",
+		"date_time_original": "2020:01:02 03:04:05",
+	}
+	littleEndian := genFullTIFF(binary.LittleEndian)
+	comment := genSegment(0xFE, []byte("comment"))
+	tests := []struct {
+		name     string
+		data     []byte
+		expected map[string]string
+	}{
+		{"empty", nil, nil},
+		{"not JPEG", []byte("GIF89a"), nil},
+		{"no EXIF", genJPEG(comment), nil},
+		{"little endian", genJPEG(genAPP1(littleEndian)), full},
+		{"big endian", genJPEG(genAPP1(genFullTIFF(binary.BigEndian))), full},
+		{"after other segments", genJPEG(comment, genAPP1(littleEndian)), full},
+		{"APP1 without EXIF header", genJPEG(genSegment(0xE1, littleEndian)), nil},
+		{"truncated data", genJPEG(genAPP1(littleEndian))[:20], nil},
+		{"segment length beyond data",
+			append([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xFF}, "Exif\x00\x00"...), nil},
+		{"segment length too small", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x00, 0x01, 0x00, 0x00}, nil},
+		{"missing marker", []byte{0xFF, 0xD8, 0x00, 0xE1, 0x00, 0x02}, nil},
+		{"EXIF after image data", append(genJPEG(), genAPP1(littleEndian)...), nil},
+	}
+	for _, test := range tests {
+		result := readEXIF(test.data)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Fatalf("Inconsistent EXIF (%s): expected: %v, actual: %v",
+				test.name, test.expected, result)
+		}
+	}
+}
+
+func TestParseTIFF(t *testing.T) {
+	order := binary.LittleEndian
+	full := genFullTIFF(order)
+	orientation := tiffEntry{tag: 0x0112, fieldType: exifTypeShort, count: 1, value: 1}
+	// 把IFD0的偏移量改为给定的值。
+	withIFD0Offset := func(offset uint32) []byte {
+		tiff := append([]byte(nil), full...)
+		order.PutUint32(tiff[4:], offset)
+		return tiff
+	}
+	// IFD0中声明的条目数量超过实际数量。
+	overCounted := genTIFF(order, []tiffEntry{orientation}, nil)
+	order.PutUint16(overCounted[8:], 100)
+	tests := []struct {
+		name     string
+		tiff     []byte
+		expected map[string]string
+	}{
+		{"too short", full[:7], nil},
+		{"invalid byte order", append([]byte("XX"), full[2:]...), nil},
+		{"invalid magic number", append([]byte("II\x2B\x00"), full[4:]...), nil},
+		{"IFD0 offset beyond data", withIFD0Offset(uint32(len(full))), nil},
+		{"IFD0 offset overflow", withIFD0Offset(0xFFFFFFFF), nil},
+		{"truncated IFD0", full[:8+2+12+5], map[string]string{"make": "ACM"}},
+		{"over-counted IFD0", overCounted, map[string]string{"orientation": "1"}},
+		{"ASCII value offset beyond data",
+			genTIFF(order, []tiffEntry{
+				{tag: 0x0131, fieldType: exifTypeASCII, count: 10, value: 1000},
+				orientation,
+			}, nil),
+			map[string]string{"orientation": "1"}},
+		{"ASCII value offset overflow",
+			genTIFF(order, []tiffEntry{
+				{tag: 0x0131, fieldType: exifTypeASCII, count: 0xFFFFFFFF, value: 0xFFFFFFFF},
+			}, nil),
+			nil},
+		{"EXIF offset beyond data",
+			genTIFF(order, []tiffEntry{
+				orientation,
+				{tag: exifIFDPointerTag, fieldType: exifTypeLong, count: 1, value: 0xFFFFFFF0},
+			}, nil),
+			map[string]string{"orientation": "1"}},
+		{"blank ASCII value",
+			genTIFF(order, []tiffEntry{
+				{tag: 0x0131, fieldType: exifTypeASCII, count: 3, inline: "  \x00"},
+			}, nil),
+			nil},
+		{"unknown tags",
+			genTIFF(order, []tiffEntry{
+				{tag: 0x0100, fieldType: exifTypeLong, count: 1, value: 640},
+			}, nil),
+			nil},
+	}
+	for _, test := range tests {
+		result := parseTIFF(test.tiff)
+		if !reflect.DeepEqual(result, test.expected) {
+			t.Fatalf("Inconsistent EXIF (%s): expected: %v, actual: %v",
+				test.name, test.expected, result)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// manifestFileName 代表清单文件的名称。清单文件位于图片目录中。
+const manifestFileName = "manifest.jsonl"
+
+// DEFAULT_MAX_IMAGE_SIZE 代表默认的图片最大字节数。
+const DEFAULT_MAX_IMAGE_SIZE = 32 << 20
+
+// imageSource 代表图片的来源。
+type imageSource struct {
+	// URL 代表图片的URL。
+	URL string `json:"url"`
+	// PageURL 代表引用图片的页面的URL。
+	PageURL string `json:"page_url,omitempty"`
+}
+
+// manifestEntry 代表清单中的一个条目，即一个已保存的图片文件。
+type manifestEntry struct {
+	// File 代表图片文件的名称。
+	File string `json:"file"`
+	// Hash 代表图片内容的SHA-256摘要的十六进制形式。
+	Hash string `json:"sha256"`
+	// Size 代表图片文件的字节数。
+	Size int64 `json:"size"`
+	// Format 代表图片的格式。
+	Format string `json:"format,omitempty"`
+	// Width 代表图片的宽度，单位：像素。
+	Width int `json:"width,omitempty"`
+	// Height 代表图片的高度，单位：像素。
+	Height int `json:"height,omitempty"`
+	// EXIF 代表图片中的常用EXIF信息。
+	EXIF map[string]string `json:"exif,omitempty"`
+	// Sources 代表图片的所有来源。
+	Sources []imageSource `json:"sources"`
+}
+
+// imageStore 代表按照内容去重的图片存储。它是并发安全的。
+type imageStore struct {
+	// dirPath 代表图片目录的路径。
+	dirPath string
+	// minSize 代表图片的最小宽度和高度，单位：像素。
+	minSize int
+	// maxSize 代表图片的最大字节数。
+	maxSize int64
+	// lock 代表用于保护以下字段的互斥锁。
+	lock sync.Mutex
+	// entries 代表内容摘要与清单条目的映射。
+	entries map[string]*manifestEntry
+	// pending 代表内容摘要与正在被写入文件的图片的映射。
+	pending map[string]*pendingImage
+	// files 代表已使用的文件名的集合。
+	files map[string]bool
+	// dirty 代表清单在上一次写出之后是否有变化。
+	dirty bool
+}
+
+// pendingImage 代表正在被写入文件的图片。
+type pendingImage struct {
+	// entry 代表图片对应的清单条目。
+	entry *manifestEntry
+	// done 代表在写入结束时被关闭的通道。
+	done chan struct{}
+	// err 代表写入文件时发生的错误。只有在done被关闭之后才可读取。
+	err error
+}
+
+// newImageStore 用于创建一个图片存储。
+// 参数maxSize代表图片的最大字节数。值不大于0时使用DEFAULT_MAX_IMAGE_SIZE。
+// 若图片目录中已有清单文件，则会载入其中的条目，以便跨越多次爬取进行去重。
+func newImageStore(dirPath string, minSize int, maxSize int64) (*imageStore, error) {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_MAX_IMAGE_SIZE
+	}
+	store := &imageStore{
+		dirPath: dirPath,
+		minSize: minSize,
+		maxSize: maxSize,
+		entries: make(map[string]*manifestEntry),
+		pending: make(map[string]*pendingImage),
+		files:   make(map[string]bool),
+	}
+	file, err := os.Open(filepath.Join(dirPath, manifestFileName))
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry manifestEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid manifest entry: %s", err)
+		}
+		store.entries[entry.Hash] = &entry
+		store.files[entry.File] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	logger.Infof("Loaded %d manifest entries from %s.", len(store.entries), dirPath)
+	return store, nil
+}
+
+// imageResult 代表保存图片的结果。
+type imageResult struct {
+	// entry 代表图片对应的清单条目的副本。
+	entry manifestEntry
+	// duplicate 代表图片是否与已保存的图片重复。
+	duplicate bool
+	// skipped 代表图片是否因尺寸过小而被跳过。
+	skipped bool
+}
+
+// save 用于保存图片内容。
+// 参数name和ext分别代表建议的文件名和图片格式。
+// 与已保存的图片内容相同的图片不会被再次保存，而只会记录其来源。
+// 图片文件在锁之外写入，其间内容相同的图片会等待写入结束。
+func (store *imageStore) save(content []byte, name string, ext string,
+	source imageSource) (imageResult, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	entry := &manifestEntry{
+		Hash:    hash,
+		Size:    int64(len(content)),
+		Format:  ext,
+		Sources: []imageSource{source},
+	}
+	// 解析图片的尺寸和EXIF信息时无需持有锁。
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	tooSmall := false
+	if err == nil {
+		entry.Width = config.Width
+		entry.Height = config.Height
+		entry.Format = format
+		tooSmall = store.minSize > 0 &&
+			(config.Width < store.minSize || config.Height < store.minSize)
+	}
+	entry.EXIF = readEXIF(content)
+	store.lock.Lock()
+	if existing, ok := store.entries[hash]; ok {
+		store.addSource(existing, source)
+		result := imageResult{entry: copyEntry(existing), duplicate: true}
+		store.lock.Unlock()
+		return result, nil
+	}
+	if p, ok := store.pending[hash]; ok {
+		store.addSource(p.entry, source)
+		store.lock.Unlock()
+		<-p.done
+		if p.err != nil {
+			return imageResult{}, p.err
+		}
+		store.lock.Lock()
+		defer store.lock.Unlock()
+		return imageResult{entry: copyEntry(p.entry), duplicate: true}, nil
+	}
+	if tooSmall {
+		store.lock.Unlock()
+		return imageResult{entry: *entry, skipped: true}, nil
+	}
+	entry.File = store.fileName(name, entry.Format, hash)
+	store.files[entry.File] = true
+	p := &pendingImage{entry: entry, done: make(chan struct{})}
+	store.pending[hash] = p
+	store.lock.Unlock()
+	// 写入文件。
+	filePath := filepath.Join(store.dirPath, entry.File)
+	err = ioutil.WriteFile(filePath, content, 0644)
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	delete(store.pending, hash)
+	defer close(p.done)
+	if err != nil {
+		delete(store.files, entry.File)
+		p.err = fmt.Errorf("couldn't create file: %s (path: %s)", err, filePath)
+		return imageResult{}, p.err
+	}
+	store.entries[hash] = entry
+	store.dirty = true
+	return imageResult{entry: copyEntry(entry)}, nil
+}
+
+// addSource 用于为清单条目添加来源。调用方需持有锁。
+func (store *imageStore) addSource(entry *manifestEntry, source imageSource) {
+	if !hasSource(entry.Sources, source) {
+		entry.Sources = append(entry.Sources, source)
+		store.dirty = true
+	}
+}
+
+// fileName 用于为图片生成未被使用的文件名。调用方需持有锁。
+func (store *imageStore) fileName(name string, format string, hash string) string {
+	name = filepath.Base(name)
+	if name == "" || name == "." || name == "/" {
+		name = hash[:16]
+	}
+	if filepath.Ext(name) == "" && format != "" {
+		name += "." + format
+	}
+	if !store.files[name] && name != manifestFileName {
+		return name
+	}
+	return hash[:8] + "-" + name
+}
+
+// Flush 用于把清单写入图片目录中的清单文件。
+// 清单会先被写入临时文件，然后再替换已有的清单文件。
+func (store *imageStore) Flush() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if !store.dirty {
+		return nil
+	}
+	entries := make([]*manifestEntry, 0, len(store.entries))
+	for _, entry := range store.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(store.dirPath, manifestFileName)
+	tempPath := path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return err
+	}
+	store.dirty = false
+	logger.Infof("Wrote %d manifest entries to %s.", len(entries), path)
+	return nil
+}
+
+// hasSource 用于判断来源列表中是否已有给定的来源。
+func hasSource(sources []imageSource, source imageSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+// copyEntry 用于复制清单条目，以便在锁之外使用。
+func copyEntry(entry *manifestEntry) manifestEntry {
+	result := *entry
+	result.Sources = append([]imageSource(nil), entry.Sources...)
+	return result
+}
+
+// formatSize 用于生成图片尺寸的描述。
+func formatSize(width, height int) string {
+	if width == 0 && height == 0 {
+		return "unknown"
+	}
+	return fmt.Sprintf("%dx%d", width, height)
+}
@@ -0,0 +1,217 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// genPNG 用于生成给定尺寸和颜色的PNG图片。
+func genPNG(width, height int, gray uint8, t *testing.T) []byte {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+	img.Set(0, 0, color.Gray{Y: gray + 1})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("An error occurs when encoding PNG: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageStoreDedup(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newImageStore(dir, 10, 0)
+	if err != nil {
+		t.Fatalf("An error occurs when creating image store: %s", err)
+	}
+	if store.maxSize != DEFAULT_MAX_IMAGE_SIZE {
+		t.Fatalf("Inconsistent max size: expected: %d, actual: %d",
+			DEFAULT_MAX_IMAGE_SIZE, store.maxSize)
+	}
+	content := genPNG(20, 20, 100, t)
+	source1 := imageSource{URL: "http://example.com/a.png", PageURL: "http://example.com/"}
+	source2 := imageSource{URL: "http://example.com/b.png", PageURL: "http://example.com/"}
+	saved, err := store.save(content, "a.png", "png", source1)
+	if err != nil {
+		t.Fatalf("An error occurs when saving image: %s", err)
+	}
+	if saved.duplicate || saved.skipped {
+		t.Fatalf("Inconsistent result: %#v", saved)
+	}
+	if saved.entry.File != "a.png" || saved.entry.Format != "png" ||
+		saved.entry.Width != 20 || saved.entry.Height != 20 ||
+		saved.entry.Size != int64(len(content)) {
+		t.Fatalf("Inconsistent entry: %#v", saved.entry)
+	}
+	written, err := ioutil.ReadFile(filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatalf("An error occurs when reading saved image: %s", err)
+	}
+	if !bytes.Equal(written, content) {
+		t.Fatal("Inconsistent saved image content!")
+	}
+	// 内容相同的图片只会记录其来源。
+	for _, source := range []imageSource{source2, source2} {
+		saved, err = store.save(content, "b.png", "png", source)
+		if err != nil {
+			t.Fatalf("An error occurs when saving image: %s", err)
+		}
+		if !saved.duplicate || saved.entry.File != "a.png" {
+			t.Fatalf("Inconsistent result: %#v", saved)
+		}
+	}
+	expectedSources := []imageSource{source1, source2}
+	if !reflect.DeepEqual(saved.entry.Sources, expectedSources) {
+		t.Fatalf("Inconsistent sources: expected: %v, actual: %v",
+			expectedSources, saved.entry.Sources)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.png")); !os.IsNotExist(err) {
+		t.Fatal("The duplicate image has been saved!")
+	}
+	// 内容不同但文件名相同的图片会使用带有摘要前缀的文件名。
+	another := genPNG(20, 20, 200, t)
+	saved, err = store.save(another, "a.png", "png", source1)
+	if err != nil {
+		t.Fatalf("An error occurs when saving image: %s", err)
+	}
+	expectedFile := saved.entry.Hash[:8] + "-a.png"
+	if saved.duplicate || saved.entry.File != expectedFile {
+		t.Fatalf("Inconsistent file name: expected: %s, actual: %s",
+			expectedFile, saved.entry.File)
+	}
+	// 尺寸过小的图片会被跳过。
+	saved, err = store.save(genPNG(5, 20, 100, t), "small.png", "png", source1)
+	if err != nil {
+		t.Fatalf("An error occurs when saving image: %s", err)
+	}
+	if !saved.skipped || saved.entry.Width != 5 {
+		t.Fatalf("Inconsistent result: %#v", saved)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "small.png")); !os.IsNotExist(err) {
+		t.Fatal("The small image has been saved!")
+	}
+}
+
+func TestImageStoreConcurrentSave(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := newImageStore(dir, 0, 0)
+	content := genPNG(20, 20, 100, t)
+	number := 10
+	results := make([]imageResult, number)
+	var wg sync.WaitGroup
+	wg.Add(number)
+	for i := 0; i < number; i++ {
+		go func(i int) {
+			defer wg.Done()
+			source := imageSource{URL: fmt.Sprintf("http://example.com/%d.png", i)}
+			result, err := store.save(content, fmt.Sprintf("%d.png", i), "png", source)
+			if err != nil {
+				t.Errorf("An error occurs when saving image: %s", err)
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+	var saved int
+	for _, result := range results {
+		if !result.duplicate {
+			saved++
+		}
+	}
+	if saved != 1 {
+		t.Fatalf("Inconsistent saved number: expected: %d, actual: %d", 1, saved)
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	if len(infos) != 1 {
+		t.Fatalf("Inconsistent file number: expected: %d, actual: %d", 1, len(infos))
+	}
+	for _, entry := range store.entries {
+		if len(entry.Sources) != number {
+			t.Fatalf("Inconsistent source number: expected: %d, actual: %d",
+				number, len(entry.Sources))
+		}
+	}
+}
+
+func TestImageStoreSaveFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "missing")
+	store, _ := newImageStore(dir, 0, 0)
+	content := genPNG(20, 20, 100, t)
+	source := imageSource{URL: "http://example.com/a.png"}
+	if _, err := store.save(content, "a.png", "png", source); err == nil {
+		t.Fatal("No error when saving image into missing dir!")
+	}
+	// 写入失败的图片不会被记录，之后仍可再次保存，并且使用原来的文件名。
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("An error occurs when creating dir: %s", err)
+	}
+	saved, err := store.save(content, "a.png", "png", source)
+	if err != nil {
+		t.Fatalf("An error occurs when saving image: %s", err)
+	}
+	if saved.duplicate || saved.entry.File != "a.png" {
+		t.Fatalf("Inconsistent result: %#v", saved)
+	}
+}
+
+func TestImageStoreManifest(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := newImageStore(dir, 0, 0)
+	// 没有变化时不会写出清单。
+	if err := store.Flush(); err != nil {
+		t.Fatalf("An error occurs when flushing manifest: %s", err)
+	}
+	manifestPath := filepath.Join(dir, manifestFileName)
+	if _, err := os.Stat(manifestPath); !os.IsNotExist(err) {
+		t.Fatal("The manifest has been written without any change!")
+	}
+	content := genPNG(20, 20, 100, t)
+	source1 := imageSource{URL: "http://example.com/a.png"}
+	source2 := imageSource{URL: "http://example.com/b.png"}
+	store.save(content, "a.png", "png", source1)
+	store.save(content, "b.png", "png", source2)
+	store.save(genPNG(30, 10, 50, t), "c.png", "png", source1)
+	if err := store.Flush(); err != nil {
+		t.Fatalf("An error occurs when flushing manifest: %s", err)
+	}
+	// 重新载入的清单与写出的清单一致，并且会被用于跨越多次爬取的去重。
+	loaded, err := newImageStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("An error occurs when loading manifest: %s", err)
+	}
+	if !reflect.DeepEqual(loaded.entries, store.entries) {
+		t.Fatalf("Inconsistent manifest entries: expected: %v, actual: %v",
+			store.entries, loaded.entries)
+	}
+	if !reflect.DeepEqual(loaded.files, store.files) {
+		t.Fatalf("Inconsistent file names: expected: %v, actual: %v",
+			store.files, loaded.files)
+	}
+	saved, err := loaded.save(content, "d.png", "png", source1)
+	if err != nil {
+		t.Fatalf("An error occurs when saving image: %s", err)
+	}
+	if !saved.duplicate || saved.entry.File != "a.png" {
+		t.Fatalf("Inconsistent result: %#v", saved)
+	}
+	if _, err := os.Stat(manifestPath + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("The temporary manifest file still exists!")
+	}
+	// 无效的清单会导致错误。
+	if err := ioutil.WriteFile(manifestPath, []byte("{\n"), 0644); err != nil {
+		t.Fatalf("An error occurs when writing manifest: %s", err)
+	}
+	if _, err := newImageStore(dir, 0, 0); err == nil {
+		t.Fatal("No error when loading invalid manifest!")
+	}
+}
@@ -1,6 +1,9 @@
 package internal
 
 import (
+	"io/ioutil"
+	"net/http"
+
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/local/analyzer"
 	"gopcp.v2/chapter6/webcrawler/module/local/downloader"
@@ -11,19 +14,29 @@ import (
 var snGen = module.NewSNGenertor(1, 0)
 
 // GetDownloaders 用于获取下载器列表。
-func GetDownloaders(number uint8) ([]module.Downloader, error) {
+// 参数jar代表各下载器共用的cookie jar，可以为nil。
+// 参数opts代表下载器的可选项，可用于设置代理池和User-Agent列表。
+// 参数scoreCalculator代表下载器的评分计算器。若它为nil，则使用简易的评分计算函数。
+func GetDownloaders(
+	number uint8,
+	jar http.CookieJar,
+	opts downloader.Options,
+	scoreCalculator module.CalculateScore) ([]module.Downloader, error) {
 	downloaders := []module.Downloader{}
 	if number == 0 {
 		return downloaders, nil
 	}
+	if scoreCalculator == nil {
+		scoreCalculator = module.CalculateScoreSimple
+	}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(
 			module.TYPE_DOWNLOADER, snGen.Get(), nil)
 		if err != nil {
 			return downloaders, err
 		}
-		d, err := downloader.New(
-			mid, genHTTPClient(), module.CalculateScoreSimple)
+		d, err := downloader.NewWithOptions(
+			mid, genHTTPClient(jar), scoreCalculator, opts)
 		if err != nil {
 			return downloaders, err
 		}
@@ -33,7 +46,8 @@ func GetDownloaders(number uint8) ([]module.Downloader, error) {
 }
 
 // GetAnalyzers 用于获取分析器列表。
-func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
+// 参数ruleSet代表分析器使用的提取规则集。若它为nil，则使用内置的响应解析函数。
+func GetAnalyzers(number uint8, ruleSet *analyzer.RuleSet) ([]module.Analyzer, error) {
 	analyzers := []module.Analyzer{}
 	if number == 0 {
 		return analyzers, nil
@@ -44,8 +58,14 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 		if err != nil {
 			return analyzers, err
 		}
-		a, err := analyzer.New(
-			mid, genResponseParsers(), module.CalculateScoreSimple)
+		var a module.Analyzer
+		if ruleSet != nil {
+			a, err = analyzer.NewWithRules(
+				mid, *ruleSet, module.CalculateScoreSimple, analyzer.Options{})
+		} else {
+			a, err = analyzer.New(
+				mid, genResponseParsers(), module.CalculateScoreSimple)
+		}
 		if err != nil {
 			return analyzers, err
 		}
@@ -54,20 +74,42 @@ func GetAnalyzers(number uint8) ([]module.Analyzer, error) {
 	return analyzers, nil
 }
 
+// LoadRuleSet 用于从JSON文件中加载分析器的提取规则集。
+func LoadRuleSet(path string) (*analyzer.RuleSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return analyzer.LoadRuleSet(data, nil)
+}
+
 // GetPipelines 用于获取条目处理管道列表。
-func GetPipelines(number uint8, dirPath string) ([]module.Pipeline, error) {
+// 参数dirPath代表保存图片的目录的路径，其中的清单文件会在调度器停止时被写出。
+// 参数minSize代表图片的最小宽度和高度，单位：像素。值为0时不跳过任何图片。
+// 参数maxSize代表图片的最大字节数。值不大于0时使用DEFAULT_MAX_IMAGE_SIZE。
+func GetPipelines(number uint8, dirPath string, minSize int, maxSize int64) ([]module.Pipeline, error) {
 	pipelines := []module.Pipeline{}
 	if number == 0 {
 		return pipelines, nil
 	}
+	absDirPath, err := checkDirPath(dirPath)
+	if err != nil {
+		return pipelines, err
+	}
+	// 所有条目处理管道共用同一个图片存储，以便对图片进行全局去重。
+	store, err := newImageStore(absDirPath, minSize, maxSize)
+	if err != nil {
+		return pipelines, err
+	}
+	opts := pipeline.Options{Flushers: []module.Flusher{store}}
 	for i := uint8(0); i < number; i++ {
 		mid, err := module.GenMID(
 			module.TYPE_PIPELINE, snGen.Get(), nil)
 		if err != nil {
 			return pipelines, err
 		}
-		a, err := pipeline.New(
-			mid, genItemProcessors(dirPath), module.CalculateScoreSimple)
+		a, err := pipeline.NewWithOptions(
+			mid, genItemProcessors(store), module.CalculateScoreSimple, opts)
 		if err != nil {
 			return pipelines, err
 		}
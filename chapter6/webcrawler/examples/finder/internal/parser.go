@@ -103,6 +103,8 @@ func genResponseParsers() []module.ParseResponse {
 			if err != nil {
 				errs = append(errs, err)
 			} else {
+				// 记录引用图片的页面，以便写入清单。
+				httpReq.Header.Set("Referer", reqURL.String())
 				req := module.NewRequest(httpReq, respDepth)
 				dataList = append(dataList, req)
 			}
@@ -160,6 +162,8 @@ func genResponseParsers() []module.ParseResponse {
 		item["reader"] = httpRespBody
 		item["name"] = path.Base(reqURL.Path)
 		item["ext"] = pictureFormat
+		item["url"] = reqURL.String()
+		item["page_url"] = httpReq.Header.Get("Referer")
 		dataList = append(dataList, module.Item(item))
 		return dataList, nil
 	}
@@ -4,22 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
 	"path/filepath"
 	"gopcp.v2/chapter6/webcrawler/module"
+	sched "gopcp.v2/chapter6/webcrawler/scheduler"
 )
 
 // genItemProcessors 用于生成条目处理器。
-func genItemProcessors(dirPath string) []module.ProcessItem {
+// 图片会按照内容去重后保存到图片存储中，尺寸过小的图片会被跳过。
+func genItemProcessors(store *imageStore) []module.ProcessItem {
 	savePicture := func(item module.Item) (result module.Item, err error) {
 		if item == nil {
 			return nil, errors.New("invalid item!")
 		}
-		// 检查和准备数据。
-		var absDirPath string
-		if absDirPath, err = checkDirPath(dirPath); err != nil {
-			return
+		// 变化条目会被原样交给下一个条目处理器。
+		if _, ok := sched.ChangeKindOf(item); ok {
+			return item, nil
 		}
+		// 检查和准备数据。
 		v := item["reader"]
 		reader, ok := v.(io.Reader)
 		if !ok {
@@ -34,34 +36,55 @@ func genItemProcessors(dirPath string) []module.ProcessItem {
 		if !ok {
 			return nil, fmt.Errorf("incorrect name type: %T", v)
 		}
-		// 创建图片文件。
-		fileName := name
-		filePath := filepath.Join(absDirPath, fileName)
-		file, err := os.Create(filePath)
+		ext, _ := item["ext"].(string)
+		var source imageSource
+		source.URL, _ = item["url"].(string)
+		source.PageURL, _ = item["page_url"].(string)
+		// 读取并保存图片。
+		content, err := readImage(reader, store.maxSize)
 		if err != nil {
-			return nil, fmt.Errorf("couldn't create file: %s (path: %s)",
-				err, filePath)
+			return nil, err
 		}
-		defer file.Close()
-		// 写图片文件。
-		_, err = io.Copy(file, reader)
+		saved, err := store.save(content, name, ext, source)
 		if err != nil {
 			return nil, err
 		}
 		// 生成新的条目。
 		result = make(map[string]interface{})
 		for k, v := range item {
-			result[k] = v
+			if k != "reader" {
+				result[k] = v
+			}
 		}
-		result["file_path"] = filePath
-		fileInfo, err := file.Stat()
-		if err != nil {
-			return nil, err
+		entry := saved.entry
+		result["format"] = entry.Format
+		result["width"] = entry.Width
+		result["height"] = entry.Height
+		if entry.EXIF != nil {
+			result["exif"] = entry.EXIF
+		}
+		if saved.skipped {
+			result["skipped"] = true
+			return result, nil
 		}
-		result["file_size"] = fileInfo.Size()
+		result["duplicate"] = saved.duplicate
+		result["file_path"] = filepath.Join(store.dirPath, entry.File)
+		result["file_size"] = entry.Size
 		return result, nil
 	}
 	recordPicture := func(item module.Item) (result module.Item, err error) {
+		if kind, ok := sched.ChangeKindOf(item); ok {
+			logger.Infof("Page %s: %s (status code: %v).",
+				kind, item[sched.CHANGE_ITEM_KEY_URL], item[sched.CHANGE_ITEM_KEY_STATUS])
+			return nil, nil
+		}
+		width, _ := item["width"].(int)
+		height, _ := item["height"].(int)
+		if skipped, _ := item["skipped"].(bool); skipped {
+			logger.Infof("Skipped small picture: %s (dimensions: %s).",
+				item["url"], formatSize(width, height))
+			return nil, nil
+		}
 		v := item["file_path"]
 		path, ok := v.(string)
 		if !ok {
@@ -72,8 +95,26 @@ func genItemProcessors(dirPath string) []module.ProcessItem {
 		if !ok {
 			return nil, fmt.Errorf("incorrect file name type: %T", v)
 		}
-		logger.Infof("Saved file: %s, size: %d byte(s).", path, size)
+		if duplicate, _ := item["duplicate"].(bool); duplicate {
+			logger.Infof("Duplicate picture: %s, same as file: %s.", item["url"], path)
+			return nil, nil
+		}
+		logger.Infof("Saved file: %s, size: %d byte(s), format: %s, dimensions: %s.",
+			path, size, item["format"], formatSize(width, height))
 		return nil, nil
 	}
 	return []module.ProcessItem{savePicture, recordPicture}
 }
+
+// readImage 用于读取图片内容。
+// 最多只会读取maxSize+1个字节，图片超出maxSize个字节时会返回错误。
+func readImage(reader io.Reader, maxSize int64) ([]byte, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("too large picture: more than %d bytes", maxSize)
+	}
+	return content, nil
+}
@@ -0,0 +1,28 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReadImage(t *testing.T) {
+	content, err := readImage(strings.NewReader("12345"), 5)
+	if err != nil {
+		t.Fatalf("An error occurs when reading image: %s", err)
+	}
+	if string(content) != "12345" {
+		t.Fatalf("Inconsistent image content: expected: %q, actual: %q", "12345", content)
+	}
+	// 超出最大字节数的图片只会被读取maxSize+1个字节。
+	reader := strings.NewReader("123456789")
+	if _, err := readImage(reader, 5); err == nil {
+		t.Fatal("No error when reading too large image!")
+	}
+	if reader.Len() != 3 {
+		t.Fatalf("Inconsistent unread length: expected: %d, actual: %d", 3, reader.Len())
+	}
+	if _, err := readImage(iotest.TimeoutReader(strings.NewReader("12345")), 5); err == nil {
+		t.Fatal("No error when reading image with failed reader!")
+	}
+}
@@ -0,0 +1,6 @@
+package frontier
+
+import "errors"
+
+// ErrClosedFrontier 是表示爬取边界已关闭的错误的变量。
+var ErrClosedFrontier = errors.New("closed frontier")
@@ -0,0 +1,413 @@
+package frontier
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter5/cmap"
+	"gopcp.v2/chapter6/webcrawler/errors"
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+	"gopcp.v2/helper/log"
+)
+
+// logger 代表日志记录器。
+var logger = log.DLogger()
+
+// 爬取边界的默认选项值。
+const (
+	// DEFAULT_LEASE_TTL 代表默认的租约有效期。
+	DEFAULT_LEASE_TTL = time.Minute
+	// DEFAULT_HOST_BUFFER_CAP 代表默认的主机请求缓冲器的容量。
+	DEFAULT_HOST_BUFFER_CAP = 50
+	// DEFAULT_HOST_MAX_BUFFER_NUMBER 代表默认的主机请求缓冲器的最大数量。
+	DEFAULT_HOST_MAX_BUFFER_NUMBER = 1000
+)
+
+// Options 代表爬取边界的选项。
+type Options struct {
+	// LeaseTTL 代表租约的有效期。
+	// 未在有效期内完成或续期的租约会过期，其请求会被重新放回待爬取的队列。
+	// 在此期间未再租借请求的工作者也会被视为已离开。值为0时使用DEFAULT_LEASE_TTL。
+	LeaseTTL time.Duration
+	// HostBufferCap 代表每个主机的请求缓冲器的容量。值为0时使用DEFAULT_HOST_BUFFER_CAP。
+	HostBufferCap uint32
+	// HostMaxBufferNumber 代表每个主机的请求缓冲器的最大数量。
+	// 值为0时使用DEFAULT_HOST_MAX_BUFFER_NUMBER。
+	HostMaxBufferNumber uint32
+}
+
+// Lease 代表请求的租约。
+type Lease struct {
+	// ID 代表租约的ID。
+	ID uint64
+	// Req 代表被租借的请求。
+	Req *module.Request
+	// Expiry 代表租约的过期时间。
+	Expiry time.Time
+}
+
+// LeaseResult 代表租借请求的结果。
+type LeaseResult struct {
+	// Leases 代表新的租约的列表。
+	Leases []Lease
+	// Finished 代表整个爬取是否已经结束。
+	// 当没有待爬取的请求和未完成的租约，且所有工作者都已空闲时，爬取即告结束。
+	Finished bool
+}
+
+// Stats 代表爬取边界的统计信息。
+type Stats struct {
+	// Seen 代表已见过的URL的数量。
+	Seen uint64 `json:"seen"`
+	// Pending 代表待爬取的请求的数量。
+	Pending uint64 `json:"pending"`
+	// Leased 代表未完成的租约的数量。
+	Leased uint64 `json:"leased"`
+	// Completed 代表已完成的租约的数量。
+	Completed uint64 `json:"completed"`
+	// Expired 代表已过期的租约的数量。
+	Expired uint64 `json:"expired"`
+	// Rejected 代表因主机的请求缓冲池已满而被拒绝的请求的数量。
+	Rejected uint64 `json:"rejected"`
+	// Hosts 代表已知的主机的数量。
+	Hosts int `json:"hosts"`
+	// Workers 代表活跃的工作者的数量。
+	Workers int `json:"workers"`
+}
+
+// Frontier 代表共享爬取边界的接口类型。
+// 它负责集中地对URL进行去重，并以租约的形式把请求分发给多个工作者。
+// 同一个主机在同一时刻只会被一个工作者爬取。
+// 该接口的实现类型必须是并发安全的！
+type Frontier interface {
+	// Add 用于提交请求。URL已被见过的请求会被忽略。
+	// 结果值代表被接受的请求的数量。
+	Add(reqs []*module.Request) (int, error)
+	// Lease 用于为给定的工作者租借最多max个请求。
+	// 参数busy代表该工作者是否还有未处理完毕的本地工作，它会影响爬取是否结束的判断。
+	Lease(worker string, max uint32, busy bool) (LeaseResult, error)
+	// Renew 用于为给定工作者的租约续期。结果值代表被续期的租约的数量。
+	Renew(worker string, ids []uint64) (int, error)
+	// Complete 用于完成给定工作者的租约。结果值代表被完成的租约的数量。
+	Complete(worker string, ids []uint64) (int, error)
+	// Stats 用于获取统计信息。
+	Stats() (Stats, error)
+	// Close 用于关闭爬取边界。
+	Close() error
+}
+
+// New 用于创建一个爬取边界。
+func New(opts Options) (Frontier, error) {
+	if opts.LeaseTTL < 0 {
+		return nil, errors.NewIllegalParameterError(
+			fmt.Sprintf("negative lease TTL: %s", opts.LeaseTTL))
+	}
+	if opts.LeaseTTL == 0 {
+		opts.LeaseTTL = DEFAULT_LEASE_TTL
+	}
+	if opts.HostBufferCap == 0 {
+		opts.HostBufferCap = DEFAULT_HOST_BUFFER_CAP
+	}
+	if opts.HostMaxBufferNumber == 0 {
+		opts.HostMaxBufferNumber = DEFAULT_HOST_MAX_BUFFER_NUMBER
+	}
+	seen, err := cmap.NewConcurrentMap(16, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &myFrontier{
+		opts:    opts,
+		seen:    seen,
+		hosts:   make(map[string]*hostQueue),
+		leases:  make(map[uint64]*leaseRecord),
+		workers: make(map[string]*workerState),
+		now:     time.Now,
+	}, nil
+}
+
+// hostQueue 代表单个主机的待爬取队列。
+type hostQueue struct {
+	// pool 代表该主机的请求缓冲池。
+	pool buffer.Pool
+	// owner 代表当前爬取该主机的工作者。若为空，则任何工作者都可以租借该主机的请求。
+	owner string
+	// leased 代表该主机的未完成的租约的数量。
+	leased int
+}
+
+// leaseRecord 代表租约的记录。
+type leaseRecord struct {
+	// lease 代表租约。
+	lease Lease
+	// worker 代表持有租约的工作者。
+	worker string
+	// host 代表请求的主机。
+	host string
+}
+
+// workerState 代表工作者的状态。
+type workerState struct {
+	// busy 代表工作者是否还有未处理完毕的本地工作。
+	busy bool
+	// lastSeen 代表工作者最近一次租借请求或续期的时间。
+	lastSeen time.Time
+}
+
+// myFrontier 代表爬取边界的实现类型。
+type myFrontier struct {
+	// opts 代表选项。
+	opts Options
+	// seen 代表已见过的URL的字典。
+	seen cmap.ConcurrentMap
+	// lock 代表用于保护以下字段的互斥锁。
+	lock sync.Mutex
+	// hosts 代表主机与其待爬取队列的映射。
+	hosts map[string]*hostQueue
+	// hostOrder 代表主机的轮转顺序。
+	hostOrder []string
+	// cursor 代表下一次租借时最先被考虑的主机在hostOrder中的索引。
+	cursor int
+	// pending 代表待爬取的请求的数量。
+	pending uint64
+	// leases 代表租约ID与租约记录的映射。
+	leases map[uint64]*leaseRecord
+	// lastID 代表最后一个租约的ID。
+	lastID uint64
+	// workers 代表工作者与其状态的映射。
+	workers map[string]*workerState
+	// completed 代表已完成的租约的数量。
+	completed uint64
+	// expired 代表已过期的租约的数量。
+	expired uint64
+	// rejected 代表被拒绝的请求的数量。
+	rejected uint64
+	// closed 代表是否已关闭。
+	closed bool
+	// now 用于获取当前时间。
+	now func() time.Time
+}
+
+// hostOf 用于获取请求的主机，它会被用作划分队列的键。
+func hostOf(req *module.Request) string {
+	return strings.ToLower(req.HTTPReq().URL.Host)
+}
+
+func (frontier *myFrontier) Add(reqs []*module.Request) (int, error) {
+	var added int
+	for _, req := range reqs {
+		if req == nil || !req.Valid() {
+			return added, errors.NewIllegalParameterError("invalid request")
+		}
+		key := req.HTTPReq().URL.String()
+		if ok, _ := frontier.seen.Put(key, struct{}{}); !ok {
+			continue
+		}
+		ok, err := frontier.enqueue(req)
+		if err != nil {
+			frontier.seen.Delete(key)
+			return added, err
+		}
+		if !ok {
+			frontier.seen.Delete(key)
+			logger.Warnf("Reject the request! The buffer pool of its host is full. (URL: %s)", key)
+			continue
+		}
+		added++
+	}
+	return added, nil
+}
+
+// enqueue 用于把请求放入其主机的待爬取队列。
+// 若队列已满，则第一个结果值为false。
+func (frontier *myFrontier) enqueue(req *module.Request) (bool, error) {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return false, ErrClosedFrontier
+	}
+	return frontier.putLocked(req), nil
+}
+
+// putLocked 用于把请求放入其主机的待爬取队列。调用方需持有锁。
+func (frontier *myFrontier) putLocked(req *module.Request) bool {
+	host := hostOf(req)
+	queue, ok := frontier.hosts[host]
+	if !ok {
+		pool, _ := buffer.NewPool(frontier.opts.HostBufferCap, frontier.opts.HostMaxBufferNumber)
+		queue = &hostQueue{pool: pool}
+		frontier.hosts[host] = queue
+		frontier.hostOrder = append(frontier.hostOrder, host)
+	}
+	if ok, _ := queue.pool.TryPut(req); !ok {
+		frontier.rejected++
+		return false
+	}
+	frontier.pending++
+	return true
+}
+
+func (frontier *myFrontier) Lease(worker string, max uint32, busy bool) (LeaseResult, error) {
+	var result LeaseResult
+	if worker == "" {
+		return result, errors.NewIllegalParameterError("empty worker")
+	}
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return result, ErrClosedFrontier
+	}
+	now := frontier.now()
+	frontier.expireLocked(now)
+	frontier.workers[worker] = &workerState{busy: busy, lastSeen: now}
+	start := frontier.cursor
+	for i := 0; i < len(frontier.hostOrder) && uint32(len(result.Leases)) < max; i++ {
+		index := (start + i) % len(frontier.hostOrder)
+		host := frontier.hostOrder[index]
+		queue := frontier.hosts[host]
+		if queue.owner != "" && queue.owner != worker {
+			continue
+		}
+		for uint32(len(result.Leases)) < max {
+			datum, _ := queue.pool.TryGet()
+			if datum == nil {
+				break
+			}
+			frontier.pending--
+			frontier.lastID++
+			lease := Lease{
+				ID:     frontier.lastID,
+				Req:    datum.(*module.Request),
+				Expiry: now.Add(frontier.opts.LeaseTTL),
+			}
+			frontier.leases[lease.ID] = &leaseRecord{lease: lease, worker: worker, host: host}
+			queue.owner = worker
+			queue.leased++
+			result.Leases = append(result.Leases, lease)
+		}
+		// 下一次从下一个主机开始，以免某个主机的请求总是被优先租借。
+		frontier.cursor = (index + 1) % len(frontier.hostOrder)
+	}
+	result.Finished = frontier.finishedLocked()
+	return result, nil
+}
+
+// finishedLocked 用于判断整个爬取是否已经结束。调用方需持有锁。
+func (frontier *myFrontier) finishedLocked() bool {
+	if frontier.seen.Len() == 0 || frontier.pending > 0 || len(frontier.leases) > 0 {
+		return false
+	}
+	for _, state := range frontier.workers {
+		if state.busy {
+			return false
+		}
+	}
+	return true
+}
+
+// expireLocked 用于处理已过期的租约和已离开的工作者。调用方需持有锁。
+// 过期租约的请求会被重新放回待爬取的队列。
+func (frontier *myFrontier) expireLocked(now time.Time) {
+	for id, record := range frontier.leases {
+		if now.Before(record.lease.Expiry) {
+			continue
+		}
+		frontier.releaseLocked(id, record)
+		frontier.expired++
+		req := record.lease.Req
+		logger.Warnf("The lease %d of worker %s has expired. (URL: %s)",
+			id, record.worker, req.HTTPReq().URL)
+		if !frontier.putLocked(req) {
+			frontier.seen.Delete(req.HTTPReq().URL.String())
+		}
+	}
+	for worker, state := range frontier.workers {
+		if now.Sub(state.lastSeen) >= frontier.opts.LeaseTTL {
+			logger.Warnf("The worker %s has left.", worker)
+			delete(frontier.workers, worker)
+		}
+	}
+}
+
+// releaseLocked 用于删除租约记录，并在主机没有未完成的租约时解除其归属。
+// 调用方需持有锁。
+func (frontier *myFrontier) releaseLocked(id uint64, record *leaseRecord) {
+	delete(frontier.leases, id)
+	queue := frontier.hosts[record.host]
+	queue.leased--
+	if queue.leased == 0 {
+		queue.owner = ""
+	}
+}
+
+func (frontier *myFrontier) Renew(worker string, ids []uint64) (int, error) {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return 0, ErrClosedFrontier
+	}
+	now := frontier.now()
+	frontier.expireLocked(now)
+	if state, ok := frontier.workers[worker]; ok {
+		state.lastSeen = now
+	}
+	var count int
+	for _, id := range ids {
+		record, ok := frontier.leases[id]
+		if !ok || record.worker != worker {
+			continue
+		}
+		record.lease.Expiry = now.Add(frontier.opts.LeaseTTL)
+		count++
+	}
+	return count, nil
+}
+
+func (frontier *myFrontier) Complete(worker string, ids []uint64) (int, error) {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return 0, ErrClosedFrontier
+	}
+	var count int
+	for _, id := range ids {
+		record, ok := frontier.leases[id]
+		if !ok || record.worker != worker {
+			continue
+		}
+		frontier.releaseLocked(id, record)
+		frontier.completed++
+		count++
+	}
+	return count, nil
+}
+
+func (frontier *myFrontier) Stats() (Stats, error) {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	return Stats{
+		Seen:      frontier.seen.Len(),
+		Pending:   frontier.pending,
+		Leased:    uint64(len(frontier.leases)),
+		Completed: frontier.completed,
+		Expired:   frontier.expired,
+		Rejected:  frontier.rejected,
+		Hosts:     len(frontier.hosts),
+		Workers:   len(frontier.workers),
+	}, nil
+}
+
+func (frontier *myFrontier) Close() error {
+	frontier.lock.Lock()
+	defer frontier.lock.Unlock()
+	if frontier.closed {
+		return nil
+	}
+	frontier.closed = true
+	for _, queue := range frontier.hosts {
+		queue.pool.Close()
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package frontier
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// genRequests 用于根据给定的URL生成请求。
+func genRequests(urls ...string) []*module.Request {
+	reqs := make([]*module.Request, 0, len(urls))
+	for _, url := range urls {
+		httpReq, _ := http.NewRequest("GET", url, nil)
+		reqs = append(reqs, module.NewRequest(httpReq, 0))
+	}
+	return reqs
+}
+
+// leaseIDs 用于获取租约的ID列表。
+func leaseIDs(leases []Lease) []uint64 {
+	ids := make([]uint64, 0, len(leases))
+	for _, lease := range leases {
+		ids = append(ids, lease.ID)
+	}
+	return ids
+}
+
+// leaseHosts 用于获取租约中的请求的主机的集合。
+func leaseHosts(leases []Lease) map[string]bool {
+	hosts := make(map[string]bool)
+	for _, lease := range leases {
+		hosts[lease.Req.HTTPReq().URL.Host] = true
+	}
+	return hosts
+}
+
+// newTestFrontier 用于创建使用给定时钟的爬取边界。
+func newTestFrontier(ttl time.Duration, now *time.Time, t *testing.T) *myFrontier {
+	f, err := New(Options{LeaseTTL: ttl})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a frontier: %s", err)
+	}
+	frontier := f.(*myFrontier)
+	frontier.now = func() time.Time { return *now }
+	return frontier
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Options{LeaseTTL: -time.Second}); err == nil {
+		t.Fatal("No error when creating a frontier with negative lease TTL!")
+	}
+	f, err := New(Options{})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a frontier: %s", err)
+	}
+	opts := f.(*myFrontier).opts
+	if opts.LeaseTTL != DEFAULT_LEASE_TTL || opts.HostBufferCap != DEFAULT_HOST_BUFFER_CAP ||
+		opts.HostMaxBufferNumber != DEFAULT_HOST_MAX_BUFFER_NUMBER {
+		t.Fatalf("Inconsistent default options: %#v", opts)
+	}
+}
+
+func TestFrontierAdd(t *testing.T) {
+	now := time.Now()
+	frontier := newTestFrontier(time.Minute, &now, t)
+	added, err := frontier.Add(genRequests(
+		"http://a.com/1", "http://a.com/2", "http://a.com/1", "http://b.com/1"))
+	if err != nil {
+		t.Fatalf("An error occurs when adding requests: %s", err)
+	}
+	if added != 3 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d", 3, added)
+	}
+	added, _ = frontier.Add(genRequests("http://b.com/1", "http://b.com/2"))
+	if added != 1 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d", 1, added)
+	}
+	if _, err := frontier.Add([]*module.Request{nil}); err == nil {
+		t.Fatal("No error when adding nil request!")
+	}
+	stats, _ := frontier.Stats()
+	expectedStats := Stats{Seen: 4, Pending: 4, Hosts: 2}
+	if stats != expectedStats {
+		t.Fatalf("Inconsistent stats: expected: %#v, actual: %#v", expectedStats, stats)
+	}
+}
+
+func TestFrontierLease(t *testing.T) {
+	now := time.Now()
+	frontier := newTestFrontier(time.Minute, &now, t)
+	frontier.Add(genRequests("http://a.com/1", "http://a.com/2", "http://b.com/1"))
+	if _, err := frontier.Lease("", 1, false); err == nil {
+		t.Fatal("No error when leasing requests for empty worker!")
+	}
+	result, err := frontier.Lease("w1", 1, false)
+	if err != nil {
+		t.Fatalf("An error occurs when leasing requests: %s", err)
+	}
+	if len(result.Leases) != 1 || !leaseHosts(result.Leases)["a.com"] {
+		t.Fatalf("Inconsistent leases: %#v", result.Leases)
+	}
+	// 主机a.com已归属于w1，因此w2只能租借主机b.com的请求。
+	result2, _ := frontier.Lease("w2", 10, false)
+	if len(result2.Leases) != 1 || !leaseHosts(result2.Leases)["b.com"] {
+		t.Fatalf("Inconsistent leases of another worker: %#v", result2.Leases)
+	}
+	result3, _ := frontier.Lease("w2", 10, false)
+	if len(result3.Leases) != 0 {
+		t.Fatalf("Inconsistent lease number: expected: %d, actual: %d", 0, len(result3.Leases))
+	}
+	// 归属于w1的主机仍然可以被w1租借。
+	result, _ = frontier.Lease("w1", 10, false)
+	if len(result.Leases) != 1 || !leaseHosts(result.Leases)["a.com"] {
+		t.Fatalf("Inconsistent leases of owner: %#v", result.Leases)
+	}
+	if result.Finished {
+		t.Fatal("The crawl is finished before the leases are completed!")
+	}
+	// 只有租约的持有者才能完成租约。
+	if count, _ := frontier.Complete("w2", leaseIDs(result.Leases)); count != 0 {
+		t.Fatalf("Inconsistent completed number: expected: %d, actual: %d", 0, count)
+	}
+	frontier.Complete("w1", []uint64{1})
+	frontier.Complete("w1", leaseIDs(result.Leases))
+	frontier.Complete("w2", leaseIDs(result2.Leases))
+	stats, _ := frontier.Stats()
+	if stats.Completed != 3 || stats.Leased != 0 || stats.Workers != 2 {
+		t.Fatalf("Inconsistent stats: %#v", stats)
+	}
+	if frontier.hosts["a.com"].owner != "" {
+		t.Fatalf("The host is still owned by %s!", frontier.hosts["a.com"].owner)
+	}
+	// 只要还有工作者处于忙碌状态，爬取就不会结束。
+	if result, _ = frontier.Lease("w1", 10, true); result.Finished {
+		t.Fatal("The crawl is finished while a worker is busy!")
+	}
+	frontier.Lease("w1", 10, false)
+	if result, _ = frontier.Lease("w2", 10, false); !result.Finished {
+		t.Fatal("The crawl is not finished!")
+	}
+}
+
+func TestFrontierExpire(t *testing.T) {
+	now := time.Now()
+	frontier := newTestFrontier(time.Minute, &now, t)
+	frontier.Add(genRequests("http://a.com/1", "http://a.com/2"))
+	result, _ := frontier.Lease("w1", 2, true)
+	if len(result.Leases) != 2 {
+		t.Fatalf("Inconsistent lease number: expected: %d, actual: %d", 2, len(result.Leases))
+	}
+	// 续期的租约不会过期。
+	now = now.Add(40 * time.Second)
+	if count, _ := frontier.Renew("w1", []uint64{result.Leases[0].ID}); count != 1 {
+		t.Fatalf("Inconsistent renewed number: expected: %d, actual: %d", 1, count)
+	}
+	now = now.Add(30 * time.Second)
+	// 过期租约的请求会被放回队列。由于主机仍归属于w1，因此只有w1能再次租借它。
+	if result2, _ := frontier.Lease("w2", 10, true); len(result2.Leases) != 0 {
+		t.Fatalf("Inconsistent lease number: expected: %d, actual: %d", 0, len(result2.Leases))
+	}
+	result2, _ := frontier.Lease("w1", 10, false)
+	if len(result2.Leases) != 1 || result2.Leases[0].Req != result.Leases[1].Req {
+		t.Fatalf("Inconsistent leases after expiration: %#v", result2.Leases)
+	}
+	stats, _ := frontier.Stats()
+	if stats.Expired != 1 || stats.Leased != 2 {
+		t.Fatalf("Inconsistent stats: %#v", stats)
+	}
+	// 过期的租约无法再被完成。
+	if count, _ := frontier.Complete("w1", leaseIDs(result.Leases)); count != 1 {
+		t.Fatalf("Inconsistent completed number: expected: %d, actual: %d", 1, count)
+	}
+	frontier.Complete("w1", leaseIDs(result2.Leases))
+	if result, _ = frontier.Lease("w1", 10, false); result.Finished {
+		t.Fatal("The crawl is finished while a worker is busy!")
+	}
+	// 长时间未租借请求的工作者会被视为已离开，即使它最后报告的状态是忙碌。
+	now = now.Add(2 * time.Minute)
+	if result, _ = frontier.Lease("w1", 10, false); !result.Finished {
+		t.Fatal("The crawl is not finished after the busy worker has left!")
+	}
+	if stats, _ = frontier.Stats(); stats.Workers != 1 {
+		t.Fatalf("Inconsistent worker number: expected: %d, actual: %d", 1, stats.Workers)
+	}
+}
+
+func TestFrontierReject(t *testing.T) {
+	f, _ := New(Options{HostBufferCap: 1, HostMaxBufferNumber: 1})
+	added, _ := f.Add(genRequests("http://a.com/1", "http://a.com/2", "http://b.com/1"))
+	if added != 2 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d", 2, added)
+	}
+	stats, _ := f.Stats()
+	if stats.Rejected != 1 || stats.Seen != 2 {
+		t.Fatalf("Inconsistent stats: %#v", stats)
+	}
+	// 被拒绝的请求可以被再次提交。
+	f.Lease("w1", 1, false)
+	if added, _ = f.Add(genRequests("http://a.com/2")); added != 1 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d", 1, added)
+	}
+}
+
+func TestFrontierClose(t *testing.T) {
+	f, _ := New(Options{})
+	f.Close()
+	if _, err := f.Add(genRequests("http://a.com/1")); err != ErrClosedFrontier {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedFrontier, err)
+	}
+	if _, err := f.Lease("w1", 1, false); err != ErrClosedFrontier {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedFrontier, err)
+	}
+}
@@ -0,0 +1,293 @@
+package frontier
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// serviceName 代表RPC服务的名称。
+const serviceName = "Frontier"
+
+// codec 代表在网络上传输请求时使用的编解码器。
+var codec = module.RequestCodec{}
+
+// AddArgs 代表提交请求的RPC参数。
+type AddArgs struct {
+	// Requests 代表被编码的请求的列表。
+	Requests [][]byte
+}
+
+// LeaseArgs 代表租借请求的RPC参数。
+type LeaseArgs struct {
+	// Worker 代表工作者。
+	Worker string
+	// Max 代表租借的请求的最大数量。
+	Max uint32
+	// Busy 代表工作者是否还有未处理完毕的本地工作。
+	Busy bool
+}
+
+// LeaseReply 代表租借请求的RPC结果。
+type LeaseReply struct {
+	// Leases 代表新的租约的列表。
+	Leases []EncodedLease
+	// Finished 代表整个爬取是否已经结束。
+	Finished bool
+}
+
+// EncodedLease 代表在网络上传输的租约。
+type EncodedLease struct {
+	// ID 代表租约的ID。
+	ID uint64
+	// Request 代表被编码的请求。
+	Request []byte
+	// Expiry 代表租约的过期时间。
+	Expiry time.Time
+}
+
+// LeaseIDArgs 代表续期或完成租约的RPC参数。
+type LeaseIDArgs struct {
+	// Worker 代表工作者。
+	Worker string
+	// IDs 代表租约ID的列表。
+	IDs []uint64
+}
+
+// rpcService 代表爬取边界的RPC服务。
+type rpcService struct {
+	// frontier 代表爬取边界。
+	frontier Frontier
+}
+
+func (service *rpcService) Add(args *AddArgs, reply *int) error {
+	reqs := make([]*module.Request, 0, len(args.Requests))
+	for _, p := range args.Requests {
+		datum, err := codec.Decode(p)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, datum.(*module.Request))
+	}
+	added, err := service.frontier.Add(reqs)
+	*reply = added
+	return err
+}
+
+func (service *rpcService) Lease(args *LeaseArgs, reply *LeaseReply) error {
+	result, err := service.frontier.Lease(args.Worker, args.Max, args.Busy)
+	if err != nil {
+		return err
+	}
+	for _, lease := range result.Leases {
+		p, err := codec.Encode(lease.Req)
+		if err != nil {
+			return err
+		}
+		reply.Leases = append(reply.Leases,
+			EncodedLease{ID: lease.ID, Request: p, Expiry: lease.Expiry})
+	}
+	reply.Finished = result.Finished
+	return nil
+}
+
+func (service *rpcService) Renew(args *LeaseIDArgs, reply *int) error {
+	count, err := service.frontier.Renew(args.Worker, args.IDs)
+	*reply = count
+	return err
+}
+
+func (service *rpcService) Complete(args *LeaseIDArgs, reply *int) error {
+	count, err := service.frontier.Complete(args.Worker, args.IDs)
+	*reply = count
+	return err
+}
+
+// Stats 的参数args未被使用。
+func (service *rpcService) Stats(args int, reply *Stats) error {
+	stats, err := service.frontier.Stats()
+	*reply = stats
+	return err
+}
+
+// Server 代表爬取边界服务的接口类型。
+type Server interface {
+	// Addr 用于获取服务监听的网络地址。
+	Addr() net.Addr
+	// Close 用于停止服务并断开所有连接。它不会关闭爬取边界本身。
+	Close() error
+}
+
+// Listen 用于在给定的TCP地址上启动爬取边界服务。
+// 各个工作者可以通过Dial函数连接该服务，并共享同一个爬取边界。
+func Listen(addr string, frontier Frontier) (Server, error) {
+	if frontier == nil {
+		return nil, errors.New("nil frontier")
+	}
+	rpcServer := rpc.NewServer()
+	if err := rpcServer.RegisterName(serviceName, &rpcService{frontier: frontier}); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &myServer{
+		listener:  listener,
+		rpcServer: rpcServer,
+		conns:     make(map[net.Conn]struct{}),
+	}
+	go server.serve()
+	logger.Infof("The frontier service is listening on %s.", listener.Addr())
+	return server, nil
+}
+
+// myServer 代表爬取边界服务的实现类型。
+type myServer struct {
+	// listener 代表网络监听器。
+	listener net.Listener
+	// rpcServer 代表RPC服务器。
+	rpcServer *rpc.Server
+	// lock 代表用于保护以下字段的互斥锁。
+	lock sync.Mutex
+	// conns 代表当前的所有连接。
+	conns map[net.Conn]struct{}
+	// closed 代表服务是否已停止。
+	closed bool
+}
+
+// serve 用于接受连接，并为每个连接启用一个goroutine来处理RPC调用。
+func (server *myServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			server.lock.Lock()
+			closed := server.closed
+			server.lock.Unlock()
+			if !closed {
+				logger.Errorf("The frontier service stops accepting connections: %s", err)
+			}
+			return
+		}
+		server.lock.Lock()
+		if server.closed {
+			server.lock.Unlock()
+			conn.Close()
+			return
+		}
+		server.conns[conn] = struct{}{}
+		server.lock.Unlock()
+		go func() {
+			server.rpcServer.ServeConn(conn)
+			server.lock.Lock()
+			delete(server.conns, conn)
+			server.lock.Unlock()
+		}()
+	}
+}
+
+func (server *myServer) Addr() net.Addr {
+	return server.listener.Addr()
+}
+
+func (server *myServer) Close() error {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	if server.closed {
+		return nil
+	}
+	server.closed = true
+	err := server.listener.Close()
+	for conn := range server.conns {
+		conn.Close()
+	}
+	return err
+}
+
+// Dial 用于连接给定TCP地址上的爬取边界服务。
+// 结果值的Close方法只会断开连接，而不会关闭远程的爬取边界。
+func Dial(addr string) (Frontier, error) {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &myClient{client: client}, nil
+}
+
+// myClient 代表爬取边界服务的客户端。
+type myClient struct {
+	// client 代表RPC客户端。
+	client *rpc.Client
+}
+
+// call 用于调用远程的方法。
+// 远程返回的表示爬取边界已关闭的错误会被还原为ErrClosedFrontier。
+func (client *myClient) call(method string, args interface{}, reply interface{}) error {
+	err := client.client.Call(serviceName+"."+method, args, reply)
+	if serverErr, ok := err.(rpc.ServerError); ok && string(serverErr) == ErrClosedFrontier.Error() {
+		return ErrClosedFrontier
+	}
+	return err
+}
+
+func (client *myClient) Add(reqs []*module.Request) (int, error) {
+	args := &AddArgs{Requests: make([][]byte, 0, len(reqs))}
+	for _, req := range reqs {
+		p, err := codec.Encode(req)
+		if err != nil {
+			return 0, err
+		}
+		args.Requests = append(args.Requests, p)
+	}
+	var added int
+	err := client.call("Add", args, &added)
+	return added, err
+}
+
+func (client *myClient) Lease(worker string, max uint32, busy bool) (LeaseResult, error) {
+	var result LeaseResult
+	var reply LeaseReply
+	args := &LeaseArgs{Worker: worker, Max: max, Busy: busy}
+	if err := client.call("Lease", args, &reply); err != nil {
+		return result, err
+	}
+	for _, encoded := range reply.Leases {
+		datum, err := codec.Decode(encoded.Request)
+		if err != nil {
+			return result, err
+		}
+		result.Leases = append(result.Leases, Lease{
+			ID:     encoded.ID,
+			Req:    datum.(*module.Request),
+			Expiry: encoded.Expiry,
+		})
+	}
+	result.Finished = reply.Finished
+	return result, nil
+}
+
+func (client *myClient) Renew(worker string, ids []uint64) (int, error) {
+	var count int
+	err := client.call("Renew", &LeaseIDArgs{Worker: worker, IDs: ids}, &count)
+	return count, err
+}
+
+func (client *myClient) Complete(worker string, ids []uint64) (int, error) {
+	var count int
+	err := client.call("Complete", &LeaseIDArgs{Worker: worker, IDs: ids}, &count)
+	return count, err
+}
+
+func (client *myClient) Stats() (Stats, error) {
+	var stats Stats
+	err := client.call("Stats", 0, &stats)
+	return stats, err
+}
+
+func (client *myClient) Close() error {
+	return client.client.Close()
+}
@@ -0,0 +1,74 @@
+package frontier
+
+import (
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	if _, err := Listen("127.0.0.1:0", nil); err == nil {
+		t.Fatal("No error when listening with nil frontier!")
+	}
+	f, _ := New(Options{})
+	server, err := Listen("127.0.0.1:0", f)
+	if err != nil {
+		t.Fatalf("An error occurs when starting frontier service: %s", err)
+	}
+	defer server.Close()
+	// 多个客户端共享同一个爬取边界。
+	client1, err := Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("An error occurs when dialing frontier service: %s", err)
+	}
+	defer client1.Close()
+	client2, err := Dial(server.Addr().String())
+	if err != nil {
+		t.Fatalf("An error occurs when dialing frontier service: %s", err)
+	}
+	defer client2.Close()
+	reqs := genRequests("http://a.com/1", "http://b.com/1")
+	reqs[0].HTTPReq().Header.Set("Referer", "http://a.com/")
+	if added, err := client1.Add(reqs); err != nil || added != 2 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d (error: %v)", 2, added, err)
+	}
+	if added, _ := client2.Add(reqs); added != 0 {
+		t.Fatalf("Inconsistent added number: expected: %d, actual: %d", 0, added)
+	}
+	result1, err := client1.Lease("w1", 1, false)
+	if err != nil {
+		t.Fatalf("An error occurs when leasing requests: %s", err)
+	}
+	if len(result1.Leases) != 1 {
+		t.Fatalf("Inconsistent lease number: expected: %d, actual: %d", 1, len(result1.Leases))
+	}
+	httpReq := result1.Leases[0].Req.HTTPReq()
+	if httpReq.URL.String() != "http://a.com/1" || httpReq.Header.Get("Referer") != "http://a.com/" {
+		t.Fatalf("Inconsistent leased request: %s %v", httpReq.URL, httpReq.Header)
+	}
+	result2, _ := client2.Lease("w2", 10, false)
+	if len(result2.Leases) != 1 || result2.Leases[0].Req.HTTPReq().URL.Host != "b.com" {
+		t.Fatalf("Inconsistent leases of another worker: %#v", result2.Leases)
+	}
+	if count, _ := client1.Renew("w1", leaseIDs(result1.Leases)); count != 1 {
+		t.Fatalf("Inconsistent renewed number: expected: %d, actual: %d", 1, count)
+	}
+	client1.Complete("w1", leaseIDs(result1.Leases))
+	if count, _ := client2.Complete("w2", leaseIDs(result2.Leases)); count != 1 {
+		t.Fatalf("Inconsistent completed number: expected: %d, actual: %d", 1, count)
+	}
+	stats, err := client2.Stats()
+	if err != nil {
+		t.Fatalf("An error occurs when getting stats: %s", err)
+	}
+	expectedStats := Stats{Seen: 2, Completed: 2, Hosts: 2, Workers: 2}
+	if stats != expectedStats {
+		t.Fatalf("Inconsistent stats: expected: %#v, actual: %#v", expectedStats, stats)
+	}
+	if result, _ := client1.Lease("w1", 1, false); !result.Finished {
+		t.Fatal("The crawl is not finished!")
+	}
+	// 远程的爬取边界被关闭之后，客户端会得到ErrClosedFrontier。
+	f.Close()
+	if _, err := client1.Lease("w1", 1, false); err != ErrClosedFrontier {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedFrontier, err)
+	}
+}
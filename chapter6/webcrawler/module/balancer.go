@@ -0,0 +1,389 @@
+package module
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// 负载均衡策略的名称。
+const (
+	// BALANCER_SCORE 代表选择评分最低的组件实例的策略。
+	BALANCER_SCORE = "score"
+	// BALANCER_ROUND_ROBIN 代表轮询的策略。
+	BALANCER_ROUND_ROBIN = "round_robin"
+	// BALANCER_WEIGHTED_RANDOM 代表加权随机的策略。
+	BALANCER_WEIGHTED_RANDOM = "weighted_random"
+	// BALANCER_LEAST_HANDLING 代表选择正在处理的调用数量最少的组件实例的策略。
+	BALANCER_LEAST_HANDLING = "least_handling"
+	// BALANCER_POWER_OF_TWO 代表随机选取两个组件实例并择优的策略。
+	BALANCER_POWER_OF_TWO = "power_of_two"
+	// BALANCER_CONSISTENT_HASH 代表根据键（如主机名）进行一致性哈希的策略。
+	BALANCER_CONSISTENT_HASH = "consistent_hash"
+)
+
+// Balancer 代表负载均衡器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type Balancer interface {
+	// Name 用于获取负载均衡策略的名称。
+	Name() string
+	// Select 用于从候选的组件实例中选择一个。
+	// 参数candidates代表按照组件ID排序的同类型组件实例，其长度总是大于0。
+	// 参数key代表选择的依据，例如请求的主机名，可以为空。
+	Select(moduleType Type, candidates []Module, key string) (Module, error)
+}
+
+// NewBalancer 用于根据策略名称创建一个负载均衡器。
+// 加权随机策略会使用CalculateWeightSimple计算权重，一致性哈希策略会使用默认的虚拟节点数量。
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case BALANCER_SCORE:
+		return NewScoreBalancer(), nil
+	case BALANCER_ROUND_ROBIN:
+		return NewRoundRobinBalancer(), nil
+	case BALANCER_WEIGHTED_RANDOM:
+		return NewWeightedRandomBalancer(CalculateWeightSimple), nil
+	case BALANCER_LEAST_HANDLING:
+		return NewLeastHandlingBalancer(), nil
+	case BALANCER_POWER_OF_TWO:
+		return NewPowerOfTwoBalancer(), nil
+	case BALANCER_CONSISTENT_HASH:
+		return NewConsistentHashBalancer(0), nil
+	}
+	errMsg := fmt.Sprintf("unsupported balancer: %s", name)
+	return nil, errors.NewIllegalParameterError(errMsg)
+}
+
+// NewScoreBalancer 用于创建一个选择评分最低的组件实例的负载均衡器。
+// 每次选择时都会重新计算所有候选组件实例的评分。
+func NewScoreBalancer() Balancer {
+	return &scoreBalancer{}
+}
+
+// scoreBalancer 代表基于评分的负载均衡器。
+type scoreBalancer struct{}
+
+func (balancer *scoreBalancer) Name() string {
+	return BALANCER_SCORE
+}
+
+func (balancer *scoreBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	minScore := uint64(0)
+	var selectedModule Module
+	for _, module := range candidates {
+		SetScore(module)
+		score := module.Score()
+		if selectedModule == nil || score < minScore {
+			selectedModule = module
+			minScore = score
+		}
+	}
+	return selectedModule, nil
+}
+
+// NewRoundRobinBalancer 用于创建一个轮询的负载均衡器。
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{counters: map[Type]uint64{}}
+}
+
+// roundRobinBalancer 代表轮询的负载均衡器。
+type roundRobinBalancer struct {
+	// counters 代表组件类型与选择次数的映射。
+	counters map[Type]uint64
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (balancer *roundRobinBalancer) Name() string {
+	return BALANCER_ROUND_ROBIN
+}
+
+func (balancer *roundRobinBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	return candidates[balancer.next(moduleType)%uint64(len(candidates))], nil
+}
+
+// next 用于获取给定类型的下一个序号。
+func (balancer *roundRobinBalancer) next(moduleType Type) uint64 {
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	n := balancer.counters[moduleType]
+	balancer.counters[moduleType] = n + 1
+	return n
+}
+
+// CalculateWeight 代表用于计算组件权重的函数类型。
+type CalculateWeight func(module Module) uint64
+
+// weightScale 代表CalculateWeightSimple计算的最大权重。
+const weightScale = 1000
+
+// CalculateWeightSimple 代表简易的组件权重计算函数。
+// 权重与组件实例正在处理的调用数量加1成反比，因此越空闲的组件实例越容易被选中。
+func CalculateWeightSimple(module Module) uint64 {
+	return weightScale / (1 + module.HandlingNumber())
+}
+
+// NewWeightedRandomBalancer 用于创建一个加权随机的负载均衡器。
+// 若参数calculator为nil，则使用CalculateWeightSimple计算权重。
+// 若所有候选组件实例的权重都为0，则等概率地选择。
+func NewWeightedRandomBalancer(calculator CalculateWeight) Balancer {
+	if calculator == nil {
+		calculator = CalculateWeightSimple
+	}
+	return &weightedRandomBalancer{
+		calculator: calculator,
+		random:     newLockedRandom(),
+	}
+}
+
+// weightedRandomBalancer 代表加权随机的负载均衡器。
+type weightedRandomBalancer struct {
+	// calculator 代表权重计算函数。
+	calculator CalculateWeight
+	// random 代表随机数生成器。
+	random *lockedRandom
+}
+
+func (balancer *weightedRandomBalancer) Name() string {
+	return BALANCER_WEIGHTED_RANDOM
+}
+
+func (balancer *weightedRandomBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	weights := make([]uint64, len(candidates))
+	var total uint64
+	for i, module := range candidates {
+		weights[i] = balancer.calculator(module)
+		total += weights[i]
+	}
+	if total == 0 {
+		return candidates[balancer.random.Intn(len(candidates))], nil
+	}
+	n := balancer.random.Uint64n(total)
+	for i, weight := range weights {
+		if n < weight {
+			return candidates[i], nil
+		}
+		n -= weight
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+// NewLeastHandlingBalancer 用于创建一个选择正在处理的调用数量最少的组件实例的负载均衡器。
+// 数量相同时会轮流选择。
+func NewLeastHandlingBalancer() Balancer {
+	return &leastHandlingBalancer{
+		roundRobin: &roundRobinBalancer{counters: map[Type]uint64{}},
+	}
+}
+
+// leastHandlingBalancer 代表基于正在处理的调用数量的负载均衡器。
+type leastHandlingBalancer struct {
+	// roundRobin 代表在数量相同时使用的轮询负载均衡器。
+	roundRobin *roundRobinBalancer
+}
+
+func (balancer *leastHandlingBalancer) Name() string {
+	return BALANCER_LEAST_HANDLING
+}
+
+func (balancer *leastHandlingBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	length := uint64(len(candidates))
+	offset := balancer.roundRobin.next(moduleType) % length
+	selectedModule := candidates[offset]
+	minHandling := selectedModule.HandlingNumber()
+	for i := uint64(1); i < length; i++ {
+		module := candidates[(offset+i)%length]
+		if handling := module.HandlingNumber(); handling < minHandling {
+			selectedModule = module
+			minHandling = handling
+		}
+	}
+	return selectedModule, nil
+}
+
+// NewPowerOfTwoBalancer 用于创建一个“两次随机选择”的负载均衡器。
+// 它会随机选取两个组件实例，并选择其中正在处理的调用数量较少的那一个。
+func NewPowerOfTwoBalancer() Balancer {
+	return &powerOfTwoBalancer{random: newLockedRandom()}
+}
+
+// powerOfTwoBalancer 代表“两次随机选择”的负载均衡器。
+type powerOfTwoBalancer struct {
+	// random 代表随机数生成器。
+	random *lockedRandom
+}
+
+func (balancer *powerOfTwoBalancer) Name() string {
+	return BALANCER_POWER_OF_TWO
+}
+
+func (balancer *powerOfTwoBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	length := len(candidates)
+	if length == 1 {
+		return candidates[0], nil
+	}
+	i := balancer.random.Intn(length)
+	j := balancer.random.Intn(length - 1)
+	if j >= i {
+		j++
+	}
+	one, another := candidates[i], candidates[j]
+	if another.HandlingNumber() < one.HandlingNumber() {
+		return another, nil
+	}
+	return one, nil
+}
+
+// DEFAULT_HASH_REPLICAS 代表一致性哈希中每个组件实例默认的虚拟节点数量。
+const DEFAULT_HASH_REPLICAS = 100
+
+// NewConsistentHashBalancer 用于创建一个一致性哈希的负载均衡器。
+// 相同的键总会被路由到同一个组件实例，在组件实例增减时只有少量的键会改变路由。
+// 若键为空，则会轮流选择。
+// 参数replicas代表每个组件实例的虚拟节点数量，为0时使用DEFAULT_HASH_REPLICAS。
+func NewConsistentHashBalancer(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = DEFAULT_HASH_REPLICAS
+	}
+	return &consistentHashBalancer{
+		replicas:   replicas,
+		rings:      map[Type]*hashRing{},
+		roundRobin: &roundRobinBalancer{counters: map[Type]uint64{}},
+	}
+}
+
+// hashRing 代表一致性哈希环。
+type hashRing struct {
+	// candidates 代表生成该哈希环的组件实例列表。
+	candidates []Module
+	// signature 代表生成该哈希环的组件实例的标识。
+	signature string
+	// hashes 代表有序的虚拟节点哈希值。
+	hashes []uint32
+	// modules 代表虚拟节点哈希值与组件实例的映射。
+	modules map[uint32]Module
+}
+
+// consistentHashBalancer 代表一致性哈希的负载均衡器。
+type consistentHashBalancer struct {
+	// replicas 代表每个组件实例的虚拟节点数量。
+	replicas int
+	// rings 代表组件类型与哈希环的映射。
+	rings map[Type]*hashRing
+	// roundRobin 代表在键为空时使用的轮询负载均衡器。
+	roundRobin *roundRobinBalancer
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (balancer *consistentHashBalancer) Name() string {
+	return BALANCER_CONSISTENT_HASH
+}
+
+func (balancer *consistentHashBalancer) Select(
+	moduleType Type, candidates []Module, key string) (Module, error) {
+	if key == "" {
+		return balancer.roundRobin.Select(moduleType, candidates, key)
+	}
+	ring := balancer.ring(moduleType, candidates)
+	hash := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(ring.hashes), func(i int) bool {
+		return ring.hashes[i] >= hash
+	})
+	if i == len(ring.hashes) {
+		i = 0
+	}
+	return ring.modules[ring.hashes[i]], nil
+}
+
+// ring 用于获取与候选组件实例对应的哈希环。
+// 仅当候选组件实例发生变化时才会重建哈希环。
+func (balancer *consistentHashBalancer) ring(
+	moduleType Type, candidates []Module) *hashRing {
+	balancer.lock.Lock()
+	ring, ok := balancer.rings[moduleType]
+	balancer.lock.Unlock()
+	// 组件注册器只会整体替换组件实例列表，
+	// 所以同一个列表可以直接复用哈希环而不必比较其中的组件实例。
+	if ok && len(ring.candidates) == len(candidates) &&
+		&ring.candidates[0] == &candidates[0] {
+		return ring
+	}
+	mids := make([]string, len(candidates))
+	for i, module := range candidates {
+		mids[i] = string(module.ID())
+	}
+	signature := strings.Join(mids, ",")
+	balancer.lock.Lock()
+	defer balancer.lock.Unlock()
+	if ring, ok := balancer.rings[moduleType]; ok && ring.signature == signature {
+		return ring
+	}
+	ring = &hashRing{
+		candidates: candidates,
+		signature:  signature,
+		hashes:     make([]uint32, 0, len(candidates)*balancer.replicas),
+		modules:    map[uint32]Module{},
+	}
+	for i, module := range candidates {
+		for j := 0; j < balancer.replicas; j++ {
+			hash := crc32.ChecksumIEEE([]byte(mids[i] + "#" + strconv.Itoa(j)))
+			if _, ok := ring.modules[hash]; ok {
+				continue
+			}
+			ring.modules[hash] = module
+			ring.hashes = append(ring.hashes, hash)
+		}
+	}
+	sort.Slice(ring.hashes, func(i, j int) bool {
+		return ring.hashes[i] < ring.hashes[j]
+	})
+	balancer.rings[moduleType] = ring
+	return ring
+}
+
+// lockedRandom 代表并发安全的随机数生成器。
+type lockedRandom struct {
+	// random 代表随机数生成器。
+	random *rand.Rand
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+// newLockedRandom 用于创建一个并发安全的随机数生成器。
+func newLockedRandom() *lockedRandom {
+	return &lockedRandom{
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Intn 用于获取[0,n)范围内的随机整数。
+func (r *lockedRandom) Intn(n int) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.random.Intn(n)
+}
+
+// Uint64n 用于获取[0,n)范围内的随机整数。
+// 大于math.MaxInt64的n会被视为math.MaxInt64。
+func (r *lockedRandom) Uint64n(n uint64) uint64 {
+	if n > math.MaxInt64 {
+		n = math.MaxInt64
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return uint64(r.random.Int63n(int64(n)))
+}
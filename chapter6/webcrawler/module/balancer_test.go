@@ -0,0 +1,214 @@
+package module
+
+import (
+	"fmt"
+	"testing"
+)
+
+// genFakeDownloaders 用于生成按照ID排序的仿造下载器列表。
+// 参数counts代表各个下载器的基础计数。
+func genFakeDownloaders(counts ...uint64) []Module {
+	modules := make([]Module, len(counts))
+	for i, count := range counts {
+		d := NewFakeDownloader(MID(fmt.Sprintf("D%d", i+1)), CalculateScoreSimple)
+		d.(*fakeDownloader).count = count
+		modules[i] = d
+	}
+	return modules
+}
+
+func TestBalancerNew(t *testing.T) {
+	names := []string{
+		BALANCER_SCORE,
+		BALANCER_ROUND_ROBIN,
+		BALANCER_WEIGHTED_RANDOM,
+		BALANCER_LEAST_HANDLING,
+		BALANCER_POWER_OF_TWO,
+		BALANCER_CONSISTENT_HASH,
+	}
+	for _, name := range names {
+		balancer, err := NewBalancer(name)
+		if err != nil {
+			t.Fatalf("An error occurs when creating balancer %s: %s", name, err)
+		}
+		if balancer.Name() != name {
+			t.Fatalf("Inconsistent balancer name: expected: %s, actual: %s",
+				name, balancer.Name())
+		}
+	}
+	if _, err := NewBalancer("unknown"); err == nil {
+		t.Fatal("No error when creating unsupported balancer!")
+	}
+}
+
+func TestBalancerScore(t *testing.T) {
+	candidates := genFakeDownloaders(5, 1, 3)
+	m, _ := NewScoreBalancer().Select(TYPE_DOWNLOADER, candidates, "")
+	if m.ID() != "D2" {
+		t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", "D2", m.ID())
+	}
+}
+
+func TestBalancerRoundRobin(t *testing.T) {
+	candidates := genFakeDownloaders(0, 0, 0)
+	balancer := NewRoundRobinBalancer()
+	for i := 0; i < 6; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		expected := candidates[i%len(candidates)].ID()
+		if m.ID() != expected {
+			t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", expected, m.ID())
+		}
+	}
+}
+
+func TestBalancerWeightedRandom(t *testing.T) {
+	candidates := genFakeDownloaders(0, 1, 2)
+	// 只有基础计数为1的下载器有权重。
+	weight := func(m Module) uint64 {
+		if m.HandlingNumber() == 3 {
+			return 10
+		}
+		return 0
+	}
+	balancer := NewWeightedRandomBalancer(weight)
+	for i := 0; i < 100; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		if m.ID() != "D2" {
+			t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", "D2", m.ID())
+		}
+	}
+	counts := map[MID]int{}
+	balancer = NewWeightedRandomBalancer(func(m Module) uint64 { return 0 })
+	for i := 0; i < 300; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		counts[m.ID()]++
+	}
+	if len(counts) != len(candidates) {
+		t.Fatalf("Not all modules are selected with zero weights: %v", counts)
+	}
+	// 默认的权重与正在处理的调用数量加1成反比。
+	balancer, _ = NewBalancer(BALANCER_WEIGHTED_RANDOM)
+	busy := genFakeDownloaders(0, 5000)
+	for i := 0; i < 100; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, busy, "")
+		if m.ID() != "D1" {
+			t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", "D1", m.ID())
+		}
+	}
+}
+
+func TestBalancerLeastHandling(t *testing.T) {
+	candidates := genFakeDownloaders(4, 2, 2, 7)
+	balancer := NewLeastHandlingBalancer()
+	counts := map[MID]int{}
+	for i := 0; i < 8; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		counts[m.ID()]++
+	}
+	if counts["D2"] == 0 || counts["D3"] == 0 || counts["D2"]+counts["D3"] != 8 {
+		t.Fatalf("Inconsistent selection counts: %v", counts)
+	}
+}
+
+func TestBalancerPowerOfTwo(t *testing.T) {
+	candidates := genFakeDownloaders(9, 0)
+	balancer := NewPowerOfTwoBalancer()
+	for i := 0; i < 10; i++ {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		if m.ID() != "D2" {
+			t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", "D2", m.ID())
+		}
+	}
+	single := candidates[:1]
+	if m, _ := balancer.Select(TYPE_DOWNLOADER, single, ""); m.ID() != "D1" {
+		t.Fatalf("Inconsistent selected module: expected: %s, actual: %s", "D1", m.ID())
+	}
+}
+
+func TestBalancerConsistentHash(t *testing.T) {
+	candidates := genFakeDownloaders(0, 0, 0, 0)
+	balancer := NewConsistentHashBalancer(0)
+	hosts := []string{}
+	for i := 0; i < 100; i++ {
+		hosts = append(hosts, fmt.Sprintf("host%d.example.com", i))
+	}
+	routes := map[string]MID{}
+	for _, host := range hosts {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, candidates, host)
+		routes[host] = m.ID()
+		for i := 0; i < 3; i++ {
+			m, _ = balancer.Select(TYPE_DOWNLOADER, candidates, host)
+			if m.ID() != routes[host] {
+				t.Fatalf("Inconsistent route for %s: expected: %s, actual: %s",
+					host, routes[host], m.ID())
+			}
+		}
+	}
+	// 去掉一个下载器后，只有原先路由到它的主机会改变路由。
+	removed := candidates[3].ID()
+	reduced := append([]Module{}, candidates[:3]...)
+	for _, host := range hosts {
+		m, _ := balancer.Select(TYPE_DOWNLOADER, reduced, host)
+		if routes[host] != removed && m.ID() != routes[host] {
+			t.Fatalf("The route for %s has been changed: expected: %s, actual: %s",
+				host, routes[host], m.ID())
+		}
+	}
+	// 键为空时轮流选择。
+	one, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+	another, _ := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+	if one.ID() == another.ID() {
+		t.Fatalf("The same module %s is selected for empty keys!", one.ID())
+	}
+}
+
+func TestRegistrarBalancer(t *testing.T) {
+	registrar := NewRegistrar(nil)
+	if registrar.Balancer().Name() != BALANCER_SCORE {
+		t.Fatalf("Inconsistent default balancer: expected: %s, actual: %s",
+			BALANCER_SCORE, registrar.Balancer().Name())
+	}
+	registrar = NewRegistrar(NewConsistentHashBalancer(0))
+	for i := 0; i < 3; i++ {
+		addr, _ := NewAddr("http", "127.0.0.1", uint64(8080+i))
+		mid, _ := GenMID(TYPE_DOWNLOADER, DefaultSNGen.Get(), addr)
+		registrar.Register(NewFakeDownloader(mid, CalculateScoreSimple))
+	}
+	m1, err := registrar.GetByKey(TYPE_DOWNLOADER, "golang.org")
+	if err != nil {
+		t.Fatalf("An error occurs when getting module instance by key: %s", err)
+	}
+	m2, _ := registrar.GetByKey(TYPE_DOWNLOADER, "golang.org")
+	if m1.ID() != m2.ID() {
+		t.Fatalf("Inconsistent module for the same key: %s, %s", m1.ID(), m2.ID())
+	}
+	registrar.Unregister(m1.ID())
+	m3, _ := registrar.GetByKey(TYPE_DOWNLOADER, "golang.org")
+	if m3 == nil || m3.ID() == m1.ID() {
+		t.Fatalf("The unregistered module %v is still selected!", m1.ID())
+	}
+	if _, err := registrar.GetByKey(TYPE_ANALYZER, "golang.org"); err != ErrNotFoundModuleInstance {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrNotFoundModuleInstance, err)
+	}
+}
+
+func TestScoreBalancerWithZeroScore(t *testing.T) {
+	// 仿造组件的调用计数总是比其内部计数大10。
+	calculator := func(counts Counts) uint64 {
+		return counts.CalledCount - 10
+	}
+	idle := NewFakeDownloader("D1", calculator)
+	busy := NewFakeDownloader("D2", calculator)
+	busy.(*fakeDownloader).fakeModule.count = 5
+	balancer := NewScoreBalancer()
+	for _, candidates := range [][]Module{{idle, busy}, {busy, idle}} {
+		selected, err := balancer.Select(TYPE_DOWNLOADER, candidates, "")
+		if err != nil {
+			t.Fatalf("An error occurs when selecting module: %s", err)
+		}
+		if selected.ID() != idle.ID() {
+			t.Fatalf("Inconsistent selected module: expected: %s, actual: %s",
+				idle.ID(), selected.ID())
+		}
+	}
+}
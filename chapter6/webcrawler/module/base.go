@@ -1,6 +1,9 @@
 package module
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
 // Counts 代表用于汇集组件内部计数的类型。
 type Counts struct {
@@ -12,16 +15,41 @@ type Counts struct {
 	CompletedCount uint64
 	// HandlingNumber 代表实时处理数。
 	HandlingNumber uint64
+	// FailedCount 代表被接受但未能成功完成的调用的计数。
+	FailedCount uint64
+	// TotalLatency 代表被接受的调用的累计耗时。
+	TotalLatency time.Duration
+	// EWMALatency 代表被接受的调用的耗时的指数加权移动平均值。
+	EWMALatency time.Duration
+}
+
+// ErrorRate 用于计算被接受的调用的失败率。
+func (counts Counts) ErrorRate() float64 {
+	if counts.AcceptedCount == 0 {
+		return 0
+	}
+	return float64(counts.FailedCount) / float64(counts.AcceptedCount)
+}
+
+// AvgLatency 用于计算被接受的调用的平均耗时。
+func (counts Counts) AvgLatency() time.Duration {
+	if counts.AcceptedCount == 0 {
+		return 0
+	}
+	return counts.TotalLatency / time.Duration(counts.AcceptedCount)
 }
 
 // SummaryStruct 代表组件摘要结构的类型。
 type SummaryStruct struct {
-	ID        MID         `json:"id"`
-	Called    uint64      `json:"called"`
-	Accepted  uint64      `json:"accepted"`
-	Completed uint64      `json:"completed"`
-	Handling  uint64      `json:"handling"`
-	Extra     interface{} `json:"extra,omitempty"`
+	ID          MID         `json:"id"`
+	Called      uint64      `json:"called"`
+	Accepted    uint64      `json:"accepted"`
+	Completed   uint64      `json:"completed"`
+	Handling    uint64      `json:"handling"`
+	Failed      uint64      `json:"failed,omitempty"`
+	AvgLatency  string      `json:"avg_latency,omitempty"`
+	EWMALatency string      `json:"ewma_latency,omitempty"`
+	Extra       interface{} `json:"extra,omitempty"`
 }
 
 // Module 代表组件的基础接口类型。
@@ -94,3 +122,10 @@ type Pipeline interface {
 
 // ProcessItem 代表用于处理条目的函数的类型。
 type ProcessItem func(item Item) (result Item, err error)
+
+// Flusher 代表可以写出缓冲数据的接口类型。
+// 调度器在停止时会调用所有实现了该接口的组件实例的Flush方法。
+type Flusher interface {
+	// Flush 用于写出所有缓冲的数据。
+	Flush() error
+}
@@ -0,0 +1,75 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// RequestCodec 代表请求的编解码器的类型。
+// 它可以被用作溢出缓冲池的编解码器，以便把请求写入磁盘。
+// 注意，带有请求体的请求无法被编码。
+type RequestCodec struct{}
+
+// encodedRequest 代表被编码的请求的类型。
+type encodedRequest struct {
+	ID      uint64      `json:"id,omitempty"`
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Host    string      `json:"host,omitempty"`
+	Header  http.Header `json:"header,omitempty"`
+	Depth   uint32      `json:"depth"`
+	Attempt uint32      `json:"attempt,omitempty"`
+}
+
+// Encode 用于编码给定的请求。
+func (RequestCodec) Encode(datum interface{}) ([]byte, error) {
+	req, ok := datum.(*Request)
+	if !ok || req == nil || !req.Valid() {
+		errMsg := fmt.Sprintf("invalid request for encoding: %T", datum)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	httpReq := req.HTTPReq()
+	if httpReq.Body != nil && httpReq.Body != http.NoBody {
+		errMsg := fmt.Sprintf("unsupported request with body (URL: %s)", httpReq.URL)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	encoded := encodedRequest{
+		ID:      req.ID(),
+		Method:  httpReq.Method,
+		URL:     httpReq.URL.String(),
+		Header:  httpReq.Header,
+		Depth:   req.Depth(),
+		Attempt: req.Attempt(),
+	}
+	if httpReq.Host != httpReq.URL.Host {
+		encoded.Host = httpReq.Host
+	}
+	return json.Marshal(encoded)
+}
+
+// Decode 用于解码出请求。
+func (RequestCodec) Decode(p []byte) (interface{}, error) {
+	var encoded encodedRequest
+	if err := json.Unmarshal(p, &encoded); err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(encoded.Method, encoded.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if encoded.Header != nil {
+		httpReq.Header = encoded.Header
+	}
+	if encoded.Host != "" {
+		httpReq.Host = encoded.Host
+	}
+	req := NewRequest(httpReq, encoded.Depth)
+	if encoded.ID != 0 {
+		req.id = encoded.ID
+	}
+	req.attempt = encoded.Attempt
+	return req, nil
+}
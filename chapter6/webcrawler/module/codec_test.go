@@ -0,0 +1,55 @@
+package module
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestCodec(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "https://github.com/gopcp?tab=repositories", nil)
+	httpReq.Header.Set("Referer", "https://github.com/")
+	httpReq.Host = "www.github.com"
+	req := NewRequest(httpReq, 2)
+	req.IncrAttempt()
+	codec := RequestCodec{}
+	p, err := codec.Encode(req)
+	if err != nil {
+		t.Fatalf("An error occurs when encoding request: %s", err)
+	}
+	datum, err := codec.Decode(p)
+	if err != nil {
+		t.Fatalf("An error occurs when decoding request: %s", err)
+	}
+	decoded, ok := datum.(*Request)
+	if !ok {
+		t.Fatalf("Inconsistent datum type: expected: %T, actual: %T", req, datum)
+	}
+	decodedHTTPReq := decoded.HTTPReq()
+	if decodedHTTPReq.Method != httpReq.Method ||
+		decodedHTTPReq.URL.String() != httpReq.URL.String() ||
+		decodedHTTPReq.Host != httpReq.Host {
+		t.Fatalf("Inconsistent HTTP request: expected: %v, actual: %v", httpReq, decodedHTTPReq)
+	}
+	if decodedHTTPReq.Header.Get("Referer") != "https://github.com/" {
+		t.Fatalf("Inconsistent header: %v", decodedHTTPReq.Header)
+	}
+	if decoded.Depth() != 2 || decoded.Attempt() != 1 {
+		t.Fatalf("Inconsistent request: depth: %d, attempt: %d",
+			decoded.Depth(), decoded.Attempt())
+	}
+	if decoded.ID() != req.ID() {
+		t.Fatalf("Inconsistent request ID: expected: %d, actual: %d", req.ID(), decoded.ID())
+	}
+	// 无法被编码的数据。
+	if _, err := codec.Encode("https://github.com/gopcp"); err == nil {
+		t.Fatal("No error when encoding non-request datum!")
+	}
+	postReq, _ := http.NewRequest("POST", "https://github.com/login", strings.NewReader("a=b"))
+	if _, err := codec.Encode(NewRequest(postReq, 0)); err == nil {
+		t.Fatal("No error when encoding request with body!")
+	}
+	if _, err := codec.Decode([]byte("{bad")); err == nil {
+		t.Fatal("No error when decoding invalid data!")
+	}
+}
@@ -0,0 +1,114 @@
+package module
+
+import (
+	"context"
+)
+
+// ContextDownloader 代表可感知上下文的下载器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ContextDownloader interface {
+	Downloader
+	// DownloadContext 会根据请求获取内容并返回响应。
+	// 参数ctx被取消或超时的时候，下载应尽快中止。
+	DownloadContext(ctx context.Context, req *Request) (*Response, error)
+}
+
+// ContextAnalyzer 代表可感知上下文的分析器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ContextAnalyzer interface {
+	Analyzer
+	// AnalyzeContext 会根据规则分析响应并返回请求和条目。
+	// 参数ctx被取消或超时的时候，分析应尽快中止。
+	AnalyzeContext(ctx context.Context, resp *Response) ([]Data, []error)
+}
+
+// ContextPipeline 代表可感知上下文的条目处理管道的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ContextPipeline interface {
+	Pipeline
+	// SendContext 会向条目处理管道发送条目。
+	// 参数ctx被取消或超时的时候，后续的条目处理步骤会被忽略。
+	SendContext(ctx context.Context, item Item) []error
+}
+
+// AdaptDownloader 用于把给定的下载器适配为可感知上下文的下载器。
+// 若下载器本身已实现ContextDownloader接口，则直接返回它。
+func AdaptDownloader(downloader Downloader) ContextDownloader {
+	if downloader == nil {
+		return nil
+	}
+	if cd, ok := downloader.(ContextDownloader); ok {
+		return cd
+	}
+	return &downloaderAdapter{Downloader: downloader}
+}
+
+// downloaderAdapter 代表下载器适配器的实现类型。
+type downloaderAdapter struct {
+	Downloader
+}
+
+// DownloadContext 会把上下文附加到HTTP请求上再进行下载，
+// 以使基于http.Client的下载器也能感知取消和超时。
+func (adapter *downloaderAdapter) DownloadContext(
+	ctx context.Context, req *Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req != nil && req.HTTPReq() != nil {
+		req = req.WithContext(ctx)
+	}
+	return adapter.Downloader.Download(req)
+}
+
+// AdaptAnalyzer 用于把给定的分析器适配为可感知上下文的分析器。
+// 若分析器本身已实现ContextAnalyzer接口，则直接返回它。
+func AdaptAnalyzer(analyzer Analyzer) ContextAnalyzer {
+	if analyzer == nil {
+		return nil
+	}
+	if ca, ok := analyzer.(ContextAnalyzer); ok {
+		return ca
+	}
+	return &analyzerAdapter{Analyzer: analyzer}
+}
+
+// analyzerAdapter 代表分析器适配器的实现类型。
+type analyzerAdapter struct {
+	Analyzer
+}
+
+// AnalyzeContext 只会在分析开始之前检查上下文。
+func (adapter *analyzerAdapter) AnalyzeContext(
+	ctx context.Context, resp *Response) ([]Data, []error) {
+	if err := ctx.Err(); err != nil {
+		return nil, []error{err}
+	}
+	return adapter.Analyzer.Analyze(resp)
+}
+
+// AdaptPipeline 用于把给定的条目处理管道适配为可感知上下文的条目处理管道。
+// 若条目处理管道本身已实现ContextPipeline接口，则直接返回它。
+func AdaptPipeline(pipeline Pipeline) ContextPipeline {
+	if pipeline == nil {
+		return nil
+	}
+	if cp, ok := pipeline.(ContextPipeline); ok {
+		return cp
+	}
+	return &pipelineAdapter{Pipeline: pipeline}
+}
+
+// pipelineAdapter 代表条目处理管道适配器的实现类型。
+type pipelineAdapter struct {
+	Pipeline
+}
+
+// SendContext 只会在处理开始之前检查上下文。
+func (adapter *pipelineAdapter) SendContext(
+	ctx context.Context, item Item) []error {
+	if err := ctx.Err(); err != nil {
+		return []error{err}
+	}
+	return adapter.Pipeline.Send(item)
+}
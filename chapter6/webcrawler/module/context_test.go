@@ -0,0 +1,95 @@
+package module
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// ctxCapturingDownloader 代表会记录请求上下文的仿造下载器。
+type ctxCapturingDownloader struct {
+	fakeDownloader
+	// ctx 代表最近一次下载时HTTP请求携带的上下文。
+	ctx context.Context
+	// attempt 代表最近一次下载时请求的下载尝试次数。
+	attempt uint32
+}
+
+func (downloader *ctxCapturingDownloader) Download(req *Request) (*Response, error) {
+	downloader.ctx = req.HTTPReq().Context()
+	downloader.attempt = req.Attempt()
+	return nil, nil
+}
+
+func TestContextAdaptDownloader(t *testing.T) {
+	if AdaptDownloader(nil) != nil {
+		t.Fatal("It still can adapt nil downloader!")
+	}
+	d := &ctxCapturingDownloader{}
+	cd := AdaptDownloader(d)
+	if cd == nil {
+		t.Fatal("Couldn't adapt downloader!")
+	}
+	if AdaptDownloader(cd) != cd {
+		t.Fatal("The context downloader was adapted again!")
+	}
+	httpReq, _ := http.NewRequest("GET", "http://127.0.0.1/", nil)
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	req := NewRequest(httpReq, 0)
+	req.IncrAttempt()
+	if _, err := cd.DownloadContext(ctx, req); err != nil {
+		t.Fatalf("An error occurs when downloading with context: %s", err)
+	}
+	if d.ctx == nil || d.ctx.Value(ctxKey{}) != "value" {
+		t.Fatal("The context has not been attached to the HTTP request!")
+	}
+	if d.attempt != 1 {
+		t.Fatalf("Inconsistent attempt: expected: %d, actual: %d", 1, d.attempt)
+	}
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.ctx = nil
+	if _, err := cd.DownloadContext(canceledCtx, NewRequest(httpReq, 0)); err == nil {
+		t.Fatal("No error when downloading with canceled context!")
+	}
+	if d.ctx != nil {
+		t.Fatal("The downloader was called with canceled context!")
+	}
+}
+
+func TestContextAdaptAnalyzer(t *testing.T) {
+	if AdaptAnalyzer(nil) != nil {
+		t.Fatal("It still can adapt nil analyzer!")
+	}
+	ca := AdaptAnalyzer(NewFakeAnalyzer(MID("A1"), nil))
+	if ca == nil {
+		t.Fatal("Couldn't adapt analyzer!")
+	}
+	if _, errs := ca.AnalyzeContext(context.Background(), nil); len(errs) != 0 {
+		t.Fatalf("Unexpected errors when analyzing with context: %v", errs)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, errs := ca.AnalyzeContext(ctx, nil); len(errs) == 0 {
+		t.Fatal("No error when analyzing with canceled context!")
+	}
+}
+
+func TestContextAdaptPipeline(t *testing.T) {
+	if AdaptPipeline(nil) != nil {
+		t.Fatal("It still can adapt nil pipeline!")
+	}
+	cp := AdaptPipeline(NewFakePipeline(MID("P1"), nil))
+	if cp == nil {
+		t.Fatal("Couldn't adapt pipeline!")
+	}
+	if errs := cp.SendContext(context.Background(), Item{}); len(errs) != 0 {
+		t.Fatalf("Unexpected errors when sending with context: %v", errs)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if errs := cp.SendContext(ctx, Item{}); len(errs) == 0 {
+		t.Fatal("No error when sending with canceled context!")
+	}
+}
@@ -1,7 +1,13 @@
 package module
 
 import (
+	"context"
+	"io"
+	"math/rand"
 	"net/http"
+	"reflect"
+	"sync/atomic"
+	"time"
 )
 
 // Data 代表数据的接口类型。
@@ -10,17 +16,36 @@ type Data interface {
 	Valid() bool
 }
 
+// lastRequestID 代表最近一次分配的请求ID。
+// 它的初始值是随机的，以免从其他进程（比如经由共享爬取边界）传来的请求与本进程的请求的ID相同。
+var lastRequestID = uint64(rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+
 // Request 代表数据请求的类型。
 type Request struct {
+	// id 代表请求的ID。
+	id uint64
 	// httpReq 代表HTTP请求。
 	httpReq *http.Request
 	// depth 代表请求的深度。
 	depth uint32
+	// attempt 代表请求的下载尝试次数。
+	attempt uint32
 }
 
 // NewRequest 用于创建一个新的请求实例。
 func NewRequest(httpReq *http.Request, depth uint32) *Request {
-	return &Request{httpReq: httpReq, depth: depth}
+	return &Request{
+		id:      atomic.AddUint64(&lastRequestID, 1),
+		httpReq: httpReq,
+		depth:   depth,
+	}
+}
+
+// ID 用于获取请求的ID。
+// 请求的副本以及经过编码和解码的请求都会保留原请求的ID，
+// 因此它可以被用来在请求被溢出到磁盘之后仍然识别出同一个请求。
+func (req *Request) ID() uint64 {
+	return req.id
 }
 
 // HTTPReq 用于获取HTTP请求。
@@ -33,6 +58,26 @@ func (req *Request) Depth() uint32 {
 	return req.depth
 }
 
+// Attempt 用于获取请求的下载尝试次数。
+func (req *Request) Attempt() uint32 {
+	return atomic.LoadUint32(&req.attempt)
+}
+
+// IncrAttempt 用于把请求的下载尝试次数加1，并返回新的次数。
+func (req *Request) IncrAttempt() uint32 {
+	return atomic.AddUint32(&req.attempt, 1)
+}
+
+// WithContext 用于生成一个HTTP请求附加了给定上下文的请求副本。
+// 副本会保留原请求的ID、深度和下载尝试次数。
+func (req *Request) WithContext(ctx context.Context) *Request {
+	copied := &Request{id: req.id, depth: req.depth, attempt: req.Attempt()}
+	if req.httpReq != nil {
+		copied.httpReq = req.httpReq.WithContext(ctx)
+	}
+	return copied
+}
+
 // Valid 用于判断请求是否有效。
 func (req *Request) Valid() bool {
 	return req.httpReq != nil && req.httpReq.URL != nil
@@ -44,6 +89,8 @@ type Response struct {
 	httpResp *http.Response
 	// depth 代表响应的深度。
 	depth uint32
+	// charset 代表检测到的响应体的原始字符集。
+	charset string
 }
 
 // NewResponse 用于创建一个新的响应实例。
@@ -61,6 +108,17 @@ func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
 
+// Charset 用于获取检测到的响应体的原始字符集。
+// 若结果值为空字符串，则说明未检测到或未经检测。
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+// SetCharset 用于记录检测到的响应体的原始字符集。
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
 // Valid 用于判断响应是否有效。
 func (resp *Response) Valid() bool {
 	return resp.httpResp != nil && resp.httpResp.Body != nil
@@ -73,3 +131,30 @@ type Item map[string]interface{}
 func (item Item) Valid() bool {
 	return item != nil
 }
+
+// CloseItem 用于关闭给定条目中所有实现了io.Closer接口的值，并返回遇到的第一个错误。
+// 条目在被丢弃或处理完毕之后都应被关闭，以释放其中的读取器等值所占用的资源，
+// 比如被放入条目的响应体的临时文件。同一个值只会被关闭一次，即使它出现在多个条目中。
+func CloseItem(items ...Item) error {
+	var firstErr error
+	closed := map[io.Closer]bool{}
+	for _, item := range items {
+		for _, v := range item {
+			closer, ok := v.(io.Closer)
+			if !ok || closer == nil {
+				continue
+			}
+			comparable := reflect.TypeOf(closer).Comparable()
+			if comparable {
+				if closed[closer] {
+					continue
+				}
+				closed[closer] = true
+			}
+			if err := closer.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
@@ -1,6 +1,8 @@
 package module
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 	"testing"
@@ -45,6 +47,31 @@ func TestRequest(t *testing.T) {
 		t.Fatalf("Inconsistent depth for request: expected: %d, actual: %d",
 			expectedDepth, req.Depth())
 	}
+	if req.Attempt() != 0 {
+		t.Fatalf("Inconsistent attempt for request: expected: %d, actual: %d",
+			0, req.Attempt())
+	}
+	if attempt := req.IncrAttempt(); attempt != 1 || req.Attempt() != 1 {
+		t.Fatalf("Inconsistent attempt for request: expected: %d, actual: %d",
+			1, req.Attempt())
+	}
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	copied := req.WithContext(ctx)
+	if copied == req || copied.HTTPReq().Context().Value(ctxKey{}) != "value" {
+		t.Fatal("The context has not been attached to the copied request!")
+	}
+	if copied.ID() != req.ID() {
+		t.Fatalf("Inconsistent ID for copied request: expected: %d, actual: %d",
+			req.ID(), copied.ID())
+	}
+	if copied.Depth() != req.Depth() || copied.Attempt() != req.Attempt() {
+		t.Fatalf("Inconsistent copied request: expected: depth %d, attempt %d, actual: depth %d, attempt %d",
+			req.Depth(), req.Attempt(), copied.Depth(), copied.Attempt())
+	}
+	if another := NewRequest(expectedHTTPReq, expectedDepth); another.ID() == req.ID() {
+		t.Fatalf("Duplicate request ID: %d", req.ID())
+	}
 	expectedHTTPReq.URL = nil
 	req = NewRequest(expectedHTTPReq, expectedDepth)
 	expectedValidity = false
@@ -92,6 +119,16 @@ func TestResponse(t *testing.T) {
 		t.Fatalf("Inconsistent depth for response: expected: %d, actual: %d",
 			expectedDepth, resp.Depth())
 	}
+	if resp.Charset() != "" {
+		t.Fatalf("Inconsistent charset for response: expected: %q, actual: %q",
+			"", resp.Charset())
+	}
+	expectedCharset := "gbk"
+	resp.SetCharset(expectedCharset)
+	if resp.Charset() != expectedCharset {
+		t.Fatalf("Inconsistent charset for response: expected: %q, actual: %q",
+			expectedCharset, resp.Charset())
+	}
 	expectHTTPResp.Body = nil
 	resp = NewResponse(expectHTTPResp, expectedDepth)
 	expectedValidity = false
@@ -128,3 +165,31 @@ func TestItem(t *testing.T) {
 			expectedValidity, valid)
 	}
 }
+
+// countingCloser 代表测试专用的记录关闭次数的关闭器。
+type countingCloser struct {
+	count int
+	err   error
+}
+
+func (closer *countingCloser) Close() error {
+	closer.count++
+	return closer.err
+}
+
+func TestCloseItem(t *testing.T) {
+	shared := &countingCloser{}
+	failed := &countingCloser{err: errors.New("close failed")}
+	item1 := Item{"body": shared, "title": "t"}
+	item2 := Item{"body": shared, "image": failed}
+	if err := CloseItem(item1, item2, nil); err != failed.err {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", failed.err, err)
+	}
+	if shared.count != 1 || failed.count != 1 {
+		t.Fatalf("Inconsistent close count: expected: %d, actual: %d, %d",
+			1, shared.count, failed.count)
+	}
+	if err := CloseItem(Item{"title": "t"}); err != nil {
+		t.Fatalf("An error occurs when closing item: %s", err)
+	}
+}
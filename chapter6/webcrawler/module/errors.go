@@ -4,3 +4,13 @@ import "errors"
 
 // ErrNotFoundModuleInstance 代表未找到组件实例的错误类型。
 var ErrNotFoundModuleInstance = errors.New("not found module instance")
+
+// ErrNoHealthyModuleInstance 代表所有组件实例都已被隔离的错误类型。
+var ErrNoHealthyModuleInstance = errors.New("no healthy module instance")
+
+// IsFieldError 用于判断给定的错误值是否是或包装了条目字段的校验错误。
+// 这类错误源于条目本身而非处理它的组件实例。
+func IsFieldError(err error) bool {
+	var fieldError *FieldError
+	return errors.As(err, &fieldError)
+}
@@ -1,6 +1,7 @@
 package module
 
 import (
+	"context"
 	"sync/atomic"
 )
 
@@ -94,10 +95,10 @@ func (fm *fakeModule) HandlingNumber() uint64 {
 
 func (fm *fakeModule) Counts() Counts {
 	return Counts{
-		fm.CalledCount(),
-		fm.AcceptedCount(),
-		fm.CompletedCount(),
-		fm.HandlingNumber(),
+		CalledCount:    fm.CalledCount(),
+		AcceptedCount:  fm.AcceptedCount(),
+		CompletedCount: fm.CompletedCount(),
+		HandlingNumber: fm.HandlingNumber(),
 	}
 }
 
@@ -182,3 +183,30 @@ func (pipeline *fakePipeline) FailFast() bool {
 func (pipeline *fakePipeline) SetFailFast(failFast bool) {
 	pipeline.failFast = failFast
 }
+
+// NewFakeRequestFilter 用于创建一个仿造的请求过滤器实例。
+// 它会丢弃深度大于参数maxDepth的请求。
+func NewFakeRequestFilter(mid MID, maxDepth uint32) RequestFilter {
+	return &fakeRequestFilter{
+		fakeModule: fakeModule{
+			mid: mid,
+		},
+		maxDepth: maxDepth,
+	}
+}
+
+// fakeRequestFilter 代表请求过滤器的仿造类型。
+type fakeRequestFilter struct {
+	// fakeModule 代表仿造的组件实例。
+	fakeModule
+	// maxDepth 代表允许的最大深度。
+	maxDepth uint32
+}
+
+func (filter *fakeRequestFilter) FilterRequest(
+	ctx context.Context, req *Request) (*Request, error) {
+	if req.Depth() > filter.maxDepth {
+		return nil, nil
+	}
+	return req, nil
+}
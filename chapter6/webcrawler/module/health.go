@@ -0,0 +1,402 @@
+package module
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// CircuitState 代表熔断器状态的类型。
+type CircuitState uint8
+
+// 熔断器状态的常量。
+const (
+	// CIRCUIT_CLOSED 代表闭合状态，即组件实例健康并可以被选择。
+	CIRCUIT_CLOSED CircuitState = 0
+	// CIRCUIT_OPEN 代表断开状态，即组件实例已被隔离。
+	CIRCUIT_OPEN CircuitState = 1
+	// CIRCUIT_HALF_OPEN 代表半开状态，即组件实例正在接受试探。
+	CIRCUIT_HALF_OPEN CircuitState = 2
+)
+
+// String 用于获取熔断器状态的字符串形式。
+func (state CircuitState) String() string {
+	switch state {
+	case CIRCUIT_CLOSED:
+		return "closed"
+	case CIRCUIT_OPEN:
+		return "open"
+	case CIRCUIT_HALF_OPEN:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// HealthOptions 代表组件健康检查的可选项。
+// 值为0的字段会使用相应的默认值。
+type HealthOptions struct {
+	// Types 代表需要进行健康检查的组件类型。若为空，则只检查下载器。
+	Types []Type
+	// WindowSize 代表用于统计的最近调用结果的数量。默认为20。
+	WindowSize uint32
+	// MinCalls 代表进行判断所需的最少调用结果数量。默认为5。
+	MinCalls uint32
+	// MaxErrorRate 代表可容忍的最大错误率，取值范围为(0, 1]。默认为0.5。
+	MaxErrorRate float64
+	// MaxLatency 代表可容忍的最大平均耗时。若为0，则不检查耗时。
+	MaxLatency time.Duration
+	// OpenDuration 代表组件实例被隔离后到接受试探之前的时长。默认为30秒。
+	OpenDuration time.Duration
+	// HalfOpenSuccesses 代表半开状态下恢复健康所需的连续成功次数。默认为1。
+	HalfOpenSuccesses uint32
+}
+
+// 健康检查可选项的默认值。
+const (
+	DEFAULT_HEALTH_WINDOW_SIZE         = 20
+	DEFAULT_HEALTH_MIN_CALLS           = 5
+	DEFAULT_HEALTH_MAX_ERROR_RATE      = 0.5
+	DEFAULT_HEALTH_OPEN_DURATION       = 30 * time.Second
+	DEFAULT_HEALTH_HALF_OPEN_SUCCESSES = 1
+)
+
+// HealthEvent 代表熔断器状态变化的事件。
+type HealthEvent struct {
+	// MID 代表组件ID。
+	MID MID
+	// From 代表原状态。
+	From CircuitState
+	// To 代表新状态。
+	To CircuitState
+	// Reason 代表状态变化的原因。
+	Reason string
+	// Time 代表状态变化的时间。
+	Time time.Time
+}
+
+// String 用于获取事件的字符串形式。
+func (event HealthEvent) String() string {
+	return fmt.Sprintf("module %s: circuit %s -> %s (%s)",
+		event.MID, event.From, event.To, event.Reason)
+}
+
+// HealthSummaryStruct 代表组件健康状况摘要的类型。
+type HealthSummaryStruct struct {
+	ID          MID     `json:"id"`
+	State       string  `json:"state"`
+	Calls       uint32  `json:"calls"`
+	ErrorRate   float64 `json:"error_rate"`
+	AvgLatency  string  `json:"avg_latency"`
+	Quarantines uint64  `json:"quarantines"`
+	LastReason  string  `json:"last_reason,omitempty"`
+}
+
+// HealthChecker 代表组件健康检查器的接口类型。
+// 它维护每个组件实例的熔断器：
+// 在最近的调用中错误率或平均耗时超标的组件实例会被隔离（断开），
+// 隔离一段时间之后会进入半开状态并接受试探，试探成功即恢复（闭合），否则再次被隔离。
+// 该接口的实现类型必须是并发安全的！
+type HealthChecker interface {
+	// Allow 用于判断给定的组件实例当前是否可以被选择。
+	Allow(mid MID) bool
+	// Acquire 用于告知给定的组件实例已被选择。
+	// 处于半开状态的组件实例在被选择后、报告结果之前不会再被选择。
+	Acquire(mid MID)
+	// Report 用于报告给定的组件实例的一次调用的结果。
+	// 参数err为nil即代表成功。
+	Report(mid MID, latency time.Duration, err error)
+	// State 用于获取给定的组件实例的熔断器状态。
+	State(mid MID) CircuitState
+	// Summary 用于获取所有被检查的组件实例的健康状况摘要。
+	Summary() []HealthSummaryStruct
+}
+
+// NewHealthChecker 用于创建一个组件健康检查器。
+// 参数listener代表熔断器状态变化的监听函数，可以为nil。
+// 它会在检查器的锁之外被调用。
+func NewHealthChecker(
+	opts HealthOptions, listener func(event HealthEvent)) (HealthChecker, error) {
+	if opts.MaxErrorRate < 0 || opts.MaxErrorRate > 1 {
+		errMsg := fmt.Sprintf("illegal max error rate: %v", opts.MaxErrorRate)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	if opts.MaxLatency < 0 || opts.OpenDuration < 0 {
+		return nil, errors.NewIllegalParameterError("negative duration")
+	}
+	if opts.WindowSize == 0 {
+		opts.WindowSize = DEFAULT_HEALTH_WINDOW_SIZE
+	}
+	if opts.MinCalls == 0 {
+		opts.MinCalls = DEFAULT_HEALTH_MIN_CALLS
+	}
+	if opts.MinCalls > opts.WindowSize {
+		errMsg := fmt.Sprintf("min calls %d exceeds window size %d",
+			opts.MinCalls, opts.WindowSize)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	if opts.MaxErrorRate == 0 {
+		opts.MaxErrorRate = DEFAULT_HEALTH_MAX_ERROR_RATE
+	}
+	if opts.OpenDuration == 0 {
+		opts.OpenDuration = DEFAULT_HEALTH_OPEN_DURATION
+	}
+	if opts.HalfOpenSuccesses == 0 {
+		opts.HalfOpenSuccesses = DEFAULT_HEALTH_HALF_OPEN_SUCCESSES
+	}
+	types := map[Type]bool{}
+	for _, moduleType := range opts.Types {
+		if !LegalType(moduleType) {
+			errMsg := fmt.Sprintf("illegal module type: %s", moduleType)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		types[moduleType] = true
+	}
+	if len(types) == 0 {
+		types[TYPE_DOWNLOADER] = true
+	}
+	return &myHealthChecker{
+		opts:     opts,
+		types:    types,
+		circuits: map[MID]*circuit{},
+		listener: listener,
+		now:      time.Now,
+	}, nil
+}
+
+// callResult 代表一次调用的结果。
+type callResult struct {
+	// failed 代表是否失败。
+	failed bool
+	// latency 代表耗时。
+	latency time.Duration
+}
+
+// circuit 代表单个组件实例的熔断器。
+type circuit struct {
+	// state 代表状态。
+	state CircuitState
+	// results 代表最近的调用结果，被用作环形缓冲区。
+	results []callResult
+	// next 代表下一个调用结果在环形缓冲区中的位置。
+	next int
+	// openedAt 代表最近一次断开的时间。
+	openedAt time.Time
+	// probing 代表半开状态下是否有试探正在进行。
+	probing bool
+	// successes 代表半开状态下的连续成功次数。
+	successes uint32
+	// quarantines 代表被隔离的次数。
+	quarantines uint64
+	// lastReason 代表最近一次状态变化的原因。
+	lastReason string
+}
+
+// stats 用于统计最近的调用结果。
+func (c *circuit) stats() (calls uint32, errorRate float64, avgLatency time.Duration) {
+	var failures uint32
+	var total time.Duration
+	for _, result := range c.results {
+		if result.failed {
+			failures++
+		}
+		total += result.latency
+	}
+	calls = uint32(len(c.results))
+	if calls == 0 {
+		return
+	}
+	errorRate = float64(failures) / float64(calls)
+	avgLatency = total / time.Duration(calls)
+	return
+}
+
+// myHealthChecker 代表组件健康检查器的实现类型。
+type myHealthChecker struct {
+	// opts 代表可选项。
+	opts HealthOptions
+	// types 代表需要进行健康检查的组件类型。
+	types map[Type]bool
+	// circuits 代表组件ID与熔断器的映射。
+	circuits map[MID]*circuit
+	// listener 代表状态变化的监听函数。
+	listener func(event HealthEvent)
+	// now 代表获取当前时间的函数。
+	now func() time.Time
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+// checked 用于判断给定的组件实例是否需要进行健康检查。
+func (checker *myHealthChecker) checked(mid MID) bool {
+	ok, moduleType := GetType(mid)
+	return ok && checker.types[moduleType]
+}
+
+// getCircuit 用于获取给定组件实例的熔断器，必要时会创建它。调用方需持有锁。
+func (checker *myHealthChecker) getCircuit(mid MID) *circuit {
+	c, ok := checker.circuits[mid]
+	if !ok {
+		c = &circuit{results: make([]callResult, 0, checker.opts.WindowSize)}
+		checker.circuits[mid] = c
+	}
+	return c
+}
+
+// transit 用于改变熔断器的状态并生成事件。调用方需持有锁。
+func (checker *myHealthChecker) transit(
+	mid MID, c *circuit, to CircuitState, reason string) HealthEvent {
+	event := HealthEvent{
+		MID:    mid,
+		From:   c.state,
+		To:     to,
+		Reason: reason,
+		Time:   checker.now(),
+	}
+	c.state = to
+	c.lastReason = reason
+	c.probing = false
+	c.successes = 0
+	switch to {
+	case CIRCUIT_OPEN:
+		c.openedAt = event.Time
+		c.quarantines++
+	case CIRCUIT_CLOSED:
+		c.results = c.results[:0]
+		c.next = 0
+	}
+	return event
+}
+
+// notify 用于通知监听函数。
+func (checker *myHealthChecker) notify(events []HealthEvent) {
+	if checker.listener == nil {
+		return
+	}
+	for _, event := range events {
+		checker.listener(event)
+	}
+}
+
+func (checker *myHealthChecker) Allow(mid MID) bool {
+	if !checker.checked(mid) {
+		return true
+	}
+	var events []HealthEvent
+	allowed := false
+	checker.lock.Lock()
+	c := checker.getCircuit(mid)
+	switch c.state {
+	case CIRCUIT_CLOSED:
+		allowed = true
+	case CIRCUIT_OPEN:
+		if checker.now().Sub(c.openedAt) >= checker.opts.OpenDuration {
+			events = append(events,
+				checker.transit(mid, c, CIRCUIT_HALF_OPEN, "probing after quarantine"))
+			allowed = true
+		}
+	case CIRCUIT_HALF_OPEN:
+		allowed = !c.probing
+	}
+	checker.lock.Unlock()
+	checker.notify(events)
+	return allowed
+}
+
+func (checker *myHealthChecker) Acquire(mid MID) {
+	if !checker.checked(mid) {
+		return
+	}
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	c := checker.getCircuit(mid)
+	if c.state == CIRCUIT_HALF_OPEN {
+		c.probing = true
+	}
+}
+
+func (checker *myHealthChecker) Report(mid MID, latency time.Duration, err error) {
+	if !checker.checked(mid) {
+		return
+	}
+	var events []HealthEvent
+	checker.lock.Lock()
+	c := checker.getCircuit(mid)
+	switch c.state {
+	case CIRCUIT_CLOSED:
+		result := callResult{failed: err != nil, latency: latency}
+		if len(c.results) < cap(c.results) {
+			c.results = append(c.results, result)
+		} else {
+			c.results[c.next] = result
+		}
+		c.next = (c.next + 1) % cap(c.results)
+		calls, errorRate, avgLatency := c.stats()
+		if calls >= checker.opts.MinCalls {
+			var reason string
+			if errorRate >= checker.opts.MaxErrorRate {
+				reason = fmt.Sprintf("error rate %.2f in last %d calls", errorRate, calls)
+				if err != nil {
+					reason += fmt.Sprintf(", last error: %s", err)
+				}
+			} else if checker.opts.MaxLatency > 0 && avgLatency > checker.opts.MaxLatency {
+				reason = fmt.Sprintf("average latency %s in last %d calls", avgLatency, calls)
+			}
+			if reason != "" {
+				events = append(events, checker.transit(mid, c, CIRCUIT_OPEN, reason))
+			}
+		}
+	case CIRCUIT_HALF_OPEN:
+		c.probing = false
+		if err != nil {
+			events = append(events, checker.transit(mid, c, CIRCUIT_OPEN,
+				fmt.Sprintf("probe failed: %s", err)))
+			break
+		}
+		if checker.opts.MaxLatency > 0 && latency > checker.opts.MaxLatency {
+			events = append(events, checker.transit(mid, c, CIRCUIT_OPEN,
+				fmt.Sprintf("probe too slow: %s", latency)))
+			break
+		}
+		c.successes++
+		if c.successes >= checker.opts.HalfOpenSuccesses {
+			events = append(events, checker.transit(mid, c, CIRCUIT_CLOSED, "probe succeeded"))
+		}
+	}
+	// 处于断开状态时到达的结果来自被隔离之前的调用，忽略即可。
+	checker.lock.Unlock()
+	checker.notify(events)
+}
+
+func (checker *myHealthChecker) State(mid MID) CircuitState {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	if c, ok := checker.circuits[mid]; ok {
+		return c.state
+	}
+	return CIRCUIT_CLOSED
+}
+
+func (checker *myHealthChecker) Summary() []HealthSummaryStruct {
+	checker.lock.Lock()
+	defer checker.lock.Unlock()
+	summaries := make([]HealthSummaryStruct, 0, len(checker.circuits))
+	for mid, c := range checker.circuits {
+		calls, errorRate, avgLatency := c.stats()
+		summaries = append(summaries, HealthSummaryStruct{
+			ID:          mid,
+			State:       c.state.String(),
+			Calls:       calls,
+			ErrorRate:   errorRate,
+			AvgLatency:  avgLatency.String(),
+			Quarantines: c.quarantines,
+			LastReason:  c.lastReason,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].ID < summaries[j].ID
+	})
+	return summaries
+}
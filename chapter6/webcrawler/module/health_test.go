@@ -0,0 +1,167 @@
+package module
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock 代表可以手动调整的时钟。
+type fakeClock struct {
+	now time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	return clock.now
+}
+
+// newTestHealthChecker 用于创建使用仿造时钟的健康检查器。
+func newTestHealthChecker(
+	opts HealthOptions, t *testing.T) (*myHealthChecker, *fakeClock, *[]HealthEvent) {
+	events := &[]HealthEvent{}
+	checker, err := NewHealthChecker(opts, func(event HealthEvent) {
+		*events = append(*events, event)
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating health checker: %s", err)
+	}
+	clock := &fakeClock{now: time.Unix(1500000000, 0)}
+	hc := checker.(*myHealthChecker)
+	hc.now = clock.Now
+	return hc, clock, events
+}
+
+func TestHealthCheckerNew(t *testing.T) {
+	invalidOptsList := []HealthOptions{
+		{MaxErrorRate: -0.1},
+		{MaxErrorRate: 1.1},
+		{MaxLatency: -time.Second},
+		{OpenDuration: -time.Second},
+		{WindowSize: 3, MinCalls: 4},
+		{Types: []Type{"X"}},
+	}
+	for _, opts := range invalidOptsList {
+		if _, err := NewHealthChecker(opts, nil); err == nil {
+			t.Fatalf("No error when creating health checker with illegal options %#v!", opts)
+		}
+	}
+}
+
+func TestHealthCheckerCircuit(t *testing.T) {
+	opts := HealthOptions{
+		WindowSize:   4,
+		MinCalls:     4,
+		MaxErrorRate: 0.5,
+		OpenDuration: time.Minute,
+	}
+	checker, clock, events := newTestHealthChecker(opts, t)
+	mid := MID("D1")
+	failure := errors.New("failure")
+	checker.Report(mid, time.Millisecond, nil)
+	checker.Report(mid, time.Millisecond, failure)
+	checker.Report(mid, time.Millisecond, nil)
+	if checker.State(mid) != CIRCUIT_CLOSED || !checker.Allow(mid) {
+		t.Fatal("The circuit is opened before enough calls!")
+	}
+	checker.Report(mid, time.Millisecond, failure)
+	if checker.State(mid) != CIRCUIT_OPEN {
+		t.Fatalf("Inconsistent state: expected: %s, actual: %s",
+			CIRCUIT_OPEN, checker.State(mid))
+	}
+	if checker.Allow(mid) {
+		t.Fatal("The quarantined module is allowed!")
+	}
+	if len(*events) != 1 || (*events)[0].To != CIRCUIT_OPEN {
+		t.Fatalf("Inconsistent events: %v", *events)
+	}
+	// 隔离时长过后进入半开状态，且只允许一个试探。
+	clock.now = clock.now.Add(time.Minute)
+	if !checker.Allow(mid) {
+		t.Fatal("The module is not allowed after quarantine!")
+	}
+	if checker.State(mid) != CIRCUIT_HALF_OPEN {
+		t.Fatalf("Inconsistent state: expected: %s, actual: %s",
+			CIRCUIT_HALF_OPEN, checker.State(mid))
+	}
+	checker.Acquire(mid)
+	if checker.Allow(mid) {
+		t.Fatal("More than one probe is allowed!")
+	}
+	// 试探失败后再次被隔离。
+	checker.Report(mid, time.Millisecond, failure)
+	if checker.State(mid) != CIRCUIT_OPEN {
+		t.Fatalf("Inconsistent state: expected: %s, actual: %s",
+			CIRCUIT_OPEN, checker.State(mid))
+	}
+	clock.now = clock.now.Add(time.Minute)
+	checker.Allow(mid)
+	checker.Acquire(mid)
+	checker.Report(mid, time.Millisecond, nil)
+	if checker.State(mid) != CIRCUIT_CLOSED {
+		t.Fatalf("Inconsistent state: expected: %s, actual: %s",
+			CIRCUIT_CLOSED, checker.State(mid))
+	}
+	expectedStates := []CircuitState{
+		CIRCUIT_OPEN, CIRCUIT_HALF_OPEN, CIRCUIT_OPEN, CIRCUIT_HALF_OPEN, CIRCUIT_CLOSED}
+	if len(*events) != len(expectedStates) {
+		t.Fatalf("Inconsistent event number: expected: %d, actual: %d",
+			len(expectedStates), len(*events))
+	}
+	for i, event := range *events {
+		if event.To != expectedStates[i] {
+			t.Fatalf("Inconsistent state of event %d: expected: %s, actual: %s",
+				i, expectedStates[i], event.To)
+		}
+	}
+	summaries := checker.Summary()
+	if len(summaries) != 1 || summaries[0].Quarantines != 2 ||
+		summaries[0].State != CIRCUIT_CLOSED.String() {
+		t.Fatalf("Inconsistent health summaries: %#v", summaries)
+	}
+}
+
+func TestHealthCheckerLatency(t *testing.T) {
+	opts := HealthOptions{MinCalls: 2, MaxLatency: 100 * time.Millisecond}
+	checker, _, _ := newTestHealthChecker(opts, t)
+	mid := MID("D1")
+	checker.Report(mid, 50*time.Millisecond, nil)
+	checker.Report(mid, 300*time.Millisecond, nil)
+	if checker.State(mid) != CIRCUIT_OPEN {
+		t.Fatalf("Inconsistent state: expected: %s, actual: %s",
+			CIRCUIT_OPEN, checker.State(mid))
+	}
+	// 默认只检查下载器。
+	analyzerMID := MID("A1")
+	for i := 0; i < 10; i++ {
+		checker.Report(analyzerMID, time.Millisecond, errors.New("failure"))
+	}
+	if !checker.Allow(analyzerMID) || checker.State(analyzerMID) != CIRCUIT_CLOSED {
+		t.Fatal("The unchecked module is quarantined!")
+	}
+}
+
+func TestRegistrarHealthChecker(t *testing.T) {
+	checker, _, _ := newTestHealthChecker(HealthOptions{MinCalls: 1}, t)
+	registrar := NewRegistrarWithChecker(NewRoundRobinBalancer(), checker)
+	if registrar.HealthChecker() == nil {
+		t.Fatal("Couldn't get the health checker of registrar!")
+	}
+	mids := []MID{"D1", "D2"}
+	for _, mid := range mids {
+		registrar.Register(NewFakeDownloader(mid, CalculateScoreSimple))
+	}
+	checker.Report("D1", time.Millisecond, errors.New("failure"))
+	for i := 0; i < 4; i++ {
+		m, err := registrar.Get(TYPE_DOWNLOADER)
+		if err != nil {
+			t.Fatalf("An error occurs when getting module instance: %s", err)
+		}
+		if m.ID() != "D2" {
+			t.Fatalf("The quarantined module %s is selected!", m.ID())
+		}
+	}
+	checker.Report("D2", time.Millisecond, errors.New("failure"))
+	if _, err := registrar.Get(TYPE_DOWNLOADER); err != ErrNoHealthyModuleInstance {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrNoHealthyModuleInstance, err)
+	}
+}
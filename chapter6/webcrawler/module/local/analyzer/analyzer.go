@@ -1,9 +1,14 @@
 package analyzer
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"time"
+
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/stub"
+	"gopcp.v2/chapter6/webcrawler/toolkit/charset"
 	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
 	"gopcp.v2/helper/log"
 )
@@ -11,11 +16,29 @@ import (
 // logger 代表日志记录器。
 var logger = log.DLogger()
 
+// Options 代表分析器的选项。
+type Options struct {
+	// Reader 代表读取HTTP响应体时使用的多重读取器的选项。
+	Reader reader.Options
+	// NoTranscoding 代表是否禁用字符集的检测和转码。
+	// 默认情况下，文本类型的响应体会在交给响应解析函数之前被转换为UTF-8编码。
+	NoTranscoding bool
+}
+
 // New 用于创建一个分析器实例。
 func New(
 	mid module.MID,
 	respParsers []module.ParseResponse,
 	scoreCalculator module.CalculateScore) (module.Analyzer, error) {
+	return NewWithOptions(mid, respParsers, scoreCalculator, Options{})
+}
+
+// NewWithOptions 用于根据给定的选项创建一个分析器实例。
+func NewWithOptions(
+	mid module.MID,
+	respParsers []module.ParseResponse,
+	scoreCalculator module.CalculateScore,
+	opts Options) (module.Analyzer, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -33,9 +56,18 @@ func New(
 		}
 		innerParsers = append(innerParsers, parser)
 	}
+	if opts.Reader.MaxSize < 0 {
+		return nil, genParameterError(
+			fmt.Sprintf("negative max body size: %d", opts.Reader.MaxSize))
+	}
+	if opts.Reader.MemoryThreshold < 0 {
+		return nil, genParameterError(
+			fmt.Sprintf("negative memory threshold: %d", opts.Reader.MemoryThreshold))
+	}
 	return &myAnalyzer{
 		ModuleInternal: moduleBase,
 		respParsers:    innerParsers,
+		opts:           opts,
 	}, nil
 }
 
@@ -45,6 +77,8 @@ type myAnalyzer struct {
 	stub.ModuleInternal
 	// respParsers 代表响应解析器列表。
 	respParsers []module.ParseResponse
+	// opts 代表选项。
+	opts Options
 }
 
 func (analyzer *myAnalyzer) RespParsers() []module.ParseResponse {
@@ -55,6 +89,26 @@ func (analyzer *myAnalyzer) RespParsers() []module.ParseResponse {
 
 func (analyzer *myAnalyzer) Analyze(
 	resp *module.Response) (dataList []module.Data, errorList []error) {
+	return analyzer.analyze(nil, resp)
+}
+
+// AnalyzeContext 会在调用每个响应解析函数之前检查给定的上下文。
+// 上下文被取消或超时的时候，后续的响应解析函数都会被忽略。
+func (analyzer *myAnalyzer) AnalyzeContext(
+	ctx context.Context,
+	resp *module.Response) (dataList []module.Data, errorList []error) {
+	if ctx == nil {
+		errorList = append(errorList, genParameterError("nil context"))
+		return
+	}
+	return analyzer.analyze(ctx, resp)
+}
+
+// analyze 用于执行分析。
+// 若参数ctx为nil，则不检查上下文。
+func (analyzer *myAnalyzer) analyze(
+	ctx context.Context,
+	resp *module.Response) (dataList []module.Data, errorList []error) {
 
 	analyzer.ModuleInternal.IncrHandlingNumber()
 	defer analyzer.ModuleInternal.DecrHandlingNumber()
@@ -85,6 +139,13 @@ func (analyzer *myAnalyzer) Analyze(
 	}
 	//当参数没有错误，开始接受处理
 	analyzer.ModuleInternal.IncrAcceptedCount()
+	startTime := time.Now()
+	defer func() {
+		analyzer.ModuleInternal.RecordLatency(time.Since(startTime))
+		if len(errorList) > 0 {
+			analyzer.ModuleInternal.IncrFailedCount()
+		}
+	}()
 	respDepth := resp.Depth()
 	logger.Infof("Parse the response (URL: %s, depth: %d)... \n",
 		reqURL, respDepth)
@@ -94,16 +155,33 @@ func (analyzer *myAnalyzer) Analyze(
 		defer httpResp.Body.Close()
 	}
 	//创建一个多重读取器
-	multipleReader, err := reader.NewMultipleReader(httpResp.Body)
+	//只有在响应解析函数读取响应体时才会真正读取数据，超出内存阈值的部分会被写入临时文件
+	multipleReader, err := reader.NewSpoolingMultipleReader(httpResp.Body, analyzer.opts.Reader)
 	if err != nil {
 		errorList = append(errorList, genError(err.Error()))
 		return
 	}
+	defer multipleReader.Close()
+	// 检测字符集，并在必要时把响应体转换为UTF-8编码。
+	var srcCharset string
+	if !analyzer.opts.NoTranscoding {
+		srcCharset = detectCharset(resp, multipleReader)
+	}
 	dataList = []module.Data{}
 	for _, respParser := range analyzer.respParsers {
+		if ctx != nil && ctx.Err() != nil {
+			errorList = append(errorList, genError(
+				fmt.Sprintf("analysis aborted: %s (URL: %s)", ctx.Err(), reqURL)))
+			break
+		}
 		//从多重读取器拿到读取器
-		httpResp.Body = multipleReader.Reader()
+		body := newBody(multipleReader, srcCharset)
+		httpResp.Body = body
 		pDataList, pErrorList := respParser(httpResp, respDepth)
+		//被放入条目的读取器会在条目被处理完毕或被丢弃之后关闭
+		if !escaped(body, pDataList) {
+			body.Close()
+		}
 		if pDataList != nil {
 			for _, pData := range pDataList {
 				if pData == nil {
@@ -128,6 +206,72 @@ func (analyzer *myAnalyzer) Analyze(
 	return dataList, errorList
 }
 
+// detectCharset 用于检测文本类型的响应体的字符集，并把结果记录在响应上。
+// 若响应体需要且可以被转码，则结果值为其原始字符集，否则为空字符串。
+// 需要转码时，HTTP响应头中的Content-Type会被改为UTF-8字符集。
+func detectCharset(resp *module.Response, multipleReader reader.MultipleReader) string {
+	httpResp := resp.HTTPResp()
+	contentType := httpResp.Header.Get("Content-Type")
+	if !charset.IsText(contentType) {
+		return ""
+	}
+	headReader := multipleReader.Reader()
+	head := make([]byte, 1024)
+	n, _ := io.ReadFull(headReader, head)
+	headReader.Close()
+	cs, source := charset.Detect(contentType, head[:n])
+	if cs == "" {
+		return ""
+	}
+	resp.SetCharset(cs)
+	if cs == charset.UTF8 && source != charset.SOURCE_BOM {
+		return ""
+	}
+	if !charset.Supported(cs) {
+		logger.Warnf("Unsupported charset %q detected from %s! Keep the original body. (URL: %s)",
+			cs, source, httpResp.Request.URL)
+		return ""
+	}
+	httpResp.Header.Set("Content-Type", charset.ReplaceCharset(contentType, charset.UTF8))
+	return cs
+}
+
+// newBody 用于从多重读取器获取一个响应体。
+// 若参数srcCharset不为空，则该响应体会把数据从该字符集转换为UTF-8编码。
+func newBody(multipleReader reader.MultipleReader, srcCharset string) io.ReadCloser {
+	body := multipleReader.Reader()
+	if srcCharset == "" {
+		return body
+	}
+	decoded, err := charset.NewReader(body, srcCharset)
+	if err != nil {
+		return body
+	}
+	return &decodedBody{Reader: decoded, Closer: body}
+}
+
+// decodedBody 代表经过转码的响应体。
+type decodedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// escaped 用于判断给定的读取器是否被放入了某个条目。
+func escaped(body io.ReadCloser, dataList []module.Data) bool {
+	for _, data := range dataList {
+		item, ok := data.(module.Item)
+		if !ok {
+			continue
+		}
+		for _, v := range item {
+			if rc, ok := v.(io.ReadCloser); ok && rc == body {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // appendDataList 用于添加请求值或条目值到列表。
 func appendDataList(dataList []module.Data, data module.Data, respDepth uint32) []module.Data {
 	if data == nil {
@@ -2,7 +2,10 @@ package analyzer
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,6 +13,7 @@ import (
 
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/stub"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
 )
 
 // testingReader 代表测试专用的读取器，实现了io.ReadCloser接口类型。
@@ -163,6 +167,162 @@ func TestAnalyze(t *testing.T) {
 	}
 }
 
+func TestAnalyzeContext(t *testing.T) {
+	resps := getTestingResps(2, "GET", "https://github.com/gopcp", 1, t)
+	mid := module.MID("A1|127.0.0.1:8080")
+	parsers := []module.ParseResponse{genTestingRespParser(false)}
+	a, err := New(mid, parsers, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s (mid: %s)",
+			err, mid)
+	}
+	ca, ok := a.(module.ContextAnalyzer)
+	if !ok {
+		t.Fatalf("The analyzer %T doesn't implement module.ContextAnalyzer!", a)
+	}
+	data, errs := ca.AnalyzeContext(context.Background(), resps[0])
+	if len(errs) != 0 {
+		t.Fatalf("An error occurs when analyzing with context: %s", errs[0])
+	}
+	if len(data) == 0 {
+		t.Fatal("No data when analyzing with context!")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data, errs = ca.AnalyzeContext(ctx, resps[1])
+	if len(errs) == 0 {
+		t.Fatal("No error when analyzing with canceled context!")
+	}
+	if len(data) != 0 {
+		t.Fatalf("It still can parse the response with canceled context! (data: %#v)", data)
+	}
+	_, errs = ca.AnalyzeContext(nil, resps[1])
+	if len(errs) == 0 {
+		t.Fatal("No error when analyzing with nil context!")
+	}
+}
+
+func TestAnalyzeWithOptions(t *testing.T) {
+	mid := module.MID("A1|127.0.0.1:8080")
+	parsers := []module.ParseResponse{genTestingRespParser(false)}
+	invalidOptsList := []Options{
+		{Reader: reader.Options{MaxSize: -1}},
+		{Reader: reader.Options{MemoryThreshold: -1}},
+	}
+	for _, opts := range invalidOptsList {
+		if _, err := NewWithOptions(mid, parsers, nil, opts); err == nil {
+			t.Fatalf("No error when create an analyzer with illegal options %#v!", opts)
+		}
+	}
+	// 测试响应体超出最大尺寸的情况。
+	opts := Options{Reader: reader.Options{MaxSize: 8}}
+	a, err := NewWithOptions(mid, parsers, nil, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s (mid: %s)",
+			err, mid)
+	}
+	resps := getTestingResps(1, "GET", "https://github.com/gopcp", 1, t)
+	if _, errs := a.Analyze(resps[0]); len(errs) == 0 {
+		t.Fatal("No error when analyze response with too large body!")
+	}
+	// 测试被放入条目的读取器在分析结束之后仍然可用。
+	var bodies []io.ReadCloser
+	keepBody := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		bodies = append(bodies, httpResp.Body)
+		return []module.Data{module.Item{"reader": httpResp.Body}}, nil
+	}
+	skipBody := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		bodies = append(bodies, httpResp.Body)
+		return nil, nil
+	}
+	a, _ = NewWithOptions(mid, []module.ParseResponse{keepBody, skipBody}, nil, Options{})
+	resps = getTestingResps(1, "GET", "https://github.com/gopcp", 1, t)
+	if _, errs := a.Analyze(resps[0]); len(errs) != 0 {
+		t.Fatalf("An error occurs when analyzing response: %s", errs[0])
+	}
+	data, err := ioutil.ReadAll(bodies[0])
+	if err != nil {
+		t.Fatalf("An error occurs when reading the kept body: %s", err)
+	}
+	expectedBody := fmt.Sprintf(fakeHTTPRespBody, 0)
+	if string(data) != expectedBody {
+		t.Fatalf("Inconsistent kept body: expected: %s, actual: %s", expectedBody, data)
+	}
+	bodies[0].Close()
+	if _, err := bodies[1].Read(make([]byte, 1)); err == nil {
+		t.Fatal("The skipped body has not been closed!")
+	}
+}
+
+func TestAnalyzeCharset(t *testing.T) {
+	var titles []string
+	parseTitle := func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		data, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, []error{err}
+		}
+		titles = append(titles, string(data))
+		return nil, nil
+	}
+	mid := module.MID("A1|127.0.0.1:8080")
+	a, _ := New(mid, []module.ParseResponse{parseTitle}, nil)
+	cases := []struct {
+		contentType     string
+		body            string
+		expectedCharset string
+		expectedBody    string
+	}{
+		{"text/html; charset=ISO-8859-1", "caf\xE9", "iso-8859-1", "café"},
+		{"text/html", "<meta charset=\"windows-1252\">\x93", "windows-1252",
+			"<meta charset=\"windows-1252\">“"},
+		{"text/html; charset=utf-8", "\xEF\xBB\xBF世界", "utf-8", "世界"},
+		{"text/html; charset=GBK", "<title>\xD6\xD0\xCE\xC4</title>", "gbk",
+			"<title>中文</title>"},
+		{"text/html", "<meta charset=\"gb2312\"><p>\xC4\xE3\xBA\xC3</p>", "gbk",
+			"<meta charset=\"gb2312\"><p>你好</p>"},
+		{"text/html; charset=big5", "<title>\xA4\xA4\xA4\xE5</title>", "big5",
+			"<title>中文</title>"},
+		{"text/html", "<meta http-equiv=\"Content-Type\" content=\"text/html; charset=Shift_JIS\">" +
+			"\x93\xFA\x96\x7B\x8C\xEA", "shift_jis",
+			"<meta http-equiv=\"Content-Type\" content=\"text/html; charset=Shift_JIS\">日本語"},
+		{"image/png", "caf\xE9", "", "caf\xE9"},
+	}
+	httpReq, _ := http.NewRequest("GET", "https://github.com/gopcp", nil)
+	for _, c := range cases {
+		titles = nil
+		httpResp := &http.Response{
+			Request: httpReq,
+			Header:  http.Header{"Content-Type": {c.contentType}},
+			Body:    testingReader{strings.NewReader(c.body)},
+		}
+		resp := module.NewResponse(httpResp, 0)
+		if _, errs := a.Analyze(resp); len(errs) != 0 {
+			t.Fatalf("An error occurs when analyzing response: %s", errs[0])
+		}
+		if resp.Charset() != c.expectedCharset {
+			t.Fatalf("Inconsistent charset: expected: %q, actual: %q",
+				c.expectedCharset, resp.Charset())
+		}
+		if len(titles) != 1 || titles[0] != c.expectedBody {
+			t.Fatalf("Inconsistent body: expected: %q, actual: %q",
+				c.expectedBody, titles)
+		}
+	}
+	// 测试禁用转码的情况。
+	a, _ = NewWithOptions(mid, []module.ParseResponse{parseTitle}, nil,
+		Options{NoTranscoding: true})
+	titles = nil
+	httpResp := &http.Response{
+		Request: httpReq,
+		Header:  http.Header{"Content-Type": {"text/html; charset=ISO-8859-1"}},
+		Body:    testingReader{strings.NewReader("caf\xE9")},
+	}
+	a.Analyze(module.NewResponse(httpResp, 0))
+	if len(titles) != 1 || titles[0] != "caf\xE9" {
+		t.Fatalf("The body was transcoded with transcoding disabled! (body: %q)", titles)
+	}
+}
+
 func TestCount(t *testing.T) {
 	mid := module.MID("D1|127.0.0.1:8080")
 	// 测试初始化后的计数。
@@ -207,6 +367,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, ai.HandlingNumber())
 	}
+	if ai.Counts().FailedCount != 1 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			1, ai.Counts().FailedCount)
+	}
 	// 测试参数有误时的计数。
 	parsers = []module.ParseResponse{genTestingRespParser(false)}
 	a, _ = New(mid, parsers, nil)
@@ -229,6 +393,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, ai.HandlingNumber())
 	}
+	if ai.Counts().FailedCount != 0 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			0, ai.Counts().FailedCount)
+	}
 	// 测试处理成功完成时的计数。
 	parsers = []module.ParseResponse{genTestingRespParser(false)}
 	a, _ = New(mid, parsers, nil)
@@ -251,6 +419,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, ai.HandlingNumber())
 	}
+	if ai.Counts().FailedCount != 0 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			0, ai.Counts().FailedCount)
+	}
 }
 
 // fakeHTTPRespBody 代表伪造的HTTP响应体的模板。
@@ -0,0 +1,479 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// RuleSet 代表声明式的提取规则集。
+// 每个规则都会被应用于URL与之匹配的HTML响应，
+// 从中提取出条目以及需要跟进的链接。
+//
+// JSON格式的示例如下：
+//
+//	{
+//	    "rules": [{
+//	        "name": "article",
+//	        "url_pattern": "^https?://example\\.com/articles/",
+//	        "item": {
+//	            "selector": "article",
+//	            "url_field": "url",
+//	            "fields": [
+//	                {"name": "title", "selector": "h1", "required": true},
+//	                {"name": "id", "selector": "a.permalink", "attr": "href",
+//	                 "regexp": "/articles/(\\d+)"},
+//	                {"name": "tags", "selector": ".tag", "multiple": true}
+//	            ]
+//	        },
+//	        "follow": [
+//	            {"selector": "a.next"},
+//	            {"selector": "a", "pattern": "/articles/\\d+$"}
+//	        ]
+//	    }]
+//	}
+type RuleSet struct {
+	// Rules 代表规则列表。
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule 代表针对某类页面的提取规则。
+type Rule struct {
+	// Name 代表规则的名称，会出现在错误信息中。
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// URLPattern 代表用于匹配请求URL的正则表达式。若为空，则匹配所有URL。
+	URLPattern string `json:"url_pattern,omitempty" yaml:"url_pattern,omitempty"`
+	// Item 代表条目的提取规则。若为nil，则不提取条目。
+	Item *ItemRule `json:"item,omitempty" yaml:"item,omitempty"`
+	// Follow 代表需要跟进的链接的提取规则。
+	Follow []LinkRule `json:"follow,omitempty" yaml:"follow,omitempty"`
+}
+
+// ItemRule 代表条目的提取规则。
+type ItemRule struct {
+	// Selector 代表条目根元素的CSS选择器，每个匹配的元素都会生成一个条目。
+	// 若为空，则整个页面只生成一个条目。
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// URLField 代表用于保存页面URL的字段的名称。若为空，则不保存。
+	URLField string `json:"url_field,omitempty" yaml:"url_field,omitempty"`
+	// Fields 代表条目中各个字段的提取规则。
+	Fields []FieldRule `json:"fields" yaml:"fields"`
+}
+
+// FieldRule 代表条目字段的提取规则。
+type FieldRule struct {
+	// Name 代表字段的名称。
+	Name string `json:"name" yaml:"name"`
+	// Selector 代表相对于条目根元素的CSS选择器。若为空，则使用条目根元素本身。
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// Attr 代表需要提取的属性。若为空，则提取元素的文本。
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	// AbsURL 代表是否需要把提取出的值解析为绝对URL。
+	AbsURL bool `json:"abs_url,omitempty" yaml:"abs_url,omitempty"`
+	// Regexp 代表用于后处理的正则表达式。
+	// 若Replace为空，则提取第一个子匹配，没有子匹配时提取整个匹配；
+	// 不匹配的值会被忽略。
+	Regexp string `json:"regexp,omitempty" yaml:"regexp,omitempty"`
+	// Replace 代表替换模板，例如“$1-$2”。
+	// 若不为空，则用它替换值中所有与Regexp匹配的部分。
+	Replace string `json:"replace,omitempty" yaml:"replace,omitempty"`
+	// Multiple 代表是否提取所有匹配的元素。
+	// 若为true，则字段的值为[]string类型，否则为string类型且只使用第一个匹配的元素。
+	Multiple bool `json:"multiple,omitempty" yaml:"multiple,omitempty"`
+	// Required 代表字段是否必须有值。
+	// 缺少必需字段的条目会被丢弃，并产生一个错误。
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// LinkRule 代表需要跟进的链接的提取规则。
+type LinkRule struct {
+	// Selector 代表链接所在元素的CSS选择器。
+	Selector string `json:"selector" yaml:"selector"`
+	// Attr 代表链接所在的属性。若为空，则使用href。
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	// Pattern 代表绝对URL必须匹配的正则表达式。若为空，则不做限制。
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+}
+
+// LoadRuleSet 用于解析和检查规则集。
+// 参数unmarshal代表反序列化函数，例如某个YAML库的Unmarshal函数。
+// 若它为nil，则按照JSON格式解析，并且不允许出现未知的字段。
+func LoadRuleSet(
+	data []byte, unmarshal func(data []byte, v interface{}) error) (*RuleSet, error) {
+	var ruleSet RuleSet
+	if unmarshal == nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&ruleSet); err != nil {
+			return nil, genParameterError(fmt.Sprintf("invalid rule set: %s", err))
+		}
+	} else if err := unmarshal(data, &ruleSet); err != nil {
+		return nil, genParameterError(fmt.Sprintf("invalid rule set: %s", err))
+	}
+	if _, err := ruleSet.compile(); err != nil {
+		return nil, err
+	}
+	return &ruleSet, nil
+}
+
+// Check 用于检查规则集。错误信息会指出有问题的规则，例如“rules[1].item.fields[0]”。
+func (ruleSet *RuleSet) Check() error {
+	_, err := ruleSet.compile()
+	return err
+}
+
+// NewRuleParser 用于根据规则集生成响应解析函数。
+func NewRuleParser(ruleSet RuleSet) (module.ParseResponse, error) {
+	rules, err := ruleSet.compile()
+	if err != nil {
+		return nil, err
+	}
+	return func(httpResp *http.Response, respDepth uint32) ([]module.Data, []error) {
+		return parseByRules(rules, httpResp, respDepth)
+	}, nil
+}
+
+// NewWithRules 用于创建一个根据规则集提取数据的分析器实例。
+func NewWithRules(
+	mid module.MID,
+	ruleSet RuleSet,
+	scoreCalculator module.CalculateScore,
+	opts Options) (module.Analyzer, error) {
+	parser, err := NewRuleParser(ruleSet)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithOptions(mid, []module.ParseResponse{parser}, scoreCalculator, opts)
+}
+
+// compiledRule 代表编译后的规则。
+type compiledRule struct {
+	Rule
+	// path 代表规则在规则集中的位置。
+	path string
+	// urlRegexp 代表编译后的URLPattern。
+	urlRegexp *regexp.Regexp
+	// fieldRegexps 代表各个字段编译后的Regexp。
+	fieldRegexps []*regexp.Regexp
+	// linkRegexps 代表各个链接规则编译后的Pattern。
+	linkRegexps []*regexp.Regexp
+}
+
+// compile 用于检查并编译规则集。
+func (ruleSet *RuleSet) compile() ([]*compiledRule, error) {
+	if len(ruleSet.Rules) == 0 {
+		return nil, genParameterError("empty rule list")
+	}
+	var rules []*compiledRule
+	for i, rule := range ruleSet.Rules {
+		path := fmt.Sprintf("rules[%d]", i)
+		if rule.Name != "" {
+			path = fmt.Sprintf("%s (%s)", path, rule.Name)
+		}
+		compiled, err := compileRule(rule, path)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled)
+	}
+	return rules, nil
+}
+
+// compileRule 用于检查并编译单个规则。参数path代表规则的位置。
+func compileRule(rule Rule, path string) (*compiledRule, error) {
+	ruleError := func(subPath string, format string, args ...interface{}) error {
+		return genParameterError(fmt.Sprintf("%s%s: %s", path, subPath,
+			fmt.Sprintf(format, args...)))
+	}
+	compiled := &compiledRule{Rule: rule, path: path}
+	if rule.Item == nil && len(rule.Follow) == 0 {
+		return nil, ruleError("", "neither item nor follow is specified")
+	}
+	var err error
+	if rule.URLPattern != "" {
+		if compiled.urlRegexp, err = regexp.Compile(rule.URLPattern); err != nil {
+			return nil, ruleError(".url_pattern", "%s", err)
+		}
+	}
+	if rule.Item != nil {
+		if rule.Item.Selector != "" {
+			if err := checkSelector(rule.Item.Selector); err != nil {
+				return nil, ruleError(".item.selector", "%s", err)
+			}
+		}
+		if len(rule.Item.Fields) == 0 {
+			return nil, ruleError(".item.fields", "empty field list")
+		}
+		names := map[string]bool{rule.Item.URLField: rule.Item.URLField != ""}
+		for i, field := range rule.Item.Fields {
+			subPath := fmt.Sprintf(".item.fields[%d]", i)
+			if field.Name == "" {
+				return nil, ruleError(subPath, "empty field name")
+			}
+			subPath = fmt.Sprintf("%s (%s)", subPath, field.Name)
+			if names[field.Name] {
+				return nil, ruleError(subPath, "duplicate field name")
+			}
+			names[field.Name] = true
+			if field.Selector != "" {
+				if err := checkSelector(field.Selector); err != nil {
+					return nil, ruleError(subPath+".selector", "%s", err)
+				}
+			}
+			var fieldRegexp *regexp.Regexp
+			if field.Regexp != "" {
+				if fieldRegexp, err = regexp.Compile(field.Regexp); err != nil {
+					return nil, ruleError(subPath+".regexp", "%s", err)
+				}
+			} else if field.Replace != "" {
+				return nil, ruleError(subPath+".replace", "replace without regexp")
+			}
+			compiled.fieldRegexps = append(compiled.fieldRegexps, fieldRegexp)
+		}
+	}
+	for i, link := range rule.Follow {
+		subPath := fmt.Sprintf(".follow[%d]", i)
+		if link.Selector == "" {
+			return nil, ruleError(subPath+".selector", "empty selector")
+		}
+		if err := checkSelector(link.Selector); err != nil {
+			return nil, ruleError(subPath+".selector", "%s", err)
+		}
+		var linkRegexp *regexp.Regexp
+		if link.Pattern != "" {
+			if linkRegexp, err = regexp.Compile(link.Pattern); err != nil {
+				return nil, ruleError(subPath+".pattern", "%s", err)
+			}
+		}
+		compiled.linkRegexps = append(compiled.linkRegexps, linkRegexp)
+	}
+	return compiled, nil
+}
+
+// checkSelector 用于检查CSS选择器的合法性。
+func checkSelector(selector string) error {
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("invalid selector %q: %s", selector, err)
+	}
+	return nil
+}
+
+// parseByRules 用于根据规则解析HTTP响应。
+func parseByRules(
+	rules []*compiledRule,
+	httpResp *http.Response,
+	respDepth uint32) ([]module.Data, []error) {
+	if httpResp == nil {
+		return nil, []error{genError("nil HTTP response")}
+	}
+	httpReq := httpResp.Request
+	if httpReq == nil || httpReq.URL == nil {
+		return nil, []error{genError("nil HTTP request")}
+	}
+	reqURL := httpReq.URL
+	var matchedRules []*compiledRule
+	for _, rule := range rules {
+		if rule.urlRegexp == nil || rule.urlRegexp.MatchString(reqURL.String()) {
+			matchedRules = append(matchedRules, rule)
+		}
+	}
+	if len(matchedRules) == 0 {
+		return nil, nil
+	}
+	contentType := httpResp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		return nil, nil
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, []error{genError(fmt.Sprintf(
+			"unsupported status code %d (requestURL: %s)", httpResp.StatusCode, reqURL))}
+	}
+	if httpResp.Body == nil {
+		return nil, []error{genError(fmt.Sprintf(
+			"nil HTTP response body (requestURL: %s)", reqURL))}
+	}
+	doc, err := goquery.NewDocumentFromReader(httpResp.Body)
+	if err != nil {
+		return nil, []error{genError(err.Error())}
+	}
+	var dataList []module.Data
+	var errs []error
+	for _, rule := range matchedRules {
+		if rule.Item != nil {
+			items, itemErrs := extractItems(rule, doc, reqURL)
+			for _, item := range items {
+				dataList = append(dataList, item)
+			}
+			errs = append(errs, itemErrs...)
+		}
+		reqs, linkErrs := extractLinks(rule, doc, reqURL, respDepth)
+		for _, req := range reqs {
+			dataList = append(dataList, req)
+		}
+		errs = append(errs, linkErrs...)
+	}
+	return dataList, errs
+}
+
+// extractItems 用于根据规则从文档中提取条目。
+func extractItems(
+	rule *compiledRule, doc *goquery.Document, reqURL *url.URL) ([]module.Item, []error) {
+	roots := doc.Selection
+	if rule.Item.Selector != "" {
+		roots = doc.Find(rule.Item.Selector)
+	}
+	var items []module.Item
+	var errs []error
+	roots.Each(func(index int, root *goquery.Selection) {
+		item := module.Item{}
+		if rule.Item.URLField != "" {
+			item[rule.Item.URLField] = reqURL.String()
+		}
+		for i, field := range rule.Item.Fields {
+			values := extractValues(root, field, rule.fieldRegexps[i], reqURL)
+			if len(values) == 0 {
+				if field.Required {
+					errs = append(errs, genError(fmt.Sprintf(
+						"%s.item.fields[%d] (%s): no value for required field (requestURL: %s, index: %d)",
+						rule.path, i, field.Name, reqURL, index)))
+					return
+				}
+				continue
+			}
+			if field.Multiple {
+				item[field.Name] = values
+			} else {
+				item[field.Name] = values[0]
+			}
+		}
+		items = append(items, item)
+	})
+	return items, errs
+}
+
+// extractValues 用于根据字段规则提取值。
+// 若字段规则的Multiple为false，则最多只会提取一个值。
+func extractValues(
+	root *goquery.Selection,
+	field FieldRule,
+	fieldRegexp *regexp.Regexp,
+	reqURL *url.URL) []string {
+	sel := root
+	if field.Selector != "" {
+		sel = root.Find(field.Selector)
+	}
+	var values []string
+	sel.EachWithBreak(func(index int, s *goquery.Selection) bool {
+		var value string
+		if field.Attr == "" {
+			value = strings.TrimSpace(s.Text())
+		} else {
+			var ok bool
+			if value, ok = s.Attr(field.Attr); !ok {
+				return true
+			}
+			value = strings.TrimSpace(value)
+		}
+		if fieldRegexp != nil {
+			var ok bool
+			if value, ok = applyRegexp(value, fieldRegexp, field.Replace); !ok {
+				return true
+			}
+		}
+		if field.AbsURL {
+			var ok bool
+			if value, ok = resolveURL(value, reqURL); !ok {
+				return true
+			}
+		}
+		if value == "" {
+			return true
+		}
+		values = append(values, value)
+		return field.Multiple
+	})
+	return values
+}
+
+// applyRegexp 用于对值进行正则表达式后处理。
+// 若值与正则表达式不匹配，则第二个结果值为false。
+func applyRegexp(value string, re *regexp.Regexp, replace string) (string, bool) {
+	if replace != "" {
+		if !re.MatchString(value) {
+			return "", false
+		}
+		return re.ReplaceAllString(value, replace), true
+	}
+	matches := re.FindStringSubmatch(value)
+	if matches == nil {
+		return "", false
+	}
+	if len(matches) > 1 {
+		return matches[1], true
+	}
+	return matches[0], true
+}
+
+// extractLinks 用于根据规则从文档中提取需要跟进的链接。
+func extractLinks(
+	rule *compiledRule,
+	doc *goquery.Document,
+	reqURL *url.URL,
+	respDepth uint32) ([]*module.Request, []error) {
+	var reqs []*module.Request
+	var errs []error
+	for i, link := range rule.Follow {
+		attr := link.Attr
+		if attr == "" {
+			attr = "href"
+		}
+		doc.Find(link.Selector).Each(func(index int, sel *goquery.Selection) {
+			href, ok := sel.Attr(attr)
+			if !ok {
+				return
+			}
+			absURL, ok := resolveURL(href, reqURL)
+			if !ok {
+				return
+			}
+			if re := rule.linkRegexps[i]; re != nil && !re.MatchString(absURL) {
+				return
+			}
+			httpReq, err := http.NewRequest("GET", absURL, nil)
+			if err != nil {
+				errs = append(errs, genError(fmt.Sprintf("%s.follow[%d]: %s",
+					rule.path, i, err)))
+				return
+			}
+			reqs = append(reqs, module.NewRequest(httpReq, respDepth))
+		})
+	}
+	return reqs, errs
+}
+
+// resolveURL 用于把给定的链接解析为基于参数base的绝对URL。
+// 空链接、页内锚点以及非HTTP协议的链接会被忽略，此时第二个结果值为false。
+func resolveURL(href string, base *url.URL) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	u.Fragment = ""
+	return u.String(), true
+}
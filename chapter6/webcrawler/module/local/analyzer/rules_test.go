@@ -0,0 +1,207 @@
+package analyzer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// testingRuleSet 代表测试用的规则集。
+const testingRuleSet = `{
+    "rules": [{
+        "name": "article",
+        "url_pattern": "^http://example\\.com/articles/",
+        "item": {
+            "selector": "article",
+            "url_field": "url",
+            "fields": [
+                {"name": "title", "selector": "h1", "required": true},
+                {"name": "id", "selector": "a.permalink", "attr": "href",
+                 "regexp": "/articles/(\\d+)"},
+                {"name": "date", "selector": ".date", "regexp": "(\\d+)/(\\d+)/(\\d+)",
+                 "replace": "$3-$1-$2"},
+                {"name": "tags", "selector": ".tag", "multiple": true},
+                {"name": "cover", "selector": "img", "attr": "src", "abs_url": true}
+            ]
+        },
+        "follow": [
+            {"selector": "a.next"},
+            {"selector": "a", "pattern": "/articles/\\d+$"}
+        ]
+    }, {
+        "name": "other",
+        "url_pattern": "^http://example\\.com/other",
+        "follow": [{"selector": "a"}]
+    }]
+}`
+
+// testingArticlePage 代表测试用的文章页面。
+const testingArticlePage = `<html><body>
+<article>
+  <h1> First </h1>
+  <a class="permalink" href="/articles/1">link</a>
+  <span class="date">10/18/2026</span>
+  <span class="tag">go</span><span class="tag">crawler</span>
+  <img src="images/1.png">
+</article>
+<article>
+  <a class="permalink" href="/articles/2">no title</a>
+</article>
+<article>
+  <h1>Third</h1>
+  <a class="permalink" href="/posts/3">link</a>
+</article>
+<a class="next" href="?page=2#top">next</a>
+<a href="javascript:void(0)">js</a>
+<a href="mailto:someone@example.com">mail</a>
+</body></html>`
+
+func TestRuleSetLoad(t *testing.T) {
+	ruleSet, err := LoadRuleSet([]byte(testingRuleSet), nil)
+	if err != nil {
+		t.Fatalf("An error occurs when loading rule set: %s", err)
+	}
+	if len(ruleSet.Rules) != 2 {
+		t.Fatalf("Inconsistent rule number: expected: %d, actual: %d",
+			2, len(ruleSet.Rules))
+	}
+	invalidSpecs := map[string]string{
+		`{"rules": []}`:              "empty rule list",
+		`{"rulez": []}`:              "unknown field",
+		`{"rules": [{"name": "a"}]}`: "rules[0] (a): neither item nor follow",
+		`{"rules": [{"url_pattern": "(", "follow": [{"selector": "a"}]}]}`: "rules[0].url_pattern",
+		`{"rules": [{"follow": [{"selector": "a"}]}, {"name": "b", "item": {"fields": [
+			{"name": "x"}, {"name": "y", "regexp": "["}]}}]}`: "rules[1] (b).item.fields[1] (y).regexp",
+		`{"rules": [{"item": {"fields": [{"name": "x"}, {"name": "x"}]}}]}`:    "duplicate field name",
+		`{"rules": [{"item": {"url_field": "x", "fields": [{"name": "x"}]}}]}`: "duplicate field name",
+		`{"rules": [{"item": {"fields": [{"name": "x", "replace": "$1"}]}}]}`:  "replace without regexp",
+		`{"rules": [{"item": {"fields": []}}]}`:                                "rules[0].item.fields: empty field list",
+		`{"rules": [{"follow": [{"selector": ""}]}]}`:                          "rules[0].follow[0].selector",
+		`{"rules": [{"follow": [{"selector": "a[href"}]}]}`:                    "rules[0].follow[0].selector",
+		`{"rules": [{"follow": [{"selector": "a", "pattern": "("}]}]}`:         "rules[0].follow[0].pattern",
+	}
+	for spec, expectedMsg := range invalidSpecs {
+		_, err := LoadRuleSet([]byte(spec), nil)
+		if err == nil {
+			t.Fatalf("No error when loading invalid rule set: %s", spec)
+		}
+		if !strings.Contains(err.Error(), expectedMsg) {
+			t.Fatalf("Inconsistent error message: expected: %q, actual: %q",
+				expectedMsg, err)
+		}
+	}
+	// 自定义的反序列化函数。
+	called := false
+	unmarshal := func(data []byte, v interface{}) error {
+		called = true
+		v.(*RuleSet).Rules = []Rule{{Follow: []LinkRule{{Selector: "a"}}}}
+		return nil
+	}
+	if _, err := LoadRuleSet([]byte("rules: ..."), unmarshal); err != nil || !called {
+		t.Fatalf("The custom unmarshal function is not used! (error: %v)", err)
+	}
+}
+
+func TestRuleParser(t *testing.T) {
+	ruleSet, _ := LoadRuleSet([]byte(testingRuleSet), nil)
+	parser, err := NewRuleParser(*ruleSet)
+	if err != nil {
+		t.Fatalf("An error occurs when creating rule parser: %s", err)
+	}
+	httpResp := genRuleTestingResp("http://example.com/articles/index", testingArticlePage)
+	dataList, errs := parser(httpResp, 1)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "fields[0] (title)") {
+		t.Fatalf("Inconsistent errors: %v", errs)
+	}
+	var items []module.Item
+	var urls []string
+	for _, data := range dataList {
+		switch d := data.(type) {
+		case module.Item:
+			items = append(items, d)
+		case *module.Request:
+			if d.Depth() != 1 {
+				t.Fatalf("Inconsistent request depth: expected: %d, actual: %d", 1, d.Depth())
+			}
+			urls = append(urls, d.HTTPReq().URL.String())
+		}
+	}
+	expectedItems := []module.Item{
+		{
+			"url":   "http://example.com/articles/index",
+			"title": "First",
+			"id":    "1",
+			"date":  "2026-10-18",
+			"tags":  []string{"go", "crawler"},
+			"cover": "http://example.com/articles/images/1.png",
+		},
+		{
+			"url":   "http://example.com/articles/index",
+			"title": "Third",
+		},
+	}
+	if !reflect.DeepEqual(items, expectedItems) {
+		t.Fatalf("Inconsistent items: expected: %#v, actual: %#v", expectedItems, items)
+	}
+	expectedURLs := []string{
+		"http://example.com/articles/index?page=2",
+		"http://example.com/articles/1",
+		"http://example.com/articles/2",
+	}
+	if !reflect.DeepEqual(urls, expectedURLs) {
+		t.Fatalf("Inconsistent URLs: expected: %v, actual: %v", expectedURLs, urls)
+	}
+	// 没有匹配的规则。
+	httpResp = genRuleTestingResp("http://example.org/", testingArticlePage)
+	if dataList, errs := parser(httpResp, 0); len(dataList) != 0 || len(errs) != 0 {
+		t.Fatalf("Unexpected result for unmatched URL: %v, %v", dataList, errs)
+	}
+	// 非HTML的响应。
+	httpResp = genRuleTestingResp("http://example.com/other", testingArticlePage)
+	httpResp.Header.Set("Content-Type", "image/png")
+	if dataList, errs := parser(httpResp, 0); len(dataList) != 0 || len(errs) != 0 {
+		t.Fatalf("Unexpected result for non-HTML response: %v, %v", dataList, errs)
+	}
+}
+
+func TestNewWithRules(t *testing.T) {
+	ruleSet, _ := LoadRuleSet([]byte(testingRuleSet), nil)
+	mid := module.MID("A1|127.0.0.1:8080")
+	a, err := NewWithRules(mid, *ruleSet, nil, Options{})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer with rules: %s", err)
+	}
+	httpResp := genRuleTestingResp("http://example.com/other", testingArticlePage)
+	dataList, errs := a.Analyze(module.NewResponse(httpResp, 0))
+	if len(errs) != 0 {
+		t.Fatalf("An error occurs when analyzing response: %v", errs)
+	}
+	// 4个HTTP链接，请求的深度会被加1。
+	if len(dataList) != 4 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d", 4, len(dataList))
+	}
+	for _, data := range dataList {
+		if req, ok := data.(*module.Request); !ok || req.Depth() != 1 {
+			t.Fatalf("Inconsistent data: %#v", data)
+		}
+	}
+	if _, err := NewWithRules(mid, RuleSet{}, nil, Options{}); err == nil {
+		t.Fatal("No error when creating an analyzer with empty rule set!")
+	}
+}
+
+// genRuleTestingResp 用于生成测试用的HTML响应。
+func genRuleTestingResp(rawURL string, page string) *http.Response {
+	u, _ := url.Parse(rawURL)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(page)),
+		Request:    &http.Request{Method: "GET", URL: u},
+	}
+}
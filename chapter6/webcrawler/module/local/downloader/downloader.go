@@ -1,7 +1,12 @@
 package downloader
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/url"
+	"time"
+
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/stub"
 	"gopcp.v2/helper/log"
@@ -10,11 +15,54 @@ import (
 // logger 代表日志记录器。
 var logger = log.DLogger()
 
+// Options 代表下载器的可选项。
+type Options struct {
+	// Proxies 代表代理URL的列表。若为空，则沿用HTTP客户端自身的代理设置。
+	Proxies []string
+	// ProxyStrategy 代表代理的选择策略，为空时使用轮询。
+	ProxyStrategy ProxyStrategy
+	// MaxProxyFailures 代表代理连续失败多少次之后会被剔除，为0时永不剔除。
+	MaxProxyFailures uint32
+	// ProxyCooldown 代表被剔除的代理在多久之后会被重新启用，为0时使用DEFAULT_PROXY_COOLDOWN。
+	ProxyCooldown time.Duration
+	// StickyProxy 代表是否为同一主机固定使用同一个代理。
+	StickyProxy bool
+	// UserAgents 代表轮流使用的User-Agent的列表。
+	// 已经设置了User-Agent的请求不受影响。
+	UserAgents []string
+	// Middlewares 代表包裹在实际下载之外的中间件的列表。
+	// 第一个中间件位于最外层。
+	Middlewares []Middleware
+}
+
+// ExtraSummaryStruct 代表下载器额外摘要信息的类型。
+type ExtraSummaryStruct struct {
+	ProxyStrategy   ProxyStrategy        `json:"proxy_strategy,omitempty"`
+	StickyProxy     bool                 `json:"sticky_proxy,omitempty"`
+	Proxies         []ProxySummaryStruct `json:"proxies,omitempty"`
+	UserAgentCount  int                  `json:"user_agent_count,omitempty"`
+	MiddlewareCount int                  `json:"middleware_count,omitempty"`
+}
+
+// proxyKey 代表在请求上下文中存放所选代理的键的类型。
+type proxyKey struct{}
+
 // New 用于创建一个下载器实例。
 func New(
 	mid module.MID,
 	client *http.Client,
 	scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	return NewWithOptions(mid, client, scoreCalculator, Options{})
+}
+
+// NewWithOptions 用于根据可选项创建一个下载器实例。
+// 若指定了代理，则HTTP客户端的Transport必须为nil或*http.Transport类型的值，
+// 它会被复制一份后再设置代理，原值不受影响。
+func NewWithOptions(
+	mid module.MID,
+	client *http.Client,
+	scoreCalculator module.CalculateScore,
+	opts Options) (module.Downloader, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -22,10 +70,48 @@ func New(
 	if client == nil {
 		return nil, genParameterError("nil http client")
 	}
-	return &myDownloader{
+	for i, agent := range opts.UserAgents {
+		if agent == "" {
+			return nil, genParameterError(fmt.Sprintf("empty user agent[%d]", i))
+		}
+	}
+	downloader := &myDownloader{
 		ModuleInternal: moduleBase,
 		httpClient:     *client,
-	}, nil
+	}
+	if len(opts.Proxies) > 0 {
+		proxyPool, err := NewProxyPool(
+			opts.Proxies, opts.ProxyStrategy, opts.MaxProxyFailures,
+			opts.ProxyCooldown, opts.StickyProxy)
+		if err != nil {
+			return nil, err
+		}
+		var transport *http.Transport
+		switch t := client.Transport.(type) {
+		case nil:
+			transport = http.DefaultTransport.(*http.Transport).Clone()
+		case *http.Transport:
+			transport = t.Clone()
+		default:
+			return nil, genParameterError(
+				fmt.Sprintf("unsupported transport for proxies: %T", t))
+		}
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, _ := req.Context().Value(proxyKey{}).(*url.URL)
+			return proxyURL, nil
+		}
+		downloader.httpClient.Transport = transport
+		downloader.proxyPool = proxyPool
+		downloader.stickyProxy = opts.StickyProxy
+	}
+	if len(opts.UserAgents) > 0 {
+		agents := make([]string, len(opts.UserAgents))
+		copy(agents, opts.UserAgents)
+		downloader.userAgents = &userAgentRotator{agents: agents}
+	}
+	downloader.middlewareCount = len(opts.Middlewares)
+	downloader.handler = Chain(opts.Middlewares...)(downloader.roundTrip)
+	return downloader, nil
 }
 
 // myDownloader 代表下载器的实现类型。
@@ -34,9 +120,36 @@ type myDownloader struct {
 	stub.ModuleInternal
 	// httpClient 代表下载用的HTTP客户端。
 	httpClient http.Client
+	// proxyPool 代表代理池。若为nil，则不使用代理池。
+	proxyPool ProxyPool
+	// stickyProxy 代表是否为同一主机固定使用同一个代理。
+	stickyProxy bool
+	// userAgents 代表User-Agent轮换器。若为nil，则不设置User-Agent。
+	userAgents *userAgentRotator
+	// middlewareCount 代表中间件的数量。
+	middlewareCount int
+	// handler 代表由中间件包裹后的下载函数。
+	handler DownloadFunc
 }
 
 func (downloader *myDownloader) Download(req *module.Request) (*module.Response, error) {
+	return downloader.download(nil, req)
+}
+
+// DownloadContext 会把给定的上下文附加到HTTP请求上再进行下载。
+// 上下文被取消或超时的时候，HTTP请求及其响应体的读取都会被中止。
+func (downloader *myDownloader) DownloadContext(
+	ctx context.Context, req *module.Request) (*module.Response, error) {
+	if ctx == nil {
+		return nil, genParameterError("nil context")
+	}
+	return downloader.download(ctx, req)
+}
+
+// download 用于执行下载。
+// 若参数ctx为nil，则沿用HTTP请求原有的上下文。
+func (downloader *myDownloader) download(
+	ctx context.Context, req *module.Request) (*module.Response, error) {
 
 	downloader.ModuleInternal.IncrHandlingNumber()
 	defer downloader.ModuleInternal.DecrHandlingNumber()
@@ -49,13 +162,84 @@ func (downloader *myDownloader) Download(req *module.Request) (*module.Response,
 	if httpReq == nil {
 		return nil, genParameterError("nil HTTP request")
 	}
+	if ctx != nil {
+		req = req.WithContext(ctx)
+	} else {
+		ctx = httpReq.Context()
+	}
 	downloader.ModuleInternal.IncrAcceptedCount()
-	logger.Infof("Do the request (URL: %s, depth: %d)... \n", httpReq.URL, req.Depth())
 
-	httpResp, err := downloader.httpClient.Do(httpReq)
+	// 耗时包括所有中间件的耗时，但不包括读取响应体的时间，响应体会由分析器读取。
+	startTime := time.Now()
+	resp, err := downloader.handler(ctx, req)
+	downloader.ModuleInternal.RecordLatency(time.Since(startTime))
+	if err == nil && (resp == nil || resp.HTTPResp() == nil) {
+		err = genError(fmt.Sprintf("no response for %s", httpReq.URL))
+	}
 	if err != nil {
+		downloader.ModuleInternal.IncrFailedCount()
 		return nil, err
 	}
 	downloader.ModuleInternal.IncrCompletedCount()
+	return resp, nil
+}
+
+// roundTrip 用于通过HTTP客户端实际执行下载。
+// 它位于中间件链的最内层，负责选择代理和设置User-Agent。
+func (downloader *myDownloader) roundTrip(
+	ctx context.Context, req *module.Request) (*module.Response, error) {
+	httpReq := req.HTTPReq()
+	if httpReq == nil {
+		return nil, genParameterError("nil HTTP request")
+	}
+	httpReq = httpReq.WithContext(ctx)
+	var proxyURL *url.URL
+	if downloader.proxyPool != nil {
+		var err error
+		proxyURL, err = downloader.proxyPool.Get(httpReq.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+		httpReq = httpReq.WithContext(
+			context.WithValue(httpReq.Context(), proxyKey{}, proxyURL))
+	}
+	if downloader.userAgents != nil && httpReq.Header.Get("User-Agent") == "" {
+		// 复制请求以免修改原请求的头部。
+		httpReq = httpReq.Clone(httpReq.Context())
+		httpReq.Header.Set("User-Agent", downloader.userAgents.get())
+	}
+	logger.Infof("Do the request (URL: %s, depth: %d)... \n", httpReq.URL, req.Depth())
+	httpResp, err := downloader.httpClient.Do(httpReq)
+	if proxyURL != nil {
+		reportErr := err
+		if reportErr == nil && httpResp.StatusCode == http.StatusProxyAuthRequired {
+			reportErr = fmt.Errorf("proxy authentication required")
+		}
+		downloader.proxyPool.Report(proxyURL, reportErr)
+	}
+	if err != nil {
+		return nil, err
+	}
 	return module.NewResponse(httpResp, req.Depth()), nil
 }
+
+// Summary 会在组件摘要中附带代理池和User-Agent的信息。
+func (downloader *myDownloader) Summary() module.SummaryStruct {
+	summary := downloader.ModuleInternal.Summary()
+	if downloader.proxyPool == nil && downloader.userAgents == nil &&
+		downloader.middlewareCount == 0 {
+		return summary
+	}
+	extra := ExtraSummaryStruct{}
+	if downloader.proxyPool != nil {
+		extra.ProxyStrategy = downloader.proxyPool.Strategy()
+		extra.StickyProxy = downloader.stickyProxy
+		extra.Proxies = downloader.proxyPool.Summary()
+	}
+	if downloader.userAgents != nil {
+		extra.UserAgentCount = len(downloader.userAgents.agents)
+	}
+	extra.MiddlewareCount = downloader.middlewareCount
+	summary.Extra = extra
+	return summary
+}
@@ -2,8 +2,11 @@ package downloader
 
 import (
 	"bufio"
+	"context"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/stub"
@@ -108,6 +111,55 @@ func TestDownload(t *testing.T) {
 
 }
 
+func TestDownloadContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+	defer server.Close()
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, _ := New(mid, &http.Client{}, nil)
+	cd, ok := d.(module.ContextDownloader)
+	if !ok {
+		t.Fatalf("The downloader %T doesn't implement module.ContextDownloader!", d)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL+"/fast", nil)
+	resp, err := cd.DownloadContext(context.Background(), module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content with context: %s", err)
+	}
+	resp.HTTPResp().Body.Close()
+	httpReq, _ = http.NewRequest("GET", server.URL+"/slow", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = cd.DownloadContext(ctx, module.NewRequest(httpReq, 0))
+	if err == nil {
+		t.Fatal("No error when downloading content with an expired context!")
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Fatalf("The download has not been aborted in time! (elapsed: %s)", elapsed)
+	}
+	// 两次下载都被接受，其中一次失败。
+	counts := d.Counts()
+	if counts.AcceptedCount != 2 || counts.FailedCount != 1 {
+		t.Fatalf("Inconsistent counts: expected: accepted 2, failed 1, actual: %#v", counts)
+	}
+	if counts.TotalLatency <= 0 || counts.EWMALatency <= 0 {
+		t.Fatalf("No latency recorded: %#v", counts)
+	}
+	if _, err = cd.DownloadContext(nil, module.NewRequest(httpReq, 0)); err == nil {
+		t.Fatal("No error when downloading content with nil context!")
+	}
+}
+
 func TestCount(t *testing.T) {
 	mid := module.MID("D1|127.0.0.1:8080")
 	httpClient := &http.Client{}
@@ -205,3 +257,92 @@ func TestCount(t *testing.T) {
 			0, di.HandlingNumber())
 	}
 }
+
+func TestDownloadWithOptions(t *testing.T) {
+	mid := module.MID("D1|127.0.0.1:8080")
+	invalidOptsList := []Options{
+		{Proxies: []string{"127.0.0.1"}},
+		{Proxies: []string{"http://127.0.0.1:8081"}, ProxyStrategy: "unknown"},
+		{UserAgents: []string{""}},
+	}
+	for _, opts := range invalidOptsList {
+		if _, err := NewWithOptions(mid, &http.Client{}, nil, opts); err == nil {
+			t.Fatalf("No error when create a downloader with illegal options %#v!", opts)
+		}
+	}
+	// 该服务器充当HTTP代理，会记录收到的请求。
+	var userAgents []string
+	var targets []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			userAgents = append(userAgents, r.UserAgent())
+			targets = append(targets, r.URL.String())
+			w.Write([]byte("proxied"))
+		}))
+	defer proxyServer.Close()
+	// 该地址上没有监听者，通过它的请求都会失败。
+	deadServer := httptest.NewServer(http.NotFoundHandler())
+	deadProxy := deadServer.URL
+	deadServer.Close()
+	opts := Options{
+		Proxies:          []string{deadProxy, proxyServer.URL},
+		ProxyStrategy:    PROXY_STRATEGY_ROUND_ROBIN,
+		MaxProxyFailures: 1,
+		UserAgents:       []string{"agent-1", "agent-2"},
+	}
+	d, err := NewWithOptions(mid, &http.Client{}, nil, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	target := "http://crawler.example/index.html"
+	var succeeded int
+	for i := 0; i < 4; i++ {
+		httpReq, _ := http.NewRequest("GET", target, nil)
+		resp, err := d.Download(module.NewRequest(httpReq, 0))
+		if err != nil {
+			continue
+		}
+		resp.HTTPResp().Body.Close()
+		succeeded++
+		if httpReq.Header.Get("User-Agent") != "" {
+			t.Fatal("The original request has been modified!")
+		}
+	}
+	if succeeded != 3 {
+		t.Fatalf("Inconsistent succeeded count: expected: %d, actual: %d", 3, succeeded)
+	}
+	for _, actual := range targets {
+		if actual != target {
+			t.Fatalf("Inconsistent target: expected: %s, actual: %s", target, actual)
+		}
+	}
+	expectedAgents := []string{"agent-2", "agent-1", "agent-2"}
+	for i, agent := range expectedAgents {
+		if userAgents[i] != agent {
+			t.Fatalf("Inconsistent user agent: expected: %s, actual: %s", agent, userAgents[i])
+		}
+	}
+	extra, ok := d.Summary().Extra.(ExtraSummaryStruct)
+	if !ok {
+		t.Fatalf("Inconsistent extra summary type: %T", d.Summary().Extra)
+	}
+	if extra.ProxyStrategy != PROXY_STRATEGY_ROUND_ROBIN {
+		t.Fatalf("Inconsistent proxy strategy: expected: %s, actual: %s",
+			PROXY_STRATEGY_ROUND_ROBIN, extra.ProxyStrategy)
+	}
+	if extra.UserAgentCount != 2 {
+		t.Fatalf("Inconsistent user agent count: expected: %d, actual: %d",
+			2, extra.UserAgentCount)
+	}
+	for _, proxy := range extra.Proxies {
+		expectedEvicted := proxy.URL == deadProxy
+		if proxy.Evicted != expectedEvicted {
+			t.Fatalf("Inconsistent eviction for proxy %s: expected: %v, actual: %v",
+				proxy.URL, expectedEvicted, proxy.Evicted)
+		}
+	}
+	plain, _ := New(mid, &http.Client{}, nil)
+	if plain.Summary().Extra != nil {
+		t.Fatalf("Non-nil extra summary for plain downloader: %#v", plain.Summary().Extra)
+	}
+}
@@ -0,0 +1,142 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/helper/log/base"
+)
+
+// ErrResponseTooLarge 代表响应体超出大小限制的错误。
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// DownloadFunc 代表执行下载的函数的类型。
+type DownloadFunc func(ctx context.Context, req *module.Request) (*module.Response, error)
+
+// Middleware 代表下载中间件的类型。
+// 中间件可以在调用参数next之前修改请求，在调用之后检查或替换响应，
+// 也可以不调用参数next而直接返回合成的响应，即短路后续的中间件和实际的下载。
+// 修改请求时应该先复制HTTP请求，以免影响原请求。
+type Middleware func(next DownloadFunc) DownloadFunc
+
+// Chain 用于把多个中间件按顺序组合为一个。
+// 第一个中间件位于最外层，它最先看到请求，也最后看到响应。
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next DownloadFunc) DownloadFunc {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			if middlewares[i] != nil {
+				next = middlewares[i](next)
+			}
+		}
+		return next
+	}
+}
+
+// HeaderMiddleware 用于生成设置默认请求头部的中间件。
+// 若参数override为false，则只设置请求中尚不存在的头部，否则会覆盖已有的值。
+func HeaderMiddleware(header http.Header, override bool) Middleware {
+	header = header.Clone()
+	return func(next DownloadFunc) DownloadFunc {
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			if len(header) == 0 {
+				return next(ctx, req)
+			}
+			httpReq := req.HTTPReq().Clone(ctx)
+			for key, values := range header {
+				if !override && httpReq.Header.Get(key) != "" {
+					continue
+				}
+				httpReq.Header[http.CanonicalHeaderKey(key)] = append([]string(nil), values...)
+			}
+			return next(ctx, module.NewRequest(httpReq, req.Depth()))
+		}
+	}
+}
+
+// LoggingMiddleware 用于生成记录请求和响应概况的中间件。
+// 若参数requestLogger为nil，则使用默认的日志记录器。
+func LoggingMiddleware(requestLogger base.MyLogger) Middleware {
+	if requestLogger == nil {
+		requestLogger = logger
+	}
+	return func(next DownloadFunc) DownloadFunc {
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			httpReq := req.HTTPReq()
+			startTime := time.Now()
+			resp, err := next(ctx, req)
+			elapsed := time.Since(startTime)
+			if err != nil {
+				requestLogger.Warnf("%s %s (depth: %d) failed after %s: %s",
+					httpReq.Method, httpReq.URL, req.Depth(), elapsed, err)
+				return resp, err
+			}
+			var statusCode int
+			if resp != nil && resp.HTTPResp() != nil {
+				statusCode = resp.HTTPResp().StatusCode
+			}
+			requestLogger.Infof("%s %s (depth: %d) -> %d in %s",
+				httpReq.Method, httpReq.URL, req.Depth(), statusCode, elapsed)
+			return resp, nil
+		}
+	}
+}
+
+// MaxResponseSizeMiddleware 用于生成限制响应体大小的中间件。
+// 若响应头部声明的长度超过参数maxSize，则会直接返回ErrResponseTooLarge。
+// 否则，读取响应体时一旦超过参数maxSize，读取就会返回ErrResponseTooLarge。
+// 若参数maxSize不大于0，则不做限制。
+func MaxResponseSizeMiddleware(maxSize int64) Middleware {
+	return func(next DownloadFunc) DownloadFunc {
+		if maxSize <= 0 {
+			return next
+		}
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			resp, err := next(ctx, req)
+			if err != nil || resp == nil || resp.HTTPResp() == nil {
+				return resp, err
+			}
+			httpResp := resp.HTTPResp()
+			if httpResp.Body == nil {
+				return resp, nil
+			}
+			if httpResp.ContentLength > maxSize {
+				httpResp.Body.Close()
+				return nil, fmt.Errorf("%w: %d bytes (limit: %d, URL: %s)",
+					ErrResponseTooLarge, httpResp.ContentLength, maxSize, req.HTTPReq().URL)
+			}
+			httpResp.Body = &limitedBody{
+				ReadCloser: httpResp.Body,
+				remaining:  maxSize,
+			}
+			return resp, nil
+		}
+	}
+}
+
+// limitedBody 代表限制了可读取大小的响应体。
+type limitedBody struct {
+	io.ReadCloser
+	// remaining 代表还可以读取的字节数。
+	remaining int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	if body.remaining < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	// 多读一个字节，以便区分恰好达到限制和超出限制这两种情况。
+	if int64(len(p)) > body.remaining+1 {
+		p = p[:body.remaining+1]
+	}
+	n, err := body.ReadCloser.Read(p)
+	body.remaining -= int64(n)
+	if body.remaining < 0 {
+		return n + int(body.remaining), ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,202 @@
+package downloader
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// genTestingServer 用于生成测试用的HTTP服务器。
+// 它会在响应体中写出请求头部X-Test的值，请求的次数会被记录在参数hits中。
+func genTestingServer(hits *uint32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddUint32(hits, 1)
+			if r.URL.Path == "/chunked" {
+				w.(http.Flusher).Flush()
+				w.Write([]byte(strings.Repeat("x", 100)))
+				return
+			}
+			w.Write([]byte(r.Header.Get("X-Test")))
+		}))
+}
+
+// readBody 用于读取响应体的全部内容。
+func readBody(resp *module.Response, t *testing.T) string {
+	defer resp.HTTPResp().Body.Close()
+	content, err := ioutil.ReadAll(resp.HTTPResp().Body)
+	if err != nil {
+		t.Fatalf("An error occurs when reading response body: %s", err)
+	}
+	return string(content)
+}
+
+func TestMiddlewareChain(t *testing.T) {
+	var hits uint32
+	server := genTestingServer(&hits)
+	defer server.Close()
+	var trace []string
+	genTracing := func(name string) Middleware {
+		return func(next DownloadFunc) DownloadFunc {
+			return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+				trace = append(trace, name+">")
+				resp, err := next(ctx, req)
+				trace = append(trace, "<"+name)
+				return resp, err
+			}
+		}
+	}
+	opts := Options{
+		Middlewares: []Middleware{
+			genTracing("a"),
+			nil,
+			genTracing("b"),
+			HeaderMiddleware(http.Header{"X-Test": {"default"}}, false),
+		},
+	}
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, err := NewWithOptions(mid, &http.Client{}, nil, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if body := readBody(resp, t); body != "default" {
+		t.Fatalf("Inconsistent response body: expected: %q, actual: %q", "default", body)
+	}
+	if httpReq.Header.Get("X-Test") != "" {
+		t.Fatal("The original request has been modified by middleware!")
+	}
+	expectedTrace := "a> b> <b <a"
+	if actualTrace := strings.Join(trace, " "); actualTrace != expectedTrace {
+		t.Fatalf("Inconsistent middleware trace: expected: %q, actual: %q",
+			expectedTrace, actualTrace)
+	}
+	// 已有的头部不会被默认值覆盖。
+	httpReq.Header.Set("X-Test", "custom")
+	resp, _ = d.Download(module.NewRequest(httpReq, 0))
+	if body := readBody(resp, t); body != "custom" {
+		t.Fatalf("Inconsistent response body: expected: %q, actual: %q", "custom", body)
+	}
+	extra, ok := d.Summary().Extra.(ExtraSummaryStruct)
+	if !ok || extra.MiddlewareCount != len(opts.Middlewares) {
+		t.Fatalf("Inconsistent extra summary: %#v", d.Summary().Extra)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	var hits uint32
+	server := genTestingServer(&hits)
+	defer server.Close()
+	cached := func(next DownloadFunc) DownloadFunc {
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			httpResp := &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(strings.NewReader("cached")),
+				Request:    req.HTTPReq(),
+			}
+			return module.NewResponse(httpResp, req.Depth()), nil
+		}
+	}
+	opts := Options{
+		Middlewares: []Middleware{
+			HeaderMiddleware(http.Header{"X-Test": {"override"}}, true),
+			cached,
+		},
+	}
+	d, _ := NewWithOptions("D1|127.0.0.1:8080", &http.Client{}, nil, opts)
+	httpReq, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := d.Download(module.NewRequest(httpReq, 2))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if body := readBody(resp, t); body != "cached" {
+		t.Fatalf("Inconsistent response body: expected: %q, actual: %q", "cached", body)
+	}
+	if resp.Depth() != 2 {
+		t.Fatalf("Inconsistent response depth: expected: %d, actual: %d", 2, resp.Depth())
+	}
+	if hits != 0 {
+		t.Fatalf("The server is still requested after short-circuiting! (hits: %d)", hits)
+	}
+	if d.CompletedCount() != 1 {
+		t.Fatalf("Inconsistent completed count: expected: %d, actual: %d",
+			1, d.CompletedCount())
+	}
+	// 返回空响应的中间件会导致下载失败。
+	empty := func(next DownloadFunc) DownloadFunc {
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			return nil, nil
+		}
+	}
+	d, _ = NewWithOptions("D1|127.0.0.1:8080", &http.Client{}, nil,
+		Options{Middlewares: []Middleware{empty}})
+	if _, err := d.Download(module.NewRequest(httpReq, 0)); err == nil {
+		t.Fatal("No error when middleware returns nil response!")
+	}
+}
+
+func TestMiddlewareLogging(t *testing.T) {
+	var hits uint32
+	server := genTestingServer(&hits)
+	defer server.Close()
+	opts := Options{Middlewares: []Middleware{LoggingMiddleware(nil)}}
+	d, _ := NewWithOptions("D1|127.0.0.1:8080", &http.Client{}, nil, opts)
+	httpReq, _ := http.NewRequest("GET", server.URL, nil)
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	resp.HTTPResp().Body.Close()
+	httpReq, _ = http.NewRequest("GET", "http://127.0.0.1:1/", nil)
+	if _, err := d.Download(module.NewRequest(httpReq, 0)); err == nil {
+		t.Fatal("No error when downloading from unreachable server!")
+	}
+}
+
+func TestMiddlewareMaxResponseSize(t *testing.T) {
+	var hits uint32
+	server := genTestingServer(&hits)
+	defer server.Close()
+	opts := Options{Middlewares: []Middleware{MaxResponseSizeMiddleware(10)}}
+	d, _ := NewWithOptions("D1|127.0.0.1:8080", &http.Client{}, nil, opts)
+	// 响应头部声明的长度超出限制。
+	httpReq, _ := http.NewRequest("GET", server.URL, nil)
+	httpReq.Header.Set("X-Test", strings.Repeat("y", 11))
+	if _, err := d.Download(module.NewRequest(httpReq, 0)); err == nil ||
+		!strings.Contains(err.Error(), ErrResponseTooLarge.Error()) {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrResponseTooLarge, err)
+	}
+	// 恰好达到限制。
+	httpReq.Header.Set("X-Test", strings.Repeat("y", 10))
+	resp, err := d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if body := readBody(resp, t); len(body) != 10 {
+		t.Fatalf("Inconsistent body length: expected: %d, actual: %d", 10, len(body))
+	}
+	// 未声明长度的响应体在读取时超出限制。
+	httpReq, _ = http.NewRequest("GET", server.URL+"/chunked", nil)
+	resp, err = d.Download(module.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	content, err := ioutil.ReadAll(resp.HTTPResp().Body)
+	resp.HTTPResp().Body.Close()
+	if err != ErrResponseTooLarge {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrResponseTooLarge, err)
+	}
+	if len(content) != 10 {
+		t.Fatalf("Inconsistent body length: expected: %d, actual: %d", 10, len(content))
+	}
+}
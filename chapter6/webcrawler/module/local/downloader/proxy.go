@@ -0,0 +1,275 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ProxyStrategy 代表代理的选择策略。
+type ProxyStrategy string
+
+// 代理选择策略的常量。
+const (
+	// PROXY_STRATEGY_ROUND_ROBIN 代表轮询。
+	PROXY_STRATEGY_ROUND_ROBIN ProxyStrategy = "round_robin"
+	// PROXY_STRATEGY_RANDOM 代表随机选择。
+	PROXY_STRATEGY_RANDOM ProxyStrategy = "random"
+	// PROXY_STRATEGY_LEAST_FAILURES 代表选择失败次数最少的代理。
+	PROXY_STRATEGY_LEAST_FAILURES ProxyStrategy = "least_failures"
+)
+
+// DEFAULT_PROXY_COOLDOWN 代表默认的被剔除的代理重新启用前的等待时间。
+const DEFAULT_PROXY_COOLDOWN = time.Minute
+
+// ErrNoProxyAvailable 代表没有可用代理的错误。
+var ErrNoProxyAvailable = errors.New("no proxy available")
+
+// ProxyPool 代表代理池的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ProxyPool interface {
+	// Strategy 用于获取代理的选择策略。
+	Strategy() ProxyStrategy
+	// Get 用于为给定的主机选择一个代理。
+	// 若所有代理都已被剔除且都尚未到重新启用的时间，则返回ErrNoProxyAvailable。
+	Get(host string) (*url.URL, error)
+	// Report 用于报告通过某个代理进行的一次请求的结果。
+	// 参数err为nil即代表成功。
+	Report(proxy *url.URL, err error)
+	// Summary 用于获取所有代理的摘要。
+	Summary() []ProxySummaryStruct
+}
+
+// ProxySummaryStruct 代表代理摘要的类型。
+type ProxySummaryStruct struct {
+	URL                 string `json:"url"`
+	Succeeded           uint64 `json:"succeeded"`
+	Failed              uint64 `json:"failed"`
+	ConsecutiveFailures uint32 `json:"consecutive_failures"`
+	Evicted             bool   `json:"evicted"`
+}
+
+// proxyEntry 代表代理池中的代理及其健康状况。
+type proxyEntry struct {
+	// url 代表代理的URL。
+	url *url.URL
+	// succeeded 代表成功计数。
+	succeeded uint64
+	// failed 代表失败计数。
+	failed uint64
+	// consecutiveFailures 代表连续失败的次数。
+	consecutiveFailures uint32
+	// evicted 代表是否已被剔除。
+	evicted bool
+	// evictedAt 代表被剔除的时间。
+	evictedAt time.Time
+}
+
+// NewProxyPool 用于创建一个代理池。
+// 参数proxies代表代理URL的列表。
+// 参数strategy代表代理的选择策略，为空时使用轮询。
+// 参数maxFailures代表连续失败多少次之后剔除代理，为0时永不剔除。
+// 参数cooldown代表被剔除的代理在多久之后会被重新启用，为0时使用DEFAULT_PROXY_COOLDOWN。
+// 重新启用的代理只有一次试探的机会，若再次失败则会立即被剔除。
+// 参数sticky代表是否为同一主机固定使用同一个代理。
+func NewProxyPool(
+	proxies []string,
+	strategy ProxyStrategy,
+	maxFailures uint32,
+	cooldown time.Duration,
+	sticky bool) (ProxyPool, error) {
+	if len(proxies) == 0 {
+		return nil, genParameterError("empty proxy list")
+	}
+	if cooldown < 0 {
+		return nil, genParameterError(fmt.Sprintf("negative proxy cooldown: %s", cooldown))
+	}
+	if cooldown == 0 {
+		cooldown = DEFAULT_PROXY_COOLDOWN
+	}
+	switch strategy {
+	case "":
+		strategy = PROXY_STRATEGY_ROUND_ROBIN
+	case PROXY_STRATEGY_ROUND_ROBIN, PROXY_STRATEGY_RANDOM, PROXY_STRATEGY_LEAST_FAILURES:
+	default:
+		return nil, genParameterError(fmt.Sprintf("unsupported proxy strategy: %s", strategy))
+	}
+	entries := make([]*proxyEntry, 0, len(proxies))
+	for i, proxy := range proxies {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, genParameterError(fmt.Sprintf("illegal proxy[%d]: %q", i, proxy))
+		}
+		entries = append(entries, &proxyEntry{url: proxyURL})
+	}
+	pool := &myProxyPool{
+		strategy:    strategy,
+		maxFailures: maxFailures,
+		cooldown:    cooldown,
+		entries:     entries,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		now:         time.Now,
+	}
+	if sticky {
+		pool.stickyMap = map[string]*proxyEntry{}
+	}
+	return pool, nil
+}
+
+// myProxyPool 代表代理池的实现类型。
+type myProxyPool struct {
+	// strategy 代表代理的选择策略。
+	strategy ProxyStrategy
+	// maxFailures 代表剔除代理前允许的最大连续失败次数。
+	maxFailures uint32
+	// cooldown 代表被剔除的代理重新启用前的等待时间。
+	cooldown time.Duration
+	// entries 代表所有的代理。
+	entries []*proxyEntry
+	// next 代表轮询时下一个代理的索引。
+	next int
+	// random 代表随机数生成器。
+	random *rand.Rand
+	// stickyMap 代表主机与固定使用的代理的映射。若为nil，则不固定。
+	stickyMap map[string]*proxyEntry
+	// now 代表用于获取当前时间的函数。
+	now func() time.Time
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (pool *myProxyPool) Strategy() ProxyStrategy {
+	return pool.strategy
+}
+
+func (pool *myProxyPool) Get(host string) (*url.URL, error) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	pool.readmit()
+	if pool.stickyMap != nil {
+		if entry, ok := pool.stickyMap[host]; ok && !entry.evicted {
+			return entry.url, nil
+		}
+	}
+	entry := pool.selectEntry()
+	if entry == nil {
+		return nil, ErrNoProxyAvailable
+	}
+	if pool.stickyMap != nil {
+		pool.stickyMap[host] = entry
+	}
+	return entry.url, nil
+}
+
+// readmit 用于重新启用已过了等待时间的被剔除的代理。调用方需持有锁。
+func (pool *myProxyPool) readmit() {
+	now := pool.now()
+	for _, entry := range pool.entries {
+		if !entry.evicted || now.Sub(entry.evictedAt) < pool.cooldown {
+			continue
+		}
+		entry.evicted = false
+		// 只保留一次试探的机会。
+		entry.consecutiveFailures = pool.maxFailures - 1
+		logger.Infof("Readmit the proxy %s after %s.", entry.url, pool.cooldown)
+	}
+}
+
+// selectEntry 用于根据选择策略选出一个未被剔除的代理。调用方需持有锁。
+func (pool *myProxyPool) selectEntry() *proxyEntry {
+	var available []*proxyEntry
+	for _, entry := range pool.entries {
+		if !entry.evicted {
+			available = append(available, entry)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+	switch pool.strategy {
+	case PROXY_STRATEGY_RANDOM:
+		return available[pool.random.Intn(len(available))]
+	case PROXY_STRATEGY_LEAST_FAILURES:
+		selected := available[0]
+		for _, entry := range available[1:] {
+			if entry.failed < selected.failed {
+				selected = entry
+			}
+		}
+		return selected
+	default:
+		entry := available[pool.next%len(available)]
+		pool.next = (pool.next + 1) % len(available)
+		return entry
+	}
+}
+
+func (pool *myProxyPool) Report(proxy *url.URL, err error) {
+	if proxy == nil {
+		return
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	for _, entry := range pool.entries {
+		if entry.url.String() != proxy.String() {
+			continue
+		}
+		if err == nil {
+			entry.succeeded++
+			entry.consecutiveFailures = 0
+			return
+		}
+		entry.failed++
+		entry.consecutiveFailures++
+		if pool.maxFailures > 0 &&
+			entry.consecutiveFailures >= pool.maxFailures && !entry.evicted {
+			entry.evicted = true
+			entry.evictedAt = pool.now()
+			logger.Warnf("Evict the proxy %s after %d consecutive failures! (last error: %s)",
+				entry.url, entry.consecutiveFailures, err)
+		}
+		return
+	}
+}
+
+func (pool *myProxyPool) Summary() []ProxySummaryStruct {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	summaries := make([]ProxySummaryStruct, 0, len(pool.entries))
+	for _, entry := range pool.entries {
+		summaries = append(summaries, ProxySummaryStruct{
+			URL:                 entry.url.String(),
+			Succeeded:           entry.succeeded,
+			Failed:              entry.failed,
+			ConsecutiveFailures: entry.consecutiveFailures,
+			Evicted:             entry.evicted,
+		})
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].URL < summaries[j].URL
+	})
+	return summaries
+}
+
+// userAgentRotator 代表轮流提供User-Agent的工具。
+type userAgentRotator struct {
+	// agents 代表User-Agent的列表。
+	agents []string
+	// next 代表下一个User-Agent的索引。
+	next int
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+// get 用于获取下一个User-Agent。
+func (rotator *userAgentRotator) get() string {
+	rotator.lock.Lock()
+	defer rotator.lock.Unlock()
+	agent := rotator.agents[rotator.next]
+	rotator.next = (rotator.next + 1) % len(rotator.agents)
+	return agent
+}
@@ -0,0 +1,145 @@
+package downloader
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestProxyPoolNew(t *testing.T) {
+	if _, err := NewProxyPool(nil, "", 0, 0, false); err == nil {
+		t.Fatal("No error when new proxy pool with empty proxy list!")
+	}
+	if _, err := NewProxyPool([]string{"http://127.0.0.1:8080"}, "unknown", 0, 0, false); err == nil {
+		t.Fatal("No error when new proxy pool with unsupported strategy!")
+	}
+	if _, err := NewProxyPool([]string{"127.0.0.1"}, "", 0, 0, false); err == nil {
+		t.Fatal("No error when new proxy pool with illegal proxy!")
+	}
+	if _, err := NewProxyPool([]string{"http://127.0.0.1:8080"}, "", 0, -time.Second, false); err == nil {
+		t.Fatal("No error when new proxy pool with negative cooldown!")
+	}
+	pool, err := NewProxyPool([]string{"http://127.0.0.1:8080"}, "", 0, 0, false)
+	if err != nil {
+		t.Fatalf("An error occurs when new proxy pool: %s", err)
+	}
+	if pool.Strategy() != PROXY_STRATEGY_ROUND_ROBIN {
+		t.Fatalf("Inconsistent strategy: expected: %s, actual: %s",
+			PROXY_STRATEGY_ROUND_ROBIN, pool.Strategy())
+	}
+}
+
+func TestProxyPoolRoundRobin(t *testing.T) {
+	proxies := []string{"http://127.0.0.1:8081", "http://127.0.0.1:8082"}
+	pool, _ := NewProxyPool(proxies, PROXY_STRATEGY_ROUND_ROBIN, 2, 0, false)
+	for i := 0; i < 4; i++ {
+		proxyURL, err := pool.Get("example.com")
+		if err != nil {
+			t.Fatalf("An error occurs when getting proxy: %s", err)
+		}
+		expected := proxies[i%len(proxies)]
+		if proxyURL.String() != expected {
+			t.Fatalf("Inconsistent proxy: expected: %s, actual: %s", expected, proxyURL)
+		}
+	}
+	// 连续失败两次之后被剔除。
+	failed, _ := pool.Get("example.com")
+	pool.Report(failed, errors.New("failed"))
+	pool.Report(failed, errors.New("failed"))
+	for i := 0; i < 3; i++ {
+		proxyURL, _ := pool.Get("example.com")
+		if proxyURL.String() == failed.String() {
+			t.Fatalf("The evicted proxy %s is still selected!", failed)
+		}
+	}
+	other, _ := pool.Get("example.com")
+	pool.Report(other, errors.New("failed"))
+	pool.Report(other, nil)
+	pool.Report(other, errors.New("failed"))
+	if _, err := pool.Get("example.com"); err != nil {
+		t.Fatalf("The proxy %s was evicted after a success!", other)
+	}
+	pool.Report(other, errors.New("failed"))
+	if _, err := pool.Get("example.com"); err != ErrNoProxyAvailable {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrNoProxyAvailable, err)
+	}
+	for _, summary := range pool.Summary() {
+		if !summary.Evicted {
+			t.Fatalf("The proxy %s should be evicted!", summary.URL)
+		}
+	}
+}
+
+func TestProxyPoolLeastFailures(t *testing.T) {
+	proxies := []string{"http://127.0.0.1:8081", "http://127.0.0.1:8082"}
+	pool, _ := NewProxyPool(proxies, PROXY_STRATEGY_LEAST_FAILURES, 0, 0, false)
+	first, _ := pool.Get("example.com")
+	pool.Report(first, errors.New("failed"))
+	for i := 0; i < 3; i++ {
+		proxyURL, _ := pool.Get("example.com")
+		if proxyURL.String() == first.String() {
+			t.Fatalf("The proxy %s with more failures is selected!", first)
+		}
+	}
+}
+
+func TestProxyPoolSticky(t *testing.T) {
+	proxies := []string{
+		"http://127.0.0.1:8081", "http://127.0.0.1:8082", "http://127.0.0.1:8083"}
+	pool, _ := NewProxyPool(proxies, PROXY_STRATEGY_RANDOM, 1, 0, true)
+	expected, _ := pool.Get("a.example.com")
+	for i := 0; i < 10; i++ {
+		proxyURL, _ := pool.Get("a.example.com")
+		if proxyURL.String() != expected.String() {
+			t.Fatalf("Inconsistent sticky proxy: expected: %s, actual: %s",
+				expected, proxyURL)
+		}
+	}
+	pool.Report(expected, errors.New("failed"))
+	proxyURL, _ := pool.Get("a.example.com")
+	if proxyURL.String() == expected.String() {
+		t.Fatalf("The evicted sticky proxy %s is still selected!", expected)
+	}
+}
+
+func TestProxyPoolReadmit(t *testing.T) {
+	proxies := []string{"http://127.0.0.1:8081", "http://127.0.0.1:8082"}
+	p, _ := NewProxyPool(proxies, PROXY_STRATEGY_ROUND_ROBIN, 2, time.Minute, false)
+	pool := p.(*myProxyPool)
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+	for i := 0; i < 2; i++ {
+		proxyURL, _ := pool.Get("example.com")
+		pool.Report(proxyURL, errors.New("failed"))
+		pool.Report(proxyURL, errors.New("failed"))
+	}
+	if _, err := pool.Get("example.com"); err != ErrNoProxyAvailable {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrNoProxyAvailable, err)
+	}
+	// 等待时间过后，被剔除的代理会被重新启用。
+	now = now.Add(time.Minute)
+	first, err := pool.Get("example.com")
+	if err != nil {
+		t.Fatalf("An error occurs when getting readmitted proxy: %s", err)
+	}
+	for _, summary := range pool.Summary() {
+		if summary.Evicted {
+			t.Fatalf("The proxy %s is not readmitted!", summary.URL)
+		}
+	}
+	// 重新启用的代理再次失败时会被立即剔除。
+	pool.Report(first, errors.New("failed"))
+	for i := 0; i < 3; i++ {
+		proxyURL, _ := pool.Get("example.com")
+		if proxyURL.String() == first.String() {
+			t.Fatalf("The failed readmitted proxy %s is still selected!", first)
+		}
+	}
+	// 重新启用的代理成功后会恢复正常的失败计数。
+	second, _ := pool.Get("example.com")
+	pool.Report(second, nil)
+	pool.Report(second, errors.New("failed"))
+	if _, err := pool.Get("example.com"); err != nil {
+		t.Fatalf("The proxy %s was evicted after a success!", second)
+	}
+}
@@ -0,0 +1,253 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// 可续传下载的默认选项值。
+const (
+	// DEFAULT_RESUME_MIN_SIZE 代表默认的启用续传的最小响应体字节数。
+	DEFAULT_RESUME_MIN_SIZE = 1 << 20
+	// DEFAULT_RESUME_MAX_RETRIES 代表默认的最大续传次数。
+	DEFAULT_RESUME_MAX_RETRIES = 3
+)
+
+// ErrIncompleteBody 代表响应体的实际长度与声明的长度不符的错误。
+var ErrIncompleteBody = errors.New("incomplete response body")
+
+// ResumeOptions 代表可续传下载的选项。
+type ResumeOptions struct {
+	// Dir 代表存放临时文件的目录。若为空，则使用系统的临时目录。
+	Dir string
+	// MinSize 代表启用续传的最小响应体字节数，以响应头部声明的长度为准。
+	// 未声明长度或长度小于该值的响应不受影响。值为0时使用DEFAULT_RESUME_MIN_SIZE。
+	MinSize int64
+	// MaxRetries 代表读取响应体失败之后的最大续传次数。值为0时使用DEFAULT_RESUME_MAX_RETRIES。
+	MaxRetries int
+	// RetryDelay 代表每次续传之前的等待时间。
+	RetryDelay time.Duration
+}
+
+// ResumableMiddleware 用于生成可续传下载的中间件。
+// 对于状态码为200且声明的长度不小于最小字节数的响应，该中间件会把响应体完整地写入临时文件。
+// 若读取中途失败，则会带着Range头部重新请求剩余的部分，
+// 并在服务端提供了验证器（强ETag或Last-Modified）时带上If-Range头部，以免拼接出不同版本的内容。
+// 若服务端不支持续传或资源已发生变化，则会从头开始重新下载。
+// 写入完成且长度与声明的长度一致时，响应体会被替换为由临时文件支撑的响应体，
+// 关闭它时临时文件会被删除。长度不一致时会返回ErrIncompleteBody。
+func ResumableMiddleware(opts ResumeOptions) Middleware {
+	if opts.MinSize <= 0 {
+		opts.MinSize = DEFAULT_RESUME_MIN_SIZE
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = DEFAULT_RESUME_MAX_RETRIES
+	}
+	return func(next DownloadFunc) DownloadFunc {
+		return func(ctx context.Context, req *module.Request) (*module.Response, error) {
+			resp, err := next(ctx, req)
+			if err != nil || resp == nil || resp.HTTPResp() == nil {
+				return resp, err
+			}
+			httpResp := resp.HTTPResp()
+			if httpResp.StatusCode != http.StatusOK || httpResp.Body == nil ||
+				httpResp.ContentLength < opts.MinSize {
+				return resp, nil
+			}
+			download := &resumableDownload{
+				opts: opts,
+				next: next,
+				req:  req,
+			}
+			if err := download.run(ctx, httpResp); err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+}
+
+// resumableDownload 代表一次可续传的下载。
+type resumableDownload struct {
+	// opts 代表可续传下载的选项。
+	opts ResumeOptions
+	// next 代表用于发出续传请求的下载函数。
+	next DownloadFunc
+	// req 代表原始的请求。
+	req *module.Request
+	// file 代表临时文件。
+	file *os.File
+	// total 代表响应体的总长度。
+	total int64
+	// written 代表已写入临时文件的字节数。
+	written int64
+	// validator 代表用于If-Range头部的验证器。若为空，则无法安全地续传。
+	validator string
+}
+
+// run 用于把给定响应的响应体完整地写入临时文件，并在成功后用临时文件替换响应体。
+func (download *resumableDownload) run(ctx context.Context, httpResp *http.Response) error {
+	file, err := ioutil.TempFile(download.opts.Dir, "download-*")
+	if err != nil {
+		httpResp.Body.Close()
+		return err
+	}
+	download.file = file
+	download.reset(httpResp)
+	// body为nil代表上一次续传请求失败，此时会在等待之后再次发出续传请求。
+	// 读取失败和续传请求失败共用同一个重试次数，且每次重试之前都会等待RetryDelay。
+	body := httpResp.Body
+	reqURL := download.req.HTTPReq().URL
+	for retries := 0; ; {
+		if body != nil {
+			err = download.copy(body)
+			if err == nil {
+				break
+			}
+			if errors.Is(err, ErrIncompleteBody) {
+				download.cleanup()
+				return fmt.Errorf("couldn't download %s: %w", reqURL, err)
+			}
+		}
+		if ctx.Err() != nil || retries >= download.opts.MaxRetries {
+			download.cleanup()
+			return fmt.Errorf("couldn't download %s: %w", reqURL, err)
+		}
+		retries++
+		logger.Warnf("Resume the download from byte %d of %d (URL: %s, retry: %d): %s",
+			download.written, download.total, reqURL, retries, err)
+		if download.opts.RetryDelay > 0 {
+			select {
+			case <-ctx.Done():
+				download.cleanup()
+				return ctx.Err()
+			case <-time.After(download.opts.RetryDelay):
+			}
+		}
+		body, err = download.resume(ctx)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		download.cleanup()
+		return err
+	}
+	httpResp.Body = &fileBody{File: file}
+	httpResp.ContentLength = download.total
+	return nil
+}
+
+// reset 用于根据一个完整的响应重新开始下载。
+func (download *resumableDownload) reset(httpResp *http.Response) {
+	download.file.Truncate(0)
+	download.file.Seek(0, io.SeekStart)
+	download.written = 0
+	download.total = httpResp.ContentLength
+	download.validator = ""
+	if etag := httpResp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		download.validator = etag
+	} else if lastModified := httpResp.Header.Get("Last-Modified"); lastModified != "" {
+		download.validator = lastModified
+	}
+}
+
+// copy 用于把响应体追加写入临时文件，并在结束后关闭响应体。
+// 若响应体在达到总长度之前结束，则返回io.ErrUnexpectedEOF。
+func (download *resumableDownload) copy(body io.ReadCloser) error {
+	defer body.Close()
+	// 多读一个字节，以便发现超出声明长度的响应体。
+	n, err := io.Copy(download.file, io.LimitReader(body, download.total-download.written+1))
+	download.written += n
+	if download.written > download.total {
+		return fmt.Errorf("%w: more than %d bytes", ErrIncompleteBody, download.total)
+	}
+	if err != nil {
+		return err
+	}
+	if download.written < download.total {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// resume 用于请求剩余的响应体。
+// 若服务端返回了完整的响应，则会从头开始重新下载。
+func (download *resumableDownload) resume(ctx context.Context) (io.ReadCloser, error) {
+	httpReq := download.req.HTTPReq().Clone(ctx)
+	if download.validator != "" {
+		httpReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", download.written))
+		httpReq.Header.Set("If-Range", download.validator)
+	} else {
+		// 没有验证器时无法确认资源未被修改，只能从头开始。
+		httpReq.Header.Del("Range")
+		httpReq.Header.Del("If-Range")
+	}
+	resp, err := download.next(ctx, module.NewRequest(httpReq, download.req.Depth()))
+	if err != nil {
+		return nil, err
+	}
+	if resp == nil || resp.HTTPResp() == nil || resp.HTTPResp().Body == nil {
+		return nil, fmt.Errorf("no response body for %s", httpReq.URL)
+	}
+	httpResp := resp.HTTPResp()
+	switch httpResp.StatusCode {
+	case http.StatusPartialContent:
+		if download.validator == "" {
+			break
+		}
+		start, total, ok := parseContentRange(httpResp.Header.Get("Content-Range"))
+		if !ok || start != download.written || total != download.total {
+			httpResp.Body.Close()
+			return nil, fmt.Errorf("unexpected content range %q (expected start: %d, total: %d)",
+				httpResp.Header.Get("Content-Range"), download.written, download.total)
+		}
+		return httpResp.Body, nil
+	case http.StatusOK:
+		if httpResp.ContentLength < 0 {
+			break
+		}
+		logger.Warnf("Restart the download from the beginning. (URL: %s)", httpReq.URL)
+		download.reset(httpResp)
+		return httpResp.Body, nil
+	}
+	httpResp.Body.Close()
+	return nil, fmt.Errorf("unexpected status code %d when resuming the download of %s",
+		httpResp.StatusCode, httpReq.URL)
+}
+
+// cleanup 用于关闭并删除临时文件。
+func (download *resumableDownload) cleanup() {
+	download.file.Close()
+	os.Remove(download.file.Name())
+}
+
+// parseContentRange 用于解析形如“bytes 100-199/200”的Content-Range头部，
+// 并返回起始位置和总长度。
+func parseContentRange(value string) (start int64, total int64, ok bool) {
+	var end int64
+	n, err := fmt.Sscanf(value, "bytes %d-%d/%d", &start, &end, &total)
+	if err != nil || n != 3 || start < 0 || end < start || total <= end {
+		return 0, 0, false
+	}
+	return start, total, true
+}
+
+// fileBody 代表由临时文件支撑的响应体。关闭它时临时文件会被删除。
+type fileBody struct {
+	*os.File
+}
+
+func (body *fileBody) Close() error {
+	err := body.File.Close()
+	if removeErr := os.Remove(body.File.Name()); err == nil {
+		err = removeErr
+	}
+	return err
+}
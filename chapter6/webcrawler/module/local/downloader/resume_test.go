@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// resumeTestingServer 代表测试可续传下载用的HTTP服务器的状态。
+type resumeTestingServer struct {
+	// content 代表资源的内容。
+	content string
+	// etag 代表资源的ETag。若为空，则不提供任何验证器。
+	etag string
+	// drops 代表需要在中途断开连接的响应的数量。
+	drops int
+	// failures 代表需要以状态码503拒绝的续传请求的数量。
+	failures int
+	// lock 代表用于保护以下字段的互斥锁。
+	lock sync.Mutex
+	// ranges 代表收到的所有请求的Range头部。
+	ranges []string
+}
+
+// genResumeTestingServer 用于生成测试可续传下载用的HTTP服务器。
+// 在前drops个响应中，服务器只写出一半的剩余内容就断开连接。
+// 前failures个续传请求会被直接拒绝。
+func genResumeTestingServer(state *resumeTestingServer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			state.lock.Lock()
+			rangeHeader := r.Header.Get("Range")
+			state.ranges = append(state.ranges, rangeHeader)
+			drop := state.drops > 0
+			if drop {
+				state.drops--
+			}
+			fail := rangeHeader != "" && state.failures > 0
+			if fail {
+				state.failures--
+			}
+			state.lock.Unlock()
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			content := state.content
+			if state.etag != "" {
+				w.Header().Set("ETag", state.etag)
+			}
+			var start int
+			if rangeHeader != "" && r.Header.Get("If-Range") == state.etag {
+				fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+				w.Header().Set("Content-Range",
+					fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+			}
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)-start))
+			if start > 0 {
+				w.WriteHeader(http.StatusPartialContent)
+			}
+			rest := content[start:]
+			if drop {
+				w.Write([]byte(rest[:len(rest)/2]))
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+			w.Write([]byte(rest))
+		}))
+}
+
+// downloadWithResume 用于通过可续传下载的中间件下载给定URL的内容。
+func downloadWithResume(url string, opts ResumeOptions) (*module.Response, error) {
+	dOpts := Options{Middlewares: []Middleware{ResumableMiddleware(opts)}}
+	d, _ := NewWithOptions("D1|127.0.0.1:8080", &http.Client{}, nil, dOpts)
+	httpReq, _ := http.NewRequest("GET", url, nil)
+	return d.Download(module.NewRequest(httpReq, 0))
+}
+
+// countFiles 用于获取给定目录中的文件数量。
+func countFiles(dir string, t *testing.T) int {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("An error occurs when reading directory %s: %s", dir, err)
+	}
+	return len(infos)
+}
+
+func TestResumableMiddleware(t *testing.T) {
+	content := strings.Repeat("0123456789", 100)
+	state := &resumeTestingServer{content: content, etag: `"v1"`, drops: 2}
+	server := genResumeTestingServer(state)
+	defer server.Close()
+	dir := t.TempDir()
+	opts := ResumeOptions{Dir: dir, MinSize: 100}
+	resp, err := downloadWithResume(server.URL, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if _, ok := resp.HTTPResp().Body.(*fileBody); !ok {
+		t.Fatalf("Inconsistent body type: expected: %T, actual: %T",
+			&fileBody{}, resp.HTTPResp().Body)
+	}
+	if resp.HTTPResp().ContentLength != int64(len(content)) {
+		t.Fatalf("Inconsistent content length: expected: %d, actual: %d",
+			len(content), resp.HTTPResp().ContentLength)
+	}
+	if body := readBody(resp, t); body != content {
+		t.Fatalf("Inconsistent response body: expected: %d bytes, actual: %d bytes",
+			len(content), len(body))
+	}
+	expectedRanges := []string{"", "bytes=500-", "bytes=750-"}
+	if fmt.Sprint(state.ranges) != fmt.Sprint(expectedRanges) {
+		t.Fatalf("Inconsistent range headers: expected: %q, actual: %q",
+			expectedRanges, state.ranges)
+	}
+	if n := countFiles(dir, t); n != 0 {
+		t.Fatalf("Inconsistent temporary file count: expected: %d, actual: %d", 0, n)
+	}
+}
+
+func TestResumableMiddlewareRestart(t *testing.T) {
+	content := strings.Repeat("x", 200)
+	// 没有验证器时只能从头开始。
+	state := &resumeTestingServer{content: content, drops: 1}
+	server := genResumeTestingServer(state)
+	defer server.Close()
+	resp, err := downloadWithResume(server.URL, ResumeOptions{Dir: t.TempDir(), MinSize: 100})
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if body := readBody(resp, t); body != content {
+		t.Fatalf("Inconsistent response body: expected: %d bytes, actual: %d bytes",
+			len(content), len(body))
+	}
+	expectedRanges := []string{"", ""}
+	if fmt.Sprint(state.ranges) != fmt.Sprint(expectedRanges) {
+		t.Fatalf("Inconsistent range headers: expected: %q, actual: %q",
+			expectedRanges, state.ranges)
+	}
+}
+
+func TestResumableMiddlewareFailure(t *testing.T) {
+	state := &resumeTestingServer{content: strings.Repeat("x", 200), etag: `"v1"`, drops: 10}
+	server := genResumeTestingServer(state)
+	defer server.Close()
+	dir := t.TempDir()
+	opts := ResumeOptions{Dir: dir, MinSize: 100, MaxRetries: 2}
+	if _, err := downloadWithResume(server.URL, opts); err == nil {
+		t.Fatal("No error when the download keeps failing!")
+	}
+	if len(state.ranges) != 3 {
+		t.Fatalf("Inconsistent request count: expected: %d, actual: %d", 3, len(state.ranges))
+	}
+	if n := countFiles(dir, t); n != 0 {
+		t.Fatalf("Inconsistent temporary file count: expected: %d, actual: %d", 0, n)
+	}
+}
+
+func TestResumableMiddlewareResumeFailure(t *testing.T) {
+	content := strings.Repeat("x", 200)
+	delay := 20 * time.Millisecond
+	// 续传请求失败时同样会在等待之后重试，并计入重试次数。
+	state := &resumeTestingServer{content: content, etag: `"v1"`, drops: 1, failures: 2}
+	server := genResumeTestingServer(state)
+	defer server.Close()
+	opts := ResumeOptions{Dir: t.TempDir(), MinSize: 100, MaxRetries: 3, RetryDelay: delay}
+	start := time.Now()
+	resp, err := downloadWithResume(server.URL, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 3*delay {
+		t.Fatalf("Inconsistent elapsed time: expected: >= %s, actual: %s", 3*delay, elapsed)
+	}
+	if body := readBody(resp, t); body != content {
+		t.Fatalf("Inconsistent response body: expected: %d bytes, actual: %d bytes",
+			len(content), len(body))
+	}
+	expectedRanges := []string{"", "bytes=100-", "bytes=100-", "bytes=100-"}
+	if fmt.Sprint(state.ranges) != fmt.Sprint(expectedRanges) {
+		t.Fatalf("Inconsistent range headers: expected: %q, actual: %q",
+			expectedRanges, state.ranges)
+	}
+	// 重试次数用尽之后不会再发出续传请求。
+	state = &resumeTestingServer{content: content, etag: `"v1"`, drops: 1, failures: 10}
+	server2 := genResumeTestingServer(state)
+	defer server2.Close()
+	dir := t.TempDir()
+	opts = ResumeOptions{Dir: dir, MinSize: 100, MaxRetries: 2, RetryDelay: delay}
+	if _, err := downloadWithResume(server2.URL, opts); err == nil {
+		t.Fatal("No error when the resume requests keep failing!")
+	}
+	if len(state.ranges) != 3 {
+		t.Fatalf("Inconsistent request count: expected: %d, actual: %d", 3, len(state.ranges))
+	}
+	if n := countFiles(dir, t); n != 0 {
+		t.Fatalf("Inconsistent temporary file count: expected: %d, actual: %d", 0, n)
+	}
+}
+
+func TestResumableMiddlewareSmallBody(t *testing.T) {
+	state := &resumeTestingServer{content: strings.Repeat("x", 50)}
+	server := genResumeTestingServer(state)
+	defer server.Close()
+	resp, err := downloadWithResume(server.URL, ResumeOptions{Dir: t.TempDir(), MinSize: 100})
+	if err != nil {
+		t.Fatalf("An error occurs when downloading content: %s", err)
+	}
+	if _, ok := resp.HTTPResp().Body.(*fileBody); ok {
+		t.Fatal("The small response body has been written to a temporary file!")
+	}
+	if body := readBody(resp, t); len(body) != 50 {
+		t.Fatalf("Inconsistent body length: expected: %d, actual: %d", 50, len(body))
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	start, total, ok := parseContentRange("bytes 100-199/200")
+	if !ok || start != 100 || total != 200 {
+		t.Fatalf("Inconsistent content range: expected: %d/%d, actual: %d/%d (ok: %v)",
+			100, 200, start, total, ok)
+	}
+	for _, value := range []string{"", "bytes */200", "bytes 100-99/200", "bytes 0-199/199"} {
+		if _, _, ok := parseContentRange(value); ok {
+			t.Fatalf("No error when parsing invalid content range %q!", value)
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
+	"time"
+
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/module/stub"
 	"gopcp.v2/helper/log"
@@ -10,11 +14,49 @@ import (
 // logger 代表日志记录器。
 var logger = log.DLogger()
 
+// Options 代表条目处理管道的选项。
+type Options struct {
+	// Schema 代表条目模式。若它不为nil，则条目会在被处理之前接受校验，
+	// 未通过校验的条目不会被交给任何条目处理函数。
+	Schema *module.Schema
+	// DeadLetter 代表死信接收器。
+	// 若它不为nil，则未通过校验的条目会连同校验错误一起被放入其中。
+	DeadLetter DeadLetterSink
+	// Flushers 代表需要随条目处理管道一起写出缓冲数据的对象的列表，
+	// 例如条目处理函数所属的文件接收器。
+	// 调度器停止时会调用条目处理管道的Flush方法，进而调用它们的Flush方法。
+	Flushers []module.Flusher
+}
+
+// DeadLetterSink 代表死信接收器的接口类型。
+// 其实现类型必须是并发安全的。
+type DeadLetterSink interface {
+	// PutItem 用于放入一个无效的条目及其错误。
+	PutItem(item module.Item, errs []error) error
+}
+
+// DeadLetterFunc 代表函数形式的死信接收器。
+type DeadLetterFunc func(item module.Item, errs []error) error
+
+// PutItem 会调用函数自身。
+func (f DeadLetterFunc) PutItem(item module.Item, errs []error) error {
+	return f(item, errs)
+}
+
 // New 用于创建一个条目处理管道实例。
 func New(
 	mid module.MID,
 	itemProcessors []module.ProcessItem,
 	scoreCalculator module.CalculateScore) (module.Pipeline, error) {
+	return NewWithOptions(mid, itemProcessors, scoreCalculator, Options{})
+}
+
+// NewWithOptions 用于根据给定的选项创建一个条目处理管道实例。
+func NewWithOptions(
+	mid module.MID,
+	itemProcessors []module.ProcessItem,
+	scoreCalculator module.CalculateScore,
+	opts Options) (module.Pipeline, error) {
 
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
@@ -26,6 +68,12 @@ func New(
 	if len(itemProcessors) == 0 {
 		return nil, genParameterError("empty item processor list")
 	}
+	for i, flusher := range opts.Flushers {
+		if flusher == nil {
+			err := genParameterError(fmt.Sprintf("nil flusher[%d]", i))
+			return nil, err
+		}
+	}
 	var innerProcessors []module.ProcessItem
 	for i, pipeline := range itemProcessors {
 		if pipeline == nil {
@@ -37,6 +85,7 @@ func New(
 	return &myPipeline{
 		ModuleInternal: moduleBase,
 		itemProcessors: innerProcessors,
+		opts:           opts,
 	}, nil
 }
 
@@ -48,6 +97,12 @@ type myPipeline struct {
 	itemProcessors []module.ProcessItem
 	// failFast 代表处理是否需要快速失败。
 	failFast bool
+	// opts 代表条目处理管道的选项。
+	opts Options
+	// invalidCount 代表未通过校验的条目的数量。
+	invalidCount uint64
+	// deadLetterCount 代表被放入死信接收器的条目的数量。
+	deadLetterCount uint64
 }
 
 func (pipeline *myPipeline) ItemProcessors() []module.ProcessItem {
@@ -57,6 +112,21 @@ func (pipeline *myPipeline) ItemProcessors() []module.ProcessItem {
 }
 
 func (pipeline *myPipeline) Send(item module.Item) []error {
+	return pipeline.send(nil, item)
+}
+
+// SendContext 会在调用每个条目处理函数之前检查给定的上下文。
+// 上下文被取消或超时的时候，后续的条目处理函数都会被忽略。
+func (pipeline *myPipeline) SendContext(ctx context.Context, item module.Item) []error {
+	if ctx == nil {
+		return []error{genParameterError("nil context")}
+	}
+	return pipeline.send(ctx, item)
+}
+
+// send 用于处理条目。
+// 若参数ctx为nil，则不检查上下文。
+func (pipeline *myPipeline) send(ctx context.Context, item module.Item) []error {
 
 	pipeline.ModuleInternal.IncrHandlingNumber()
 	defer pipeline.ModuleInternal.DecrHandlingNumber()
@@ -68,10 +138,29 @@ func (pipeline *myPipeline) Send(item module.Item) []error {
 		errs = append(errs, err)
 		return errs
 	}
+	// 条目在被处理完毕或被拒绝之后都会被关闭，以免其中未被条目处理函数关闭的读取器一直占用资源。
+	var currentItem = item
+	defer func() {
+		if err := module.CloseItem(item, currentItem); err != nil {
+			logger.Warnf("An error occurs when closing item: %s (pipeline: %s)\n",
+				err, pipeline.ID())
+		}
+	}()
+	if pipeline.opts.Schema != nil {
+		if errs := pipeline.opts.Schema.Validate(item); len(errs) > 0 {
+			pipeline.reject(item, errs)
+			return errs
+		}
+	}
 	pipeline.ModuleInternal.IncrAcceptedCount()
 	logger.Infof("Process item %+v... \n", item)
-	var currentItem = item
+	startTime := time.Now()
 	for _, processor := range pipeline.itemProcessors {
+		if ctx != nil && ctx.Err() != nil {
+			errs = append(errs, genError(
+				fmt.Sprintf("processing aborted: %s", ctx.Err())))
+			break
+		}
 		processedItem, err := processor(currentItem)
 		if err != nil {
 			errs = append(errs, err)
@@ -84,12 +173,42 @@ func (pipeline *myPipeline) Send(item module.Item) []error {
 			currentItem = processedItem
 		}
 	}
+	pipeline.ModuleInternal.RecordLatency(time.Since(startTime))
 	if len(errs) == 0 {
 		pipeline.ModuleInternal.IncrCompletedCount()
+	} else {
+		pipeline.ModuleInternal.IncrFailedCount()
 	}
 	return errs
 }
 
+// reject 用于记录未通过校验的条目，并在必要时把它放入死信接收器。
+func (pipeline *myPipeline) reject(item module.Item, errs []error) {
+	atomic.AddUint64(&pipeline.invalidCount, 1)
+	logger.Warnf("Invalid item %+v: %v (pipeline: %s)\n",
+		item, errs, pipeline.ID())
+	if pipeline.opts.DeadLetter == nil {
+		return
+	}
+	if err := pipeline.opts.DeadLetter.PutItem(item, errs); err != nil {
+		logger.Errorf("Couldn't put item into dead letter sink: %s (pipeline: %s)\n",
+			err, pipeline.ID())
+		return
+	}
+	atomic.AddUint64(&pipeline.deadLetterCount, 1)
+}
+
+// Flush 会依次调用选项中各个对象的Flush方法，并返回第一个错误。
+func (pipeline *myPipeline) Flush() error {
+	var firstErr error
+	for _, flusher := range pipeline.opts.Flushers {
+		if err := flusher.Flush(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
 func (pipeline *myPipeline) FailFast() bool {
 	return pipeline.failFast
 }
@@ -100,15 +219,24 @@ func (pipeline *myPipeline) SetFailFast(failFast bool) {
 
 // extraSummaryStruct 代表条目处理管道实额外信息的摘要类型。
 type extraSummaryStruct struct {
-	FailFast        bool `json:"fail_fast"`
-	ProcessorNumber int  `json:"processor_number"`
+	FailFast        bool   `json:"fail_fast"`
+	ProcessorNumber int    `json:"processor_number"`
+	SchemaFields    int    `json:"schema_fields,omitempty"`
+	InvalidCount    uint64 `json:"invalid_count,omitempty"`
+	DeadLetterCount uint64 `json:"dead_letter_count,omitempty"`
 }
 
 func (pipeline *myPipeline) Summary() module.SummaryStruct {
 	summary := pipeline.ModuleInternal.Summary()
-	summary.Extra = extraSummaryStruct{
+	extra := extraSummaryStruct{
 		FailFast:        pipeline.failFast,
 		ProcessorNumber: len(pipeline.itemProcessors),
+		InvalidCount:    atomic.LoadUint64(&pipeline.invalidCount),
+		DeadLetterCount: atomic.LoadUint64(&pipeline.deadLetterCount),
+	}
+	if pipeline.opts.Schema != nil {
+		extra.SchemaFields = len(pipeline.opts.Schema.Fields())
 	}
+	summary.Extra = extra
 	return summary
 }
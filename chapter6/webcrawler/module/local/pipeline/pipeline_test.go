@@ -1,8 +1,10 @@
 package pipeline
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"testing"
 
 	"gopcp.v2/chapter6/webcrawler/module"
@@ -123,6 +125,42 @@ func TestSend(t *testing.T) {
 	}
 }
 
+func TestSendContext(t *testing.T) {
+	mid := module.MID("P1|127.0.0.1:8080")
+	processors := []module.ProcessItem{
+		genTestingItemProccessor(false),
+		genTestingItemProccessor(false),
+	}
+	p, err := New(mid, processors, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s (mid: %s)",
+			err, mid)
+	}
+	cp, ok := p.(module.ContextPipeline)
+	if !ok {
+		t.Fatalf("The pipeline %T doesn't implement module.ContextPipeline!", p)
+	}
+	item := module.Item{"number": 0}
+	if errs := cp.SendContext(context.Background(), item); len(errs) != 0 {
+		t.Fatalf("An error occurs when sending item with context: %s", errs[0])
+	}
+	if item["number"] != 2 {
+		t.Fatalf("Inconsistent number: expected: %d, actual: %v", 2, item["number"])
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	item = module.Item{"number": 0}
+	if errs := cp.SendContext(ctx, item); len(errs) == 0 {
+		t.Fatal("No error when sending item with canceled context!")
+	}
+	if item["number"] != 0 {
+		t.Fatalf("The item was processed with canceled context! (number: %v)", item["number"])
+	}
+	if errs := cp.SendContext(nil, item); len(errs) == 0 {
+		t.Fatal("No error when sending item with nil context!")
+	}
+}
+
 func TestFailFast(t *testing.T) {
 	mid := module.MID("D1|127.0.0.1:8080")
 	processors := []module.ProcessItem{genTestingItemProccessor(false)}
@@ -200,6 +238,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, pi.HandlingNumber())
 	}
+	if pi.Counts().FailedCount != 1 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			1, pi.Counts().FailedCount)
+	}
 	// 测试参数有误时的计数。
 	processors = []module.ProcessItem{genTestingItemProccessor(false)}
 	p, err = New(mid, processors, nil)
@@ -228,6 +270,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, pi.HandlingNumber())
 	}
+	if pi.Counts().FailedCount != 0 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			0, pi.Counts().FailedCount)
+	}
 	// 测试处理成功完成时的计数。
 	processors = []module.ProcessItem{genTestingItemProccessor(false)}
 	p, err = New(mid, processors, nil)
@@ -256,6 +302,10 @@ func TestCount(t *testing.T) {
 		t.Fatalf("Inconsistent handling number for internal module: expected: %d, actual: %d",
 			0, pi.HandlingNumber())
 	}
+	if pi.Counts().FailedCount != 0 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			0, pi.Counts().FailedCount)
+	}
 }
 
 func TestSummary(t *testing.T) {
@@ -299,6 +349,154 @@ func TestSummary(t *testing.T) {
 	}
 }
 
+func TestSendWithSchema(t *testing.T) {
+	mid := module.MID("D1|127.0.0.1:8080")
+	schema, err := module.NewSchema([]module.Field{
+		{Name: "number", Type: module.FIELD_INT, Required: true},
+	}, false)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a schema: %s", err)
+	}
+	var deadItems []module.Item
+	var deadErrs [][]error
+	opts := Options{
+		Schema: schema,
+		DeadLetter: DeadLetterFunc(func(item module.Item, errs []error) error {
+			deadItems = append(deadItems, item)
+			deadErrs = append(deadErrs, errs)
+			return nil
+		}),
+	}
+	processors := []module.ProcessItem{genTestingItemProccessor(false)}
+	p, err := NewWithOptions(mid, processors, nil, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s (mid: %s, opts: %#v)",
+			err, mid, opts)
+	}
+	if errs := p.Send(module.Item{"number": 1}); len(errs) != 0 {
+		t.Fatalf("An error occurs when sending valid item: %v", errs)
+	}
+	invalidItem := module.Item{"number": "1"}
+	errs := p.Send(invalidItem)
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	if fe, ok := errs[0].(*module.FieldError); !ok || fe.Field != "number" {
+		t.Fatalf("Inconsistent validation error: %#v", errs[0])
+	}
+	if invalidItem["number"] != "1" {
+		t.Fatal("The invalid item has been processed!")
+	}
+	if len(deadItems) != 1 || deadItems[0]["number"] != "1" || len(deadErrs[0]) != 1 {
+		t.Fatalf("Inconsistent dead letters: items: %v, errors: %v", deadItems, deadErrs)
+	}
+	if p.AcceptedCount() != 1 || p.CalledCount() != 2 {
+		t.Fatalf("Inconsistent counts: called: %d, accepted: %d",
+			p.CalledCount(), p.AcceptedCount())
+	}
+	extra := p.Summary().Extra.(extraSummaryStruct)
+	if extra.SchemaFields != 1 || extra.InvalidCount != 1 || extra.DeadLetterCount != 1 {
+		t.Fatalf("Inconsistent extra summary: %#v", extra)
+	}
+	// 死信接收器出错的情况。
+	opts.DeadLetter = DeadLetterFunc(func(item module.Item, errs []error) error {
+		return errors.New("unavailable")
+	})
+	p, _ = NewWithOptions(mid, processors, nil, opts)
+	if errs := p.Send(module.Item{}); len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	extra = p.Summary().Extra.(extraSummaryStruct)
+	if extra.InvalidCount != 1 || extra.DeadLetterCount != 0 {
+		t.Fatalf("Inconsistent extra summary: %#v", extra)
+	}
+}
+
+// testingCloser 代表测试用的记录关闭次数的读取器。
+type testingCloser struct {
+	count int
+}
+
+func (c *testingCloser) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (c *testingCloser) Close() error {
+	c.count++
+	return nil
+}
+
+func TestSendClosesItem(t *testing.T) {
+	mid := module.MID("D1|127.0.0.1:8080")
+	schema, _ := module.NewSchema([]module.Field{
+		{Name: "number", Type: module.FIELD_INT, Required: true},
+	}, false)
+	processors := []module.ProcessItem{
+		genTestingItemProccessor(true),
+		genTestingItemProccessor(false),
+	}
+	p, err := NewWithOptions(mid, processors, nil, Options{Schema: schema})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s (mid: %s)", err, mid)
+	}
+	p.SetFailFast(true)
+	// 被拒绝的条目和因之前的条目处理函数失败而未被处理完的条目中的读取器都会被关闭。
+	for _, number := range []interface{}{"1", 1} {
+		body := &testingCloser{}
+		if errs := p.Send(module.Item{"number": number, "body": body}); len(errs) != 1 {
+			t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+		}
+		if body.count != 1 {
+			t.Fatalf("Inconsistent close count (number: %v): expected: %d, actual: %d",
+				number, 1, body.count)
+		}
+	}
+}
+
+// testingFlusher 代表测试用的可写出缓冲数据的对象。
+type testingFlusher struct {
+	count int
+	err   error
+}
+
+func (f *testingFlusher) Flush() error {
+	f.count++
+	return f.err
+}
+
+func TestFlush(t *testing.T) {
+	mid := module.MID("D1|127.0.0.1:8080")
+	processors := []module.ProcessItem{genTestingItemProccessor(false)}
+	if _, err := NewWithOptions(mid, processors, nil,
+		Options{Flushers: []module.Flusher{nil}}); err == nil {
+		t.Fatal("No error when create a pipeline with nil flusher!")
+	}
+	flushers := []*testingFlusher{
+		{err: errors.New("first")}, {err: errors.New("second")}, {}}
+	opts := Options{}
+	for _, f := range flushers {
+		opts.Flushers = append(opts.Flushers, f)
+	}
+	p, err := NewWithOptions(mid, processors, nil, opts)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s (mid: %s, opts: %#v)",
+			err, mid, opts)
+	}
+	flusher, ok := p.(module.Flusher)
+	if !ok {
+		t.Fatal("The pipeline didn't implement module.Flusher!")
+	}
+	if err := flusher.Flush(); err == nil || err.Error() != "first" {
+		t.Fatalf("Inconsistent flush error: expected: %s, actual: %v", "first", err)
+	}
+	for i, f := range flushers {
+		if f.count != 1 {
+			t.Fatalf("Inconsistent flush count of flusher[%d]: expected: %d, actual: %d",
+				i, 1, f.count)
+		}
+	}
+}
+
 func genTestingItemProccessor(fail bool) module.ProcessItem {
 	if fail {
 		return func(item module.Item) (result module.Item, err error) {
@@ -0,0 +1,176 @@
+package sinks
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RotateOptions 代表文件轮转的选项。
+type RotateOptions struct {
+	// MaxSize 代表单个文件在压缩之前的最大字节数。值为0时不按大小轮转。
+	MaxSize int64
+	// Interval 代表单个文件的最长写入时间。值为0时不按时间轮转。
+	Interval time.Duration
+	// Gzip 代表是否使用gzip压缩文件。
+	Gzip bool
+}
+
+// check 用于检查选项的合法性。
+func (opts RotateOptions) check() error {
+	if opts.MaxSize < 0 {
+		return genParameterError(fmt.Sprintf("negative max size %d", opts.MaxSize))
+	}
+	if opts.Interval < 0 {
+		return genParameterError(fmt.Sprintf("negative interval %s", opts.Interval))
+	}
+	return nil
+}
+
+// rotatingFile 代表可轮转的文件。
+// 给定的路径只用于生成文件名，实际写入的每个文件的名称都会带有时间戳和序号，
+// 例如：路径items.jsonl对应的文件名会形如items-20060102T150405-0001.jsonl。
+// 该类型不是并发安全的。
+type rotatingFile struct {
+	// prefix 代表文件路径中扩展名之前的部分。
+	prefix string
+	// ext 代表文件的扩展名。
+	ext string
+	// opts 代表轮转选项。
+	opts RotateOptions
+	// header 代表每个文件开头的内容。
+	header []byte
+	// file 代表当前的文件。
+	file *os.File
+	// gzipWriter 代表当前文件的gzip写入器。
+	gzipWriter *gzip.Writer
+	// writer 代表当前文件的缓冲写入器。
+	writer *bufio.Writer
+	// size 代表当前文件在压缩之前已写入的字节数。
+	size int64
+	// openedAt 代表当前文件的创建时间。
+	openedAt time.Time
+	// seq 代表文件的序号。
+	seq uint64
+	// paths 代表所有已创建的文件的路径。
+	paths []string
+	// now 用于获取当前时间。
+	now func() time.Time
+}
+
+// newRotatingFile 用于创建一个可轮转的文件。
+func newRotatingFile(path string, header []byte, opts RotateOptions) (*rotatingFile, error) {
+	if path == "" {
+		return nil, genParameterError("empty file path")
+	}
+	if err := opts.check(); err != nil {
+		return nil, err
+	}
+	ext := filepath.Ext(path)
+	return &rotatingFile{
+		prefix: strings.TrimSuffix(path, ext),
+		ext:    ext,
+		opts:   opts,
+		header: header,
+		now:    time.Now,
+	}, nil
+}
+
+// write 用于写入数据，并在必要时轮转文件。
+// 一次写入的数据总会被写入同一个文件。
+func (rf *rotatingFile) write(p []byte) error {
+	if rf.file != nil && rf.shouldRotate(len(p)) {
+		if err := rf.closeFile(); err != nil {
+			return err
+		}
+	}
+	if rf.file == nil {
+		if err := rf.openFile(); err != nil {
+			return err
+		}
+	}
+	n, err := rf.writer.Write(p)
+	rf.size += int64(n)
+	return err
+}
+
+// shouldRotate 用于判断在写入给定长度的数据之前是否需要轮转文件。
+func (rf *rotatingFile) shouldRotate(length int) bool {
+	if rf.size <= int64(len(rf.header)) {
+		return false
+	}
+	if rf.opts.MaxSize > 0 && rf.size+int64(length) > rf.opts.MaxSize {
+		return true
+	}
+	if rf.opts.Interval > 0 && rf.now().Sub(rf.openedAt) >= rf.opts.Interval {
+		return true
+	}
+	return false
+}
+
+// openFile 用于创建一个新的文件并写入开头的内容。
+func (rf *rotatingFile) openFile() error {
+	if err := os.MkdirAll(filepath.Dir(rf.prefix), 0755); err != nil {
+		return err
+	}
+	openedAt := rf.now()
+	var file *os.File
+	var path string
+	for {
+		rf.seq++
+		path = fmt.Sprintf("%s-%s-%04d%s",
+			rf.prefix, openedAt.Format("20060102T150405"), rf.seq, rf.ext)
+		if rf.opts.Gzip {
+			path += ".gz"
+		}
+		var err error
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			break
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+	}
+	var w io.Writer = file
+	if rf.opts.Gzip {
+		rf.gzipWriter = gzip.NewWriter(file)
+		w = rf.gzipWriter
+	}
+	rf.file = file
+	rf.writer = bufio.NewWriter(w)
+	rf.size = 0
+	rf.openedAt = openedAt
+	rf.paths = append(rf.paths, path)
+	if len(rf.header) > 0 {
+		n, err := rf.writer.Write(rf.header)
+		rf.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+// closeFile 用于写出缓冲的数据并关闭当前的文件。
+func (rf *rotatingFile) closeFile() error {
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.writer.Flush()
+	if rf.gzipWriter != nil {
+		if gzErr := rf.gzipWriter.Close(); err == nil {
+			err = gzErr
+		}
+		rf.gzipWriter = nil
+	}
+	if closeErr := rf.file.Close(); err == nil {
+		err = closeErr
+	}
+	rf.file = nil
+	rf.writer = nil
+	return err
+}
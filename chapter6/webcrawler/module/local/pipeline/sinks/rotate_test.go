@@ -0,0 +1,116 @@
+package sinks
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileNew(t *testing.T) {
+	if _, err := newRotatingFile("", nil, RotateOptions{}); err == nil {
+		t.Fatal("No error when creating rotating file with empty path!")
+	}
+	if _, err := newRotatingFile("a.log", nil, RotateOptions{MaxSize: -1}); err == nil {
+		t.Fatal("No error when creating rotating file with negative max size!")
+	}
+	if _, err := newRotatingFile("a.log", nil, RotateOptions{Interval: -1}); err == nil {
+		t.Fatal("No error when creating rotating file with negative interval!")
+	}
+}
+
+func TestRotatingFileBySize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	rf, err := newRotatingFile(filepath.Join(dir, "sub", "out.txt"),
+		[]byte("h\n"), RotateOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("An error occurs when creating rotating file: %s", err)
+	}
+	// 超过最大字节数的单次写入不会被拆分到多个文件中。
+	for _, line := range []string{"1234\n", "5678\n", "0123456789ab\n", "c\n"} {
+		if err := rf.write([]byte(line)); err != nil {
+			t.Fatalf("An error occurs when writing: %s", err)
+		}
+	}
+	if err := rf.closeFile(); err != nil {
+		t.Fatalf("An error occurs when closing: %s", err)
+	}
+	expectedContents := []string{"h\n1234\n", "h\n5678\n", "h\n0123456789ab\n", "h\nc\n"}
+	if len(rf.paths) != len(expectedContents) {
+		t.Fatalf("Inconsistent file number: expected: %d, actual: %d (paths: %v)",
+			len(expectedContents), len(rf.paths), rf.paths)
+	}
+	for i, path := range rf.paths {
+		if !strings.HasPrefix(filepath.Base(path), "out-") || filepath.Ext(path) != ".txt" {
+			t.Fatalf("Unexpected file name: %s", path)
+		}
+		content, _ := ioutil.ReadFile(path)
+		if string(content) != expectedContents[i] {
+			t.Fatalf("Inconsistent content of file %s: expected: %q, actual: %q",
+				path, expectedContents[i], content)
+		}
+	}
+}
+
+func TestRotatingFileByTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	rf, err := newRotatingFile(filepath.Join(dir, "out.txt"), nil,
+		RotateOptions{Interval: time.Minute, Gzip: true})
+	if err != nil {
+		t.Fatalf("An error occurs when creating rotating file: %s", err)
+	}
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	rf.now = func() time.Time { return now }
+	rf.write([]byte("a"))
+	now = now.Add(30 * time.Second)
+	rf.write([]byte("b"))
+	now = now.Add(30 * time.Second)
+	rf.write([]byte("c"))
+	rf.closeFile()
+	expectedContents := []string{"ab", "c"}
+	if len(rf.paths) != len(expectedContents) {
+		t.Fatalf("Inconsistent file number: expected: %d, actual: %d (paths: %v)",
+			len(expectedContents), len(rf.paths), rf.paths)
+	}
+	expectedPath := filepath.Join(dir, "out-20261018T080000-0001.txt.gz")
+	if rf.paths[0] != expectedPath {
+		t.Fatalf("Inconsistent file path: expected: %s, actual: %s",
+			expectedPath, rf.paths[0])
+	}
+	for i, path := range rf.paths {
+		content := readGzipFile(t, path)
+		if content != expectedContents[i] {
+			t.Fatalf("Inconsistent content of file %s: expected: %q, actual: %q",
+				path, expectedContents[i], content)
+		}
+	}
+}
+
+// readGzipFile 用于读取gzip文件解压后的内容。
+func readGzipFile(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("An error occurs when opening file %s: %s", path, err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("An error occurs when creating gzip reader: %s", err)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("An error occurs when reading gzip file %s: %s", path, err)
+	}
+	return string(content)
+}
@@ -0,0 +1,200 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// Sink 代表把条目写入文件的接收器的接口类型。
+// 其Process方法可以被用作条目处理函数，也可以被多个条目处理管道共用。
+// 该接口的实现类型是并发安全的。
+type Sink interface {
+	// Process 用于写入条目，并原样返回该条目以便后续的条目处理函数继续处理。
+	// 其签名与module.ProcessItem一致。
+	Process(item module.Item) (module.Item, error)
+	// Flush 用于写出缓冲的数据并结束当前的文件。
+	// 之后写入的条目会被写入新的文件。
+	Flush() error
+	// Close 用于关闭接收器。关闭之后写入的条目会导致错误。
+	Close() error
+	// Count 用于获取已写入的条目的数量。
+	Count() uint64
+	// Files 用于获取所有已创建的文件的路径。
+	Files() []string
+}
+
+// encodeItem 代表把条目编码为一条记录的函数的类型。
+type encodeItem func(item module.Item) ([]byte, error)
+
+// mySink 代表接收器的实现类型。
+type mySink struct {
+	// lock 代表互斥锁。
+	lock sync.Mutex
+	// file 代表可轮转的文件。
+	file *rotatingFile
+	// encode 代表条目编码函数。
+	encode encodeItem
+	// count 代表已写入的条目的数量。
+	count uint64
+	// closed 代表接收器是否已关闭。
+	closed bool
+}
+
+// NewJSONLSink 用于创建一个把条目以JSON Lines格式写入文件的接收器。
+// 每个条目都会被编码为一行JSON对象。
+func NewJSONLSink(path string, opts RotateOptions) (Sink, error) {
+	file, err := newRotatingFile(path, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	encode := func(item module.Item) ([]byte, error) {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+	return &mySink{file: file, encode: encode}, nil
+}
+
+// Column 代表CSV文件中的列。
+type Column struct {
+	// Header 代表列的标题。若为空，则使用Field。
+	Header string
+	// Field 代表列对应的条目字段的名称。
+	Field string
+}
+
+// NewCSVSink 用于创建一个把条目以CSV格式写入文件的接收器。
+// 参数columns代表列与条目字段的对应关系，每个文件的第一行都是列的标题。
+// 条目中不存在的字段会被写为空字符串，列表和字典类型的值会被写为JSON。
+func NewCSVSink(path string, columns []Column, opts RotateOptions) (Sink, error) {
+	if len(columns) == 0 {
+		return nil, genParameterError("empty column list")
+	}
+	headers := make([]string, len(columns))
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		if column.Field == "" {
+			return nil, genParameterError(fmt.Sprintf("empty field of column[%d]", i))
+		}
+		fields[i] = column.Field
+		headers[i] = column.Header
+		if headers[i] == "" {
+			headers[i] = column.Field
+		}
+	}
+	header, err := encodeCSVRecord(headers)
+	if err != nil {
+		return nil, err
+	}
+	file, err := newRotatingFile(path, header, opts)
+	if err != nil {
+		return nil, err
+	}
+	encode := func(item module.Item) ([]byte, error) {
+		record := make([]string, len(fields))
+		for i, field := range fields {
+			value, err := formatValue(item[field])
+			if err != nil {
+				return nil, fmt.Errorf("couldn't format field %q: %s", field, err)
+			}
+			record[i] = value
+		}
+		return encodeCSVRecord(record)
+	}
+	return &mySink{file: file, encode: encode}, nil
+}
+
+func (sink *mySink) Process(item module.Item) (module.Item, error) {
+	if item == nil {
+		return nil, genParameterError("nil item")
+	}
+	record, err := sink.encode(item)
+	if err != nil {
+		return nil, genError(fmt.Sprintf("couldn't encode item: %s", err))
+	}
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.closed {
+		return nil, genError("closed sink")
+	}
+	if err := sink.file.write(record); err != nil {
+		return nil, genError(fmt.Sprintf("couldn't write item: %s", err))
+	}
+	sink.count++
+	return item, nil
+}
+
+func (sink *mySink) Flush() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.file.closeFile()
+}
+
+func (sink *mySink) Close() error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	if sink.closed {
+		return nil
+	}
+	sink.closed = true
+	return sink.file.closeFile()
+}
+
+func (sink *mySink) Count() uint64 {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	return sink.count
+}
+
+func (sink *mySink) Files() []string {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	paths := make([]string, len(sink.file.paths))
+	copy(paths, sink.file.paths)
+	return paths
+}
+
+// encodeCSVRecord 用于把一条记录编码为CSV格式的一行。
+func encodeCSVRecord(record []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// formatValue 用于把条目字段的值格式化为字符串。
+func formatValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct, reflect.Ptr:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+	return fmt.Sprint(value), nil
+}
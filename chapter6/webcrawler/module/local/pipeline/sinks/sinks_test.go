@@ -0,0 +1,143 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+func TestJSONLSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewJSONLSink(filepath.Join(dir, "items.jsonl"), RotateOptions{MaxSize: 1024})
+	if err != nil {
+		t.Fatalf("An error occurs when creating JSONL sink: %s", err)
+	}
+	// 模拟多个条目处理管道并发地写入。
+	number := 200
+	var wg sync.WaitGroup
+	for i := 0; i < number; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			item := module.Item{"number": i, "text": strings.Repeat("x", 20)}
+			result, err := sink.Process(item)
+			if err != nil {
+				t.Errorf("An error occurs when processing item: %s", err)
+			}
+			if result["number"] != i {
+				t.Errorf("Inconsistent result item: %v", result)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := sink.Close(); err != nil {
+		t.Fatalf("An error occurs when closing sink: %s", err)
+	}
+	if sink.Count() != uint64(number) {
+		t.Fatalf("Inconsistent item count: expected: %d, actual: %d", number, sink.Count())
+	}
+	files := sink.Files()
+	if len(files) < 2 {
+		t.Fatalf("The sink didn't rotate files: %v", files)
+	}
+	seen := map[int]bool{}
+	for _, path := range files {
+		file, _ := os.Open(path)
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var item struct {
+				Number int `json:"number"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+				t.Fatalf("An error occurs when decoding line %q: %s", scanner.Text(), err)
+			}
+			seen[item.Number] = true
+		}
+		file.Close()
+	}
+	if len(seen) != number {
+		t.Fatalf("Inconsistent written item number: expected: %d, actual: %d",
+			number, len(seen))
+	}
+	if _, err := sink.Process(module.Item{}); err == nil {
+		t.Fatal("No error when processing item with closed sink!")
+	}
+	if _, err := sink.Process(nil); err == nil {
+		t.Fatal("No error when processing nil item!")
+	}
+}
+
+func TestCSVSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sinks")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "items.csv")
+	if _, err := NewCSVSink(path, nil, RotateOptions{}); err == nil {
+		t.Fatal("No error when creating CSV sink with empty column list!")
+	}
+	if _, err := NewCSVSink(path, []Column{{Header: "h"}}, RotateOptions{}); err == nil {
+		t.Fatal("No error when creating CSV sink with empty field!")
+	}
+	columns := []Column{
+		{Header: "Title", Field: "title"},
+		{Field: "tags"},
+		{Header: "Size", Field: "size"},
+	}
+	sink, err := NewCSVSink(path, columns, RotateOptions{Gzip: true})
+	if err != nil {
+		t.Fatalf("An error occurs when creating CSV sink: %s", err)
+	}
+	sink.Process(module.Item{"title": "a, \"b\"", "tags": []string{"x", "y"}, "size": 10})
+	sink.Process(module.Item{"title": "c", "extra": true})
+	// 写出缓冲数据之后的条目会被写入新的文件。
+	if err := sink.Flush(); err != nil {
+		t.Fatalf("An error occurs when flushing sink: %s", err)
+	}
+	sink.Process(module.Item{"size": 1.5})
+	sink.Close()
+	files := sink.Files()
+	if len(files) != 2 {
+		t.Fatalf("Inconsistent file number: expected: %d, actual: %d", 2, len(files))
+	}
+	expectedRecordsList := [][][]string{
+		{
+			{"Title", "tags", "Size"},
+			{"a, \"b\"", `["x","y"]`, "10"},
+			{"c", "", ""},
+		},
+		{
+			{"Title", "tags", "Size"},
+			{"", "", "1.5"},
+		},
+	}
+	for i, path := range files {
+		records, err := csv.NewReader(strings.NewReader(readGzipFile(t, path))).ReadAll()
+		if err != nil {
+			t.Fatalf("An error occurs when reading CSV file %s: %s", path, err)
+		}
+		if len(records) != len(expectedRecordsList[i]) {
+			t.Fatalf("Inconsistent record number: expected: %d, actual: %d",
+				len(expectedRecordsList[i]), len(records))
+		}
+		for j, record := range records {
+			if strings.Join(record, "|") != strings.Join(expectedRecordsList[i][j], "|") {
+				t.Fatalf("Inconsistent record: expected: %q, actual: %q",
+					expectedRecordsList[i][j], record)
+			}
+		}
+	}
+}
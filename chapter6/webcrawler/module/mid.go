@@ -20,11 +20,11 @@ type MID string
 
 // GenMID 会根据给定参数生成组件ID。
 func GenMID(mtype Type, sn uint64, maddr net.Addr) (MID, error) {
-	if !LegalType(mtype) {
+	ok, letter := typeToLetter(mtype)
+	if !ok {
 		errMsg := fmt.Sprintf("illegal module type: %s", mtype)
 		return "", errors.NewIllegalParameterError(errMsg)
 	}
-	letter := legalTypeLetterMap[mtype]
 	var midStr string
 	if maddr == nil {
 		midStr = fmt.Sprintf(midTemplate, letter, sn, "")
@@ -57,7 +57,7 @@ func SplitMID(mid MID) ([]string, error) {
 		return nil, errors.NewIllegalParameterError("insufficient MID")
 	}
 	letter = midStr[:1]
-	if _, ok = legalLetterTypeMap[letter]; !ok {
+	if ok, _ = letterToType(letter); !ok {
 		return nil, errors.NewIllegalParameterError(
 			fmt.Sprintf("illegal module type letter: %s", letter))
 	}
@@ -1,5 +1,12 @@
 package module
 
+import (
+	"fmt"
+	"sync"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
 // Type 代表组件的类型。
 type Type string
 
@@ -13,6 +20,20 @@ const (
 	TYPE_PIPELINE Type = "pipeline"
 )
 
+// TypeSpec 代表组件类型的规格。
+type TypeSpec struct {
+	// Type 代表组件类型。
+	Type Type
+	// Letter 代表组件类型的字母代号，必须是一个大写英文字母。
+	// 它会作为组件ID的前缀。
+	Letter string
+	// Stage 代表该类型的组件在调度流程中所处的阶段。
+	Stage Stage
+	// Check 用于判断组件实例是否属于该类型。
+	// 无论它是否为nil，组件实例都必须实现所处阶段要求的接口。
+	Check func(module Module) bool
+}
+
 // legalTypeLetterMap 代表合法的组件类型-字母的映射。
 var legalTypeLetterMap = map[Type]string{
 	TYPE_DOWNLOADER: "D",
@@ -27,30 +48,118 @@ var legalLetterTypeMap = map[string]Type{
 	"P": TYPE_PIPELINE,
 }
 
+// typeSpecMap 代表组件类型与其规格的映射。
+var typeSpecMap = map[Type]TypeSpec{
+	TYPE_DOWNLOADER: {Type: TYPE_DOWNLOADER, Letter: "D", Stage: STAGE_DOWNLOAD},
+	TYPE_ANALYZER:   {Type: TYPE_ANALYZER, Letter: "A", Stage: STAGE_ANALYZE},
+	TYPE_PIPELINE:   {Type: TYPE_PIPELINE, Letter: "P", Stage: STAGE_PIPELINE},
+}
+
+// typeList 代表按照注册顺序排列的组件类型。
+var typeList = []Type{TYPE_DOWNLOADER, TYPE_ANALYZER, TYPE_PIPELINE}
+
+// typeRWLock 代表组件类型注册专用读写锁。
+var typeRWLock sync.RWMutex
+
+// RegisterType 用于注册新的组件类型。
+// 同一阶段中的多个组件类型会按照注册顺序依次处理数据。
+// 组件类型应该在创建和注册相应的组件实例之前注册。
+func RegisterType(spec TypeSpec) error {
+	if spec.Type == "" {
+		return errors.NewIllegalParameterError("empty module type")
+	}
+	if len(spec.Letter) != 1 || spec.Letter[0] < 'A' || spec.Letter[0] > 'Z' {
+		errMsg := fmt.Sprintf("illegal module type letter: %q", spec.Letter)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	if !LegalStage(spec.Stage) {
+		errMsg := fmt.Sprintf("illegal stage: %q", spec.Stage)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	if builtinStages[spec.Stage] {
+		errMsg := fmt.Sprintf("reserved stage: %s", spec.Stage)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	typeRWLock.Lock()
+	defer typeRWLock.Unlock()
+	if _, ok := legalTypeLetterMap[spec.Type]; ok {
+		errMsg := fmt.Sprintf("duplicate module type: %s", spec.Type)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	if mt, ok := legalLetterTypeMap[spec.Letter]; ok {
+		errMsg := fmt.Sprintf("duplicate module type letter: %s (type: %s)",
+			spec.Letter, mt)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	legalTypeLetterMap[spec.Type] = spec.Letter
+	legalLetterTypeMap[spec.Letter] = spec.Type
+	typeSpecMap[spec.Type] = spec
+	typeList = append(typeList, spec.Type)
+	return nil
+}
+
+// GetTypeSpec 用于获取给定组件类型的规格。
+// 若给定的组件类型未注册，则第二个结果值会是false。
+func GetTypeSpec(moduleType Type) (TypeSpec, bool) {
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
+	spec, ok := typeSpecMap[moduleType]
+	return spec, ok
+}
+
+// Types 用于获取按照注册顺序排列的所有组件类型。
+func Types() []Type {
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
+	types := make([]Type, len(typeList))
+	copy(types, typeList)
+	return types
+}
+
+// TypesByStage 用于获取按照注册顺序排列的处于给定阶段的组件类型。
+func TypesByStage(stage Stage) []Type {
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
+	var types []Type
+	for _, mt := range typeList {
+		if typeSpecMap[mt].Stage == stage {
+			types = append(types, mt)
+		}
+	}
+	return types
+}
+
+// BuiltinType 用于判断给定的组件类型是否是内置的组件类型。
+func BuiltinType(moduleType Type) bool {
+	switch moduleType {
+	case TYPE_DOWNLOADER, TYPE_ANALYZER, TYPE_PIPELINE:
+		return true
+	}
+	return false
+}
+
 // CheckType 用于判断组件实例的类型是否匹配。
 func CheckType(moduleType Type, module Module) bool {
 	if moduleType == "" || module == nil {
 		return false
 	}
-	switch moduleType {
-	case TYPE_DOWNLOADER:
-		if _, ok := module.(Downloader); ok {
-			return true
-		}
-	case TYPE_ANALYZER:
-		if _, ok := module.(Analyzer); ok {
-			return true
-		}
-	case TYPE_PIPELINE:
-		if _, ok := module.(Pipeline); ok {
-			return true
-		}
+	spec, ok := GetTypeSpec(moduleType)
+	if !ok {
+		return false
 	}
-	return false
+	if !stageCheckMap[spec.Stage](module) {
+		return false
+	}
+	if spec.Check != nil && !spec.Check(module) {
+		return false
+	}
+	return true
 }
 
 // LegalType 用于判断给定的组件类型  是否合法。
 func LegalType(moduleType Type) bool {
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
 	if _, ok := legalTypeLetterMap[moduleType]; ok {
 		return true
 	}
@@ -64,12 +173,13 @@ func GetType(mid MID) (bool, Type) {
 	if err != nil {
 		return false, ""
 	}
-	mt, ok := legalLetterTypeMap[parts[0]]
-	return ok, mt
+	return letterToType(parts[0])
 }
 
 // getLetter 用于获取组件类型的字母代号。
 func getLetter(moduleType Type) (bool, string) {
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
 	var letter string
 	var found bool
 	for l, t := range legalLetterTypeMap {
@@ -85,29 +195,17 @@ func getLetter(moduleType Type) (bool, string) {
 // typeToLetter 用于根据给定的组件类型获得其字母代号。
 // 若给定的组件类型不合法，则第一个结果值会是false。
 func typeToLetter(moduleType Type) (bool, string) {
-	switch moduleType {
-	case TYPE_DOWNLOADER:
-		return true, "D"
-	case TYPE_ANALYZER:
-		return true, "A"
-	case TYPE_PIPELINE:
-		return true, "P"
-	default:
-		return false, ""
-	}
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
+	letter, ok := legalTypeLetterMap[moduleType]
+	return ok, letter
 }
 
 // letterToType 用于根据字母代号获得对应的组件类型。
 // 若给定的字母代号不合法，则第一个结果值会是false。
 func letterToType(letter string) (bool, Type) {
-	switch letter {
-	case "D":
-		return true, TYPE_DOWNLOADER
-	case "A":
-		return true, TYPE_ANALYZER
-	case "P":
-		return true, TYPE_PIPELINE
-	default:
-		return false, ""
-	}
+	typeRWLock.RLock()
+	defer typeRWLock.RUnlock()
+	mt, ok := legalLetterTypeMap[letter]
+	return ok, mt
 }
@@ -143,3 +143,88 @@ func TestTypeletterToType(t *testing.T) {
 		}
 	}
 }
+
+func TestTypeRegister(t *testing.T) {
+	filterType := Type("test_request_filter")
+	spec := TypeSpec{
+		Type:   filterType,
+		Letter: "F",
+		Stage:  STAGE_REQUEST,
+	}
+	if err := RegisterType(spec); err != nil {
+		t.Fatalf("An error occurs when registering module type: %s (spec: %#v)",
+			err, spec)
+	}
+	invalidSpecs := []TypeSpec{
+		spec,
+		{Type: "", Letter: "G", Stage: STAGE_REQUEST},
+		{Type: "test_other", Letter: "F", Stage: STAGE_REQUEST},
+		{Type: "test_other", Letter: "g", Stage: STAGE_REQUEST},
+		{Type: "test_other", Letter: "GH", Stage: STAGE_REQUEST},
+		{Type: "test_other", Letter: "G", Stage: "unknown"},
+		{Type: "test_other", Letter: "G", Stage: STAGE_DOWNLOAD},
+		{Type: TYPE_DOWNLOADER, Letter: "G", Stage: STAGE_REQUEST},
+	}
+	for _, invalidSpec := range invalidSpecs {
+		if err := RegisterType(invalidSpec); err == nil {
+			t.Fatalf("No error when registering module type with invalid spec %#v!",
+				invalidSpec)
+		}
+	}
+	if !LegalType(filterType) {
+		t.Fatalf("The registered module type %q is not legal!", filterType)
+	}
+	if BuiltinType(filterType) {
+		t.Fatalf("The registered module type %q is built-in!", filterType)
+	}
+	if types := TypesByStage(STAGE_REQUEST); len(types) != 1 || types[0] != filterType {
+		t.Fatalf("Inconsistent module types of stage %s: %v", STAGE_REQUEST, types)
+	}
+	mid, err := GenMID(filterType, 3, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when generating MID: %s", err)
+	}
+	if mid != "F3" {
+		t.Fatalf("Inconsistent MID: expected: %s, actual: %s", "F3", mid)
+	}
+	if ok, mt := GetType(mid); !ok || mt != filterType {
+		t.Fatalf("Inconsistent module type: expected: %s, actual: %s", filterType, mt)
+	}
+	filter := NewFakeRequestFilter(mid, 1)
+	if !CheckType(filterType, filter) {
+		t.Fatalf("Inconsistent module type: expected: %s, actual: %T", filterType, filter)
+	}
+	if CheckType(filterType, defaultFakeDownloader) || CheckType(TYPE_DOWNLOADER, filter) {
+		t.Fatal("The module type is not matched, but do not be detected!")
+	}
+	registrar := NewRegistrar(nil)
+	if ok, err := registrar.Register(filter); !ok || err != nil {
+		t.Fatalf("Couldn't register module with type %s: %v", filterType, err)
+	}
+	m, err := registrar.Get(filterType)
+	if err != nil {
+		t.Fatalf("An error occurs when getting module with type %s: %s", filterType, err)
+	}
+	if m.ID() != mid {
+		t.Fatalf("Inconsistent MID: expected: %s, actual: %s", mid, m.ID())
+	}
+	// 附加的检查函数同样会被使用。
+	checkedType := Type("test_checked_request_filter")
+	err = RegisterType(TypeSpec{
+		Type:   checkedType,
+		Letter: "K",
+		Stage:  STAGE_REQUEST,
+		Check: func(module Module) bool {
+			return module.Addr() != ""
+		},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when registering module type: %s", err)
+	}
+	if CheckType(checkedType, NewFakeRequestFilter("K1", 1)) {
+		t.Fatal("The check function of module type is ignored!")
+	}
+	if !CheckType(checkedType, NewFakeRequestFilter("K1|127.0.0.1:8080", 1)) {
+		t.Fatalf("Inconsistent module type: expected: %s", checkedType)
+	}
+}
@@ -2,7 +2,9 @@ package module
 
 import (
 	"fmt"
+	"sort"
 	"sync"
+
 	"gopcp.v2/chapter6/webcrawler/errors"
 )
 
@@ -15,6 +17,13 @@ type Registrar interface {
 	// Get 用于获取一个指定类型的组件的实例。
 	// 本函数应该基于负载均衡策略返回实例。
 	Get(moduleType Type) (Module, error)
+	// GetByKey 用于根据给定的键获取一个指定类型的组件的实例。
+	// 参数key代表负载均衡的依据，例如请求的主机名。
+	GetByKey(moduleType Type, key string) (Module, error)
+	// Balancer 用于获取负载均衡器。
+	Balancer() Balancer
+	// HealthChecker 用于获取组件健康检查器。若未启用健康检查，则返回nil。
+	HealthChecker() HealthChecker
 	// GetAllByType 用于获取指定类型的所有组件实例。
 	GetAllByType(moduleType Type) (map[MID]Module, error)
 	// GetAll 用于获取所有组件实例。
@@ -24,9 +33,23 @@ type Registrar interface {
 }
 
 // NewRegistrar 用于创建一个组件注册器的实例。
-func NewRegistrar() Registrar {
+// 参数balancer代表负载均衡器。若它为nil，则使用基于评分的负载均衡器。
+func NewRegistrar(balancer Balancer) Registrar {
+	return NewRegistrarWithChecker(balancer, nil)
+}
+
+// NewRegistrarWithChecker 用于创建一个带有组件健康检查器的组件注册器的实例。
+// 被健康检查器隔离的组件实例不会被选择。
+// 参数checker为nil即代表不进行健康检查。
+func NewRegistrarWithChecker(balancer Balancer, checker HealthChecker) Registrar {
+	if balancer == nil {
+		balancer = NewScoreBalancer()
+	}
 	return &myRegistrar{
 		moduleTypeMap: map[Type]map[MID]Module{},
+		moduleListMap: map[Type][]Module{},
+		balancer:      balancer,
+		checker:       checker,
 	}
 }
 
@@ -34,6 +57,13 @@ func NewRegistrar() Registrar {
 type myRegistrar struct {
 	// moduleTypeMap 代表组件类型与对应组件实例的映射。
 	moduleTypeMap map[Type]map[MID]Module
+	// moduleListMap 代表组件类型与按照ID排序的组件实例列表的映射。
+	// 列表只会被整体替换而不会被修改，以便在锁外使用。
+	moduleListMap map[Type][]Module
+	// balancer 代表负载均衡器。
+	balancer Balancer
+	// checker 代表组件健康检查器。
+	checker HealthChecker
 	// rwlock 代表组件注册专用读写锁。
 	rwlock sync.RWMutex
 }
@@ -47,7 +77,7 @@ func (registrar *myRegistrar) Register(module Module) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	moduleType := legalLetterTypeMap[parts[0]]
+	_, moduleType := letterToType(parts[0])
 	if !CheckType(moduleType, module) {
 		errMsg := fmt.Sprintf("incorrect module type: %s", moduleType)
 		return false, errors.NewIllegalParameterError(errMsg)
@@ -63,6 +93,7 @@ func (registrar *myRegistrar) Register(module Module) (bool, error) {
 	}
 	modules[mid] = module
 	registrar.moduleTypeMap[moduleType] = modules
+	registrar.updateModuleList(moduleType)
 	return true, nil
 }
 
@@ -71,13 +102,14 @@ func (registrar *myRegistrar) Unregister(mid MID) (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	moduleType := legalLetterTypeMap[parts[0]]
+	_, moduleType := letterToType(parts[0])
 	var deleted bool
 	registrar.rwlock.Lock()
 	defer registrar.rwlock.Unlock()
 	if modules, ok := registrar.moduleTypeMap[moduleType]; ok {
 		if _, ok := modules[mid]; ok {
 			delete(modules, mid)
+			registrar.updateModuleList(moduleType)
 			deleted = true
 		}
 	}
@@ -87,24 +119,68 @@ func (registrar *myRegistrar) Unregister(mid MID) (bool, error) {
 // Get 用于获取一个指定类型的组件的实例。
 // 本函数会基于负载均衡策略返回实例。
 func (registrar *myRegistrar) Get(moduleType Type) (Module, error) {
-	modules, err := registrar.GetAllByType(moduleType)
-	if err != nil {
-		return nil, err
+	return registrar.GetByKey(moduleType, "")
+}
+
+// GetByKey 用于根据给定的键获取一个指定类型的组件的实例。
+// 本函数会基于负载均衡策略返回实例。
+func (registrar *myRegistrar) GetByKey(moduleType Type, key string) (Module, error) {
+	if !LegalType(moduleType) {
+		errMsg := fmt.Sprintf("illegal module type: %s", moduleType)
+		return nil, errors.NewIllegalParameterError(errMsg)
 	}
-	minScore := uint64(0)
-	var selectedModule Module
-	for _, module := range modules {
-		SetScore(module)
-		if err != nil {
-			return nil, err
-		}
-		score := module.Score()
-		if minScore == 0 || score < minScore {
-			selectedModule = module
-			minScore = score
+	registrar.rwlock.RLock()
+	candidates := registrar.moduleListMap[moduleType]
+	registrar.rwlock.RUnlock()
+	if len(candidates) == 0 {
+		return nil, ErrNotFoundModuleInstance
+	}
+	if registrar.checker == nil {
+		return registrar.balancer.Select(moduleType, candidates, key)
+	}
+	healthy := make([]Module, 0, len(candidates))
+	for _, module := range candidates {
+		if registrar.checker.Allow(module.ID()) {
+			healthy = append(healthy, module)
 		}
 	}
-	return selectedModule, nil
+	if len(healthy) == 0 {
+		return nil, ErrNoHealthyModuleInstance
+	}
+	// 一致性哈希等策略依赖于列表的稳定，所以在全部健康时仍然使用原列表。
+	if len(healthy) == len(candidates) {
+		healthy = candidates
+	}
+	module, err := registrar.balancer.Select(moduleType, healthy, key)
+	if err == nil && module != nil {
+		registrar.checker.Acquire(module.ID())
+	}
+	return module, err
+}
+
+func (registrar *myRegistrar) Balancer() Balancer {
+	return registrar.balancer
+}
+
+func (registrar *myRegistrar) HealthChecker() HealthChecker {
+	return registrar.checker
+}
+
+// updateModuleList 用于重建指定类型的组件实例列表。调用方需持有写锁。
+func (registrar *myRegistrar) updateModuleList(moduleType Type) {
+	modules := registrar.moduleTypeMap[moduleType]
+	if len(modules) == 0 {
+		delete(registrar.moduleListMap, moduleType)
+		return
+	}
+	list := make([]Module, 0, len(modules))
+	for _, module := range modules {
+		list = append(list, module)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID() < list[j].ID()
+	})
+	registrar.moduleListMap[moduleType] = list
 }
 
 // GetAllByType 用于获取指定类型的所有组件实例。
@@ -144,4 +220,5 @@ func (registrar *myRegistrar) Clear() {
 	registrar.rwlock.Lock()
 	defer registrar.rwlock.Unlock()
 	registrar.moduleTypeMap = map[Type]map[MID]Module{}
+	registrar.moduleListMap = map[Type][]Module{}
 }
@@ -7,7 +7,7 @@ import (
 )
 
 func TestRegNew(t *testing.T) {
-	registrar := NewRegistrar()
+	registrar := NewRegistrar(nil)
 	if registrar == nil {
 		t.Fatal("Couldn't create registrar!")
 	}
@@ -20,7 +20,7 @@ func TestRegRegister(t *testing.T) {
 	addr, _ := NewAddr("http", "127.0.0.1", 8080)
 	mid := MID(fmt.Sprintf(midTemplate, ml, sn, addr))
 	// 测试无效组件实例的注册。
-	registrar := NewRegistrar()
+	registrar := NewRegistrar(nil)
 	ok, err := registrar.Register(nil)
 	if err == nil {
 		t.Fatal("No error when register module instance with nil module!")
@@ -126,7 +126,7 @@ func TestRegRegister(t *testing.T) {
 }
 
 func TestModuleUnregister(t *testing.T) {
-	registrar := NewRegistrar()
+	registrar := NewRegistrar(nil)
 	var mids []MID
 	for _, mt := range legalTypes {
 		for mip := range legalIPMap {
@@ -183,7 +183,7 @@ func TestModuleUnregister(t *testing.T) {
 }
 
 func TestModuleGet(t *testing.T) {
-	registrar := NewRegistrar()
+	registrar := NewRegistrar(nil)
 	mt := illegalTypes[0]
 	m1, err := registrar.Get(mt)
 	if err == nil {
@@ -242,7 +242,7 @@ func TestModuleAllInParallel(t *testing.T) {
 		addrs[i], _ = NewAddr("http", "127.0.0.1", port)
 		sns[i] = DefaultSNGen.Get()
 	}
-	registrar := NewRegistrar()
+	registrar := NewRegistrar(nil)
 	t.Run("All in parallel", func(t *testing.T) {
 		t.Run("Register", func(t *testing.T) {
 			t.Parallel()
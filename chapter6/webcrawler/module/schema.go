@@ -0,0 +1,327 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// FieldType 代表条目字段的类型。
+type FieldType string
+
+// 条目字段类型的常量。
+const (
+	// FIELD_ANY 代表任意类型。
+	FIELD_ANY FieldType = "any"
+	// FIELD_STRING 代表字符串类型。
+	FIELD_STRING FieldType = "string"
+	// FIELD_INT 代表整数类型。值为整数的浮点数也会被接受。
+	FIELD_INT FieldType = "int"
+	// FIELD_FLOAT 代表数值类型。
+	FIELD_FLOAT FieldType = "float"
+	// FIELD_BOOL 代表布尔类型。
+	FIELD_BOOL FieldType = "bool"
+	// FIELD_TIME 代表时间类型。RFC 3339格式的字符串也会被接受。
+	FIELD_TIME FieldType = "time"
+	// FIELD_LIST 代表切片或数组类型。
+	FIELD_LIST FieldType = "list"
+	// FIELD_MAP 代表字典类型。
+	FIELD_MAP FieldType = "map"
+)
+
+// legalFieldTypeMap 代表合法的条目字段类型的字典。
+var legalFieldTypeMap = map[FieldType]bool{
+	FIELD_ANY:    true,
+	FIELD_STRING: true,
+	FIELD_INT:    true,
+	FIELD_FLOAT:  true,
+	FIELD_BOOL:   true,
+	FIELD_TIME:   true,
+	FIELD_LIST:   true,
+	FIELD_MAP:    true,
+}
+
+// Field 代表条目字段的声明。
+type Field struct {
+	// Name 代表字段的名称，即条目中的键。
+	Name string `json:"name"`
+	// Type 代表字段的类型。若为空，则等同于FIELD_ANY。
+	Type FieldType `json:"type,omitempty"`
+	// Required 代表字段是否必须存在且不为nil。
+	Required bool `json:"required,omitempty"`
+	// Min 代表数值的最小值。仅对FIELD_INT和FIELD_FLOAT有效。
+	Min *float64 `json:"min,omitempty"`
+	// Max 代表数值的最大值。仅对FIELD_INT和FIELD_FLOAT有效。
+	Max *float64 `json:"max,omitempty"`
+	// MinLen 代表最小长度。对字符串、切片、数组和字典有效。
+	MinLen int `json:"min_len,omitempty"`
+	// MaxLen 代表最大长度。对字符串、切片、数组和字典有效。值为0时不限制。
+	MaxLen int `json:"max_len,omitempty"`
+	// Pattern 代表字符串需要匹配的正则表达式。仅对FIELD_STRING有效。
+	Pattern string `json:"pattern,omitempty"`
+	// Enum 代表字符串的可选值列表。仅对FIELD_STRING有效。
+	Enum []string `json:"enum,omitempty"`
+}
+
+// FieldError 代表条目字段的校验错误。
+type FieldError struct {
+	// Field 代表字段的名称。
+	Field string
+	// Msg 代表错误的描述。
+	Msg string
+}
+
+func (fe *FieldError) Error() string {
+	return fmt.Sprintf("invalid item field %q: %s", fe.Field, fe.Msg)
+}
+
+// Schema 代表条目模式，用于在条目被处理之前对其进行校验。
+// 模式一旦创建就不可变，可以被并发地使用。
+type Schema struct {
+	// fields 代表字段声明的列表。
+	fields []Field
+	// fieldMap 代表以名称为键的字段声明的字典。
+	fieldMap map[string]*compiledField
+	// strict 代表是否拒绝未声明的字段。
+	strict bool
+}
+
+// compiledField 代表已编译的字段声明。
+type compiledField struct {
+	Field
+	// patternRegexp 代表已编译的Pattern。
+	patternRegexp *regexp.Regexp
+	// enumMap 代表Enum中的值的字典。
+	enumMap map[string]bool
+}
+
+// NewSchema 用于创建一个条目模式。
+// 参数strict代表是否拒绝未声明的字段。
+func NewSchema(fields []Field, strict bool) (*Schema, error) {
+	if len(fields) == 0 {
+		return nil, errors.NewIllegalParameterError("empty field list")
+	}
+	schema := &Schema{
+		fields:   make([]Field, len(fields)),
+		fieldMap: make(map[string]*compiledField, len(fields)),
+		strict:   strict,
+	}
+	copy(schema.fields, fields)
+	for i, field := range fields {
+		if field.Name == "" {
+			errMsg := fmt.Sprintf("empty name of field[%d]", i)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		if _, ok := schema.fieldMap[field.Name]; ok {
+			errMsg := fmt.Sprintf("duplicate field %q", field.Name)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		if field.Type == "" {
+			field.Type = FIELD_ANY
+		}
+		if !legalFieldTypeMap[field.Type] {
+			errMsg := fmt.Sprintf("illegal type %q of field %q", field.Type, field.Name)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			errMsg := fmt.Sprintf("min is greater than max in field %q", field.Name)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		if field.MinLen < 0 || field.MaxLen < 0 ||
+			(field.MaxLen > 0 && field.MinLen > field.MaxLen) {
+			errMsg := fmt.Sprintf("illegal length range [%d, %d] in field %q",
+				field.MinLen, field.MaxLen, field.Name)
+			return nil, errors.NewIllegalParameterError(errMsg)
+		}
+		compiled := &compiledField{Field: field}
+		if field.Pattern != "" {
+			patternRegexp, err := regexp.Compile(field.Pattern)
+			if err != nil {
+				errMsg := fmt.Sprintf("illegal pattern of field %q: %s", field.Name, err)
+				return nil, errors.NewIllegalParameterError(errMsg)
+			}
+			compiled.patternRegexp = patternRegexp
+		}
+		if len(field.Enum) > 0 {
+			compiled.enumMap = make(map[string]bool, len(field.Enum))
+			for _, value := range field.Enum {
+				compiled.enumMap[value] = true
+			}
+		}
+		schema.fieldMap[field.Name] = compiled
+	}
+	return schema, nil
+}
+
+// Fields 用于获取字段声明的列表。
+func (schema *Schema) Fields() []Field {
+	fields := make([]Field, len(schema.fields))
+	copy(fields, schema.fields)
+	return fields
+}
+
+// Strict 用于判断是否拒绝未声明的字段。
+func (schema *Schema) Strict() bool {
+	return schema.strict
+}
+
+// Validate 用于校验条目。
+// 返回的每个错误值的类型都是*FieldError，且按字段名称排序。
+func (schema *Schema) Validate(item Item) []error {
+	if item == nil {
+		return []error{&FieldError{Msg: "nil item"}}
+	}
+	var errs []error
+	for _, field := range schema.fields {
+		compiled := schema.fieldMap[field.Name]
+		value, ok := item[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				errs = append(errs, &FieldError{Field: field.Name, Msg: "missing"})
+			}
+			continue
+		}
+		if msg := compiled.check(value); msg != "" {
+			errs = append(errs, &FieldError{Field: field.Name, Msg: msg})
+		}
+	}
+	if schema.strict {
+		for name := range item {
+			if _, ok := schema.fieldMap[name]; !ok {
+				errs = append(errs, &FieldError{Field: name, Msg: "undeclared"})
+			}
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].(*FieldError).Field < errs[j].(*FieldError).Field
+	})
+	return errs
+}
+
+// Decode 用于在校验条目之后把它解码到参数v代表的值中。
+// 参数v一般应为结构体的指针。解码会借助JSON编解码完成，所以结构体字段需要相应的json标签。
+func (schema *Schema) Decode(item Item, v interface{}) []error {
+	if errs := schema.Validate(item); len(errs) > 0 {
+		return errs
+	}
+	if err := DecodeItem(item, v); err != nil {
+		return []error{err}
+	}
+	return nil
+}
+
+// DecodeItem 用于把条目解码到参数v代表的值中。
+// 参数v一般应为结构体的指针。解码会借助JSON编解码完成，所以结构体字段需要相应的json标签。
+func DecodeItem(item Item, v interface{}) error {
+	if item == nil {
+		return errors.NewIllegalParameterError("nil item")
+	}
+	if v == nil || reflect.ValueOf(v).Kind() != reflect.Ptr {
+		return errors.NewIllegalParameterError("non-pointer decoding target")
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("couldn't encode item: %s", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("couldn't decode item: %s", err)
+	}
+	return nil
+}
+
+// check 用于检查字段的值，并在值不合法时返回错误的描述。
+func (field *compiledField) check(value interface{}) string {
+	rv := reflect.ValueOf(value)
+	switch field.Type {
+	case FIELD_STRING:
+		s, ok := value.(string)
+		if !ok {
+			return typeMismatch(field.Type, value)
+		}
+		if msg := field.checkLen(len(s)); msg != "" {
+			return msg
+		}
+		if field.patternRegexp != nil && !field.patternRegexp.MatchString(s) {
+			return fmt.Sprintf("%q does not match pattern %q", s, field.Pattern)
+		}
+		if field.enumMap != nil && !field.enumMap[s] {
+			return fmt.Sprintf("%q is not one of [%s]", s, strings.Join(field.Enum, ", "))
+		}
+	case FIELD_INT, FIELD_FLOAT:
+		n, ok := toFloat(rv)
+		if !ok {
+			return typeMismatch(field.Type, value)
+		}
+		if field.Type == FIELD_INT && n != math.Trunc(n) {
+			return typeMismatch(field.Type, value)
+		}
+		if field.Min != nil && n < *field.Min {
+			return fmt.Sprintf("%v is less than %v", value, *field.Min)
+		}
+		if field.Max != nil && n > *field.Max {
+			return fmt.Sprintf("%v is greater than %v", value, *field.Max)
+		}
+	case FIELD_BOOL:
+		if _, ok := value.(bool); !ok {
+			return typeMismatch(field.Type, value)
+		}
+	case FIELD_TIME:
+		switch t := value.(type) {
+		case time.Time:
+		case *time.Time:
+		case string:
+			if _, err := time.Parse(time.RFC3339, t); err != nil {
+				return fmt.Sprintf("%q is not a RFC 3339 time", t)
+			}
+		default:
+			return typeMismatch(field.Type, value)
+		}
+	case FIELD_LIST:
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return typeMismatch(field.Type, value)
+		}
+		return field.checkLen(rv.Len())
+	case FIELD_MAP:
+		if rv.Kind() != reflect.Map {
+			return typeMismatch(field.Type, value)
+		}
+		return field.checkLen(rv.Len())
+	}
+	return ""
+}
+
+// checkLen 用于检查长度，并在长度不合法时返回错误的描述。
+func (field *compiledField) checkLen(length int) string {
+	if length < field.MinLen {
+		return fmt.Sprintf("length %d is less than %d", length, field.MinLen)
+	}
+	if field.MaxLen > 0 && length > field.MaxLen {
+		return fmt.Sprintf("length %d is greater than %d", length, field.MaxLen)
+	}
+	return ""
+}
+
+// toFloat 用于把数值类型的值转换为float64类型的值。
+func toFloat(rv reflect.Value) (float64, bool) {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// typeMismatch 用于生成类型不匹配的错误描述。
+func typeMismatch(expected FieldType, value interface{}) string {
+	return fmt.Sprintf("expected %s, got %T", expected, value)
+}
@@ -0,0 +1,159 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSchemaNew(t *testing.T) {
+	min, max := float64(10), float64(1)
+	invalidFieldsList := [][]Field{
+		nil,
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", Type: "complex"}},
+		{{Name: "a", Type: FIELD_INT, Min: &min, Max: &max}},
+		{{Name: "a", Type: FIELD_STRING, MinLen: 5, MaxLen: 1}},
+		{{Name: "a", Type: FIELD_STRING, MinLen: -1}},
+		{{Name: "a", Type: FIELD_STRING, Pattern: "("}},
+	}
+	for _, fields := range invalidFieldsList {
+		if _, err := NewSchema(fields, false); err == nil {
+			t.Fatalf("No error when creating schema with invalid fields: %#v", fields)
+		}
+	}
+	fields := []Field{{Name: "a", Type: FIELD_STRING}}
+	schema, err := NewSchema(fields, true)
+	if err != nil {
+		t.Fatalf("An error occurs when creating schema: %s", err)
+	}
+	fields[0].Name = "b"
+	if schema.Fields()[0].Name != "a" {
+		t.Fatal("The fields of schema are modified from outside!")
+	}
+	if !schema.Strict() {
+		t.Fatal("Inconsistent strict flag: expected: true, actual: false")
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	min, max := float64(0), float64(100)
+	schema, err := NewSchema([]Field{
+		{Name: "title", Type: FIELD_STRING, Required: true, MinLen: 1, MaxLen: 10},
+		{Name: "url", Type: FIELD_STRING, Pattern: "^https?://"},
+		{Name: "kind", Type: FIELD_STRING, Enum: []string{"a", "b"}},
+		{Name: "count", Type: FIELD_INT, Min: &min, Max: &max},
+		{Name: "price", Type: FIELD_FLOAT},
+		{Name: "ok", Type: FIELD_BOOL},
+		{Name: "at", Type: FIELD_TIME},
+		{Name: "tags", Type: FIELD_LIST, MaxLen: 2},
+		{Name: "attrs", Type: FIELD_MAP},
+		{Name: "raw"},
+	}, false)
+	if err != nil {
+		t.Fatalf("An error occurs when creating schema: %s", err)
+	}
+	validItems := []Item{
+		{"title": "t"},
+		{"title": "t", "url": nil},
+		{
+			"title": "0123456789",
+			"url":   "http://example.com",
+			"kind":  "b",
+			"count": float64(100),
+			"price": 1,
+			"ok":    false,
+			"at":    time.Now(),
+			"tags":  []string{"x", "y"},
+			"attrs": map[string]int{},
+			"raw":   struct{}{},
+			"extra": 1,
+		},
+		{"title": "t", "count": uint8(0), "at": "2026-10-18T08:00:00Z", "tags": [0]int{}},
+	}
+	for _, item := range validItems {
+		if errs := schema.Validate(item); len(errs) != 0 {
+			t.Fatalf("An error occurs when validating item %v: %v", item, errs)
+		}
+	}
+	invalidItems := map[string]Item{
+		"title": {"title": ""},
+		"url":   {"title": "t", "url": "ftp://example.com"},
+		"kind":  {"title": "t", "kind": "c"},
+		"count": {"title": "t", "count": 1.5},
+		"price": {"title": "t", "price": "1"},
+		"ok":    {"title": "t", "ok": "true"},
+		"at":    {"title": "t", "at": "yesterday"},
+		"tags":  {"title": "t", "tags": []int{1, 2, 3}},
+		"attrs": {"title": "t", "attrs": []int{}},
+	}
+	for name, item := range invalidItems {
+		errs := schema.Validate(item)
+		if len(errs) != 1 {
+			t.Fatalf("Inconsistent error number for item %v: expected: %d, actual: %d (errors: %v)",
+				item, 1, len(errs), errs)
+		}
+		if errs[0].(*FieldError).Field != name {
+			t.Fatalf("Inconsistent invalid field: expected: %s, actual: %s",
+				name, errs[0].(*FieldError).Field)
+		}
+	}
+	errs := schema.Validate(Item{"count": -1})
+	if len(errs) != 2 ||
+		errs[0].(*FieldError).Field != "count" ||
+		errs[1].(*FieldError).Field != "title" ||
+		!strings.Contains(errs[1].Error(), "missing") {
+		t.Fatalf("Inconsistent errors: %v", errs)
+	}
+	for _, err := range errs {
+		if !IsFieldError(err) || !IsFieldError(fmt.Errorf("wrapped: %w", err)) {
+			t.Fatalf("The error is not recognized as field error: %v", err)
+		}
+	}
+	if IsFieldError(ErrNoHealthyModuleInstance) {
+		t.Fatal("The non-field error is recognized as field error!")
+	}
+	if errs := schema.Validate(nil); len(errs) != 1 {
+		t.Fatalf("Inconsistent error number for nil item: expected: %d, actual: %d",
+			1, len(errs))
+	}
+	// 严格模式。
+	schema, _ = NewSchema([]Field{{Name: "title"}}, true)
+	errs = schema.Validate(Item{"title": "t", "extra": 1})
+	if len(errs) != 1 || errs[0].(*FieldError).Field != "extra" {
+		t.Fatalf("Inconsistent errors in strict mode: %v", errs)
+	}
+}
+
+func TestSchemaDecode(t *testing.T) {
+	type article struct {
+		Title string    `json:"title"`
+		Count int       `json:"count"`
+		Tags  []string  `json:"tags"`
+		At    time.Time `json:"at"`
+	}
+	schema, _ := NewSchema([]Field{
+		{Name: "title", Type: FIELD_STRING, Required: true},
+		{Name: "count", Type: FIELD_INT},
+	}, false)
+	at := time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC)
+	item := Item{"title": "t", "count": 3, "tags": []string{"x"}, "at": at}
+	var a article
+	if errs := schema.Decode(item, &a); len(errs) != 0 {
+		t.Fatalf("An error occurs when decoding item: %v", errs)
+	}
+	if a.Title != "t" || a.Count != 3 || len(a.Tags) != 1 || !a.At.Equal(at) {
+		t.Fatalf("Inconsistent decoded value: %#v", a)
+	}
+	if errs := schema.Decode(Item{"count": 3}, &a); len(errs) != 1 {
+		t.Fatalf("No error when decoding invalid item!")
+	}
+	if err := DecodeItem(item, a); err == nil {
+		t.Fatal("No error when decoding item into non-pointer value!")
+	}
+	if err := DecodeItem(Item{"count": "3"}, &a); err == nil {
+		t.Fatal("No error when decoding item with mismatched type!")
+	}
+}
@@ -1,8 +1,48 @@
 package module
 
+import (
+	"fmt"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
 // CalculateScore 代表用于计算组件评分的函数类型。
+// 评分越低的组件实例越应该被优先选择。
 type CalculateScore func(counts Counts) uint64
 
+// 内置的组件评分计算函数的名称。
+const (
+	// SCORE_SIMPLE 代表简易的组件评分计算函数的名称。
+	SCORE_SIMPLE = "simple"
+	// SCORE_RELIABILITY 代表偏好可靠组件的评分计算函数的名称。
+	SCORE_RELIABILITY = "reliability"
+	// SCORE_LATENCY 代表偏好快速组件的评分计算函数的名称。
+	SCORE_LATENCY = "latency"
+	// SCORE_ADAPTIVE 代表同时偏好快速和可靠组件的评分计算函数的名称。
+	SCORE_ADAPTIVE = "adaptive"
+)
+
+// adaptiveErrorPenalty 代表自适应评分中失败率的惩罚系数。
+// 失败率为100%的组件实例的评分会是同等耗时和负载下无失败的组件实例的17倍。
+const adaptiveErrorPenalty = 16
+
+// GetScoreCalculator 用于根据名称获取内置的组件评分计算函数。
+func GetScoreCalculator(name string) (CalculateScore, error) {
+	switch name {
+	case SCORE_SIMPLE:
+		return CalculateScoreSimple, nil
+	case SCORE_RELIABILITY:
+		return CalculateScoreReliability, nil
+	case SCORE_LATENCY:
+		return CalculateScoreLatency, nil
+	case SCORE_ADAPTIVE:
+		return CalculateScoreAdaptive, nil
+	}
+	errMsg := fmt.Sprintf("unsupported score calculator: %s", name)
+	return nil, errors.NewIllegalParameterError(errMsg)
+}
+
 // CalculateScoreSimple 代表简易的组件评分计算函数。
 func CalculateScoreSimple(counts Counts) uint64 {
 	//8<<2 == 8 * 2^2 == 8 * 4 == 32
@@ -14,6 +54,29 @@ func CalculateScoreSimple(counts Counts) uint64 {
 		counts.HandlingNumber<<4
 }
 
+// CalculateScoreReliability 代表偏好可靠组件的评分计算函数。
+// 它在简易评分的基础上为每次失败加上远大于成功完成的权重，
+// 因此经常失败的组件实例会更少地被选择。
+func CalculateScoreReliability(counts Counts) uint64 {
+	return CalculateScoreSimple(counts) + counts.FailedCount<<6
+}
+
+// CalculateScoreLatency 代表偏好快速组件的评分计算函数。
+// 评分近似于新调用的预期等待时间（以微秒为单位），
+// 即耗时的指数加权移动平均值与实时处理数加1的乘积。
+// 尚无耗时记录的组件实例会按照实时处理数被优先选择。
+func CalculateScoreLatency(counts Counts) uint64 {
+	latency := uint64(counts.EWMALatency / time.Microsecond)
+	return (latency + 1) * (counts.HandlingNumber + 1)
+}
+
+// CalculateScoreAdaptive 代表同时偏好快速和可靠组件的评分计算函数。
+// 它会按照失败率放大基于耗时的评分。
+func CalculateScoreAdaptive(counts Counts) uint64 {
+	score := CalculateScoreLatency(counts)
+	return uint64(float64(score) * (1 + adaptiveErrorPenalty*counts.ErrorRate()))
+}
+
 // SetScore 用于设置给定组件的评分。
 // 结果值代表是否更新了评分。
 func SetScore(module Module) bool {
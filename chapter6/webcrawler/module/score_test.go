@@ -1,6 +1,9 @@
 package module
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestCalculateScoreSimple(t *testing.T) {
 	counts := Counts{
@@ -38,3 +41,64 @@ func TestSetScore(t *testing.T) {
 		t.Fatal("It still can set same score for module!")
 	}
 }
+
+func TestCalculateScoreReliability(t *testing.T) {
+	reliable := Counts{CalledCount: 100, AcceptedCount: 100, CompletedCount: 100}
+	unreliable := Counts{CalledCount: 100, AcceptedCount: 100,
+		CompletedCount: 50, FailedCount: 50}
+	if CalculateScoreReliability(reliable) >= CalculateScoreReliability(unreliable) {
+		t.Fatalf("The unreliable module is preferred: reliable: %d, unreliable: %d",
+			CalculateScoreReliability(reliable), CalculateScoreReliability(unreliable))
+	}
+}
+
+func TestCalculateScoreLatency(t *testing.T) {
+	fresh := Counts{}
+	fast := Counts{EWMALatency: 10 * time.Millisecond, HandlingNumber: 1}
+	slow := Counts{EWMALatency: 500 * time.Millisecond, HandlingNumber: 1}
+	busy := Counts{EWMALatency: 10 * time.Millisecond, HandlingNumber: 100}
+	scores := []uint64{
+		CalculateScoreLatency(fresh),
+		CalculateScoreLatency(fast),
+		CalculateScoreLatency(slow),
+		CalculateScoreLatency(busy),
+	}
+	if !(scores[0] < scores[1] && scores[1] < scores[2] && scores[2] < scores[3]) {
+		t.Fatalf("Inconsistent order of latency scores: %v", scores)
+	}
+	expectedScore := uint64((10000 + 1) * 2)
+	if scores[1] != expectedScore {
+		t.Fatalf("Inconsistent score: expected: %d, actual: %d",
+			expectedScore, scores[1])
+	}
+}
+
+func TestCalculateScoreAdaptive(t *testing.T) {
+	healthy := Counts{AcceptedCount: 10, EWMALatency: 100 * time.Millisecond}
+	failing := Counts{AcceptedCount: 10, FailedCount: 5, EWMALatency: 100 * time.Millisecond}
+	if CalculateScoreAdaptive(healthy) != CalculateScoreLatency(healthy) {
+		t.Fatalf("Inconsistent score: expected: %d, actual: %d",
+			CalculateScoreLatency(healthy), CalculateScoreAdaptive(healthy))
+	}
+	expectedScore := CalculateScoreLatency(failing) * 9
+	if score := CalculateScoreAdaptive(failing); score != expectedScore {
+		t.Fatalf("Inconsistent score: expected: %d, actual: %d",
+			expectedScore, score)
+	}
+}
+
+func TestGetScoreCalculator(t *testing.T) {
+	names := []string{SCORE_SIMPLE, SCORE_RELIABILITY, SCORE_LATENCY, SCORE_ADAPTIVE}
+	for _, name := range names {
+		calculator, err := GetScoreCalculator(name)
+		if err != nil {
+			t.Fatalf("An error occurs when getting score calculator %q: %s", name, err)
+		}
+		if calculator == nil {
+			t.Fatalf("Nil score calculator for %q!", name)
+		}
+	}
+	if _, err := GetScoreCalculator("unknown"); err == nil {
+		t.Fatal("No error when getting unsupported score calculator!")
+	}
+}
@@ -0,0 +1,94 @@
+package module
+
+import "context"
+
+// Stage 代表组件在调度流程中所处的阶段。
+type Stage string
+
+// 调度流程中的阶段的常量。
+const (
+	// STAGE_DOWNLOAD 代表下载阶段，仅供下载器使用。
+	STAGE_DOWNLOAD Stage = "download"
+	// STAGE_ANALYZE 代表分析阶段，仅供分析器使用。
+	STAGE_ANALYZE Stage = "analyze"
+	// STAGE_PIPELINE 代表条目处理阶段，仅供条目处理管道使用。
+	STAGE_PIPELINE Stage = "pipeline"
+	// STAGE_RESPONSE 代表下载之后、响应进入响应缓冲池之前的阶段，
+	// 例如渲染页面。该阶段的组件必须实现ResponseProcessor接口。
+	STAGE_RESPONSE Stage = "response"
+	// STAGE_REQUEST 代表分析之后、新请求进入请求缓冲池之前的阶段，
+	// 例如过滤请求。该阶段的组件必须实现RequestFilter接口。
+	STAGE_REQUEST Stage = "request"
+	// STAGE_ITEM 代表分析之后、条目进入条目缓冲池之前的阶段，
+	// 例如过滤或补全条目。该阶段的组件必须实现ItemFilter接口。
+	STAGE_ITEM Stage = "item"
+)
+
+// builtinStages 代表只能由内置组件类型使用的阶段。
+var builtinStages = map[Stage]bool{
+	STAGE_DOWNLOAD: true,
+	STAGE_ANALYZE:  true,
+	STAGE_PIPELINE: true,
+}
+
+// stageCheckMap 代表阶段与该阶段的组件必须实现的接口的检查函数的映射。
+var stageCheckMap = map[Stage]func(module Module) bool{
+	STAGE_DOWNLOAD: func(module Module) bool {
+		_, ok := module.(Downloader)
+		return ok
+	},
+	STAGE_ANALYZE: func(module Module) bool {
+		_, ok := module.(Analyzer)
+		return ok
+	},
+	STAGE_PIPELINE: func(module Module) bool {
+		_, ok := module.(Pipeline)
+		return ok
+	},
+	STAGE_RESPONSE: func(module Module) bool {
+		_, ok := module.(ResponseProcessor)
+		return ok
+	},
+	STAGE_REQUEST: func(module Module) bool {
+		_, ok := module.(RequestFilter)
+		return ok
+	},
+	STAGE_ITEM: func(module Module) bool {
+		_, ok := module.(ItemFilter)
+		return ok
+	},
+}
+
+// LegalStage 用于判断给定的阶段是否合法。
+func LegalStage(stage Stage) bool {
+	_, ok := stageCheckMap[stage]
+	return ok
+}
+
+// ResponseProcessor 代表响应处理器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ResponseProcessor interface {
+	Module
+	// ProcessResponse 会处理响应并返回处理后的响应。
+	// 若结果响应为nil，则代表丢弃该响应。
+	// 若结果响应不是原响应，则本方法负责关闭原响应的响应体。
+	ProcessResponse(ctx context.Context, resp *Response) (*Response, error)
+}
+
+// RequestFilter 代表请求过滤器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type RequestFilter interface {
+	Module
+	// FilterRequest 会过滤请求并返回应该被放入请求缓冲池的请求。
+	// 若结果请求为nil，则代表丢弃该请求。
+	FilterRequest(ctx context.Context, req *Request) (*Request, error)
+}
+
+// ItemFilter 代表条目过滤器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type ItemFilter interface {
+	Module
+	// FilterItem 会过滤条目并返回应该被放入条目缓冲池的条目。
+	// 若结果条目为nil，则代表丢弃该条目。
+	FilterItem(ctx context.Context, item Item) (Item, error)
+}
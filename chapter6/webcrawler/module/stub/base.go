@@ -1,6 +1,10 @@
 package stub
 
-import "gopcp.v2/chapter6/webcrawler/module"
+import (
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
 
 // ModuleInternal 代表组件的内部基础接口类型。
 type ModuleInternal interface {
@@ -15,6 +19,11 @@ type ModuleInternal interface {
 	IncrHandlingNumber()
 	// DecrHandlingNumber 会把实时处理数减1。
 	DecrHandlingNumber()
+	// IncrFailedCount 会把失败计数增1。
+	IncrFailedCount()
+	// RecordLatency 用于记录一次被接受的调用的耗时。
+	// 累计耗时和耗时的指数加权移动平均值都会被更新。
+	RecordLatency(latency time.Duration)
 	// Clear 用于清空所有计数。
 	Clear()
 }
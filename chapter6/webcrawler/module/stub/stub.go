@@ -3,6 +3,8 @@ package stub
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
+
 	"gopcp.v2/chapter6/webcrawler/errors"
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/helper/log"
@@ -11,6 +13,9 @@ import (
 // logger 代表日志记录器。
 var logger = log.DLogger()
 
+// EWMA_LATENCY_WEIGHT 代表计算耗时的指数加权移动平均值时最新耗时所占的权重。
+const EWMA_LATENCY_WEIGHT = 0.2
+
 // myModule 代表组件内部基础接口的实现类型。
 type myModule struct {
 	// mid 代表组件ID。
@@ -29,6 +34,12 @@ type myModule struct {
 	completedCount uint64
 	// handlingNumber 代表实时处理数。
 	handlingNumber uint64
+	// failedCount 代表失败计数。
+	failedCount uint64
+	// totalLatency 代表以纳秒为单位的累计耗时。
+	totalLatency uint64
+	// ewmaLatency 代表以纳秒为单位的耗时的指数加权移动平均值。
+	ewmaLatency uint64
 }
 
 // NewModuleInternal 用于创建一个组件内部基础类型的实例。
@@ -90,19 +101,28 @@ func (m *myModule) Counts() module.Counts {
 		AcceptedCount:  atomic.LoadUint64(&m.acceptedCount),
 		CompletedCount: atomic.LoadUint64(&m.completedCount),
 		HandlingNumber: atomic.LoadUint64(&m.handlingNumber),
+		FailedCount:    atomic.LoadUint64(&m.failedCount),
+		TotalLatency:   time.Duration(atomic.LoadUint64(&m.totalLatency)),
+		EWMALatency:    time.Duration(atomic.LoadUint64(&m.ewmaLatency)),
 	}
 }
 
 func (m *myModule) Summary() module.SummaryStruct {
 	counts := m.Counts()
-	return module.SummaryStruct{
+	summary := module.SummaryStruct{
 		ID:        m.ID(),
 		Called:    counts.CalledCount,
 		Accepted:  counts.AcceptedCount,
 		Completed: counts.CompletedCount,
 		Handling:  counts.HandlingNumber,
+		Failed:    counts.FailedCount,
 		Extra:     nil,
 	}
+	if counts.TotalLatency > 0 {
+		summary.AvgLatency = counts.AvgLatency().String()
+		summary.EWMALatency = counts.EWMALatency.String()
+	}
+	return summary
 }
 
 func (m *myModule) IncrCalledCount() {
@@ -125,9 +145,36 @@ func (m *myModule) DecrHandlingNumber() {
 	atomic.AddUint64(&m.handlingNumber, ^uint64(0))
 }
 
+func (m *myModule) IncrFailedCount() {
+	atomic.AddUint64(&m.failedCount, 1)
+}
+
+func (m *myModule) RecordLatency(latency time.Duration) {
+	if latency < 0 {
+		latency = 0
+	}
+	atomic.AddUint64(&m.totalLatency, uint64(latency))
+	for {
+		old := atomic.LoadUint64(&m.ewmaLatency)
+		var ewma uint64
+		if old == 0 {
+			ewma = uint64(latency)
+		} else {
+			ewma = uint64(float64(old)*(1-EWMA_LATENCY_WEIGHT) +
+				float64(latency)*EWMA_LATENCY_WEIGHT)
+		}
+		if atomic.CompareAndSwapUint64(&m.ewmaLatency, old, ewma) {
+			return
+		}
+	}
+}
+
 func (m *myModule) Clear() {
 	atomic.StoreUint64(&m.calledCount, 0)
 	atomic.StoreUint64(&m.acceptedCount, 0)
 	atomic.StoreUint64(&m.completedCount, 0)
 	atomic.StoreUint64(&m.handlingNumber, 0)
+	atomic.StoreUint64(&m.failedCount, 0)
+	atomic.StoreUint64(&m.totalLatency, 0)
+	atomic.StoreUint64(&m.ewmaLatency, 0)
 }
@@ -2,6 +2,7 @@ package stub
 
 import (
 	"testing"
+	"time"
 
 	"gopcp.v2/chapter6/webcrawler/module"
 )
@@ -206,6 +207,48 @@ func TestSummary(t *testing.T) {
 	}
 }
 
+func TestFailedCountAndLatency(t *testing.T) {
+	mi, _ := NewModuleInternal(mid, nil)
+	for i := 0; i < 3; i++ {
+		mi.IncrAcceptedCount()
+	}
+	mi.IncrFailedCount()
+	if mi.Counts().FailedCount != 1 {
+		t.Fatalf("Inconsistent failed count for internal module: expected: %d, actual: %d",
+			1, mi.Counts().FailedCount)
+	}
+	if summary := mi.Summary(); summary.AvgLatency != "" || summary.EWMALatency != "" {
+		t.Fatalf("Non-empty latency in summary without records: %#v", summary)
+	}
+	latencies := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 0}
+	for _, latency := range latencies {
+		mi.RecordLatency(latency)
+	}
+	counts := mi.Counts()
+	if counts.TotalLatency != 300*time.Millisecond {
+		t.Fatalf("Inconsistent total latency for internal module: expected: %s, actual: %s",
+			300*time.Millisecond, counts.TotalLatency)
+	}
+	// 100ms -> 100*0.8+200*0.2=120ms -> 120*0.8+0*0.2=96ms
+	expectedEWMA := 96 * time.Millisecond
+	if counts.EWMALatency != expectedEWMA {
+		t.Fatalf("Inconsistent EWMA latency for internal module: expected: %s, actual: %s",
+			expectedEWMA, counts.EWMALatency)
+	}
+	if counts.AvgLatency() != 100*time.Millisecond {
+		t.Fatalf("Inconsistent average latency for internal module: expected: %s, actual: %s",
+			100*time.Millisecond, counts.AvgLatency())
+	}
+	summary := mi.Summary()
+	if summary.Failed != 1 || summary.EWMALatency != expectedEWMA.String() {
+		t.Fatalf("Inconsistent summary for internal module: %#v", summary)
+	}
+	mi.Clear()
+	if counts := mi.Counts(); counts != (module.Counts{}) {
+		t.Fatalf("Inconsistent counts after clearing: %#v", counts)
+	}
+}
+
 func TestAllInParallel(t *testing.T) {
 	number := uint64(100000)
 	mi, _ := NewModuleInternal(mid, nil)
@@ -0,0 +1,297 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+	werrors "gopcp.v2/chapter6/webcrawler/errors"
+	sched "gopcp.v2/chapter6/webcrawler/scheduler"
+	"gopcp.v2/helper/log"
+)
+
+// logger 代表日志记录器。
+var logger = log.DLogger()
+
+// summary 代表监控结果摘要的结构。
+type summary struct {
+	// NumGoroutine 代表Goroutine的数量。
+	NumGoroutine int `json:"goroutine_number"`
+	// SchedSummary 代表调度器的摘要信息。
+	SchedSummary sched.SummaryStruct `json:"sched_summary"`
+	// EscapedTime 代表从开始监控至今流逝的时间。
+	EscapedTime string `json:"escaped_time"`
+	// ReceivedErrors 代表从错误通道接收到的错误按照类型和原因类别分组的统计信息。
+	ReceivedErrors []werrors.ErrorStat `json:"received_errors,omitempty"`
+}
+
+// msgReachMaxIdleCount 代表已达到最大空闲计数的消息模板。
+var msgReachMaxIdleCount = "The scheduler has been idle for a period of time" +
+	" (about %s)." + " Consider to stop it now."
+
+// msgStopScheduler 代表停止调度器的消息模板。
+var msgStopScheduler = "Stop scheduler...%s."
+
+// Record 代表日志记录函数的类型。
+// 参数level代表日志级别。级别设定：0-普通；1-警告；2-错误。
+type Record func(level uint8, content string)
+
+// Monitor 代表调度器监控器的接口类型。
+type Monitor interface {
+	// Stop 用于停止监控。该方法不会停止调度器，并且可以被多次调用。
+	Stop()
+	// Done 用于获得监控结束通知通道。
+	// 当监控结束之后，该通道会接收到一个代表了空闲状态检查次数的数值，随后被关闭。
+	Done() <-chan uint64
+}
+
+// myMonitor 代表调度器监控器的实现类型。
+type myMonitor struct {
+	// stopFunc 代表用于停止监控的函数。
+	stopFunc context.CancelFunc
+	// checkCountChan 代表检查计数通道。
+	checkCountChan chan uint64
+}
+
+func (monitor *myMonitor) Stop() {
+	monitor.stopFunc()
+}
+
+func (monitor *myMonitor) Done() <-chan uint64 {
+	return monitor.checkCountChan
+}
+
+// Start 用于开始监控调度器，并返回相应的监控器。
+// 参数scheduler代表作为监控目标的调度器，它必须已被初始化。
+// 参数checkInterval代表检查间隔时间，单位：纳秒。
+// 参数summarizeInterval代表摘要获取间隔时间，单位：纳秒。
+// 参数maxIdleCount代表最大空闲计数。
+// 调度器需持续空闲checkInterval与maxIdleCount之积的时间才会被认为已经可以停止。
+// 参数autoStop被用来指示该方法是否在调度器空闲足够长的时间之后自行停止调度器。
+// 参数record代表日志记录函数。
+func Start(
+	scheduler sched.Scheduler,
+	checkInterval time.Duration,
+	summarizeInterval time.Duration,
+	maxIdleCount uint,
+	autoStop bool,
+	record Record) Monitor {
+	// 防止调度器不可用。
+	if scheduler == nil {
+		panic(errors.New("The scheduler is invalid!"))
+	}
+	if scheduler.Done() == nil {
+		panic(errors.New("The scheduler has not been initialized!"))
+	}
+	// 防止过小的检查间隔时间对爬取流程造成不良影响。
+	if checkInterval < time.Millisecond*100 {
+		checkInterval = time.Millisecond * 100
+	}
+	// 防止过小的摘要获取间隔时间对爬取流程造成不良影响。
+	if summarizeInterval < time.Second {
+		summarizeInterval = time.Second
+	}
+	// 防止过小的最大空闲计数造成调度器的过早停止。
+	if maxIdleCount < 10 {
+		maxIdleCount = 10
+	}
+	logger.Infof("Monitor parameters: checkInterval: %s, summarizeInterval: %s,"+
+		" maxIdleCount: %d, autoStop: %v",
+		checkInterval, summarizeInterval, maxIdleCount, autoStop)
+	// 生成监控停止通知器。
+	stopNotifier, stopFunc := context.WithCancel(context.Background())
+	// 接收和报告错误。
+	errorStats := werrors.NewAggregator()
+	reportError(scheduler, record, errorStats, stopNotifier)
+	// 记录摘要信息。
+	recordSummary(scheduler, summarizeInterval, record, errorStats, stopNotifier)
+	// 检查计数通道
+	checkCountChan := make(chan uint64, 1)
+	// 检查空闲状态
+	checkStatus(scheduler,
+		checkInterval*time.Duration(maxIdleCount),
+		autoStop,
+		checkCountChan,
+		record,
+		stopNotifier,
+		stopFunc)
+	return &myMonitor{
+		stopFunc:       stopFunc,
+		checkCountChan: checkCountChan,
+	}
+}
+
+// checkStatus 用于检查状态，并在满足持续空闲时间的条件时采取必要措施。
+// 它会等待调度器发出的空闲通知，而不会轮询调度器的状态。
+// 参数maxIdleTime代表调度器可被停止之前需要持续空闲的时间。
+func checkStatus(
+	scheduler sched.Scheduler,
+	maxIdleTime time.Duration,
+	autoStop bool,
+	checkCountChan chan<- uint64,
+	record Record,
+	stopNotifier context.Context,
+	stopFunc context.CancelFunc) {
+	go func() {
+		var checkCount uint64
+		defer func() {
+			stopFunc()
+			checkCountChan <- checkCount
+			close(checkCountChan)
+		}()
+		timer := time.NewTimer(maxIdleTime)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			// 等待调度器进入空闲状态。
+			idleChan := scheduler.IdleChan()
+			select {
+			case <-idleChan:
+			case <-scheduler.Done():
+				return
+			case <-stopNotifier.Done():
+				return
+			}
+			checkCount++
+			firstIdleTime := time.Now()
+			// 等待足够长的时间。
+			timer.Reset(maxIdleTime)
+			select {
+			case <-timer.C:
+			case <-scheduler.Done():
+				return
+			case <-stopNotifier.Done():
+				return
+			}
+			// 若期间有新的数据被放入缓冲池，则空闲通知通道会被更换，需要重新等待。
+			if scheduler.IdleChan() != idleChan {
+				continue
+			}
+			msg := fmt.Sprintf(msgReachMaxIdleCount, time.Since(firstIdleTime).String())
+			record(0, msg)
+			if autoStop {
+				var result string
+				if err := scheduler.Stop(); err == nil {
+					result = "success"
+				} else {
+					result = fmt.Sprintf("failing(%s)", err)
+				}
+				msg = fmt.Sprintf(msgStopScheduler, result)
+				record(0, msg)
+			}
+			return
+		}
+	}()
+}
+
+// recordSummary 用于记录摘要信息。
+func recordSummary(
+	scheduler sched.Scheduler,
+	summarizeInterval time.Duration,
+	record Record,
+	errorStats werrors.Aggregator,
+	stopNotifier context.Context) {
+	go func() {
+		// 准备。
+		var prevSchedSummaryStruct sched.SummaryStruct
+		var prevNumGoroutine int
+		var prevErrorTotal uint64
+		var recordCount uint64 = 1
+		startTime := time.Now()
+		ticker := time.NewTicker(summarizeInterval)
+		defer ticker.Stop()
+		for {
+			// 获取Goroutine数量和调度器摘要信息。
+			currNumGoroutine := runtime.NumGoroutine()
+			currSchedSummaryStruct := scheduler.Summary().Struct()
+			currErrorTotal := errorStats.Total()
+			// 比对前后两份摘要信息的一致性。只有不一致时才会记录。
+			if currNumGoroutine != prevNumGoroutine ||
+				currErrorTotal != prevErrorTotal ||
+				!currSchedSummaryStruct.Same(prevSchedSummaryStruct) {
+				// 记录摘要信息。
+				summay := summary{
+					NumGoroutine:   runtime.NumGoroutine(),
+					SchedSummary:   currSchedSummaryStruct,
+					EscapedTime:    time.Since(startTime).String(),
+					ReceivedErrors: errorStats.Stats(),
+				}
+				b, err := json.MarshalIndent(summay, "", "    ")
+				if err != nil {
+					logger.Errorf("An error occurs when generating scheduler summary: %s\n", err)
+				} else {
+					msg := fmt.Sprintf("Monitor summary[%d]:\n%s", recordCount, b)
+					record(0, msg)
+					prevNumGoroutine = currNumGoroutine
+					prevErrorTotal = currErrorTotal
+					prevSchedSummaryStruct = currSchedSummaryStruct
+					recordCount++
+				}
+			}
+			// 等待下一次获取或监控停止。
+			select {
+			case <-ticker.C:
+			case <-stopNotifier.Done():
+				return
+			}
+		}
+	}()
+}
+
+// reportError 用于接收和报告错误，并按照类型和原因类别进行统计。
+func reportError(
+	scheduler sched.Scheduler,
+	record Record,
+	errorStats werrors.Aggregator,
+	stopNotifier context.Context) {
+	errorChan := scheduler.ErrorChan()
+	go func() {
+		for {
+			select {
+			case err, ok := <-errorChan:
+				if !ok {
+					return
+				}
+				errorStats.Add(err)
+				errMsg := fmt.Sprintf("Received an error from error channel: %s%s",
+					err, describeErrorContext(err))
+				record(2, errMsg)
+			case <-stopNotifier.Done():
+				return
+			}
+		}
+	}()
+}
+
+// describeErrorContext 用于生成爬虫错误的上下文的描述。
+// 若给定的错误值不是爬虫错误或没有上下文，则返回空字符串。
+func describeErrorContext(err error) string {
+	var ce werrors.CrawlerError
+	if !errors.As(err, &ce) {
+		return ""
+	}
+	ctx := ce.Context()
+	var parts []string
+	if ctx.Stage != "" {
+		parts = append(parts, "stage: "+ctx.Stage)
+	}
+	if ctx.MID != "" {
+		parts = append(parts, "MID: "+ctx.MID)
+	}
+	if ctx.URL != "" {
+		parts = append(parts, "URL: "+ctx.URL)
+	}
+	if ctx.Attempt > 0 {
+		parts = append(parts, fmt.Sprintf("attempt: %d", ctx.Attempt))
+	}
+	if cause := werrors.CauseKind(err); cause != "" {
+		parts = append(parts, "cause: "+cause)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
@@ -0,0 +1,171 @@
+package monitor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	sched "gopcp.v2/chapter6/webcrawler/scheduler"
+)
+
+// fakeSummary 代表测试用的调度器摘要的类型。
+type fakeSummary struct{}
+
+func (fakeSummary) Struct() sched.SummaryStruct {
+	return sched.SummaryStruct{}
+}
+
+func (fakeSummary) String() string {
+	return ""
+}
+
+// fakeScheduler 代表测试用的调度器的类型。
+// 未被覆盖的方法都不应被调用。
+type fakeScheduler struct {
+	sched.Scheduler
+	lock     sync.Mutex
+	doneCh   chan struct{}
+	idleCh   chan struct{}
+	errorCh  chan error
+	stopped  bool
+	stopOnce sync.Once
+}
+
+func newFakeScheduler() *fakeScheduler {
+	return &fakeScheduler{
+		doneCh:  make(chan struct{}),
+		idleCh:  make(chan struct{}),
+		errorCh: make(chan error, 1),
+	}
+}
+
+func (fake *fakeScheduler) Stop() error {
+	fake.lock.Lock()
+	fake.stopped = true
+	fake.lock.Unlock()
+	fake.stopOnce.Do(func() { close(fake.doneCh) })
+	return nil
+}
+
+func (fake *fakeScheduler) Done() <-chan struct{} {
+	return fake.doneCh
+}
+
+func (fake *fakeScheduler) IdleChan() <-chan struct{} {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return fake.idleCh
+}
+
+func (fake *fakeScheduler) ErrorChan() <-chan error {
+	return fake.errorCh
+}
+
+func (fake *fakeScheduler) Summary() sched.SchedSummary {
+	return fakeSummary{}
+}
+
+// setIdle 用于模拟调度器进入空闲状态或有新的工作。
+func (fake *fakeScheduler) setIdle(idle bool) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	if idle {
+		close(fake.idleCh)
+	} else {
+		fake.idleCh = make(chan struct{})
+	}
+}
+
+func (fake *fakeScheduler) isStopped() bool {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	return fake.stopped
+}
+
+// records 代表被记录的日志的类型。
+type records struct {
+	lock     sync.Mutex
+	contents []string
+}
+
+func (r *records) record(level uint8, content string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.contents = append(r.contents, content)
+}
+
+func (r *records) len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.contents)
+}
+
+func TestMonitorAutoStop(t *testing.T) {
+	scheduler := newFakeScheduler()
+	var r records
+	monitor := Start(scheduler, 0, 0, 0, true, r.record)
+	scheduler.errorCh <- errors.New("something wrong")
+	// 空闲的时间不够长时有新的工作，不应停止调度器。
+	scheduler.setIdle(true)
+	time.Sleep(200 * time.Millisecond)
+	scheduler.setIdle(false)
+	select {
+	case <-monitor.Done():
+		t.Fatal("The monitor is done while the scheduler is busy!")
+	case <-time.After(time.Second):
+	}
+	if scheduler.isStopped() {
+		t.Fatal("The scheduler is stopped while it is busy!")
+	}
+	// 持续空闲足够长的时间之后，调度器会被停止。
+	scheduler.setIdle(true)
+	select {
+	case count := <-monitor.Done():
+		if count != 2 {
+			t.Fatalf("Inconsistent check count: expected: %d, actual: %d", 2, count)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("The monitor is not done after the scheduler was idle long enough!")
+	}
+	if !scheduler.isStopped() {
+		t.Fatal("The scheduler is not stopped by monitor!")
+	}
+	// 至少记录了错误、摘要、空闲和停止这几条日志。
+	if n := r.len(); n < 4 {
+		t.Fatalf("Too few records: %d", n)
+	}
+}
+
+func TestMonitorStop(t *testing.T) {
+	scheduler := newFakeScheduler()
+	var r records
+	monitor := Start(scheduler, time.Hour, 0, 0, true, r.record)
+	scheduler.setIdle(true)
+	time.Sleep(100 * time.Millisecond)
+	monitor.Stop()
+	monitor.Stop()
+	select {
+	case count := <-monitor.Done():
+		if count != 1 {
+			t.Fatalf("Inconsistent check count: expected: %d, actual: %d", 1, count)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The monitor is not done after it was stopped!")
+	}
+	if scheduler.isStopped() {
+		t.Fatal("The scheduler is stopped by stopped monitor!")
+	}
+	if _, ok := <-monitor.Done(); ok {
+		t.Fatal("The done channel of monitor has not been closed!")
+	}
+	// 调度器被停止时，监控也会结束。
+	scheduler = newFakeScheduler()
+	monitor = Start(scheduler, 0, 0, 0, false, r.record)
+	scheduler.Stop()
+	select {
+	case <-monitor.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The monitor is not done after the scheduler was stopped!")
+	}
+}
@@ -1,6 +1,13 @@
 package scheduler
 
-import "gopcp.v2/chapter6/webcrawler/module"
+import (
+	"fmt"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
+)
 
 // Args 代表参数容器的接口类型。
 type Args interface {
@@ -17,12 +24,47 @@ type RequestArgs struct {
 	// maxDepth 代表了需要被爬取的最大深度。
 	// 实际深度大于此值的请求都会被忽略。
 	MaxDepth uint32 `json:"max_depth"`
+	// Bootstrap 代表会话引导相关的参数。若为nil，则不进行会话引导。
+	Bootstrap *BootstrapArgs `json:"bootstrap,omitempty"`
+	// Dedup 代表内容去重相关的参数。若为nil，则不进行内容去重。
+	Dedup *DedupArgs `json:"dedup,omitempty"`
+	// DeadLetter 代表死信相关的参数。若为nil，则不记录死信，下载失败的请求也不会被重试。
+	DeadLetter *DeadLetterArgs `json:"dead_letter,omitempty"`
+	// Recrawl 代表重新爬取相关的参数。若为nil，则不记录页面指纹，也不进行增量爬取。
+	Recrawl *RecrawlArgs `json:"recrawl,omitempty"`
+	// Frontier 代表共享爬取边界相关的参数。若为nil，则只使用本地的请求缓冲池。
+	Frontier *FrontierArgs `json:"frontier,omitempty"`
 }
 
 func (args *RequestArgs) Check() error {
 	if args.AcceptedDomains == nil {
 		return genError("nil accepted primary domain list")
 	}
+	if args.Bootstrap != nil {
+		if err := args.Bootstrap.Check(); err != nil {
+			return err
+		}
+	}
+	if args.Dedup != nil {
+		if err := args.Dedup.Check(); err != nil {
+			return err
+		}
+	}
+	if args.DeadLetter != nil {
+		if err := args.DeadLetter.Check(); err != nil {
+			return err
+		}
+	}
+	if args.Recrawl != nil {
+		if err := args.Recrawl.Check(); err != nil {
+			return err
+		}
+	}
+	if args.Frontier != nil {
+		if err := args.Frontier.Check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -34,6 +76,21 @@ func (args *RequestArgs) Same(another *RequestArgs) bool {
 	if another.MaxDepth != args.MaxDepth {
 		return false
 	}
+	if !another.Bootstrap.Same(args.Bootstrap) {
+		return false
+	}
+	if !another.Dedup.Same(args.Dedup) {
+		return false
+	}
+	if !another.DeadLetter.Same(args.DeadLetter) {
+		return false
+	}
+	if !another.Recrawl.Same(args.Recrawl) {
+		return false
+	}
+	if !another.Frontier.Same(args.Frontier) {
+		return false
+	}
 	anotherDomains := another.AcceptedDomains
 	anotherDomainsLen := len(anotherDomains)
 	if anotherDomainsLen != len(args.AcceptedDomains) {
@@ -67,6 +124,13 @@ type DataArgs struct {
 	ErrorBufferCap uint32 `json:"error_buffer_cap"`
 	// ErrorMaxBufferNumber 代表错误缓冲器的最大数量。
 	ErrorMaxBufferNumber uint32 `json:"error_max_buffer_number"`
+	// ReqSpillDir 代表请求溢出文件的目录。
+	// 若不为空，则请求缓冲池已满时，请求会被溢出到该目录中的文件里，而不会阻塞分析器。
+	ReqSpillDir string `json:"req_spill_dir,omitempty"`
+	// ReqSpillSegmentSize 代表单个请求溢出文件的最大字节数。值为0时使用默认值。
+	ReqSpillSegmentSize int64 `json:"req_spill_segment_size,omitempty"`
+	// PoolPolicy 代表各个缓冲池的伸缩策略。若为nil，则使用默认的伸缩策略。
+	PoolPolicy *buffer.PoolPolicy `json:"pool_policy,omitempty"`
 }
 
 func (args *DataArgs) Check() error {
@@ -94,14 +158,33 @@ func (args *DataArgs) Check() error {
 	if args.ErrorMaxBufferNumber == 0 {
 		return genError("zero max error buffer number")
 	}
+	if args.PoolPolicy != nil {
+		maxBufferNumbers := []uint32{
+			args.ReqMaxBufferNumber,
+			args.RespMaxBufferNumber,
+			args.ItemMaxBufferNumber,
+			args.ErrorMaxBufferNumber,
+		}
+		for _, maxBufferNumber := range maxBufferNumbers {
+			if err := args.PoolPolicy.Check(maxBufferNumber); err != nil {
+				return err
+			}
+		}
+	}
+	if args.ReqSpillSegmentSize < 0 {
+		return genError(fmt.Sprintf("negative request spill segment size: %d",
+			args.ReqSpillSegmentSize))
+	}
 	return nil
 }
 
 // ModuleArgsSummary 代表组件相关的参数容器的摘要类型。
 type ModuleArgsSummary struct {
-	DownloaderListSize int `json:"downloader_list_size"`
-	AnalyzerListSize   int `json:"analyzer_list_size"`
-	PipelineListSize   int `json:"pipeline_list_size"`
+	DownloaderListSize int    `json:"downloader_list_size"`
+	AnalyzerListSize   int    `json:"analyzer_list_size"`
+	PipelineListSize   int    `json:"pipeline_list_size"`
+	ExtraListSize      int    `json:"extra_list_size,omitempty"`
+	Balancer           string `json:"balancer,omitempty"`
 }
 
 // ModuleArgs 代表组件相关的参数容器的类型。
@@ -112,6 +195,29 @@ type ModuleArgs struct {
 	Analyzers []module.Analyzer
 	// Pipelines 代表条目处理管道管道列表。
 	Pipelines []module.Pipeline
+	// DownloadTimeout 代表单次下载的超时时间。
+	// 它不包含响应在响应缓冲池中等待的时间，分析器读取响应体的时间则计入AnalyzeTimeout。
+	// 若该值为0，则不设超时。
+	DownloadTimeout time.Duration
+	// AnalyzeTimeout 代表单次分析的超时时间，包含读取响应体的时间。
+	// 若该值为0，则不设超时。
+	AnalyzeTimeout time.Duration
+	// PipelineTimeout 代表单个条目处理的超时时间。
+	// 若该值为0，则不设超时。
+	PipelineTimeout time.Duration
+	// BodyReader 代表调度器在分析之前读取响应体时使用的多重读取器的选项。
+	// 只有启用了内容去重或重新爬取时，调度器才会读取响应体。
+	// 其中的MaxSize应与下载器和分析器所限制的最大尺寸一致。
+	BodyReader reader.Options
+	// Balancer 代表获取组件实例时使用的负载均衡器。
+	// 若该值为nil，则使用基于评分的负载均衡器。
+	Balancer module.Balancer
+	// Health 代表组件健康检查的可选项。
+	// 若该值为nil，则不进行健康检查，组件实例也不会被隔离。
+	Health *module.HealthOptions
+	// Extras 代表自定义类型的组件实例列表。
+	// 它们的类型必须已经通过module.RegisterType注册。
+	Extras []module.Module
 }
 
 // Check 用于当前参数容器的有效性。
@@ -125,13 +231,56 @@ func (args *ModuleArgs) Check() error {
 	if len(args.Pipelines) == 0 {
 		return genError("empty pipeline list")
 	}
+	if args.DownloadTimeout < 0 {
+		return genError("negative download timeout")
+	}
+	if args.AnalyzeTimeout < 0 {
+		return genError("negative analyze timeout")
+	}
+	if args.PipelineTimeout < 0 {
+		return genError("negative pipeline timeout")
+	}
+	if args.BodyReader.MaxSize < 0 {
+		return genError("negative max body size")
+	}
+	if args.BodyReader.MemoryThreshold < 0 {
+		return genError("negative body memory threshold")
+	}
+	if args.Health != nil {
+		if _, err := module.NewHealthChecker(*args.Health, nil); err != nil {
+			return genErrorByError(err)
+		}
+	}
+	for _, m := range args.Extras {
+		if m == nil {
+			return genError("nil extra module")
+		}
+		ok, moduleType := module.GetType(m.ID())
+		if !ok {
+			return genError(fmt.Sprintf("illegal extra module ID: %s", m.ID()))
+		}
+		if module.BuiltinType(moduleType) {
+			return genError(fmt.Sprintf(
+				"built-in module type %s in extra module list (MID: %s)",
+				moduleType, m.ID()))
+		}
+		if !module.CheckType(moduleType, m) {
+			return genError(fmt.Sprintf(
+				"incorrect extra module type: %T (MID: %s)", m, m.ID()))
+		}
+	}
 	return nil
 }
 
 func (args *ModuleArgs) Summary() ModuleArgsSummary {
-	return ModuleArgsSummary{
+	summary := ModuleArgsSummary{
 		DownloaderListSize: len(args.Downloaders),
 		AnalyzerListSize:   len(args.Analyzers),
 		PipelineListSize:   len(args.Pipelines),
+		ExtraListSize:      len(args.Extras),
+	}
+	if args.Balancer != nil {
+		summary.Balancer = args.Balancer.Name()
 	}
+	return summary
 }
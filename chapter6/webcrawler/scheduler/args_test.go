@@ -14,6 +14,7 @@ import (
 	"gopcp.v2/chapter6/webcrawler/module/local/analyzer"
 	"gopcp.v2/chapter6/webcrawler/module/local/downloader"
 	"gopcp.v2/chapter6/webcrawler/module/local/pipeline"
+	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
 )
 
 func TestArgsRequest(t *testing.T) {
@@ -97,6 +98,22 @@ func TestArgsData(t *testing.T) {
 				dataArgs)
 		}
 	}
+	dataArgs.ReqSpillDir = "spill"
+	dataArgs.ReqSpillSegmentSize = -1
+	if err := dataArgs.Check(); err == nil {
+		t.Fatalf("No error when check data arguments! (dataArgs: %#v)",
+			dataArgs)
+	}
+	dataArgs = genDataArgs(10, 2, 1)
+	dataArgs.PoolPolicy = &buffer.PoolPolicy{MinBufferNumber: 3}
+	if err := dataArgs.Check(); err == nil {
+		t.Fatalf("No error when check data arguments! (pool policy: %#v)",
+			*dataArgs.PoolPolicy)
+	}
+	dataArgs.PoolPolicy.MinBufferNumber = 2
+	if err := dataArgs.Check(); err != nil {
+		t.Fatalf("An error occurs when checking data arguments: %s", err)
+	}
 }
 
 // genRequestArgs 用于生成请求参数的实例。
@@ -161,12 +178,62 @@ func TestArgsModule(t *testing.T) {
 		genSimpleModuleArgs(3, 2, 0, t),
 		ModuleArgs{},
 	}
+	for i := 0; i < 3; i++ {
+		moduleArgs := genSimpleModuleArgs(3, 2, 1, t)
+		switch i {
+		case 0:
+			moduleArgs.DownloadTimeout = -time.Second
+		case 1:
+			moduleArgs.AnalyzeTimeout = -time.Second
+		case 2:
+			moduleArgs.PipelineTimeout = -time.Second
+		}
+		moduleArgsList = append(moduleArgsList, moduleArgs)
+	}
 	for _, moduleArgs := range moduleArgsList {
 		if err := moduleArgs.Check(); err == nil {
 			t.Fatalf("No error when check module arguments! (moduleArgs: %#v)",
 				moduleArgs)
 		}
 	}
+	moduleArgs = genSimpleModuleArgs(3, 2, 1, t)
+	if summary := moduleArgs.Summary(); summary.Balancer != "" {
+		t.Fatalf("Inconsistent balancer in summary: expected: %q, actual: %q",
+			"", summary.Balancer)
+	}
+	moduleArgs.Balancer = module.NewRoundRobinBalancer()
+	if err := moduleArgs.Check(); err != nil {
+		t.Fatalf("An error occurs when checking module arguments: %s", err)
+	}
+	if summary := moduleArgs.Summary(); summary.Balancer != module.BALANCER_ROUND_ROBIN {
+		t.Fatalf("Inconsistent balancer in summary: expected: %q, actual: %q",
+			module.BALANCER_ROUND_ROBIN, summary.Balancer)
+	}
+	sched := NewScheduler()
+	if err := sched.Init(genRequestArgs([]string{}, 0), genDataArgs(10, 2, 1), moduleArgs); err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	balancerName := sched.(*myScheduler).registrar.Balancer().Name()
+	if balancerName != module.BALANCER_ROUND_ROBIN {
+		t.Fatalf("Inconsistent balancer of registrar: expected: %s, actual: %s",
+			module.BALANCER_ROUND_ROBIN, balancerName)
+	}
+	if sched.(*myScheduler).registrar.HealthChecker() != nil {
+		t.Fatal("The health checker is enabled without health options!")
+	}
+	moduleArgs.Health = &module.HealthOptions{MaxErrorRate: 2}
+	if err := moduleArgs.Check(); err == nil {
+		t.Fatalf("No error when check module arguments! (health: %#v)",
+			moduleArgs.Health)
+	}
+	moduleArgs.Health = &module.HealthOptions{}
+	sched = NewScheduler()
+	if err := sched.Init(genRequestArgs([]string{}, 0), genDataArgs(10, 2, 1), moduleArgs); err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	if sched.(*myScheduler).registrar.HealthChecker() == nil {
+		t.Fatal("The health checker is not enabled with health options!")
+	}
 }
 
 // genSimpleModuleArgs 用于生成只包含简易组件实例的参数实例。
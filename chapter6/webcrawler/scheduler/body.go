@@ -0,0 +1,91 @@
+package scheduler
+
+import (
+	"io"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/toolkit/dedup"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
+)
+
+// responseBody 代表调度器在分析之前对响应体的读取。
+// 同一个响应的响应体只会被读取一次，其指纹可以被多处共享。
+type responseBody struct {
+	// resp 代表响应。
+	resp *module.Response
+	// opts 代表读取响应体时使用的多重读取器的选项。
+	opts reader.Options
+	// fp 代表响应体的指纹。
+	fp dedup.Fingerprint
+	// err 代表读取响应体时发生的错误。
+	err error
+	// read 代表响应体是否已被读取。
+	read bool
+}
+
+// newResponseBody 用于为给定的响应创建响应体的读取。
+func (sched *myScheduler) newResponseBody(resp *module.Response) *responseBody {
+	return &responseBody{resp: resp, opts: sched.bodyReaderOpts}
+}
+
+// fingerprint 用于获取响应体的指纹。响应体只会在第一次调用时被读取。
+// 读取会通过按需读取的多重读取器进行：内存中最多只保存MemoryThreshold个字节，
+// 超出部分会被写入临时文件，而超出MaxSize时会返回错误。
+// 读取成功之后，响应体会被替换为可以从头读取的形式；读取失败时，响应体会被关闭。
+func (body *responseBody) fingerprint() (dedup.Fingerprint, error) {
+	if body.read {
+		return body.fp, body.err
+	}
+	body.read = true
+	httpResp := body.resp.HTTPResp()
+	spool, err := reader.NewSpoolingMultipleReader(httpResp.Body, body.opts)
+	if err != nil {
+		httpResp.Body.Close()
+		body.err = err
+		return body.fp, body.err
+	}
+	r := spool.Reader()
+	body.fp, body.err = dedup.ReadFingerprint(r, httpResp.Header.Get("Content-Type"))
+	r.Close()
+	if body.err != nil {
+		spool.Close()
+		httpResp.Body.Close()
+		return body.fp, body.err
+	}
+	httpResp.Body = &spooledBody{
+		ReadCloser: spool.Reader(),
+		spool:      spool,
+		src:        httpResp.Body,
+	}
+	return body.fp, nil
+}
+
+// spooledBody 代表已被读取过的响应体。
+// 关闭时，它会释放多重读取器并关闭原始的响应体。
+type spooledBody struct {
+	io.ReadCloser
+	// spool 代表保存响应体的多重读取器。
+	spool reader.MultipleReader
+	// src 代表原始的响应体。
+	src io.Closer
+}
+
+func (body *spooledBody) Close() error {
+	body.ReadCloser.Close()
+	body.spool.Close()
+	return body.src.Close()
+}
+
+// inspectResponse 用于在分析之前检查响应。
+// 重新爬取和内容去重共享同一次对响应体的读取。
+// 未变化的页面或内容重复的响应会被丢弃，此时结果值为nil。
+// 若读取响应体时发生错误，则响应同样会被丢弃，并返回该错误。
+func (sched *myScheduler) inspectResponse(
+	req *module.Request, resp *module.Response) (*module.Response, error) {
+	body := sched.newResponseBody(resp)
+	resp, err := sched.recrawlResponse(req, body)
+	if resp == nil || err != nil {
+		return nil, err
+	}
+	return sched.dedupResponse(body)
+}
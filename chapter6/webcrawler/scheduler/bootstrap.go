@@ -0,0 +1,305 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxBootstrapBodySize 代表会话引导步骤中读取响应体的最大字节数。
+const maxBootstrapBodySize = 10 << 20
+
+// BootstrapArgs 代表会话引导相关的参数容器的类型。
+// 会话引导会在调度器放入第一个请求之前，依次执行声明的HTTP步骤，
+// 例如获取登录页面、提取CSRF令牌、提交登录表单以及确认登录成功。
+type BootstrapArgs struct {
+	// Client 代表执行各个步骤所用的HTTP客户端。
+	// 为了让下载器共享登录后的cookie，
+	// 它应该与下载器所用的HTTP客户端使用同一个cookie jar。
+	Client *http.Client `json:"-"`
+	// Variables 代表可在步骤中引用的变量，例如用户名和密码。
+	// 出于安全考虑，它们不会出现在调度器摘要中。
+	Variables map[string]string `json:"-"`
+	// Timeout 代表单个步骤的超时时间。若为0，则不设超时。
+	Timeout time.Duration `json:"timeout"`
+	// Steps 代表需要依次执行的步骤。
+	Steps []BootstrapStep `json:"steps"`
+}
+
+// BootstrapStep 代表会话引导中的一个HTTP步骤。
+// URL、头部的值、表单的值以及Expect.Contains中都可以使用“${name}”的形式引用变量，
+// 变量来自BootstrapArgs.Variables以及之前的步骤提取出的值。
+type BootstrapStep struct {
+	// Name 代表步骤的名称。
+	Name string `json:"name"`
+	// Method 代表HTTP方法。若为空，则在有表单时使用POST，否则使用GET。
+	Method string `json:"method,omitempty"`
+	// URL 代表请求的URL。
+	URL string `json:"url"`
+	// Header 代表额外的请求头部。
+	Header map[string]string `json:"header,omitempty"`
+	// Form 代表以application/x-www-form-urlencoded格式提交的表单。
+	Form map[string]string `json:"form,omitempty"`
+	// Extract 代表需要从响应中提取的值。
+	Extract []BootstrapExtraction `json:"extract,omitempty"`
+	// Expect 代表对响应的断言。若为nil，则只要求响应状态码小于400。
+	Expect *BootstrapExpectation `json:"expect,omitempty"`
+}
+
+// BootstrapExtraction 代表从响应的HTML中提取值的规则。
+type BootstrapExtraction struct {
+	// Variable 代表保存提取结果的变量名称。
+	Variable string `json:"variable"`
+	// Selector 代表CSS选择器，会使用第一个匹配的元素。
+	Selector string `json:"selector"`
+	// Attr 代表需要提取的属性。若为空，则提取元素的文本。
+	Attr string `json:"attr,omitempty"`
+}
+
+// BootstrapExpectation 代表对步骤响应的断言。
+type BootstrapExpectation struct {
+	// StatusCodes 代表可接受的状态码。若为空，则接受小于400的状态码。
+	StatusCodes []int `json:"status_codes,omitempty"`
+	// Contains 代表响应体中必须包含的内容。
+	Contains string `json:"contains,omitempty"`
+	// NotContains 代表响应体中不能包含的内容。
+	NotContains string `json:"not_contains,omitempty"`
+	// Selector 代表响应的HTML中至少要有一个元素与之匹配的CSS选择器。
+	Selector string `json:"selector,omitempty"`
+	// Cookie 代表步骤完成后必须存在于该步骤URL的cookie中的名称。
+	Cookie string `json:"cookie,omitempty"`
+}
+
+func (args *BootstrapArgs) Check() error {
+	if args.Client == nil {
+		return genError("nil bootstrap HTTP client")
+	}
+	if args.Timeout < 0 {
+		return genError(fmt.Sprintf("negative bootstrap timeout: %s", args.Timeout))
+	}
+	if len(args.Steps) == 0 {
+		return genError("empty bootstrap step list")
+	}
+	for i, step := range args.Steps {
+		if step.URL == "" {
+			return genError(fmt.Sprintf("empty URL of bootstrap step %d", i))
+		}
+		for _, extraction := range step.Extract {
+			if extraction.Variable == "" || extraction.Selector == "" {
+				return genError(fmt.Sprintf(
+					"incomplete extraction of bootstrap step %d: %#v", i, extraction))
+			}
+		}
+	}
+	return nil
+}
+
+// Same 用于判断两个会话引导相关的参数容器是否相同。
+func (args *BootstrapArgs) Same(another *BootstrapArgs) bool {
+	if args == nil || another == nil {
+		return args == another
+	}
+	return args.Timeout == another.Timeout &&
+		reflect.DeepEqual(args.Steps, another.Steps)
+}
+
+// regexpForVariable 代表用于查找变量引用的正则表达式。
+var regexpForVariable = regexp.MustCompile(`\$\{([A-Za-z0-9_.\-]+)\}`)
+
+// expandVariables 用于替换给定字符串中的变量引用。
+func expandVariables(s string, variables map[string]string) (string, error) {
+	var missing string
+	result := regexpForVariable.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, ok := variables[name]
+		if !ok && missing == "" {
+			missing = name
+		}
+		return value
+	})
+	if missing != "" {
+		return "", fmt.Errorf("undefined variable %q", missing)
+	}
+	return result, nil
+}
+
+// runBootstrap 用于依次执行会话引导的各个步骤。
+func runBootstrap(ctx context.Context, args *BootstrapArgs) error {
+	variables := map[string]string{}
+	for name, value := range args.Variables {
+		variables[name] = value
+	}
+	for i, step := range args.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		logger.Infof("Run the bootstrap step %s (URL: %s)...", name, step.URL)
+		if err := runBootstrapStep(ctx, args, step, variables); err != nil {
+			return genError(fmt.Sprintf("bootstrap step %s failed: %s", name, err))
+		}
+	}
+	return nil
+}
+
+// runBootstrapStep 用于执行会话引导的单个步骤。
+// 提取出的值会被存入参数variables。
+func runBootstrapStep(
+	ctx context.Context,
+	args *BootstrapArgs,
+	step BootstrapStep,
+	variables map[string]string) error {
+	httpReq, err := newBootstrapRequest(step, variables)
+	if err != nil {
+		return err
+	}
+	if args.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, args.Timeout)
+		defer cancel()
+	}
+	httpResp, err := args.Client.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(httpResp.Body, maxBootstrapBodySize))
+	if err != nil {
+		return err
+	}
+	expect := step.Expect
+	if expect == nil {
+		expect = &BootstrapExpectation{}
+	}
+	if err := checkStatusCode(httpResp.StatusCode, expect.StatusCodes); err != nil {
+		return err
+	}
+	if expect.Contains != "" {
+		contains, err := expandVariables(expect.Contains, variables)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(contains)) {
+			return fmt.Errorf("the response does not contain %q", contains)
+		}
+	}
+	if expect.NotContains != "" && bytes.Contains(body, []byte(expect.NotContains)) {
+		return fmt.Errorf("the response contains %q", expect.NotContains)
+	}
+	if len(step.Extract) > 0 || expect.Selector != "" {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if expect.Selector != "" && doc.Find(expect.Selector).Length() == 0 {
+			return fmt.Errorf("no element matches the selector %q", expect.Selector)
+		}
+		for _, extraction := range step.Extract {
+			sel := doc.Find(extraction.Selector).First()
+			if sel.Length() == 0 {
+				return fmt.Errorf("no element matches the selector %q (variable: %s)",
+					extraction.Selector, extraction.Variable)
+			}
+			var value string
+			if extraction.Attr == "" {
+				value = strings.TrimSpace(sel.Text())
+			} else {
+				var ok bool
+				value, ok = sel.Attr(extraction.Attr)
+				if !ok {
+					return fmt.Errorf("no attribute %q in the element matches %q (variable: %s)",
+						extraction.Attr, extraction.Selector, extraction.Variable)
+				}
+			}
+			variables[extraction.Variable] = value
+		}
+	}
+	if expect.Cookie != "" {
+		if !hasCookie(args.Client.Jar, httpReq.URL, expect.Cookie) {
+			return fmt.Errorf("no cookie named %q for %s", expect.Cookie, httpReq.URL)
+		}
+	}
+	return nil
+}
+
+// newBootstrapRequest 用于根据步骤生成HTTP请求。
+func newBootstrapRequest(
+	step BootstrapStep, variables map[string]string) (*http.Request, error) {
+	rawURL, err := expandVariables(step.URL, variables)
+	if err != nil {
+		return nil, err
+	}
+	method := strings.ToUpper(step.Method)
+	if method == "" {
+		method = "GET"
+		if len(step.Form) > 0 {
+			method = "POST"
+		}
+	}
+	var body io.Reader
+	if len(step.Form) > 0 {
+		form := url.Values{}
+		for key, value := range step.Form {
+			value, err := expandVariables(value, variables)
+			if err != nil {
+				return nil, err
+			}
+			form.Set(key, value)
+		}
+		body = strings.NewReader(form.Encode())
+	}
+	httpReq, err := http.NewRequest(method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for key, value := range step.Header {
+		value, err := expandVariables(value, variables)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set(key, value)
+	}
+	return httpReq, nil
+}
+
+// checkStatusCode 用于检查响应的状态码是否可接受。
+func checkStatusCode(statusCode int, expected []int) error {
+	if len(expected) == 0 {
+		if statusCode >= 400 {
+			return fmt.Errorf("unexpected status code %d", statusCode)
+		}
+		return nil
+	}
+	for _, code := range expected {
+		if statusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected status code %d (expected: %v)", statusCode, expected)
+}
+
+// hasCookie 用于判断cookie jar中是否有给定URL的、具有给定名称的cookie。
+func hasCookie(jar http.CookieJar, u *url.URL, name string) bool {
+	if jar == nil {
+		return false
+	}
+	for _, cookie := range jar.Cookies(u) {
+		if cookie.Name == name {
+			return true
+		}
+	}
+	return false
+}
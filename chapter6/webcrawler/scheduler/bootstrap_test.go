@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newLoginServer 用于创建一个需要登录的测试服务器。
+func newLoginServer() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `<html><body><form method="post">`+
+				`<input type="hidden" name="csrf" value="token-123">`+
+				`<span class="hint"> welcome back </span></form></body></html>`)
+			return
+		}
+		r.ParseForm()
+		if r.PostForm.Get("csrf") != "token-123" {
+			http.Error(w, "invalid csrf token", http.StatusForbidden)
+			return
+		}
+		if r.PostForm.Get("user") != "gopher" || r.PostForm.Get("password") != "secret" {
+			fmt.Fprint(w, "Login failed")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s-1", Path: "/"})
+		http.Redirect(w, r, "/home", http.StatusFound)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("sid"); err != nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		fmt.Fprintf(w, `<html><body><div id="user">Hello, gopher</div></body></html>`)
+	})
+	return httptest.NewServer(mux)
+}
+
+// genBootstrapArgs 用于生成会话引导参数的实例。
+func genBootstrapArgs(baseURL string, password string) *BootstrapArgs {
+	jar, _ := cookiejar.New(nil)
+	return &BootstrapArgs{
+		Client:    &http.Client{Jar: jar},
+		Variables: map[string]string{"base": baseURL, "password": password},
+		Timeout:   5 * time.Second,
+		Steps: []BootstrapStep{
+			{
+				Name: "login-page",
+				URL:  "${base}/login",
+				Extract: []BootstrapExtraction{
+					{Variable: "csrf", Selector: "input[name=csrf]", Attr: "value"},
+					{Variable: "hint", Selector: ".hint"},
+				},
+			},
+			{
+				Name: "login",
+				URL:  "${base}/login",
+				Form: map[string]string{
+					"csrf":     "${csrf}",
+					"user":     "gopher",
+					"password": "${password}",
+				},
+				Expect: &BootstrapExpectation{
+					StatusCodes: []int{http.StatusOK},
+					NotContains: "Login failed",
+					Selector:    "#user",
+					Cookie:      "sid",
+				},
+			},
+		},
+	}
+}
+
+func TestBootstrapRun(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+	args := genBootstrapArgs(server.URL, "secret")
+	if err := args.Check(); err != nil {
+		t.Fatalf("An error occurs when checking bootstrap args: %s", err)
+	}
+	if err := runBootstrap(context.Background(), args); err != nil {
+		t.Fatalf("An error occurs when running bootstrap: %s", err)
+	}
+	// 登录后的cookie可被共享同一个cookie jar的客户端使用。
+	client := &http.Client{Jar: args.Client.Jar}
+	resp, err := client.Get(server.URL + "/home")
+	if err != nil {
+		t.Fatalf("An error occurs when requesting home page: %s", err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Path != "/home" {
+		t.Fatalf("Inconsistent final path: expected: %s, actual: %s",
+			"/home", resp.Request.URL.Path)
+	}
+	// 登录失败的情况。
+	args = genBootstrapArgs(server.URL, "wrong")
+	err = runBootstrap(context.Background(), args)
+	if err == nil {
+		t.Fatal("No error when running bootstrap with wrong password!")
+	}
+	if !strings.Contains(err.Error(), "Login failed") {
+		t.Fatalf("Inconsistent error: %s", err)
+	}
+	// 引用未定义变量的情况。
+	args = genBootstrapArgs(server.URL, "secret")
+	args.Steps[1].Form["extra"] = "${undefined}"
+	if err := runBootstrap(context.Background(), args); err == nil {
+		t.Fatal("No error when referencing undefined variable!")
+	}
+	// 提取失败的情况。
+	args = genBootstrapArgs(server.URL, "secret")
+	args.Steps[0].Extract[0].Selector = "input[name=token]"
+	if err := runBootstrap(context.Background(), args); err == nil {
+		t.Fatal("No error when extracting value by unmatched selector!")
+	}
+}
+
+func TestBootstrapArgs(t *testing.T) {
+	invalidArgsList := []*BootstrapArgs{
+		{Steps: []BootstrapStep{{URL: "http://example.com"}}},
+		{Client: &http.Client{}},
+		{Client: &http.Client{}, Steps: []BootstrapStep{{}}},
+		{Client: &http.Client{}, Timeout: -1,
+			Steps: []BootstrapStep{{URL: "http://example.com"}}},
+		{Client: &http.Client{}, Steps: []BootstrapStep{{URL: "http://example.com",
+			Extract: []BootstrapExtraction{{Variable: "v"}}}}},
+	}
+	for _, args := range invalidArgsList {
+		if err := args.Check(); err == nil {
+			t.Fatalf("No error when checking illegal bootstrap args %#v!", args)
+		}
+		requestArgs := RequestArgs{AcceptedDomains: []string{}, Bootstrap: args}
+		if err := requestArgs.Check(); err == nil {
+			t.Fatalf("No error when checking request args with illegal bootstrap args %#v!", args)
+		}
+	}
+	one := genBootstrapArgs("http://example.com", "secret")
+	another := genBootstrapArgs("http://example.com", "other")
+	if !one.Same(another) {
+		t.Fatal("Different bootstrap args with same steps!")
+	}
+	another.Steps[0].URL = "http://example.com/signin"
+	if one.Same(another) {
+		t.Fatal("Same bootstrap args with different steps!")
+	}
+	var nilArgs *BootstrapArgs
+	if nilArgs.Same(one) || !nilArgs.Same(nil) {
+		t.Fatal("Inconsistent comparison result for nil bootstrap args!")
+	}
+}
+
+func TestBootstrapStart(t *testing.T) {
+	server := newLoginServer()
+	defer server.Close()
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Bootstrap = genBootstrapArgs(server.URL, "wrong")
+	dataArgs := genDataArgs(10, 2, 1)
+	moduleArgs := genSimpleModuleArgs(1, 1, 1, t)
+	sched := NewScheduler()
+	if err := sched.Init(requestArgs, dataArgs, moduleArgs); err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	firstHTTPReq, _ := http.NewRequest("GET", server.URL+"/home", nil)
+	if err := sched.Start(firstHTTPReq); err == nil {
+		t.Fatal("No error when starting scheduler with failed bootstrap!")
+	}
+	if sched.Status() != SCHED_STATUS_INITIALIZED {
+		t.Fatalf("Inconsistent status: expected: %s, actual: %s",
+			GetStatusDescription(SCHED_STATUS_INITIALIZED),
+			GetStatusDescription(sched.Status()))
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	variables := map[string]string{"host": "example.com", "user.name": "gopher"}
+	actual, err := expandVariables("http://${host}/u/${user.name}?q=$x", variables)
+	if err != nil {
+		t.Fatalf("An error occurs when expanding variables: %s", err)
+	}
+	expected := "http://example.com/u/gopher?q=$x"
+	if actual != expected {
+		t.Fatalf("Inconsistent expanded string: expected: %s, actual: %s", expected, actual)
+	}
+	if _, err := expandVariables("${missing}", variables); err == nil {
+		t.Fatal("No error when expanding undefined variable!")
+	}
+}
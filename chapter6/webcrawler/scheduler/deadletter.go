@@ -0,0 +1,381 @@
+package scheduler
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// DeadLetterKind 代表死信的种类。
+type DeadLetterKind string
+
+// 死信种类的常量。
+const (
+	// DEAD_LETTER_REQUEST 代表下载失败的请求。
+	DEAD_LETTER_REQUEST DeadLetterKind = "request"
+	// DEAD_LETTER_ITEM 代表处理失败的条目。
+	DEAD_LETTER_ITEM DeadLetterKind = "item"
+)
+
+// DeadLetterArgs 代表死信相关的参数容器的类型。
+type DeadLetterArgs struct {
+	// Path 代表死信文件的路径。死信会以JSON Lines格式追加写入该文件。
+	Path string `json:"path"`
+	// MaxAttempts 代表每个请求的最大下载尝试次数。
+	// 下载失败的请求会被重试，直到尝试次数达到该值后才会成为死信。
+	// 值为0或1时，下载失败的请求会直接成为死信。
+	MaxAttempts uint32 `json:"max_attempts,omitempty"`
+}
+
+// Check 用于检查当前参数容器的有效性。
+func (args *DeadLetterArgs) Check() error {
+	if args.Path == "" {
+		return genError("empty dead letter file path")
+	}
+	return nil
+}
+
+// Same 用于判断两个死信相关的参数容器是否相同。
+func (args *DeadLetterArgs) Same(another *DeadLetterArgs) bool {
+	if args == nil || another == nil {
+		return args == another
+	}
+	return *args == *another
+}
+
+// DeadLetterAttempt 代表一次失败的处理尝试。
+type DeadLetterAttempt struct {
+	// Attempt 代表尝试的序号，从1开始。
+	Attempt uint32 `json:"attempt"`
+	// MID 代表处理数据的组件实例的ID。
+	MID string `json:"mid,omitempty"`
+	// Stage 代表失败时所处的调度阶段。
+	Stage string `json:"stage,omitempty"`
+	// ErrorType 代表错误的类型。
+	ErrorType errors.ErrorType `json:"error_type,omitempty"`
+	// Errors 代表错误的提示信息的列表。
+	Errors []string `json:"errors"`
+	// Time 代表失败的时间。
+	Time time.Time `json:"time"`
+}
+
+// DeadLetter 代表死信，即无法被成功处理的请求或条目。
+type DeadLetter struct {
+	// ID 代表死信在死信文件中的序号，从1开始。
+	ID uint64 `json:"id"`
+	// Kind 代表死信的种类。
+	Kind DeadLetterKind `json:"kind"`
+	// Method 代表请求的HTTP方法。仅对请求有效。
+	Method string `json:"method,omitempty"`
+	// URL 代表请求的URL。仅对请求有效。
+	URL string `json:"url,omitempty"`
+	// Header 代表请求的HTTP头。仅对请求有效。
+	Header http.Header `json:"header,omitempty"`
+	// Depth 代表请求的深度。仅对请求有效。
+	Depth uint32 `json:"depth,omitempty"`
+	// Item 代表条目。仅对条目有效。
+	// 注意，从死信文件中读出的条目中的数值都是float64类型的。
+	Item module.Item `json:"item,omitempty"`
+	// Attempts 代表历次失败的尝试。
+	Attempts []DeadLetterAttempt `json:"attempts"`
+	// Time 代表成为死信的时间。
+	Time time.Time `json:"time"`
+}
+
+// request 用于根据死信重建请求。
+func (letter DeadLetter) request() (*module.Request, error) {
+	method := letter.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	httpReq, err := http.NewRequest(method, letter.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range letter.Header {
+		httpReq.Header[key] = append([]string(nil), values...)
+	}
+	return module.NewRequest(httpReq, letter.Depth), nil
+}
+
+// DeadLetterStore 代表死信存储的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type DeadLetterStore interface {
+	// Put 用于追加一封死信，并返回被赋予了ID和时间的死信。
+	Put(letter DeadLetter) (DeadLetter, error)
+	// Count 用于获取本次打开之后追加的死信的数量。
+	Count() uint64
+	// Close 用于关闭死信存储。
+	Close() error
+}
+
+// myDeadLetterStore 代表基于追加写入的文件的死信存储的实现类型。
+type myDeadLetterStore struct {
+	// lock 代表互斥锁。
+	lock sync.Mutex
+	// file 代表死信文件。
+	file *os.File
+	// lastID 代表最后一封死信的ID。
+	lastID uint64
+	// count 代表本次打开之后追加的死信的数量。
+	count uint64
+}
+
+// NewDeadLetterStore 用于打开或创建死信文件，并返回相应的死信存储。
+// 新的死信会被追加到文件的末尾，其ID会接续文件中已有的死信。
+func NewDeadLetterStore(path string) (DeadLetterStore, error) {
+	letters, err := ReadDeadLetters(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store := &myDeadLetterStore{file: file}
+	for _, letter := range letters {
+		if letter.ID > store.lastID {
+			store.lastID = letter.ID
+		}
+	}
+	return store, nil
+}
+
+func (store *myDeadLetterStore) Put(letter DeadLetter) (DeadLetter, error) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.file == nil {
+		return letter, genError("closed dead letter store")
+	}
+	letter.ID = store.lastID + 1
+	if letter.Time.IsZero() {
+		letter.Time = time.Now()
+	}
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return letter, genErrorByError(err)
+	}
+	if _, err := store.file.Write(append(line, '\n')); err != nil {
+		return letter, genErrorByError(err)
+	}
+	store.lastID = letter.ID
+	store.count++
+	return letter, nil
+}
+
+func (store *myDeadLetterStore) Count() uint64 {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	return store.count
+}
+
+func (store *myDeadLetterStore) Close() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if store.file == nil {
+		return nil
+	}
+	err := store.file.Close()
+	store.file = nil
+	return err
+}
+
+// ReadDeadLetters 用于读取死信文件中的所有死信。
+// 可以从中选出问题已被解决的死信，再通过调度器的Replay方法重新注入。
+func ReadDeadLetters(path string) ([]DeadLetter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return letters, genError(fmt.Sprintf("invalid dead letter at line %d: %s",
+				lineNumber, err))
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return letters, genErrorByError(err)
+	}
+	return letters, nil
+}
+
+// initDeadLetters 用于根据参数打开死信存储。
+func (sched *myScheduler) initDeadLetters(args *DeadLetterArgs) error {
+	sched.closeDeadLetters()
+	sched.deadLetters = nil
+	sched.deadLetterArgs = args
+	if args == nil {
+		return nil
+	}
+	store, err := NewDeadLetterStore(args.Path)
+	if err != nil {
+		return err
+	}
+	sched.deadLetters = store
+	logger.Infof("-- Dead letters: path: %s, max attempts: %d", args.Path, args.MaxAttempts)
+	return nil
+}
+
+// closeDeadLetters 用于关闭死信存储并清除失败尝试的记录。
+func (sched *myScheduler) closeDeadLetters() {
+	if sched.deadLetters != nil {
+		if err := sched.deadLetters.Close(); err != nil {
+			logger.Errorf("An error occurs when closing dead letter store: %s", err)
+		}
+	}
+	sched.attemptHistory.Range(func(key, _ interface{}) bool {
+		sched.attemptHistory.Delete(key)
+		return true
+	})
+}
+
+// genDeadLetterAttempt 用于根据爬虫错误生成失败尝试的记录。
+func genDeadLetterAttempt(attempt uint32, errs ...errors.CrawlerError) DeadLetterAttempt {
+	record := DeadLetterAttempt{Attempt: attempt, Time: time.Now()}
+	for _, ce := range errs {
+		if record.ErrorType == "" {
+			ctx := ce.Context()
+			record.MID = ctx.MID
+			record.Stage = ctx.Stage
+			record.ErrorType = ce.Type()
+			record.Time = ctx.Time
+		}
+		record.Errors = append(record.Errors, ce.Error())
+	}
+	return record
+}
+
+// handleFailedRequest 用于处理下载失败的请求。
+// 若尝试次数未达到上限，则记录本次失败并重试，否则把请求连同历次失败的记录放入死信存储。
+func (sched *myScheduler) handleFailedRequest(req *module.Request, ce errors.CrawlerError) {
+	if sched.deadLetters == nil {
+		return
+	}
+	value, _ := sched.attemptHistory.LoadOrStore(req.ID(), []DeadLetterAttempt(nil))
+	history := append(value.([]DeadLetterAttempt), genDeadLetterAttempt(req.Attempt(), ce))
+	if req.Attempt() < sched.deadLetterArgs.MaxAttempts {
+		// 先记录失败的尝试，以免重试的请求在记录之前就被下载。
+		sched.attemptHistory.Store(req.ID(), history)
+		if sched.resendReq(req) {
+			logger.Infof("Retry the request after %d failed attempt(s). (URL: %s)",
+				req.Attempt(), req.HTTPReq().URL)
+			return
+		}
+	}
+	sched.attemptHistory.Delete(req.ID())
+	httpReq := req.HTTPReq()
+	letter := DeadLetter{
+		Kind:     DEAD_LETTER_REQUEST,
+		Method:   httpReq.Method,
+		URL:      httpReq.URL.String(),
+		Header:   httpReq.Header,
+		Depth:    req.Depth(),
+		Attempts: history,
+	}
+	sched.putDeadLetter(letter)
+}
+
+// handleFailedItem 用于把处理失败的条目连同错误放入死信存储。
+func (sched *myScheduler) handleFailedItem(item module.Item, errs []errors.CrawlerError) {
+	if sched.deadLetters == nil || len(errs) == 0 {
+		return
+	}
+	letter := DeadLetter{
+		Kind:     DEAD_LETTER_ITEM,
+		Item:     item,
+		Attempts: []DeadLetterAttempt{genDeadLetterAttempt(1, errs...)},
+	}
+	sched.putDeadLetter(letter)
+}
+
+// putDeadLetter 用于把死信放入死信存储。
+func (sched *myScheduler) putDeadLetter(letter DeadLetter) {
+	letter, err := sched.deadLetters.Put(letter)
+	if err != nil {
+		logger.Errorf("Couldn't put dead letter: %s (kind: %s, URL: %s)",
+			err, letter.Kind, letter.URL)
+		return
+	}
+	logger.Warnf("Put dead letter %d. (kind: %s, URL: %s, attempts: %d)",
+		letter.ID, letter.Kind, letter.URL, len(letter.Attempts))
+}
+
+// forgetRequest 用于清除已下载成功的请求的失败记录。
+func (sched *myScheduler) forgetRequest(req *module.Request) {
+	if sched.deadLetters != nil && req.Attempt() > 1 {
+		sched.attemptHistory.Delete(req.ID())
+	}
+}
+
+// resendReq 会把需要重试的请求直接放入请求缓冲池，而不经过URL去重等过滤。
+func (sched *myScheduler) resendReq(req *module.Request) bool {
+	if sched.canceled() || sched.reqBufferPool.Closed() {
+		return false
+	}
+	return sched.sendTracked(func() bool {
+		return sched.reqOverflow.put(sched.ctx, req)
+	})
+}
+
+// Replay 用于把给定的死信重新注入到正在运行的调度器中。
+// 请求类的死信会像新发现的请求一样经过过滤，条目类的死信会被直接放入条目缓冲池。
+// 结果值代表被成功注入的死信的数量。
+func (sched *myScheduler) Replay(letters []DeadLetter) (int, error) {
+	if sched.Status() != SCHED_STATUS_STARTED {
+		return 0, genError("the scheduler has not been started")
+	}
+	var count int
+	for _, letter := range letters {
+		switch letter.Kind {
+		case DEAD_LETTER_REQUEST:
+			req, err := letter.request()
+			if err != nil {
+				return count, genError(fmt.Sprintf("invalid dead letter %d: %s", letter.ID, err))
+			}
+			if !sched.sendReq(req) {
+				logger.Warnf("Ignore the dead letter %d. (URL: %s)", letter.ID, letter.URL)
+				continue
+			}
+		case DEAD_LETTER_ITEM:
+			item := letter.Item
+			sent := sched.sendTracked(func() bool {
+				return sendItem(sched.ctx, item, sched.itemOverflow)
+			})
+			if !sent {
+				logger.Warnf("Ignore the dead letter %d.", letter.ID)
+				continue
+			}
+		default:
+			return count, genError(fmt.Sprintf("unknown kind %q of dead letter %d",
+				letter.Kind, letter.ID))
+		}
+		count++
+	}
+	return count, nil
+}
+
+// getDeadLetterCount 用于获取已追加的死信的数量。
+func getDeadLetterCount(store DeadLetterStore) uint64 {
+	if store == nil {
+		return 0
+	}
+	return store.Count()
+}
@@ -0,0 +1,266 @@
+package scheduler
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	werrors "gopcp.v2/chapter6/webcrawler/errors"
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/module/local/pipeline"
+)
+
+func TestDeadLetterArgs(t *testing.T) {
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.DeadLetter = &DeadLetterArgs{}
+	if err := requestArgs.Check(); err == nil {
+		t.Fatal("No error when checking request arguments with empty dead letter path!")
+	}
+	requestArgs.DeadLetter = &DeadLetterArgs{Path: "dead.jsonl", MaxAttempts: 3}
+	if err := requestArgs.Check(); err != nil {
+		t.Fatalf("An error occurs when checking request arguments: %s", err)
+	}
+	another := genRequestArgs([]string{}, 0)
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with and without dead letter are same!")
+	}
+	another.DeadLetter = &DeadLetterArgs{Path: "dead.jsonl", MaxAttempts: 3}
+	if !requestArgs.Same(&another) {
+		t.Fatal("The request arguments with same dead letter arguments are not same!")
+	}
+	another.DeadLetter.MaxAttempts = 2
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with different dead letter arguments are same!")
+	}
+}
+
+func TestDeadLetterStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead.jsonl")
+	store, err := NewDeadLetterStore(path)
+	if err != nil {
+		t.Fatalf("An error occurs when creating dead letter store: %s", err)
+	}
+	letter, err := store.Put(DeadLetter{Kind: DEAD_LETTER_REQUEST, URL: "http://example.com/a"})
+	if err != nil {
+		t.Fatalf("An error occurs when putting dead letter: %s", err)
+	}
+	if letter.ID != 1 || letter.Time.IsZero() {
+		t.Fatalf("Inconsistent dead letter: %#v", letter)
+	}
+	store.Put(DeadLetter{Kind: DEAD_LETTER_ITEM, Item: module.Item{"n": 1}})
+	if store.Count() != 2 {
+		t.Fatalf("Inconsistent dead letter count: expected: %d, actual: %d", 2, store.Count())
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("An error occurs when closing dead letter store: %s", err)
+	}
+	if _, err := store.Put(DeadLetter{Kind: DEAD_LETTER_ITEM}); err == nil {
+		t.Fatal("No error when putting dead letter into closed store!")
+	}
+	// 重新打开时，新的死信会被追加，且ID会接续已有的死信。
+	store, err = NewDeadLetterStore(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reopening dead letter store: %s", err)
+	}
+	letter, _ = store.Put(DeadLetter{Kind: DEAD_LETTER_REQUEST, URL: "http://example.com/b"})
+	store.Close()
+	if letter.ID != 3 || store.Count() != 1 {
+		t.Fatalf("Inconsistent dead letter: ID: %d, count: %d", letter.ID, store.Count())
+	}
+	letters, err := ReadDeadLetters(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reading dead letters: %s", err)
+	}
+	if len(letters) != 3 {
+		t.Fatalf("Inconsistent dead letter number: expected: %d, actual: %d", 3, len(letters))
+	}
+	for i, letter := range letters {
+		if letter.ID != uint64(i+1) {
+			t.Fatalf("Inconsistent ID of dead letter %d: %d", i, letter.ID)
+		}
+	}
+	if letters[1].Item["n"] != float64(1) {
+		t.Fatalf("Inconsistent item: %#v", letters[1].Item)
+	}
+	ioutil.WriteFile(path, []byte("{bad json}\n"), 0644)
+	if _, err := ReadDeadLetters(path); err == nil {
+		t.Fatal("No error when reading invalid dead letters!")
+	}
+	if _, err := NewDeadLetterStore(path); err == nil {
+		t.Fatal("No error when opening invalid dead letter file!")
+	}
+}
+
+func TestSchedDeadLetter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "dead.jsonl")
+	requestArgs := genRequestArgs([]string{"example.com"}, 1)
+	requestArgs.DeadLetter = &DeadLetterArgs{Path: path, MaxAttempts: 2}
+	sched := NewScheduler()
+	err = sched.Init(requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	httpReq, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	httpReq.Header.Set("User-Agent", "test")
+	req := module.NewRequest(httpReq, 1)
+	// 第一次失败之后，请求会被重试。
+	req.IncrAttempt()
+	errCtx := genErrorContext("D1", module.STAGE_DOWNLOAD, req)
+	ms.handleFailedRequest(req, genCrawlerError(errors.New("refused"), errCtx))
+	datum, err := ms.reqBufferPool.Get()
+	if err != nil {
+		t.Fatalf("An error occurs when getting request: %s", err)
+	}
+	if datum != req {
+		t.Fatalf("Inconsistent retried request: expected: %v, actual: %v", req, datum)
+	}
+	// 经过溢出缓冲池的编码和解码之后，请求的失败记录不会丢失。
+	codec := module.RequestCodec{}
+	p, err := codec.Encode(req)
+	if err != nil {
+		t.Fatalf("An error occurs when encoding request: %s", err)
+	}
+	datum, err = codec.Decode(p)
+	if err != nil {
+		t.Fatalf("An error occurs when decoding request: %s", err)
+	}
+	req = datum.(*module.Request)
+	// 第二次失败之后，请求会成为死信。
+	req.IncrAttempt()
+	errCtx = genErrorContext("D1", module.STAGE_DOWNLOAD, req)
+	ms.handleFailedRequest(req, genCrawlerError(errors.New("timeout"), errCtx))
+	if ms.reqBufferPool.Total() != 0 {
+		t.Fatalf("The request is retried too many times!")
+	}
+	item := module.Item{"url": "http://example.com/a"}
+	errCtx = genErrorContext("P1", module.STAGE_PIPELINE, nil)
+	ms.handleFailedItem(item, []werrors.CrawlerError{
+		genCrawlerError(errors.New("bad item"), errCtx),
+		genCrawlerError(errors.New("bad field"), errCtx),
+	})
+	if count := sched.Summary().Struct().DeadLetters; count != 2 {
+		t.Fatalf("Inconsistent dead letter count: expected: %d, actual: %d", 2, count)
+	}
+	letters, err := ReadDeadLetters(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reading dead letters: %s", err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("Inconsistent dead letter number: expected: %d, actual: %d", 2, len(letters))
+	}
+	letter := letters[0]
+	if letter.Kind != DEAD_LETTER_REQUEST || letter.URL != "http://example.com/a" ||
+		letter.Depth != 1 || letter.Header.Get("User-Agent") != "test" {
+		t.Fatalf("Inconsistent request dead letter: %#v", letter)
+	}
+	if len(letter.Attempts) != 2 {
+		t.Fatalf("Inconsistent attempt number: expected: %d, actual: %d", 2, len(letter.Attempts))
+	}
+	for i, attempt := range letter.Attempts {
+		if attempt.Attempt != uint32(i+1) || attempt.MID != "D1" ||
+			attempt.ErrorType != werrors.ERROR_TYPE_DOWNLOADER {
+			t.Fatalf("Inconsistent attempt %d: %#v", i, attempt)
+		}
+	}
+	letter = letters[1]
+	if letter.Kind != DEAD_LETTER_ITEM || letter.Item["url"] != item["url"] ||
+		len(letter.Attempts) != 1 || len(letter.Attempts[0].Errors) != 2 {
+		t.Fatalf("Inconsistent item dead letter: %#v", letter)
+	}
+	// 重新注入死信。
+	if _, err := sched.Replay(letters); err == nil {
+		t.Fatal("No error when replaying dead letters into unstarted scheduler!")
+	}
+	ms.status = SCHED_STATUS_STARTED
+	count, err := sched.Replay(letters)
+	if err != nil {
+		t.Fatalf("An error occurs when replaying dead letters: %s", err)
+	}
+	if count != 2 {
+		t.Fatalf("Inconsistent replayed number: expected: %d, actual: %d", 2, count)
+	}
+	datum, err = ms.reqBufferPool.Get()
+	if err != nil {
+		t.Fatalf("An error occurs when getting request: %s", err)
+	}
+	replayed := datum.(*module.Request)
+	if replayed.HTTPReq().URL.String() != letters[0].URL || replayed.Depth() != 1 {
+		t.Fatalf("Inconsistent replayed request: %v", replayed)
+	}
+	datum, err = ms.itemBufferPool.Get()
+	if err != nil {
+		t.Fatalf("An error occurs when getting item: %s", err)
+	}
+	if datum.(module.Item)["url"] != item["url"] {
+		t.Fatalf("Inconsistent replayed item: %#v", datum)
+	}
+	// 已处理过的URL不会被再次注入。
+	count, _ = sched.Replay(letters[:1])
+	if count != 0 {
+		t.Fatalf("Inconsistent replayed number: expected: %d, actual: %d", 0, count)
+	}
+	if _, err := sched.Replay([]DeadLetter{{Kind: "unknown"}}); err == nil {
+		t.Fatal("No error when replaying dead letter of unknown kind!")
+	}
+	ms.status = SCHED_STATUS_INITIALIZED
+	ms.closeDeadLetters()
+}
+
+func TestSchedSchemaReject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadletter")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	requestArgs := genRequestArgs([]string{"example.com"}, 1)
+	requestArgs.DeadLetter = &DeadLetterArgs{Path: filepath.Join(dir, "dead.jsonl")}
+	schema, _ := module.NewSchema([]module.Field{{Name: "title", Required: true}}, false)
+	var rejected int
+	p, err := pipeline.NewWithOptions("P1", []module.ProcessItem{processItem}, nil,
+		pipeline.Options{
+			Schema: schema,
+			DeadLetter: pipeline.DeadLetterFunc(func(item module.Item, errs []error) error {
+				rejected++
+				return nil
+			}),
+		})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s", err)
+	}
+	moduleArgs := genSimpleModuleArgs(1, 1, 0, t)
+	moduleArgs.Pipelines = []module.Pipeline{p}
+	moduleArgs.Health = &module.HealthOptions{MinCalls: 1}
+	sched := NewScheduler()
+	if err := sched.Init(requestArgs, genDataArgs(10, 2, 1), moduleArgs); err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	// 未通过校验的条目只会由条目处理管道放入死信接收器，并且不会使其被隔离。
+	for i := 0; i < 3; i++ {
+		ms.pickOne(module.Item{"url": "http://example.com/a"})
+	}
+	if rejected != 3 {
+		t.Fatalf("Inconsistent rejected number: expected: %d, actual: %d", 3, rejected)
+	}
+	if count := sched.Summary().Struct().DeadLetters; count != 0 {
+		t.Fatalf("Inconsistent dead letter count: expected: %d, actual: %d", 0, count)
+	}
+	if state := ms.registrar.HealthChecker().State(p.ID()); state != module.CIRCUIT_CLOSED {
+		t.Fatalf("Inconsistent circuit state: expected: %v, actual: %v",
+			module.CIRCUIT_CLOSED, state)
+	}
+}
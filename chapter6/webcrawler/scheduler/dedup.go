@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"fmt"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/toolkit/dedup"
+)
+
+// DedupArgs 代表内容去重相关的参数容器的类型。
+// 内容与已下载的内容完全相同或近似重复的响应都不会被分析。
+type DedupArgs struct {
+	// MaxDistance 代表判定为近似重复的SimHash指纹的最大海明距离。
+	// 值为0时，只有SimHash指纹相同的内容才会被判定为近似重复。
+	MaxDistance int `json:"max_distance"`
+}
+
+// Check 用于检查当前参数容器的有效性。
+func (args *DedupArgs) Check() error {
+	if args.MaxDistance < 0 || args.MaxDistance > dedup.MAX_DISTANCE {
+		return genError(fmt.Sprintf("illegal max distance %d: should be in [0, %d]",
+			args.MaxDistance, dedup.MAX_DISTANCE))
+	}
+	return nil
+}
+
+// Same 用于判断两个内容去重相关的参数容器是否相同。
+func (args *DedupArgs) Same(another *DedupArgs) bool {
+	if args == nil || another == nil {
+		return args == another
+	}
+	return *args == *another
+}
+
+// dedupResponse 用于检测响应的内容是否与已下载的内容重复。
+// 重复的响应会被丢弃，此时结果值为nil。
+// 若读取响应体时发生错误，则返回该错误。
+func (sched *myScheduler) dedupResponse(body *responseBody) (*module.Response, error) {
+	resp := body.resp
+	if sched.detector == nil {
+		return resp, nil
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp == nil || httpResp.Body == nil {
+		return resp, nil
+	}
+	fp, err := body.fingerprint()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read response body for dedup: %w", err)
+	}
+	result := sched.detector.CheckFingerprint(fp)
+	if !result.Duplicate() {
+		return resp, nil
+	}
+	closeResponse(resp)
+	var reqURL string
+	if httpResp.Request != nil && httpResp.Request.URL != nil {
+		reqURL = httpResp.Request.URL.String()
+	}
+	if result.Exact {
+		logger.Infof("Ignore the response with duplicate content. (URL: %s)", reqURL)
+	} else {
+		logger.Infof("Ignore the response with near-duplicate content. (URL: %s, distance: %d)",
+			reqURL, result.Distance)
+	}
+	return nil, nil
+}
+
+// getDedupSummary 用于获取内容去重的计数。
+// 若未启用内容去重，则返回nil。
+func getDedupSummary(detector dedup.Detector) *dedup.Counts {
+	if detector == nil {
+		return nil
+	}
+	counts := detector.Counts()
+	return &counts
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/toolkit/dedup"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
+)
+
+func TestDedupArgs(t *testing.T) {
+	requestArgs := genRequestArgs([]string{}, 0)
+	for _, distance := range []int{-1, dedup.MAX_DISTANCE + 1} {
+		requestArgs.Dedup = &DedupArgs{MaxDistance: distance}
+		if err := requestArgs.Check(); err == nil {
+			t.Fatalf("No error when checking request arguments with max distance %d!", distance)
+		}
+	}
+	requestArgs.Dedup = &DedupArgs{MaxDistance: 3}
+	if err := requestArgs.Check(); err != nil {
+		t.Fatalf("An error occurs when checking request arguments: %s", err)
+	}
+	another := genRequestArgs([]string{}, 0)
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with and without dedup are same!")
+	}
+	another.Dedup = &DedupArgs{MaxDistance: 3}
+	if !requestArgs.Same(&another) {
+		t.Fatal("The request arguments with same dedup arguments are not same!")
+	}
+	another.Dedup.MaxDistance = 2
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with different dedup arguments are same!")
+	}
+}
+
+func TestSchedDedup(t *testing.T) {
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Dedup = &DedupArgs{MaxDistance: 3}
+	moduleArgs := genSimpleModuleArgs(1, 1, 1, t)
+	// 较小的内存阈值使得响应体的大部分都会被写入临时文件。
+	moduleArgs.BodyReader = reader.Options{MaxSize: 2048, MemoryThreshold: 16}
+	sched := NewScheduler()
+	err := sched.Init(requestArgs, genDataArgs(10, 2, 1), moduleArgs)
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20)
+	pages := []struct {
+		url       string
+		body      string
+		duplicate bool
+	}{
+		{"http://example.com/a", "<p>" + text + "</p>", false},
+		{"http://example.com/a?sid=1", "<p>" + text + "</p>", true},
+		{"http://example.com/a?print=1", "<div>" + text + "</div>", true},
+		{"http://example.com/b", "<p>hello world</p>", false},
+	}
+	for _, page := range pages {
+		httpReq, _ := http.NewRequest("GET", page.url, nil)
+		body := &trackingBody{Reader: strings.NewReader(page.body)}
+		httpResp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       body,
+			Request:    httpReq,
+		}
+		resp, err := ms.dedupResponse(ms.newResponseBody(module.NewResponse(httpResp, 0)))
+		if err != nil {
+			t.Fatalf("An error occurs when deduplicating response: %s (URL: %s)", err, page.url)
+		}
+		if page.duplicate {
+			if resp != nil {
+				t.Fatalf("The duplicate response has not been dropped! (URL: %s)", page.url)
+			}
+			if !body.closed {
+				t.Fatalf("The original body has not been closed! (URL: %s)", page.url)
+			}
+			continue
+		}
+		if resp == nil {
+			t.Fatalf("The response has been dropped by mistake! (URL: %s)", page.url)
+		}
+		content, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+		if string(content) != page.body {
+			t.Fatalf("Inconsistent response body: expected: %q, actual: %q",
+				page.body, content)
+		}
+		resp.HTTPResp().Body.Close()
+		if !body.closed {
+			t.Fatalf("The original body has not been closed! (URL: %s)", page.url)
+		}
+	}
+	// 读取响应体失败或响应体过大时会返回错误，并且响应体会被关闭。
+	for _, r := range []io.Reader{
+		io.MultiReader(strings.NewReader("<p>"), iotest.ErrReader(io.ErrUnexpectedEOF)),
+		strings.NewReader(strings.Repeat("x", 4096)),
+	} {
+		httpReq, _ := http.NewRequest("GET", "http://example.com/c", nil)
+		body := &trackingBody{Reader: r}
+		httpResp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       body,
+			Request:    httpReq,
+		}
+		resp, err := ms.dedupResponse(ms.newResponseBody(module.NewResponse(httpResp, 0)))
+		if err == nil || resp != nil {
+			t.Fatal("No error when deduplicating response with unreadable body!")
+		}
+		if !body.closed {
+			t.Fatal("The unreadable body has not been closed!")
+		}
+	}
+	counts := sched.Summary().Struct().Dedup
+	expectedCounts := dedup.Counts{Checked: 4, Exact: 1, Near: 1, Unique: 2}
+	if counts == nil || *counts != expectedCounts {
+		t.Fatalf("Inconsistent dedup counts: expected: %#v, actual: %#v",
+			expectedCounts, counts)
+	}
+	// 未启用内容去重的情况。
+	sched = NewScheduler()
+	err = sched.Init(genRequestArgs([]string{}, 0), genDataArgs(10, 2, 1),
+		genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	if counts := sched.Summary().Struct().Dedup; counts != nil {
+		t.Fatalf("Inconsistent dedup counts: expected: %v, actual: %#v", nil, counts)
+	}
+}
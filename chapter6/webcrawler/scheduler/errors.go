@@ -1,9 +1,10 @@
 package scheduler
 
 import (
+	"context"
+
 	"gopcp.v2/chapter6/webcrawler/errors"
 	"gopcp.v2/chapter6/webcrawler/module"
-	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
 )
 
 // genError 用于生成爬虫错误值。
@@ -14,8 +15,7 @@ func genError(errMsg string) error {
 
 // genErrorByError 用于基于给定的错误值生成爬虫错误值。
 func genErrorByError(err error) error {
-	return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER,
-		err.Error())
+	return errors.NewCrawlerErrorBy(errors.ERROR_TYPE_SCHEDULER, err)
 }
 
 // genParameterError 用于生成爬虫参数错误值。
@@ -25,38 +25,77 @@ func genParameterError(errMsg string) error {
 }
 
 // sendError 用于向错误缓冲池发送错误值。
-func sendError(err error, mid module.MID, errorBufferPool buffer.Pool) bool {
-	if err == nil || errorBufferPool == nil || errorBufferPool.Closed() {
+// 参数errorOverflow代表错误缓冲池的溢出队列。
+func sendError(ctx context.Context, err error, mid module.MID, errorOverflow *overflowQueue) bool {
+	if err == nil {
 		return false
 	}
-	var crawlerError errors.CrawlerError
-	var ok bool
-	crawlerError, ok = err.(errors.CrawlerError)
-	if !ok {
-		var moduleType module.Type
-		var errorType errors.ErrorType
-		ok, moduleType = module.GetType(mid)
-		if !ok {
-			errorType = errors.ERROR_TYPE_SCHEDULER
-		} else {
-			switch moduleType {
-			case module.TYPE_DOWNLOADER:
-				errorType = errors.ERROR_TYPE_DOWNLOADER
-			case module.TYPE_ANALYZER:
-				errorType = errors.ERROR_TYPE_ANALYZER
-			case module.TYPE_PIPELINE:
-				errorType = errors.ERROR_TYPE_PIPELINE
-			}
+	errCtx := errors.ErrorContext{MID: string(mid)}
+	return sendCrawlerError(ctx, genCrawlerError(err, errCtx), errorOverflow)
+}
+
+// genCrawlerError 用于为给定的错误值附加上下文并生成爬虫错误值。
+// 若给定的错误值不是爬虫错误，则会根据上下文中的组件ID确定错误的类型。
+func genCrawlerError(err error, errCtx errors.ErrorContext) errors.CrawlerError {
+	errorType := errors.ERROR_TYPE_SCHEDULER
+	if ok, moduleType := module.GetType(module.MID(errCtx.MID)); ok {
+		switch moduleType {
+		case module.TYPE_DOWNLOADER:
+			errorType = errors.ERROR_TYPE_DOWNLOADER
+		case module.TYPE_ANALYZER:
+			errorType = errors.ERROR_TYPE_ANALYZER
+		case module.TYPE_PIPELINE:
+			errorType = errors.ERROR_TYPE_PIPELINE
+		default:
+			errorType = errors.ErrorType(string(moduleType) + " error")
 		}
-		crawlerError = errors.NewCrawlerError(errorType, err.Error())
 	}
-	if errorBufferPool.Closed() {
+	return errors.WithContext(err, errorType, errCtx)
+}
+
+// sendCrawlerError 用于向错误缓冲池发送爬虫错误值。
+// 错误缓冲池已满时，错误值会被放入其溢出队列而不会被丢弃。
+// 只有在溢出队列也已满时才会等待，直到有空位或参数ctx被取消为止。
+func sendCrawlerError(ctx context.Context, crawlerError errors.CrawlerError,
+	errorOverflow *overflowQueue) bool {
+	return errorOverflow.put(ctx, crawlerError)
+}
+
+// reportError 用于为给定的错误值附加上下文、计入错误统计并发送到错误缓冲池。
+func (sched *myScheduler) reportError(err error, errCtx errors.ErrorContext) bool {
+	if err == nil {
 		return false
 	}
-	go func(crawlerError errors.CrawlerError) {
-		if err := errorBufferPool.Put(crawlerError); err != nil {
-			logger.Warnln("The error buffer pool was closed. Ignore error sending.")
+	crawlerError := genCrawlerError(err, errCtx)
+	if sched.errorStats != nil {
+		sched.errorStats.Add(crawlerError)
+	}
+	return sendCrawlerError(sched.ctx, crawlerError, sched.errorOverflow)
+}
+
+// genErrorContext 用于根据组件ID、调度阶段和相关的数据生成错误上下文。
+// 参数data可以是请求、响应或其他数据，也可以为nil。
+func genErrorContext(mid module.MID, stage module.Stage, data interface{}) errors.ErrorContext {
+	errCtx := errors.ErrorContext{MID: string(mid), Stage: string(stage)}
+	switch d := data.(type) {
+	case *module.Request:
+		if d == nil {
+			break
+		}
+		if d.Valid() {
+			errCtx.URL = d.HTTPReq().URL.String()
 		}
-	}(crawlerError)
-	return true
+		errCtx.Depth = d.Depth()
+		errCtx.Attempt = d.Attempt()
+	case *module.Response:
+		if d == nil {
+			break
+		}
+		if httpResp := d.HTTPResp(); httpResp != nil &&
+			httpResp.Request != nil && httpResp.Request.URL != nil {
+			errCtx.URL = httpResp.Request.URL.String()
+		}
+		errCtx.Depth = d.Depth()
+	}
+	return errCtx
 }
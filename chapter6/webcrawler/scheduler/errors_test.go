@@ -1,7 +1,10 @@
 package scheduler
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
 	"testing"
 
 	werrors "gopcp.v2/chapter6/webcrawler/errors"
@@ -75,12 +78,13 @@ func TestErrorSend(t *testing.T) {
 		werrors.ERROR_TYPE_SCHEDULER, "testing error")
 	mid := module.MID("")
 	buffer, _ := buffer.NewPool(10, 2)
-	if !sendError(cerr, mid, buffer) {
+	queue := newOverflowQueue(buffer, "error")
+	if !sendError(context.Background(), cerr, mid, queue) {
 		t.Fatalf("Couldn't send error! (error: %s, MID: %s, buffer: %#v)",
 			cerr, mid, buffer)
 	}
 	err := errors.New("testing error")
-	if !sendError(err, mid, buffer) {
+	if !sendError(context.Background(), err, mid, queue) {
 		t.Fatalf("Couldn't send error! (error: %s, MID: %s, buffer: %#v)",
 			err, mid, buffer)
 	}
@@ -90,19 +94,112 @@ func TestErrorSend(t *testing.T) {
 		module.MID("P0"),
 	}
 	for _, mid := range mids {
-		if !sendError(err, mid, buffer) {
+		if !sendError(context.Background(), err, mid, queue) {
 			t.Fatalf("Couldn't send error! (error: %s, MID: %s, buffer: %#v)",
 				err, mid, buffer)
 		}
 	}
-	if sendError(nil, mid, buffer) {
+	if sendError(context.Background(), nil, mid, queue) {
 		t.Fatalf("It still can send error with nil error!")
 	}
-	if sendError(err, mid, nil) {
+	if sendError(context.Background(), err, mid, nil) {
 		t.Fatalf("It still can send error with nil buffer!")
 	}
+	// 错误缓冲池已满时，错误值会被放入溢出队列而不会被丢弃。
+	capacity := int(buffer.BufferCap() * buffer.MaxBufferNumber())
+	for i := int(buffer.Total()); i < capacity+1; i++ {
+		if !sendError(context.Background(), err, mid, queue) {
+			t.Fatalf("Couldn't send error %d!", i)
+		}
+	}
+	if length := queue.len(); length != 1 {
+		t.Fatalf("Inconsistent overflow length: expected: %d, actual: %d", 1, length)
+	}
 	buffer.Close()
-	if sendError(err, mid, buffer) {
+	if sendError(context.Background(), err, mid, queue) {
 		t.Fatalf("It still can send error with closed buffer!")
 	}
 }
+
+func TestErrorContextGen(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	req := module.NewRequest(httpReq, 2)
+	req.IncrAttempt()
+	errCtx := genErrorContext("D1", module.STAGE_DOWNLOAD, req)
+	expectedCtx := werrors.ErrorContext{
+		URL:     "http://example.com/a",
+		MID:     "D1",
+		Stage:   string(module.STAGE_DOWNLOAD),
+		Depth:   2,
+		Attempt: 1,
+	}
+	if errCtx != expectedCtx {
+		t.Fatalf("Inconsistent error context: expected: %#v, actual: %#v",
+			expectedCtx, errCtx)
+	}
+	resp := module.NewResponse(&http.Response{Request: httpReq}, 3)
+	errCtx = genErrorContext("A1", module.STAGE_ANALYZE, resp)
+	if errCtx.URL != "http://example.com/a" || errCtx.Depth != 3 || errCtx.Attempt != 0 {
+		t.Fatalf("Inconsistent error context: %#v", errCtx)
+	}
+	for _, data := range []interface{}{nil, (*module.Request)(nil), (*module.Response)(nil), module.Item{}} {
+		errCtx = genErrorContext("P1", module.STAGE_PIPELINE, data)
+		if errCtx.URL != "" || errCtx.MID != "P1" || errCtx.Stage != string(module.STAGE_PIPELINE) {
+			t.Fatalf("Inconsistent error context: %#v", errCtx)
+		}
+	}
+}
+
+func TestErrorReport(t *testing.T) {
+	sched := NewScheduler()
+	err := sched.Init(genRequestArgs([]string{}, 0), genDataArgs(10, 2, 1),
+		genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	httpReq, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	req := module.NewRequest(httpReq, 1)
+	cause := fmt.Errorf("couldn't get a downloader: %w", module.ErrNoHealthyModuleInstance)
+	if !ms.reportError(cause, genErrorContext("", module.STAGE_DOWNLOAD, req)) {
+		t.Fatal("Couldn't report error!")
+	}
+	ms.reportError(errors.New("bad page"), genErrorContext("A1", module.STAGE_ANALYZE, nil))
+	if ms.reportError(nil, werrors.ErrorContext{}) {
+		t.Fatal("It still can report nil error!")
+	}
+	received := map[werrors.ErrorType]werrors.CrawlerError{}
+	for i := 0; i < 2; i++ {
+		datum, err := ms.errorBufferPool.Get()
+		if err != nil {
+			t.Fatalf("An error occurs when getting error: %s", err)
+		}
+		ce, ok := datum.(werrors.CrawlerError)
+		if !ok {
+			t.Fatalf("Inconsistent error type: expected: %T, actual: %T",
+				werrors.CrawlerError(nil), datum)
+		}
+		received[ce.Type()] = ce
+	}
+	ce := received[werrors.ERROR_TYPE_SCHEDULER]
+	if ce == nil || !errors.Is(ce, module.ErrNoHealthyModuleInstance) {
+		t.Fatalf("The cause of scheduler error is lost: %v", ce)
+	}
+	if ce.Context().URL != "http://example.com/a" || ce.Context().Depth != 1 {
+		t.Fatalf("Inconsistent error context: %#v", ce.Context())
+	}
+	ce = received[werrors.ERROR_TYPE_ANALYZER]
+	if ce == nil || ce.Context().MID != "A1" {
+		t.Fatalf("Inconsistent analyzer error: %v", ce)
+	}
+	stats := sched.Summary().Struct().Errors
+	if len(stats) != 2 {
+		t.Fatalf("Inconsistent error stat number: expected: %d, actual: %d",
+			2, len(stats))
+	}
+	for _, stat := range stats {
+		if stat.Count != 1 {
+			t.Fatalf("Inconsistent error count: %#v", stat)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/frontier"
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// 共享爬取边界的默认参数值。
+const (
+	// DEFAULT_FRONTIER_LEASE_SIZE 代表默认的每次租借的请求的最大数量。
+	DEFAULT_FRONTIER_LEASE_SIZE = 10
+	// DEFAULT_FRONTIER_POLL_INTERVAL 代表默认的轮询共享爬取边界的时间间隔。
+	DEFAULT_FRONTIER_POLL_INTERVAL = 500 * time.Millisecond
+)
+
+// FrontierArgs 代表共享爬取边界相关的参数容器的类型。
+// 启用后，调度器会把通过过滤的请求提交给共享爬取边界服务，由其集中去重，
+// 并只下载从该服务租借到的请求。多个调度器可以借此共同完成同一次爬取。
+type FrontierArgs struct {
+	// Addr 代表共享爬取边界服务的TCP地址。
+	Addr string `json:"addr"`
+	// Worker 代表当前调度器作为工作者的名称。它在同一次爬取中必须是唯一的。
+	Worker string `json:"worker"`
+	// LeaseSize 代表每次租借的请求的最大数量。值为0时使用DEFAULT_FRONTIER_LEASE_SIZE。
+	LeaseSize uint32 `json:"lease_size,omitempty"`
+	// PollInterval 代表轮询共享爬取边界的时间间隔。
+	// 未完成的租约也会按照该间隔续期。值为0时使用DEFAULT_FRONTIER_POLL_INTERVAL。
+	PollInterval time.Duration `json:"poll_interval,omitempty"`
+}
+
+// Check 用于检查当前参数容器的有效性。
+func (args *FrontierArgs) Check() error {
+	if args.Addr == "" {
+		return genError("empty frontier address")
+	}
+	if args.Worker == "" {
+		return genError("empty frontier worker")
+	}
+	if args.PollInterval < 0 {
+		return genError(fmt.Sprintf("negative frontier poll interval: %s", args.PollInterval))
+	}
+	return nil
+}
+
+// Same 用于判断两个共享爬取边界相关的参数容器是否相同。
+func (args *FrontierArgs) Same(another *FrontierArgs) bool {
+	if args == nil || another == nil {
+		return args == another
+	}
+	return *args == *another
+}
+
+// FrontierCounts 代表使用共享爬取边界的计数。
+type FrontierCounts struct {
+	// Submitted 代表提交给共享爬取边界的请求的数量。
+	Submitted uint64 `json:"submitted"`
+	// Accepted 代表被共享爬取边界接受的请求的数量，即URL未被任何工作者见过的请求的数量。
+	Accepted uint64 `json:"accepted"`
+	// Leased 代表租借到的请求的数量。
+	Leased uint64 `json:"leased"`
+	// Completed 代表已完成的租约的数量。
+	Completed uint64 `json:"completed"`
+}
+
+// frontierWorker 代表调度器作为共享爬取边界的工作者时的状态。
+type frontierWorker struct {
+	// args 代表共享爬取边界相关的参数。
+	args FrontierArgs
+	// frontier 代表共享爬取边界的客户端。
+	frontier frontier.Frontier
+	// leases 代表租借到的请求的ID与其租约ID的映射。
+	leases sync.Map
+	// held 代表是否为等待远程工作而登记了一项在途工作。仅由轮询的goroutine访问。
+	held bool
+	// counts 代表计数。其中的字段只能被原子地访问。
+	counts FrontierCounts
+}
+
+// initFrontier 用于按照给定的参数连接共享爬取边界服务。
+// 若参数为nil，则不使用共享爬取边界。
+func (sched *myScheduler) initFrontier(args *FrontierArgs) error {
+	sched.closeFrontier()
+	sched.frontierWorker = nil
+	if args == nil {
+		return nil
+	}
+	worker := &frontierWorker{args: *args}
+	if worker.args.LeaseSize == 0 {
+		worker.args.LeaseSize = DEFAULT_FRONTIER_LEASE_SIZE
+	}
+	if worker.args.PollInterval == 0 {
+		worker.args.PollInterval = DEFAULT_FRONTIER_POLL_INTERVAL
+	}
+	client, err := frontier.Dial(args.Addr)
+	if err != nil {
+		return genError(fmt.Sprintf("couldn't connect to frontier %s: %s", args.Addr, err))
+	}
+	worker.frontier = client
+	sched.frontierWorker = worker
+	logger.Infof("-- Frontier: address: %s, worker: %s, lease size: %d",
+		args.Addr, args.Worker, worker.args.LeaseSize)
+	return nil
+}
+
+// closeFrontier 用于断开与共享爬取边界服务的连接。
+// 未完成的租约会在过期后被共享爬取边界收回。
+func (sched *myScheduler) closeFrontier() {
+	worker := sched.frontierWorker
+	if worker == nil {
+		return
+	}
+	if err := worker.frontier.Close(); err != nil {
+		logger.Errorf("An error occurs when closing frontier client: %s", err)
+	}
+}
+
+// leased 用于判断给定的请求是否是本工作者租借到的请求。
+func (sched *myScheduler) leased(req *module.Request) bool {
+	if sched.frontierWorker == nil {
+		return false
+	}
+	_, ok := sched.frontierWorker.leases.Load(req.ID())
+	return ok
+}
+
+// submitToFrontier 用于把通过过滤的请求提交给共享爬取边界。
+func (sched *myScheduler) submitToFrontier(req *module.Request) bool {
+	worker := sched.frontierWorker
+	atomic.AddUint64(&worker.counts.Submitted, 1)
+	added, err := worker.frontier.Add([]*module.Request{req})
+	if err != nil {
+		err = fmt.Errorf("couldn't submit the request to frontier: %w", err)
+		sched.reportError(err, genErrorContext("", "", req))
+		return false
+	}
+	if added == 0 {
+		logger.Warnf("Ignore the request! Its URL has been seen by frontier. (URL: %s)\n",
+			req.HTTPReq().URL)
+		return false
+	}
+	atomic.AddUint64(&worker.counts.Accepted, 1)
+	return true
+}
+
+// startFrontier 用于开始轮询共享爬取边界。
+// 在共享爬取边界报告整个爬取结束之前，调度器都不会被视为空闲。
+func (sched *myScheduler) startFrontier() {
+	worker := sched.frontierWorker
+	if worker == nil {
+		return
+	}
+	sched.tracker.add()
+	worker.held = true
+	go func() {
+		ticker := time.NewTicker(worker.args.PollInterval)
+		defer ticker.Stop()
+		for {
+			sched.pollFrontier(worker)
+			select {
+			case <-sched.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pollFrontier 用于为未完成的租约续期，并在本地的请求不足时租借新的请求。
+func (sched *myScheduler) pollFrontier(worker *frontierWorker) {
+	if sched.canceled() {
+		return
+	}
+	var ids []uint64
+	worker.leases.Range(func(_, id interface{}) bool {
+		ids = append(ids, id.(uint64))
+		return true
+	})
+	if len(ids) > 0 {
+		if _, err := worker.frontier.Renew(worker.args.Worker, ids); err != nil {
+			err = fmt.Errorf("couldn't renew leases: %w", err)
+			sched.reportError(err, genErrorContext("", "", nil))
+		}
+	}
+	if sched.reqBufferPool.Total() >= uint64(worker.args.LeaseSize) {
+		return
+	}
+	var holds uint64
+	if worker.held {
+		holds = 1
+	}
+	busy := sched.tracker.pending() > holds
+	result, err := worker.frontier.Lease(worker.args.Worker, worker.args.LeaseSize, busy)
+	if err != nil {
+		err = fmt.Errorf("couldn't lease requests: %w", err)
+		sched.reportError(err, genErrorContext("", "", nil))
+		return
+	}
+	for _, lease := range result.Leases {
+		atomic.AddUint64(&worker.counts.Leased, 1)
+		worker.leases.Store(lease.Req.ID(), lease.ID)
+		if !sched.resendReq(lease.Req) {
+			// 放入失败的请求会在租约过期后被共享爬取边界收回。
+			worker.leases.Delete(lease.Req.ID())
+		}
+	}
+	if result.Finished && worker.held {
+		logger.Info("The crawl has been finished by all frontier workers.")
+		worker.held = false
+		sched.tracker.done()
+	} else if !result.Finished && !worker.held {
+		worker.held = true
+		sched.tracker.add()
+	}
+}
+
+// completeLease 用于在请求被处理完毕之后完成其租约。
+// 等待重试的请求的租约不会被完成。
+func (sched *myScheduler) completeLease(req *module.Request) {
+	worker := sched.frontierWorker
+	if worker == nil || sched.canceled() {
+		return
+	}
+	if _, retrying := sched.attemptHistory.Load(req.ID()); retrying {
+		return
+	}
+	id, ok := worker.leases.Load(req.ID())
+	if !ok {
+		return
+	}
+	worker.leases.Delete(req.ID())
+	if _, err := worker.frontier.Complete(worker.args.Worker, []uint64{id.(uint64)}); err != nil {
+		err = fmt.Errorf("couldn't complete the lease %d: %w", id, err)
+		sched.reportError(err, genErrorContext("", "", req))
+		return
+	}
+	atomic.AddUint64(&worker.counts.Completed, 1)
+}
+
+// getFrontierSummary 用于获取使用共享爬取边界的计数。
+func getFrontierSummary(worker *frontierWorker) *FrontierCounts {
+	if worker == nil {
+		return nil
+	}
+	return &FrontierCounts{
+		Submitted: atomic.LoadUint64(&worker.counts.Submitted),
+		Accepted:  atomic.LoadUint64(&worker.counts.Accepted),
+		Leased:    atomic.LoadUint64(&worker.counts.Leased),
+		Completed: atomic.LoadUint64(&worker.counts.Completed),
+	}
+}
@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+
+	"gopcp.v2/chapter6/webcrawler/frontier"
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+func TestFrontierArgs(t *testing.T) {
+	args := &FrontierArgs{Worker: "w1"}
+	if err := args.Check(); err == nil {
+		t.Fatal("No error when checking frontier arguments with empty address!")
+	}
+	args.Addr = "127.0.0.1:9090"
+	if err := args.Check(); err != nil {
+		t.Fatalf("An error occurs when checking frontier arguments: %s", err)
+	}
+	invalidArgs := *args
+	invalidArgs.Worker = ""
+	if err := invalidArgs.Check(); err == nil {
+		t.Fatal("No error when checking frontier arguments with empty worker!")
+	}
+	invalidArgs = *args
+	invalidArgs.PollInterval = -1
+	if err := invalidArgs.Check(); err == nil {
+		t.Fatal("No error when checking frontier arguments with negative poll interval!")
+	}
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Frontier = &invalidArgs
+	if err := requestArgs.Check(); err == nil {
+		t.Fatal("No error when checking request arguments with invalid frontier arguments!")
+	}
+	requestArgs.Frontier = args
+	another := genRequestArgs([]string{}, 0)
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with and without frontier are same!")
+	}
+	sameArgs := *args
+	another.Frontier = &sameArgs
+	if !requestArgs.Same(&another) {
+		t.Fatal("The request arguments with same frontier arguments are not same!")
+	}
+}
+
+// initFrontierSched 用于初始化一个使用给定共享爬取边界服务的调度器。
+func initFrontierSched(addr string, worker string, t *testing.T) *myScheduler {
+	requestArgs := genRequestArgs([]string{"a.com", "b.com"}, 1)
+	requestArgs.Frontier = &FrontierArgs{Addr: addr, Worker: worker, LeaseSize: 2}
+	sched := NewScheduler()
+	err := sched.Init(requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	return sched.(*myScheduler)
+}
+
+func TestSchedFrontier(t *testing.T) {
+	f, _ := frontier.New(frontier.Options{})
+	server, err := frontier.Listen("127.0.0.1:0", f)
+	if err != nil {
+		t.Fatalf("An error occurs when starting frontier service: %s", err)
+	}
+	defer server.Close()
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Frontier = &FrontierArgs{Addr: "127.0.0.1:1", Worker: "w0"}
+	if err := NewScheduler().Init(
+		requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t)); err == nil {
+		t.Fatal("No error when initializing scheduler with unreachable frontier!")
+	}
+	sched1 := initFrontierSched(server.Addr().String(), "w1", t)
+	defer sched1.closeFrontier()
+	sched2 := initFrontierSched(server.Addr().String(), "w2", t)
+	defer sched2.closeFrontier()
+	// 请求由共享爬取边界集中去重，而不会被放入本地的请求缓冲池。
+	for _, url := range []string{"http://a.com/1", "http://a.com/2", "http://b.com/1"} {
+		httpReq, _ := http.NewRequest("GET", url, nil)
+		if !sched1.sendReq(module.NewRequest(httpReq, 1)) {
+			t.Fatalf("The request is not sent! (URL: %s)", url)
+		}
+		httpReq, _ = http.NewRequest("GET", url, nil)
+		if sched2.sendReq(module.NewRequest(httpReq, 1)) {
+			t.Fatalf("The request with seen URL is sent! (URL: %s)", url)
+		}
+	}
+	if total := sched1.reqBufferPool.Total(); total != 0 {
+		t.Fatalf("Inconsistent request number: expected: %d, actual: %d", 0, total)
+	}
+	// 同一个主机的请求只会被一个工作者租借。这里模拟了startFrontier的效果。
+	sched1.tracker.add()
+	sched1.frontierWorker.held = true
+	sched1.tracker.start()
+	sched1.pollFrontier(sched1.frontierWorker)
+	sched2.tracker.add()
+	sched2.frontierWorker.held = true
+	sched2.tracker.start()
+	sched2.pollFrontier(sched2.frontierWorker)
+	hosts := make(map[string]string)
+	var reqs []*module.Request
+	var requeued *module.Request
+	for _, sched := range []*myScheduler{sched1, sched2} {
+		for sched.reqBufferPool.Total() > 0 {
+			datum, _ := sched.reqBufferPool.Get()
+			req := datum.(*module.Request)
+			host := req.HTTPReq().URL.Host
+			worker := sched.frontierWorker.args.Worker
+			if owner, ok := hosts[host]; ok && owner != worker {
+				t.Fatalf("The host %s is leased by both %s and %s!", host, owner, worker)
+			}
+			hosts[host] = worker
+			// 需要重新排队的租借请求会被直接放回本地的请求缓冲池。
+			if requeued == nil {
+				requeued = req
+				if !sched.sendReq(req) {
+					t.Fatal("The leased request is not requeued!")
+				}
+				sched.tracker.done()
+				continue
+			}
+			reqs = append(reqs, req)
+			// 经过溢出缓冲池的编码和解码之后，租借到的请求仍能完成其租约。
+			p, _ := module.RequestCodec{}.Encode(req)
+			decoded, _ := module.RequestCodec{}.Decode(p)
+			sched.completeLease(decoded.(*module.Request))
+			sched.tracker.done()
+		}
+	}
+	if len(reqs) != 3 || len(hosts) != 2 {
+		t.Fatalf("Inconsistent leased requests: %d request(s) of %d host(s)", len(reqs), len(hosts))
+	}
+	if reqs[0] != requeued && reqs[1] != requeued {
+		t.Fatal("The requeued request is lost!")
+	}
+	// 在所有租约都已完成且所有工作者都已空闲时，爬取即告结束。
+	for _, sched := range []*myScheduler{sched1, sched2, sched1} {
+		sched.pollFrontier(sched.frontierWorker)
+	}
+	for _, sched := range []*myScheduler{sched1, sched2} {
+		if sched.frontierWorker.held {
+			t.Fatalf("The worker %s is still waiting for the frontier!",
+				sched.frontierWorker.args.Worker)
+		}
+		if !closed(sched.IdleChan()) {
+			t.Fatalf("The worker %s is not idle!", sched.frontierWorker.args.Worker)
+		}
+	}
+	counts1 := sched1.Summary().Struct().Frontier
+	counts2 := sched2.Summary().Struct().Frontier
+	if counts1 == nil || counts2 == nil {
+		t.Fatal("No frontier counts in the summary!")
+	}
+	if counts1.Submitted != 3 || counts1.Accepted != 3 ||
+		counts2.Submitted != 3 || counts2.Accepted != 0 {
+		t.Fatalf("Inconsistent submission counts: %#v, %#v", *counts1, *counts2)
+	}
+	if counts1.Leased+counts2.Leased != 3 || counts1.Completed+counts2.Completed != 3 {
+		t.Fatalf("Inconsistent lease counts: %#v, %#v", *counts1, *counts2)
+	}
+	stats, _ := f.Stats()
+	if stats.Seen != 3 || stats.Completed != 3 || stats.Leased != 0 || stats.Workers != 2 {
+		t.Fatalf("Inconsistent frontier stats: %#v", stats)
+	}
+}
+
+func TestSchedFrontierSubmitFailure(t *testing.T) {
+	f, _ := frontier.New(frontier.Options{})
+	server, err := frontier.Listen("127.0.0.1:0", f)
+	if err != nil {
+		t.Fatalf("An error occurs when starting frontier service: %s", err)
+	}
+	defer server.Close()
+	sched := initFrontierSched(server.Addr().String(), "w1", t)
+	defer sched.closeFrontier()
+	// 提交失败的请求不会被记录为已处理，再次被发现时仍会被提交。
+	f.Close()
+	url := "http://a.com/1"
+	for i := 1; i <= 2; i++ {
+		httpReq, _ := http.NewRequest("GET", url, nil)
+		if sched.sendReq(module.NewRequest(httpReq, 1)) {
+			t.Fatalf("The request is sent to the closed frontier! (URL: %s)", url)
+		}
+		if v := sched.urlMap.Get(url); v != nil {
+			t.Fatalf("The URL of the unsubmitted request is recorded! (URL: %s)", url)
+		}
+		if submitted := sched.frontierWorker.counts.Submitted; submitted != uint64(i) {
+			t.Fatalf("Inconsistent submitted number: expected: %d, actual: %d", i, submitted)
+		}
+	}
+}
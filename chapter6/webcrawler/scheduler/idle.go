@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"sync"
+)
+
+// workTracker 代表在途工作的追踪器。
+// 在途工作指已被放入缓冲池但尚未被处理完毕的请求、响应和条目。
+// 由于处理一项数据时产生的新数据总会在该项数据被处理完毕之前登记，
+// 因此在途工作的数量只会在所有工作都完成时才降为0。
+type workTracker struct {
+	// lock 代表用于保护各字段的互斥锁。
+	lock sync.Mutex
+	// count 代表在途工作的数量。
+	count uint64
+	// started 代表是否已开始追踪。在此之前不会发出空闲通知。
+	started bool
+	// idle 代表当前的空闲通知通道是否已被关闭。
+	idle bool
+	// idleCh 代表当前的空闲通知通道。
+	idleCh chan struct{}
+}
+
+// newWorkTracker 用于创建一个在途工作追踪器。
+func newWorkTracker() *workTracker {
+	return &workTracker{idleCh: make(chan struct{})}
+}
+
+// start 用于开始追踪。若此时没有在途工作，则立即发出空闲通知。
+func (tracker *workTracker) start() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.started = true
+	tracker.notifyIfIdle()
+}
+
+// add 用于登记一项在途工作。
+// 若空闲通知已经发出，则会创建一个新的空闲通知通道。
+func (tracker *workTracker) add() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	tracker.count++
+	if tracker.idle {
+		tracker.idle = false
+		tracker.idleCh = make(chan struct{})
+	}
+}
+
+// done 用于注销一项在途工作。
+// 若在途工作的数量因此降为0，则发出空闲通知。
+func (tracker *workTracker) done() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	if tracker.count > 0 {
+		tracker.count--
+	}
+	tracker.notifyIfIdle()
+}
+
+// notifyIfIdle 用于在已开始追踪且没有在途工作时关闭空闲通知通道。
+// 调用方需持有锁。
+func (tracker *workTracker) notifyIfIdle() {
+	if tracker.started && tracker.count == 0 && !tracker.idle {
+		tracker.idle = true
+		close(tracker.idleCh)
+	}
+}
+
+// pending 用于获取在途工作的数量。
+func (tracker *workTracker) pending() uint64 {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.count
+}
+
+// idleChan 用于获得当前的空闲通知通道。
+func (tracker *workTracker) idleChan() <-chan struct{} {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+	return tracker.idleCh
+}
+
+// sendTracked 会把将要发送的数据登记为在途工作，然后调用send发送它。
+// 登记先于发送，以免数据在登记之前就已被处理完毕；若发送失败，则撤销登记。
+func (sched *myScheduler) sendTracked(send func() bool) bool {
+	sched.tracker.add()
+	if !send() {
+		sched.tracker.done()
+		return false
+	}
+	return true
+}
+
+func (sched *myScheduler) Done() <-chan struct{} {
+	if sched.ctx == nil {
+		return nil
+	}
+	return sched.ctx.Done()
+}
+
+func (sched *myScheduler) IdleChan() <-chan struct{} {
+	if sched.tracker == nil {
+		return nil
+	}
+	return sched.tracker.idleChan()
+}
@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// closed 用于判断给定的通道是否已被关闭。
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestWorkTracker(t *testing.T) {
+	tracker := newWorkTracker()
+	idleCh := tracker.idleChan()
+	// 开始追踪之前不会发出空闲通知。
+	tracker.add()
+	tracker.done()
+	if closed(idleCh) {
+		t.Fatal("The idle channel is closed before tracking started!")
+	}
+	tracker.start()
+	if !closed(idleCh) {
+		t.Fatal("The idle channel is not closed after tracking started without work!")
+	}
+	tracker.add()
+	busyCh := tracker.idleChan()
+	if busyCh == idleCh {
+		t.Fatal("The idle channel is not renewed after work was added!")
+	}
+	tracker.add()
+	tracker.done()
+	if closed(busyCh) {
+		t.Fatal("The idle channel is closed while there is work in flight!")
+	}
+	tracker.done()
+	if !closed(busyCh) {
+		t.Fatal("The idle channel is not closed after all work has been done!")
+	}
+	if tracker.idleChan() != busyCh {
+		t.Fatal("The idle channel is renewed without new work!")
+	}
+	// 多余的注销不会使计数溢出。
+	tracker.done()
+	tracker.add()
+	if tracker.count != 1 {
+		t.Fatalf("Inconsistent work count: expected: %d, actual: %d", 1, tracker.count)
+	}
+}
+
+func TestSchedIdleChan(t *testing.T) {
+	sched := NewScheduler()
+	if sched.Done() != nil || sched.IdleChan() != nil {
+		t.Fatal("The notification channels are not nil in uninitialized scheduler!")
+	}
+	requestArgs := genRequestArgs([]string{"example.com"}, 0)
+	err := sched.Init(requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	idleCh := sched.IdleChan()
+	if idleCh == nil || closed(idleCh) {
+		t.Fatal("Invalid idle channel in unstarted scheduler!")
+	}
+	doneCh := sched.Done()
+	if doneCh == nil || closed(doneCh) {
+		t.Fatal("Invalid done channel in unstarted scheduler!")
+	}
+	// 首次请求的URL协议不受支持，因此它会被过滤掉。
+	ms := sched.(*myScheduler)
+	httpReq, _ := http.NewRequest("GET", "ftp://example.com/", nil)
+	if err := sched.Start(httpReq); err != nil {
+		t.Fatalf("An error occurs when starting scheduler: %s", err)
+	}
+	select {
+	case <-idleCh:
+	case <-time.After(time.Second):
+		t.Fatal("The idle channel is not closed after the first request was filtered!")
+	}
+	// 放入的请求在被处理完毕之前，调度器都不是空闲的。
+	ms.tracker.add()
+	busyCh := sched.IdleChan()
+	if closed(busyCh) {
+		t.Fatal("The idle channel is closed while there is work in flight!")
+	}
+	ms.tracker.done()
+	if !closed(busyCh) {
+		t.Fatal("The idle channel is not closed after all work has been done!")
+	}
+	if err := sched.Stop(); err != nil {
+		t.Fatalf("An error occurs when stopping scheduler: %s", err)
+	}
+	if !closed(doneCh) {
+		t.Fatal("The done channel is not closed after the scheduler was stopped!")
+	}
+}
@@ -0,0 +1,147 @@
+package scheduler
+
+import (
+	"context"
+
+	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+)
+
+// initOverflowQueues 用于为请求、响应、条目和错误缓冲池创建溢出队列。
+// 缓冲池未变的溢出队列会被保留，以免丢失其中尚未转运的数据。
+func (sched *myScheduler) initOverflowQueues() {
+	if sched.reqOverflow == nil || sched.reqOverflow.pool != sched.reqBufferPool {
+		sched.reqOverflow = newOverflowQueue(sched.reqBufferPool, "request")
+	}
+	if sched.respOverflow == nil || sched.respOverflow.pool != sched.respBufferPool {
+		sched.respOverflow = newOverflowQueue(sched.respBufferPool, "response")
+	}
+	if sched.itemOverflow == nil || sched.itemOverflow.pool != sched.itemBufferPool {
+		sched.itemOverflow = newOverflowQueue(sched.itemBufferPool, "item")
+		sched.itemOverflow.discard = releaseItem
+	}
+	if sched.errorOverflow == nil || sched.errorOverflow.pool != sched.errorBufferPool {
+		sched.errorOverflow = newOverflowQueue(sched.errorBufferPool, "error")
+	}
+}
+
+// transfer 会为每个溢出队列启动一个转运goroutine。
+func (sched *myScheduler) transfer() {
+	for _, queue := range []*overflowQueue{
+		sched.reqOverflow, sched.respOverflow, sched.itemOverflow, sched.errorOverflow} {
+		go queue.transfer(sched.ctx)
+	}
+}
+
+// overflowQueue 代表缓冲池的有界溢出队列。
+// 缓冲池已满时，数据会先被放入溢出队列，再由唯一的转运goroutine依次放入缓冲池。
+// 这样，下载和分析这两个互为上下游的处理流程就不会因等待对方的缓冲池而相互阻塞，
+// 它们把数据放回自己的缓冲池时也不会阻塞自己。
+// 只有在溢出队列也已满时，发送方才会等待，直到有空位或调度器被停止为止。
+type overflowQueue struct {
+	// pool 代表目标缓冲池。
+	pool buffer.Pool
+	// name 代表数据的名称，仅用于日志。
+	name string
+	// ch 代表存放溢出数据的通道。
+	ch chan interface{}
+	// discard 代表处理被丢弃的数据的函数，可以为nil。
+	discard func(datum interface{})
+}
+
+// newOverflowQueue 用于为给定的缓冲池创建溢出队列。
+// 溢出队列的容量等于缓冲池的最大容量。
+func newOverflowQueue(pool buffer.Pool, name string) *overflowQueue {
+	capacity := uint64(pool.BufferCap()) * uint64(pool.MaxBufferNumber())
+	return &overflowQueue{
+		pool: pool,
+		name: name,
+		ch:   make(chan interface{}, capacity),
+	}
+}
+
+// put 用于把数据放入缓冲池，或在缓冲池已满时把数据放入溢出队列。
+// 若缓冲池已关闭，或在等待溢出队列的空位时参数ctx被取消，则返回false。
+func (queue *overflowQueue) put(ctx context.Context, datum interface{}) bool {
+	if queue == nil || queue.pool.Closed() {
+		return false
+	}
+	// 溢出队列中尚有数据时不再直接放入缓冲池，以免后发送的数据越过先发送的数据。
+	if len(queue.ch) == 0 {
+		ok, err := queue.pool.TryPut(datum)
+		if ok {
+			return true
+		}
+		if err != nil {
+			logger.Warnf("The %s buffer pool was closed. Ignore %s sending.",
+				queue.name, queue.name)
+			return false
+		}
+	}
+	select {
+	case queue.ch <- datum:
+		return true
+	default:
+	}
+	logger.Warnf("The %s buffer pool and its overflow queue are full. Wait for space...",
+		queue.name)
+	select {
+	case queue.ch <- datum:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// len 用于获取溢出队列中的数据的数量。
+func (queue *overflowQueue) len() int {
+	if queue == nil {
+		return 0
+	}
+	return len(queue.ch)
+}
+
+// transfer 用于把溢出队列中的数据依次放入缓冲池。
+// 它会一直运行，直到参数ctx被取消或缓冲池被关闭为止。
+func (queue *overflowQueue) transfer(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case datum := <-queue.ch:
+			err := queue.pool.PutContext(ctx, datum)
+			if err != nil {
+				queue.drop(datum)
+			}
+			if err == buffer.ErrClosedBufferPool {
+				logger.Warnf("The %s buffer pool was closed. Stop transferring %ss.",
+					queue.name, queue.name)
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// clear 用于丢弃溢出队列中的所有数据。
+func (queue *overflowQueue) clear() {
+	if queue == nil {
+		return
+	}
+	for {
+		select {
+		case datum := <-queue.ch:
+			queue.drop(datum)
+		default:
+			return
+		}
+	}
+}
+
+// drop 用于丢弃给定的数据。
+func (queue *overflowQueue) drop(datum interface{}) {
+	if queue.discard != nil {
+		queue.discard(datum)
+	}
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+)
+
+func TestOverflowQueue(t *testing.T) {
+	pool, _ := buffer.NewPool(2, 2)
+	queue := newOverflowQueue(pool, "request")
+	capacity := int(pool.BufferCap() * pool.MaxBufferNumber())
+	before := runtime.NumGoroutine()
+	// 填满缓冲池和溢出队列。
+	for i := 0; i < capacity*2; i++ {
+		if !queue.put(context.Background(), i) {
+			t.Fatalf("Couldn't put datum %d!", i)
+		}
+	}
+	if total := pool.Total(); total != uint64(capacity) {
+		t.Fatalf("Inconsistent total: expected: %d, actual: %d", capacity, total)
+	}
+	if length := queue.len(); length != capacity {
+		t.Fatalf("Inconsistent overflow length: expected: %d, actual: %d", capacity, length)
+	}
+	// 溢出队列已满时，发送方会一直等待到上下文被取消为止。
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if queue.put(ctx, capacity*2) {
+		t.Fatal("It still can put datum into full overflow queue!")
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("Inconsistent goroutine number: expected: <= %d, actual: %d", before, after)
+	}
+	// 转运goroutine会把溢出的数据全部放入缓冲池。
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go queue.transfer(ctx)
+	received := make(map[interface{}]bool)
+	for i := 0; i < capacity*2; i++ {
+		datum, err := pool.Get()
+		if err != nil {
+			t.Fatalf("An error occurs when getting datum: %s", err)
+		}
+		received[datum] = true
+	}
+	for i := 0; i < capacity*2; i++ {
+		if !received[i] {
+			t.Fatalf("The datum %d has been lost!", i)
+		}
+	}
+	if length := queue.len(); length != 0 {
+		t.Fatalf("Inconsistent overflow length: expected: %d, actual: %d", 0, length)
+	}
+	pool.Close()
+	if queue.put(context.Background(), 0) {
+		t.Fatal("It still can put datum into closed buffer pool!")
+	}
+}
+
+func TestSchedSendGoroutines(t *testing.T) {
+	sched := NewScheduler()
+	err := sched.Init(genRequestArgs([]string{}, 0), genDataArgs(2, 1, 1),
+		genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	capacity := int(ms.itemBufferPool.BufferCap() * ms.itemBufferPool.MaxBufferNumber())
+	before := runtime.NumGoroutine()
+	bodies := make([]*trackingBody, capacity*2)
+	// 缓冲池已满时，发送数据不会为每个数据创建goroutine。
+	for i := 0; i < capacity*2; i++ {
+		bodies[i] = &trackingBody{Reader: strings.NewReader("body")}
+		item := map[string]interface{}{"index": i, "body": bodies[i]}
+		if !sendItem(ms.ctx, item, ms.itemOverflow) {
+			t.Fatalf("Couldn't send item %d!", i)
+		}
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Fatalf("Inconsistent goroutine number: expected: <= %d, actual: %d", before, after)
+	}
+	if ms.Idle() {
+		t.Fatal("The scheduler with overflowed items is idle!")
+	}
+	// 调度器停止后，等待溢出队列的发送方会立即返回。
+	ms.cancelFunc()
+	body := &trackingBody{Reader: strings.NewReader("body")}
+	if sendItem(ms.ctx, map[string]interface{}{"body": body}, ms.itemOverflow) {
+		t.Fatal("It still can send item after the scheduler was stopped!")
+	}
+	if !body.closed {
+		t.Fatal("The body in the unsent item has not been closed!")
+	}
+	// 调度器停止时，缓冲池和溢出队列中尚未被处理的条目都会被关闭。
+	ms.releaseItems()
+	ms.itemBufferPool.Close()
+	ms.itemOverflow.clear()
+	for i, body := range bodies {
+		if !body.closed {
+			t.Fatalf("The body in the buffered item %d has not been closed!", i)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package scheduler
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// RecrawlArgs 代表重新爬取相关的参数容器的类型。
+// 启用重新爬取后，调度器会为每个下载成功的页面记录指纹，并在被停止时把所有指纹写入输出文件。
+// 若指定了上一次爬取输出的指纹文件，则调度器会进行增量爬取：
+// 只重新访问已到期的页面，跳过未变化的页面的分析，并把新增、变化和移除的页面作为变化条目发出。
+type RecrawlArgs struct {
+	// Input 代表上一次爬取输出的指纹文件的路径。若为空，则进行完整的爬取。
+	Input string `json:"input,omitempty"`
+	// Output 代表本次爬取输出的指纹文件的路径。可以与Input相同。
+	Output string `json:"output"`
+	// MinInterval 代表重新访问的最短间隔时间，也是新页面的初始间隔时间。
+	MinInterval time.Duration `json:"min_interval"`
+	// MaxInterval 代表重新访问的最长间隔时间。
+	MaxInterval time.Duration `json:"max_interval"`
+}
+
+// Check 用于检查当前参数容器的有效性。
+func (args *RecrawlArgs) Check() error {
+	if args.Output == "" {
+		return genError("empty fingerprint output file path")
+	}
+	if args.MinInterval <= 0 {
+		return genError(fmt.Sprintf("illegal min recrawl interval: %s", args.MinInterval))
+	}
+	if args.MaxInterval < args.MinInterval {
+		return genError(fmt.Sprintf("illegal max recrawl interval: %s (min: %s)",
+			args.MaxInterval, args.MinInterval))
+	}
+	return nil
+}
+
+// Same 用于判断两个重新爬取相关的参数容器是否相同。
+func (args *RecrawlArgs) Same(another *RecrawlArgs) bool {
+	if args == nil || another == nil {
+		return args == another
+	}
+	return *args == *another
+}
+
+// Fingerprint 代表页面的指纹，用于判断页面在两次访问之间是否发生了变化。
+type Fingerprint struct {
+	// URL 代表页面的URL。
+	URL string `json:"url"`
+	// Depth 代表页面的请求的深度。
+	Depth uint32 `json:"depth"`
+	// ETag 代表响应的ETag头。
+	ETag string `json:"etag,omitempty"`
+	// LastModified 代表响应的Last-Modified头。
+	LastModified string `json:"last_modified,omitempty"`
+	// ContentHash 代表响应体的SHA-256摘要的十六进制形式。
+	ContentHash string `json:"content_hash"`
+	// Interval 代表重新访问的间隔时间。
+	// 页面每被发现变化一次，该值就减半；每被确认未变化一次，该值就加倍。
+	Interval time.Duration `json:"interval"`
+	// Checks 代表访问的次数。
+	Checks uint32 `json:"checks"`
+	// Changes 代表被发现变化的次数，不包括首次访问。
+	Changes uint32 `json:"changes"`
+	// CheckedAt 代表最近一次访问的时间。
+	CheckedAt time.Time `json:"checked_at"`
+	// ChangedAt 代表最近一次被发现变化的时间。
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Due 用于判断页面在给定的时间是否需要被重新访问。
+func (fp Fingerprint) Due(now time.Time) bool {
+	return !now.Before(fp.CheckedAt.Add(fp.Interval))
+}
+
+// ReadFingerprints 用于从给定的指纹文件中读出所有的指纹。
+func ReadFingerprints(path string) ([]Fingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, genErrorByError(err)
+	}
+	defer file.Close()
+	var fingerprints []Fingerprint
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var fp Fingerprint
+		if err := json.Unmarshal(scanner.Bytes(), &fp); err != nil {
+			return fingerprints, genError(fmt.Sprintf("invalid fingerprint at line %d: %s",
+				lineNumber, err))
+		}
+		fingerprints = append(fingerprints, fp)
+	}
+	if err := scanner.Err(); err != nil {
+		return fingerprints, genErrorByError(err)
+	}
+	return fingerprints, nil
+}
+
+// WriteFingerprints 用于把给定的指纹以JSON Lines格式写入指纹文件。
+// 指纹会先被写入同一目录下的临时文件，然后再替换目标文件，以免写入中断时损坏已有的文件。
+func WriteFingerprints(path string, fingerprints []Fingerprint) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return genErrorByError(err)
+	}
+	defer os.Remove(tempFile.Name())
+	writer := bufio.NewWriter(tempFile)
+	encoder := json.NewEncoder(writer)
+	for _, fp := range fingerprints {
+		if err := encoder.Encode(fp); err != nil {
+			tempFile.Close()
+			return genErrorByError(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tempFile.Close()
+		return genErrorByError(err)
+	}
+	if err := tempFile.Close(); err != nil {
+		return genErrorByError(err)
+	}
+	if err := os.Rename(tempFile.Name(), path); err != nil {
+		return genErrorByError(err)
+	}
+	return nil
+}
+
+// ChangeKind 代表页面变化的类型。
+type ChangeKind string
+
+// 页面变化类型的常量。
+const (
+	// CHANGE_NEW 代表上一次爬取时不存在的页面。
+	CHANGE_NEW ChangeKind = "new"
+	// CHANGE_CHANGED 代表内容发生了变化的页面。
+	CHANGE_CHANGED ChangeKind = "changed"
+	// CHANGE_REMOVED 代表已被移除的页面，即响应状态码为404或410的页面。
+	CHANGE_REMOVED ChangeKind = "removed"
+)
+
+// 变化条目中的键。
+const (
+	// CHANGE_ITEM_KEY 代表变化条目中变化类型的键，其值的类型为string。
+	CHANGE_ITEM_KEY = "recrawl_change"
+	// CHANGE_ITEM_KEY_URL 代表变化条目中页面URL的键，其值的类型为string。
+	CHANGE_ITEM_KEY_URL = "url"
+	// CHANGE_ITEM_KEY_STATUS 代表变化条目中响应状态码的键，其值的类型为int。
+	CHANGE_ITEM_KEY_STATUS = "status_code"
+	// CHANGE_ITEM_KEY_FINGERPRINT 代表变化条目中页面指纹的键，其值的类型为Fingerprint。
+	CHANGE_ITEM_KEY_FINGERPRINT = "fingerprint"
+)
+
+// ChangeKindOf 用于获取变化条目的变化类型。
+// 若给定的条目不是变化条目，则第二个结果值为false。
+func ChangeKindOf(item module.Item) (ChangeKind, bool) {
+	kind, ok := item[CHANGE_ITEM_KEY].(string)
+	if !ok {
+		return "", false
+	}
+	return ChangeKind(kind), true
+}
+
+// genChangeItem 用于生成变化条目。
+func genChangeItem(kind ChangeKind, fp Fingerprint, statusCode int) module.Item {
+	return module.Item{
+		CHANGE_ITEM_KEY:             string(kind),
+		CHANGE_ITEM_KEY_URL:         fp.URL,
+		CHANGE_ITEM_KEY_STATUS:      statusCode,
+		CHANGE_ITEM_KEY_FINGERPRINT: fp,
+	}
+}
+
+// RecrawlCounts 代表重新爬取的计数。
+type RecrawlCounts struct {
+	// Unchanged 代表未变化的页面的数量。
+	Unchanged uint64 `json:"unchanged"`
+	// Changed 代表发生了变化的页面的数量。
+	Changed uint64 `json:"changed"`
+	// New 代表新增的页面的数量。
+	New uint64 `json:"new"`
+	// Removed 代表已被移除的页面的数量。
+	Removed uint64 `json:"removed"`
+	// Skipped 代表因尚未到期而未被访问的页面的数量。
+	Skipped uint64 `json:"skipped"`
+}
+
+// recrawler 代表重新爬取的状态。它是并发安全的。
+type recrawler struct {
+	// args 代表重新爬取相关的参数。
+	args RecrawlArgs
+	// incremental 代表是否在进行增量爬取，即是否载入了上一次爬取输出的指纹。
+	incremental bool
+	// lock 代表用于保护以下字段的互斥锁。
+	lock sync.Mutex
+	// fingerprints 代表URL与页面指纹的映射。
+	fingerprints map[string]*Fingerprint
+	// counts 代表计数。
+	counts RecrawlCounts
+	// now 用于获取当前时间。
+	now func() time.Time
+}
+
+// newRecrawler 用于根据参数创建重新爬取的状态，并载入上一次爬取输出的指纹。
+func newRecrawler(args RecrawlArgs) (*recrawler, error) {
+	rc := &recrawler{
+		args:         args,
+		fingerprints: make(map[string]*Fingerprint),
+		now:          time.Now,
+	}
+	if args.Input == "" {
+		return rc, nil
+	}
+	fingerprints, err := ReadFingerprints(args.Input)
+	if err != nil {
+		return nil, err
+	}
+	rc.incremental = true
+	for i := range fingerprints {
+		fp := fingerprints[i]
+		fp.Interval = rc.clampInterval(fp.Interval)
+		rc.fingerprints[fp.URL] = &fp
+	}
+	return rc, nil
+}
+
+// clampInterval 用于把间隔时间限制在参数规定的范围内。
+func (rc *recrawler) clampInterval(interval time.Duration) time.Duration {
+	if interval < rc.args.MinInterval {
+		return rc.args.MinInterval
+	}
+	if interval > rc.args.MaxInterval {
+		return rc.args.MaxInterval
+	}
+	return interval
+}
+
+// dueFingerprints 用于获取所有已到期的页面的指纹，结果按照深度和URL排序。
+func (rc *recrawler) dueFingerprints() []Fingerprint {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	now := rc.now()
+	var due []Fingerprint
+	for _, fp := range rc.fingerprints {
+		if fp.Due(now) {
+			due = append(due, *fp)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if due[i].Depth != due[j].Depth {
+			return due[i].Depth < due[j].Depth
+		}
+		return due[i].URL < due[j].URL
+	})
+	return due
+}
+
+// skip 用于判断给定URL的页面是否因尚未到期而应被跳过。
+func (rc *recrawler) skip(url string) bool {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	fp, ok := rc.fingerprints[url]
+	if !ok || fp.Due(rc.now()) {
+		return false
+	}
+	rc.counts.Skipped++
+	return true
+}
+
+// prepare 用于为已知页面的请求添加条件请求头。
+func (rc *recrawler) prepare(httpReq *http.Request) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	fp, ok := rc.fingerprints[httpReq.URL.String()]
+	if !ok {
+		return
+	}
+	if fp.ETag != "" && httpReq.Header.Get("If-None-Match") == "" {
+		httpReq.Header.Set("If-None-Match", fp.ETag)
+	}
+	if fp.LastModified != "" && httpReq.Header.Get("If-Modified-Since") == "" {
+		httpReq.Header.Set("If-Modified-Since", fp.LastModified)
+	}
+}
+
+// update 用于根据一次成功的访问更新页面的指纹。
+// 参数contentHash为空时代表服务端确认页面未变化。
+// 结果值中的变化类型为空时代表页面未变化。
+func (rc *recrawler) update(
+	url string, depth uint32, header http.Header, contentHash string) (ChangeKind, Fingerprint) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	now := rc.now()
+	fp, ok := rc.fingerprints[url]
+	var kind ChangeKind
+	switch {
+	case !ok && contentHash == "":
+		return kind, Fingerprint{URL: url, Depth: depth}
+	case !ok:
+		fp = &Fingerprint{
+			URL:         url,
+			Depth:       depth,
+			ContentHash: contentHash,
+			Interval:    rc.args.MinInterval,
+			ChangedAt:   now,
+		}
+		rc.fingerprints[url] = fp
+		kind = CHANGE_NEW
+		rc.counts.New++
+	case contentHash == "" || contentHash == fp.ContentHash:
+		fp.Interval = rc.clampInterval(fp.Interval * 2)
+		rc.counts.Unchanged++
+	default:
+		fp.ContentHash = contentHash
+		fp.Interval = rc.clampInterval(fp.Interval / 2)
+		fp.Changes++
+		fp.ChangedAt = now
+		kind = CHANGE_CHANGED
+		rc.counts.Changed++
+	}
+	if depth < fp.Depth {
+		fp.Depth = depth
+	}
+	if etag := header.Get("ETag"); etag != "" {
+		fp.ETag = etag
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		fp.LastModified = lastModified
+	}
+	fp.Checks++
+	fp.CheckedAt = now
+	return kind, *fp
+}
+
+// remove 用于移除已知页面的指纹。
+// 若给定URL的页面未知，则第二个结果值为false。
+func (rc *recrawler) remove(url string) (Fingerprint, bool) {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	fp, ok := rc.fingerprints[url]
+	if !ok {
+		return Fingerprint{}, false
+	}
+	delete(rc.fingerprints, url)
+	rc.counts.Removed++
+	return *fp, true
+}
+
+// snapshot 用于获取所有页面的指纹，结果按照URL排序。
+func (rc *recrawler) snapshot() []Fingerprint {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	fingerprints := make([]Fingerprint, 0, len(rc.fingerprints))
+	for _, fp := range rc.fingerprints {
+		fingerprints = append(fingerprints, *fp)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return fingerprints[i].URL < fingerprints[j].URL
+	})
+	return fingerprints
+}
+
+// getCounts 用于获取计数。
+func (rc *recrawler) getCounts() RecrawlCounts {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return rc.counts
+}
+
+// initRecrawl 用于根据参数初始化重新爬取的状态。
+func (sched *myScheduler) initRecrawl(args *RecrawlArgs) error {
+	sched.recrawler = nil
+	if args == nil {
+		return nil
+	}
+	rc, err := newRecrawler(*args)
+	if err != nil {
+		return err
+	}
+	sched.recrawler = rc
+	logger.Infof("-- Recrawl: input: %q, output: %q, interval: [%s, %s], known pages: %d",
+		args.Input, args.Output, args.MinInterval, args.MaxInterval, len(rc.fingerprints))
+	return nil
+}
+
+// sendDueRequests 用于为所有已到期的已知页面发送请求。
+func (sched *myScheduler) sendDueRequests() {
+	if sched.recrawler == nil {
+		return
+	}
+	var count int
+	for _, fp := range sched.recrawler.dueFingerprints() {
+		httpReq, err := http.NewRequest(http.MethodGet, fp.URL, nil)
+		if err != nil {
+			logger.Warnf("Ignore the known page with invalid URL %q: %s", fp.URL, err)
+			continue
+		}
+		if sched.sendReq(module.NewRequest(httpReq, fp.Depth)) {
+			count++
+		}
+	}
+	logger.Infof("Sent %d request(s) for the known pages to recrawl.", count)
+}
+
+// skipRecrawl 用于判断给定的请求是否因其页面尚未到期而应被跳过。
+func (sched *myScheduler) skipRecrawl(reqURL string) bool {
+	return sched.recrawler != nil && sched.recrawler.skip(reqURL)
+}
+
+// prepareRecrawl 用于为已知页面的请求添加条件请求头。
+func (sched *myScheduler) prepareRecrawl(req *module.Request) {
+	if sched.recrawler == nil {
+		return
+	}
+	if httpReq := req.HTTPReq(); httpReq != nil && httpReq.URL != nil {
+		sched.recrawler.prepare(httpReq)
+	}
+}
+
+// recrawlResponse 用于根据响应更新页面的指纹，并在增量爬取时发出变化条目。
+// 未变化或已被移除的页面的响应会被丢弃，此时结果值为nil。
+// 若读取响应体时发生错误，则返回该错误。
+func (sched *myScheduler) recrawlResponse(
+	req *module.Request, body *responseBody) (*module.Response, error) {
+	resp := body.resp
+	if sched.recrawler == nil {
+		return resp, nil
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp == nil {
+		return resp, nil
+	}
+	reqURL := req.HTTPReq().URL.String()
+	switch code := httpResp.StatusCode; {
+	case code == http.StatusNotModified:
+		closeResponse(resp)
+		sched.recrawler.update(reqURL, req.Depth(), httpResp.Header, "")
+		logger.Infof("Ignore the response of unchanged page. (URL: %s)", reqURL)
+		return nil, nil
+	case code == http.StatusNotFound || code == http.StatusGone:
+		fp, ok := sched.recrawler.remove(reqURL)
+		if !ok {
+			return resp, nil
+		}
+		closeResponse(resp)
+		sched.sendChangeItem(CHANGE_REMOVED, fp, code)
+		return nil, nil
+	case code < 200 || code >= 300 || httpResp.Body == nil:
+		return resp, nil
+	}
+	contentFP, err := body.fingerprint()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read response body for recrawl: %w", err)
+	}
+	kind, fp := sched.recrawler.update(
+		reqURL, req.Depth(), httpResp.Header, hex.EncodeToString(contentFP.Hash[:]))
+	if kind == "" {
+		closeResponse(resp)
+		logger.Infof("Ignore the response of unchanged page. (URL: %s)", reqURL)
+		return nil, nil
+	}
+	sched.sendChangeItem(kind, fp, httpResp.StatusCode)
+	return resp, nil
+}
+
+// sendChangeItem 用于在增量爬取时发出变化条目。
+func (sched *myScheduler) sendChangeItem(kind ChangeKind, fp Fingerprint, statusCode int) {
+	if !sched.recrawler.incremental {
+		return
+	}
+	item := genChangeItem(kind, fp, statusCode)
+	sched.sendTracked(func() bool { return sendItem(sched.ctx, item, sched.itemOverflow) })
+}
+
+// closeRecrawl 用于把所有页面的指纹写入输出文件。
+func (sched *myScheduler) closeRecrawl() {
+	if sched.recrawler == nil {
+		return
+	}
+	fingerprints := sched.recrawler.snapshot()
+	if err := WriteFingerprints(sched.recrawler.args.Output, fingerprints); err != nil {
+		logger.Errorf("An error occurs when writing fingerprints: %s", err)
+		return
+	}
+	logger.Infof("Wrote %d fingerprint(s) to %s.", len(fingerprints), sched.recrawler.args.Output)
+}
+
+// getRecrawlSummary 用于获取重新爬取的计数。
+// 若未启用重新爬取，则返回nil。
+func getRecrawlSummary(rc *recrawler) *RecrawlCounts {
+	if rc == nil {
+		return nil
+	}
+	counts := rc.getCounts()
+	return &counts
+}
@@ -0,0 +1,363 @@
+package scheduler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+func TestRecrawlArgs(t *testing.T) {
+	args := &RecrawlArgs{MinInterval: time.Hour, MaxInterval: 24 * time.Hour}
+	if err := args.Check(); err == nil {
+		t.Fatal("No error when checking recrawl arguments with empty output path!")
+	}
+	args.Output = "fingerprints.jsonl"
+	if err := args.Check(); err != nil {
+		t.Fatalf("An error occurs when checking recrawl arguments: %s", err)
+	}
+	invalidArgs := *args
+	invalidArgs.MinInterval = 0
+	if err := invalidArgs.Check(); err == nil {
+		t.Fatal("No error when checking recrawl arguments with zero min interval!")
+	}
+	invalidArgs = *args
+	invalidArgs.MaxInterval = time.Minute
+	if err := invalidArgs.Check(); err == nil {
+		t.Fatal("No error when checking recrawl arguments with max interval less than min!")
+	}
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Recrawl = &invalidArgs
+	if err := requestArgs.Check(); err == nil {
+		t.Fatal("No error when checking request arguments with invalid recrawl arguments!")
+	}
+	requestArgs.Recrawl = args
+	another := genRequestArgs([]string{}, 0)
+	if requestArgs.Same(&another) {
+		t.Fatal("The request arguments with and without recrawl are same!")
+	}
+	sameArgs := *args
+	another.Recrawl = &sameArgs
+	if !requestArgs.Same(&another) {
+		t.Fatal("The request arguments with same recrawl arguments are not same!")
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recrawl")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fingerprints.jsonl")
+	checkedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	fingerprints := []Fingerprint{
+		{URL: "http://example.com/a", ContentHash: "1", Interval: time.Hour, CheckedAt: checkedAt},
+		{URL: "http://example.com/b", Depth: 1, ETag: `"b"`, Interval: 2 * time.Hour},
+	}
+	if err := WriteFingerprints(path, fingerprints); err != nil {
+		t.Fatalf("An error occurs when writing fingerprints: %s", err)
+	}
+	// 重复写入会替换已有的文件。
+	if err := WriteFingerprints(path, fingerprints); err != nil {
+		t.Fatalf("An error occurs when rewriting fingerprints: %s", err)
+	}
+	read, err := ReadFingerprints(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reading fingerprints: %s", err)
+	}
+	if len(read) != len(fingerprints) {
+		t.Fatalf("Inconsistent fingerprint number: expected: %d, actual: %d",
+			len(fingerprints), len(read))
+	}
+	for i, fp := range read {
+		if fp != fingerprints[i] {
+			t.Fatalf("Inconsistent fingerprint %d: expected: %#v, actual: %#v",
+				i, fingerprints[i], fp)
+		}
+	}
+	if read[0].Due(checkedAt.Add(time.Minute)) {
+		t.Fatal("The fingerprint is due before its interval elapsed!")
+	}
+	if !read[0].Due(checkedAt.Add(time.Hour)) {
+		t.Fatal("The fingerprint is not due after its interval elapsed!")
+	}
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Inconsistent file number in dir: expected: %d, actual: %d", 1, len(entries))
+	}
+	ioutil.WriteFile(path, []byte("{bad json}\n"), 0644)
+	if _, err := ReadFingerprints(path); err == nil {
+		t.Fatal("No error when reading invalid fingerprints!")
+	}
+}
+
+func TestRecrawler(t *testing.T) {
+	args := RecrawlArgs{Output: "unused", MinInterval: time.Hour, MaxInterval: 8 * time.Hour}
+	rc, err := newRecrawler(args)
+	if err != nil {
+		t.Fatalf("An error occurs when creating recrawler: %s", err)
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc.now = func() time.Time { return now }
+	url := "http://example.com/a"
+	header := http.Header{}
+	header.Set("ETag", `"v1"`)
+	kind, fp := rc.update(url, 2, header, "h1")
+	if kind != CHANGE_NEW || fp.Interval != time.Hour || fp.Checks != 1 || fp.ETag != `"v1"` {
+		t.Fatalf("Inconsistent new fingerprint: kind: %q, fingerprint: %#v", kind, fp)
+	}
+	// 未变化的页面的间隔时间会加倍，但不会超过最大值。
+	for i, expected := range []time.Duration{2 * time.Hour, 4 * time.Hour, 8 * time.Hour, 8 * time.Hour} {
+		kind, fp = rc.update(url, 2, http.Header{}, "h1")
+		if kind != "" || fp.Interval != expected {
+			t.Fatalf("Inconsistent unchanged fingerprint %d: kind: %q, interval: %s (expected: %s)",
+				i, kind, fp.Interval, expected)
+		}
+	}
+	// 发生变化的页面的间隔时间会减半。
+	kind, fp = rc.update(url, 1, http.Header{}, "h2")
+	if kind != CHANGE_CHANGED || fp.Interval != 4*time.Hour || fp.Changes != 1 ||
+		fp.Depth != 1 || fp.ETag != `"v1"` {
+		t.Fatalf("Inconsistent changed fingerprint: kind: %q, fingerprint: %#v", kind, fp)
+	}
+	// 服务端确认未变化时，内容摘要保持不变。
+	kind, fp = rc.update(url, 1, http.Header{}, "")
+	if kind != "" || fp.ContentHash != "h2" || fp.Checks != 7 {
+		t.Fatalf("Inconsistent unchanged fingerprint: kind: %q, fingerprint: %#v", kind, fp)
+	}
+	if rc.skip(url) {
+		now = now.Add(8 * time.Hour)
+		if rc.skip(url) {
+			t.Fatal("The page is skipped after its interval elapsed!")
+		}
+	} else {
+		t.Fatal("The page is not skipped before its interval elapsed!")
+	}
+	if len(rc.dueFingerprints()) != 1 {
+		t.Fatal("The page is not due after its interval elapsed!")
+	}
+	httpReq, _ := http.NewRequest("GET", url, nil)
+	rc.prepare(httpReq)
+	if httpReq.Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("Inconsistent conditional header: %v", httpReq.Header)
+	}
+	if _, ok := rc.remove(url); !ok {
+		t.Fatal("Couldn't remove the known page!")
+	}
+	if _, ok := rc.remove(url); ok {
+		t.Fatal("The unknown page is removed!")
+	}
+	expectedCounts := RecrawlCounts{Unchanged: 5, Changed: 1, New: 1, Removed: 1, Skipped: 1}
+	if counts := rc.getCounts(); counts != expectedCounts {
+		t.Fatalf("Inconsistent recrawl counts: expected: %#v, actual: %#v", expectedCounts, counts)
+	}
+}
+
+// genTestResponse 用于生成测试用的响应。
+func genTestResponse(req *module.Request, statusCode int, body string) *module.Response {
+	httpResp := &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Request:    req.HTTPReq(),
+	}
+	return module.NewResponse(httpResp, req.Depth())
+}
+
+// recrawlTestResponse 用于让调度器根据给定的响应更新页面的指纹。
+func recrawlTestResponse(ms *myScheduler,
+	req *module.Request, resp *module.Response, t *testing.T) *module.Response {
+	resp, err := ms.recrawlResponse(req, ms.newResponseBody(resp))
+	if err != nil {
+		t.Fatalf("An error occurs when recrawling response: %s", err)
+	}
+	return resp
+}
+
+func TestSchedInspectResponse(t *testing.T) {
+	requestArgs := genRequestArgs([]string{}, 0)
+	requestArgs.Dedup = &DedupArgs{}
+	requestArgs.Recrawl = &RecrawlArgs{
+		Output:      "fingerprints.jsonl",
+		MinInterval: time.Hour,
+		MaxInterval: 24 * time.Hour,
+	}
+	sched := NewScheduler()
+	err := sched.Init(requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	var reqs []*module.Request
+	for _, url := range []string{"http://example.com/a", "http://example.com/b"} {
+		httpReq, _ := http.NewRequest("GET", url, nil)
+		reqs = append(reqs, module.NewRequest(httpReq, 1))
+	}
+	// 重新爬取和内容去重共享同一次对响应体的读取。
+	resp, err := ms.inspectResponse(reqs[0], genTestResponse(reqs[0], http.StatusOK, "content"))
+	if err != nil || resp == nil {
+		t.Fatalf("The response of new page is ignored! (error: %v)", err)
+	}
+	body, ok := resp.HTTPResp().Body.(*spooledBody)
+	if !ok {
+		t.Fatalf("The response body has not been read: %T", resp.HTTPResp().Body)
+	}
+	if _, ok := body.src.(*spooledBody); ok {
+		t.Fatal("The response body has been read twice!")
+	}
+	if content, _ := ioutil.ReadAll(body); string(content) != "content" {
+		t.Fatalf("Inconsistent response body: %q", content)
+	}
+	body.Close()
+	// 内容重复的页面仍然会被记录指纹。
+	resp, err = ms.inspectResponse(reqs[1], genTestResponse(reqs[1], http.StatusOK, "content"))
+	if err != nil || resp != nil {
+		t.Fatalf("The response with duplicate content is not ignored! (error: %v)", err)
+	}
+	fingerprints := ms.recrawler.snapshot()
+	if len(fingerprints) != 2 || fingerprints[0].ContentHash != fingerprints[1].ContentHash {
+		t.Fatalf("Inconsistent fingerprints: %#v", fingerprints)
+	}
+}
+
+func TestSchedRecrawl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recrawl")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	input := filepath.Join(dir, "input.jsonl")
+	output := filepath.Join(dir, "output.jsonl")
+	now := time.Now()
+	fingerprints := []Fingerprint{
+		// 已到期且未变化。
+		{URL: "http://example.com/same", ContentHash: "", ETag: `"s"`,
+			Interval: time.Hour, CheckedAt: now.Add(-2 * time.Hour)},
+		// 已到期且已变化。
+		{URL: "http://example.com/changed", ContentHash: "old",
+			Interval: time.Hour, CheckedAt: now.Add(-2 * time.Hour)},
+		// 已到期且已被移除。
+		{URL: "http://example.com/removed", ContentHash: "old",
+			Interval: time.Hour, CheckedAt: now.Add(-2 * time.Hour)},
+		// 尚未到期。
+		{URL: "http://example.com/fresh", ContentHash: "old",
+			Interval: time.Hour, CheckedAt: now},
+	}
+	if err := WriteFingerprints(input, fingerprints); err != nil {
+		t.Fatalf("An error occurs when writing fingerprints: %s", err)
+	}
+	requestArgs := genRequestArgs([]string{"example.com"}, 1)
+	requestArgs.Recrawl = &RecrawlArgs{
+		Input:       input,
+		Output:      output,
+		MinInterval: time.Hour,
+		MaxInterval: 24 * time.Hour,
+	}
+	sched := NewScheduler()
+	err = sched.Init(requestArgs, genDataArgs(10, 2, 1), genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	// 只有已到期的页面才会被重新访问。
+	ms.sendDueRequests()
+	if total := ms.reqBufferPool.Total(); total != 3 {
+		t.Fatalf("Inconsistent due request number: expected: %d, actual: %d", 3, total)
+	}
+	httpReq, _ := http.NewRequest("GET", "http://example.com/fresh", nil)
+	if ms.sendReq(module.NewRequest(httpReq, 1)) {
+		t.Fatal("The request of fresh page is sent!")
+	}
+	reqs := make(map[string]*module.Request)
+	for i := 0; i < 3; i++ {
+		datum, _ := ms.reqBufferPool.Get()
+		req := datum.(*module.Request)
+		ms.prepareRecrawl(req)
+		reqs[req.HTTPReq().URL.String()] = req
+	}
+	if reqs["http://example.com/same"].HTTPReq().Header.Get("If-None-Match") != `"s"` {
+		t.Fatal("No conditional header in the request of known page!")
+	}
+	if resp := recrawlTestResponse(ms, reqs["http://example.com/same"],
+		genTestResponse(reqs["http://example.com/same"], http.StatusNotModified, ""), t); resp != nil {
+		t.Fatal("The response of unchanged page is not ignored!")
+	}
+	resp := recrawlTestResponse(ms, reqs["http://example.com/changed"],
+		genTestResponse(reqs["http://example.com/changed"], http.StatusOK, "new content"), t)
+	if resp == nil {
+		t.Fatal("The response of changed page is ignored!")
+	}
+	if content, _ := ioutil.ReadAll(resp.HTTPResp().Body); string(content) != "new content" {
+		t.Fatalf("Inconsistent response body: %q", content)
+	}
+	if resp := recrawlTestResponse(ms, reqs["http://example.com/removed"],
+		genTestResponse(reqs["http://example.com/removed"], http.StatusNotFound, ""), t); resp != nil {
+		t.Fatal("The response of removed page is not ignored!")
+	}
+	httpReq, _ = http.NewRequest("GET", "http://example.com/new", nil)
+	req := module.NewRequest(httpReq, 1)
+	if recrawlTestResponse(ms, req, genTestResponse(req, http.StatusOK, "content"), t) == nil {
+		t.Fatal("The response of new page is ignored!")
+	}
+	// 变化条目会被放入条目缓冲池。
+	expectedKinds := map[string]ChangeKind{
+		"http://example.com/changed": CHANGE_CHANGED,
+		"http://example.com/removed": CHANGE_REMOVED,
+		"http://example.com/new":     CHANGE_NEW,
+	}
+	if total := ms.itemBufferPool.Total(); total != uint64(len(expectedKinds)) {
+		t.Fatalf("Inconsistent change item number: expected: %d, actual: %d",
+			len(expectedKinds), total)
+	}
+	for range expectedKinds {
+		datum, _ := ms.itemBufferPool.Get()
+		item := datum.(module.Item)
+		kind, ok := ChangeKindOf(item)
+		if !ok {
+			t.Fatalf("The item is not a change item: %#v", item)
+		}
+		url := item[CHANGE_ITEM_KEY_URL].(string)
+		if kind != expectedKinds[url] {
+			t.Fatalf("Inconsistent change kind of %s: expected: %q, actual: %q",
+				url, expectedKinds[url], kind)
+		}
+	}
+	if _, ok := ChangeKindOf(module.Item{"url": "http://example.com/"}); ok {
+		t.Fatal("The ordinary item is regarded as a change item!")
+	}
+	expectedCounts := RecrawlCounts{Unchanged: 1, Changed: 1, New: 1, Removed: 1, Skipped: 1}
+	if counts := sched.Summary().Struct().Recrawl; counts == nil || *counts != expectedCounts {
+		t.Fatalf("Inconsistent recrawl counts: expected: %#v, actual: %#v", expectedCounts, counts)
+	}
+	// 所有现存页面的指纹都会被写入输出文件。
+	ms.closeRecrawl()
+	written, err := ReadFingerprints(output)
+	if err != nil {
+		t.Fatalf("An error occurs when reading fingerprints: %s", err)
+	}
+	expectedURLs := []string{
+		"http://example.com/changed",
+		"http://example.com/fresh",
+		"http://example.com/new",
+		"http://example.com/same",
+	}
+	if len(written) != len(expectedURLs) {
+		t.Fatalf("Inconsistent fingerprint number: expected: %d, actual: %d",
+			len(expectedURLs), len(written))
+	}
+	for i, fp := range written {
+		if fp.URL != expectedURLs[i] {
+			t.Fatalf("Inconsistent URL of fingerprint %d: expected: %s, actual: %s",
+				i, expectedURLs[i], fp.URL)
+		}
+	}
+	if written[3].Interval != 2*time.Hour || written[0].Interval != time.Hour {
+		t.Fatalf("Inconsistent intervals: %s, %s", written[3].Interval, written[0].Interval)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 	"gopcp.v2/chapter5/cmap"
+	werrors "gopcp.v2/chapter6/webcrawler/errors"
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+	"gopcp.v2/chapter6/webcrawler/toolkit/dedup"
+	"gopcp.v2/chapter6/webcrawler/toolkit/reader"
 	"gopcp.v2/helper/log"
 )
 
@@ -39,8 +44,19 @@ type Scheduler interface {
 	ErrorChan() <-chan error
 	// Idle 用于判断所有处理模块是否都处于空闲状态。
 	Idle() bool
+	// Done 用于获得停止通知通道。调度器被停止时该通道会被关闭。
+	// 若结果值为nil，则说明调度器尚未被初始化。
+	Done() <-chan struct{}
+	// IdleChan 用于获得空闲通知通道。
+	// 调度器启动之后，当所有已放入缓冲池的数据都已被处理完毕时，该通道会被关闭。
+	// 一旦有新的数据被放入缓冲池，再次调用该方法就会获得一个新的通道。
+	// 若结果值为nil，则说明调度器尚未被初始化。
+	IdleChan() <-chan struct{}
 	// Summary 用于获取摘要实例。
 	Summary() SchedSummary
+	// Replay 用于把给定的死信重新注入到正在运行的调度器中。
+	// 结果值代表被成功注入的死信的数量。
+	Replay(letters []DeadLetter) (int, error)
 }
 
 // NewScheduler 会创建一个调度器实例。
@@ -52,6 +68,18 @@ func NewScheduler() Scheduler {
 type myScheduler struct {
 	// maxDepth 代表爬取的最大深度。首次请求的深度为0。
 	maxDepth uint32
+	// bootstrapArgs 代表会话引导相关的参数。若为nil，则不进行会话引导。
+	bootstrapArgs *BootstrapArgs
+	// stageTypeMap 代表阶段与处于该阶段且有组件实例的自定义组件类型的映射。
+	stageTypeMap map[module.Stage][]module.Type
+	// downloadTimeout 代表单次下载的超时时间。
+	downloadTimeout time.Duration
+	// analyzeTimeout 代表单次分析的超时时间。
+	analyzeTimeout time.Duration
+	// pipelineTimeout 代表单个条目处理的超时时间。
+	pipelineTimeout time.Duration
+	// bodyReaderOpts 代表在分析之前读取响应体时使用的多重读取器的选项。
+	bodyReaderOpts reader.Options
 	// acceptedDomainMap 代表可以接受的URL的主域名的字典。
 	acceptedDomainMap cmap.ConcurrentMap
 	// registrar 代表组件注册器。
@@ -64,8 +92,34 @@ type myScheduler struct {
 	itemBufferPool buffer.Pool
 	// errorBufferPool 代表错误的缓冲池。
 	errorBufferPool buffer.Pool
+	// dataArgs 代表初始化时的数据参数，用于在启动时重新创建已关闭的缓冲池。
+	dataArgs DataArgs
+	// reqOverflow 代表请求缓冲池的溢出队列。
+	reqOverflow *overflowQueue
+	// respOverflow 代表响应缓冲池的溢出队列。
+	respOverflow *overflowQueue
+	// itemOverflow 代表条目缓冲池的溢出队列。
+	itemOverflow *overflowQueue
+	// errorOverflow 代表错误缓冲池的溢出队列。
+	errorOverflow *overflowQueue
 	// urlMap 代表已处理的URL的字典。
 	urlMap cmap.ConcurrentMap
+	// detector 代表重复内容检测器。若为nil，则不进行内容去重。
+	detector dedup.Detector
+	// errorStats 代表按照类型和原因类别对错误进行统计的错误聚合器。
+	errorStats werrors.Aggregator
+	// deadLetterArgs 代表死信相关的参数。若为nil，则不记录死信。
+	deadLetterArgs *DeadLetterArgs
+	// deadLetters 代表死信存储。若为nil，则不记录死信。
+	deadLetters DeadLetterStore
+	// attemptHistory 代表请求的ID与其历次失败的下载尝试的映射。
+	attemptHistory sync.Map
+	// recrawler 代表重新爬取的状态。若为nil，则不记录页面指纹。
+	recrawler *recrawler
+	// frontierWorker 代表使用共享爬取边界时的工作者状态。若为nil，则不使用共享爬取边界。
+	frontierWorker *frontierWorker
+	// tracker 代表在途工作的追踪器。
+	tracker *workTracker
 	// ctx 代表上下文，用于感知调度器的停止。
 	ctx context.Context
 	// cancelFunc 代表取消函数，用于停止调度器。
@@ -116,11 +170,17 @@ func (sched *myScheduler) Init(
 	logger.Info("Module arguments are valid.")
 	// 初始化内部字段。
 	logger.Info("Initialize scheduler’s fields...")
-	if sched.registrar == nil {
-		sched.registrar = module.NewRegistrar()
-	} else {
-		sched.registrar.Clear()
+	// 每次初始化都重新创建组件注册器，以便使用新指定的负载均衡器和健康检查器。
+	var healthChecker module.HealthChecker
+	if moduleArgs.Health != nil {
+		healthChecker, err = module.NewHealthChecker(*moduleArgs.Health, sched.onHealthEvent)
+		if err != nil {
+			return err
+		}
 	}
+	sched.registrar = module.NewRegistrarWithChecker(moduleArgs.Balancer, healthChecker)
+	logger.Infof("-- Balancer: %s", sched.registrar.Balancer().Name())
+	logger.Infof("-- Health check: %v", healthChecker != nil)
 	sched.maxDepth = requestArgs.MaxDepth
 	logger.Infof("-- Max depth: %d", sched.maxDepth)
 	sched.acceptedDomainMap, _ =
@@ -130,11 +190,46 @@ func (sched *myScheduler) Init(
 	}
 	logger.Infof("-- Accepted primary domains: %v",
 		requestArgs.AcceptedDomains)
+	sched.bootstrapArgs = requestArgs.Bootstrap
+	if sched.bootstrapArgs != nil {
+		logger.Infof("-- Bootstrap steps: %d", len(sched.bootstrapArgs.Steps))
+	}
+	sched.downloadTimeout = moduleArgs.DownloadTimeout
+	sched.analyzeTimeout = moduleArgs.AnalyzeTimeout
+	sched.pipelineTimeout = moduleArgs.PipelineTimeout
+	sched.bodyReaderOpts = moduleArgs.BodyReader
+	logger.Infof("-- Stage timeouts: download: %s, analyze: %s, pipeline: %s",
+		sched.downloadTimeout, sched.analyzeTimeout, sched.pipelineTimeout)
+	sched.stageTypeMap = genStageTypeMap(moduleArgs.Extras)
+	for stage, types := range sched.stageTypeMap {
+		logger.Infof("-- Extra module types in stage %s: %v", stage, types)
+	}
 	sched.urlMap, _ = cmap.NewConcurrentMap(16, nil)
 	logger.Infof("-- URL map: length: %d, concurrency: %d",
 		sched.urlMap.Len(), sched.urlMap.Concurrency())
-	sched.initBufferPool(dataArgs)
+	sched.errorStats = werrors.NewAggregator()
+	sched.detector = nil
+	if requestArgs.Dedup != nil {
+		sched.detector, err = dedup.NewDetector(requestArgs.Dedup.MaxDistance)
+		if err != nil {
+			return err
+		}
+		logger.Infof("-- Content dedup: max distance: %d", requestArgs.Dedup.MaxDistance)
+	}
+	if err = sched.initDeadLetters(requestArgs.DeadLetter); err != nil {
+		return err
+	}
+	if err = sched.initRecrawl(requestArgs.Recrawl); err != nil {
+		return err
+	}
+	if err = sched.initFrontier(requestArgs.Frontier); err != nil {
+		return err
+	}
+	if err = sched.initBufferPool(dataArgs); err != nil {
+		return err
+	}
 	sched.resetContext()
+	sched.tracker = newWorkTracker()
 	sched.summary =
 		newSchedSummary(requestArgs, dataArgs, moduleArgs, sched)
 	// 注册组件。
@@ -189,6 +284,14 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 	}
 	logger.Infof("-- Primary domain: %s", primaryDomain)
 	sched.acceptedDomainMap.Put(primaryDomain, struct{}{})
+	// 进行会话引导。
+	if sched.bootstrapArgs != nil {
+		logger.Info("Bootstrap the session...")
+		if err = runBootstrap(sched.ctx, sched.bootstrapArgs); err != nil {
+			return
+		}
+		logger.Info("The session has been bootstrapped.")
+	}
 	// 开始调度数据和组件。
 	if err = sched.checkBufferPoolForStart(); err != nil {
 		return
@@ -196,10 +299,17 @@ func (sched *myScheduler) Start(firstHTTPReq *http.Request) (err error) {
 	sched.download()
 	sched.analyze()
 	sched.pick()
+	sched.transfer()
 	logger.Info("Scheduler has been started.")
 	// 放入第一个请求。
 	firstReq := module.NewRequest(firstHTTPReq, 0)
 	sched.sendReq(firstReq)
+	// 在增量爬取时重新访问已到期的已知页面。
+	sched.sendDueRequests()
+	// 开始从共享爬取边界租借请求。
+	sched.startFrontier()
+	// 开始追踪在途工作。若首次请求被过滤掉，则调度器会立即处于空闲状态。
+	sched.tracker.start()
 	return nil
 }
 
@@ -225,12 +335,54 @@ func (sched *myScheduler) Stop() (err error) {
 	sched.cancelFunc()
 	sched.reqBufferPool.Close()
 	sched.respBufferPool.Close()
+	sched.releaseItems()
 	sched.itemBufferPool.Close()
+	sched.itemOverflow.clear()
 	sched.errorBufferPool.Close()
+	sched.flushModules()
+	sched.closeDeadLetters()
+	sched.closeRecrawl()
+	sched.closeFrontier()
 	logger.Info("Scheduler has been stopped.")
 	return nil
 }
 
+// releaseItems 用于关闭条目缓冲池中尚未被处理的条目。
+func (sched *myScheduler) releaseItems() {
+	for {
+		datum, err := sched.itemBufferPool.TryGet()
+		if datum == nil || err != nil {
+			return
+		}
+		releaseItem(datum)
+	}
+}
+
+// releaseItem 用于关闭被丢弃的条目，以释放其中的读取器等值所占用的资源。
+// 参数datum代表条目，其他类型的数据会被忽略。
+func releaseItem(datum interface{}) {
+	item, ok := datum.(module.Item)
+	if !ok {
+		return
+	}
+	if err := module.CloseItem(item); err != nil {
+		logger.Warnf("An error occurs when closing dropped item: %s", err)
+	}
+}
+
+// flushModules 用于让所有可写出缓冲数据的组件实例写出缓冲数据。
+func (sched *myScheduler) flushModules() {
+	for mid, m := range sched.registrar.GetAll() {
+		flusher, ok := m.(module.Flusher)
+		if !ok {
+			continue
+		}
+		if err := flusher.Flush(); err != nil {
+			logger.Errorf("An error occurs when flushing module %s: %s", mid, err)
+		}
+	}
+}
+
 func (sched *myScheduler) Status() Status {
 	var status Status
 	sched.statusLock.RLock()
@@ -248,23 +400,26 @@ func (sched *myScheduler) ErrorChan() <-chan error {
 				close(errCh)
 				break
 			}
-			datum, err := errBuffer.Get()
+			datum, err := errBuffer.GetContext(sched.ctx)
 			if err != nil {
-				logger.Warnln("The error buffer pool was closed. Break error reception.")
+				if !sched.canceled() {
+					logger.Warnln("The error buffer pool was closed. Break error reception.")
+				}
 				close(errCh)
 				break
 			}
 			err, ok := datum.(error)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect error type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sched.reportError(errors.New(errMsg), genErrorContext("", "", nil))
 				continue
 			}
-			if sched.canceled() {
+			select {
+			case errCh <- err:
+			case <-sched.ctx.Done():
 				close(errCh)
-				break
+				return
 			}
-			errCh <- err
 		}
 	}(errBuffer, errCh)
 	return errCh
@@ -279,7 +434,10 @@ func (sched *myScheduler) Idle() bool {
 	}
 	if sched.reqBufferPool.Total() > 0 ||
 		sched.respBufferPool.Total() > 0 ||
-		sched.itemBufferPool.Total() > 0 {
+		sched.itemBufferPool.Total() > 0 ||
+		sched.reqOverflow.len() > 0 ||
+		sched.respOverflow.len() > 0 ||
+		sched.itemOverflow.len() > 0 {
 		return false
 	}
 	return true
@@ -349,6 +507,18 @@ func (sched *myScheduler) registerModules(moduleArgs ModuleArgs) error {
 	}
 	logger.Infof("All pipelines have been registered. (number: %d)",
 		len(moduleArgs.Pipelines))
+	for _, m := range moduleArgs.Extras {
+		ok, err := sched.registrar.Register(m)
+		if err != nil {
+			return genErrorByError(err)
+		}
+		if !ok {
+			errMsg := fmt.Sprintf("Couldn't register extra module instance with MID %q!", m.ID())
+			return genError(errMsg)
+		}
+	}
+	logger.Infof("All extra modules have been registered. (number: %d)",
+		len(moduleArgs.Extras))
 	return nil
 }
 
@@ -360,17 +530,20 @@ func (sched *myScheduler) download() {
 			if sched.canceled() {
 				break
 			}
-			datum, err := sched.reqBufferPool.Get()
+			datum, err := sched.reqBufferPool.GetContext(sched.ctx)
 			if err != nil {
-				logger.Warnln("The request buffer pool was closed. Break request reception.")
+				if !sched.canceled() {
+					logger.Warnln("The request buffer pool was closed. Break request reception.")
+				}
 				break
 			}
 			req, ok := datum.(*module.Request)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect request type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sched.reportError(errors.New(errMsg), genErrorContext("", module.STAGE_DOWNLOAD, nil))
 			}
 			sched.downloadOne(req)
+			sched.tracker.done()
 		}
 	}()
 }
@@ -383,10 +556,17 @@ func (sched *myScheduler) downloadOne(req *module.Request) {
 	if sched.canceled() {
 		return
 	}
-	m, err := sched.registrar.Get(module.TYPE_DOWNLOADER)
+	// 以主机名作为键，以便一致性哈希等策略把同一主机的请求交给同一个下载器。
+	var host string
+	if httpReq := req.HTTPReq(); httpReq != nil && httpReq.URL != nil {
+		host = httpReq.URL.Host
+	}
+	m, err := sched.registrar.GetByKey(module.TYPE_DOWNLOADER, host)
 	if err != nil || m == nil {
-		errMsg := fmt.Sprintf("couldn't get a downloader: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
+		if !sched.waitForHealthy(err) {
+			err = fmt.Errorf("couldn't get a downloader: %w", err)
+			sched.reportError(err, genErrorContext("", module.STAGE_DOWNLOAD, req))
+		}
 		sched.sendReq(req)
 		return
 	}
@@ -394,17 +574,50 @@ func (sched *myScheduler) downloadOne(req *module.Request) {
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect downloader type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
+		sched.reportError(errors.New(errMsg), genErrorContext(m.ID(), module.STAGE_DOWNLOAD, req))
 		sched.sendReq(req)
 		return
 	}
-	resp, err := downloader.Download(req)
+	req.IncrAttempt()
+	sched.prepareRecrawl(req)
+	ctx, stop, cancel := sched.downloadContext()
+	startTime := time.Now()
+	resp, err := module.AdaptDownloader(downloader).DownloadContext(ctx, req)
+	if err != nil && context.Cause(ctx) == context.DeadlineExceeded {
+		err = fmt.Errorf("download timed out after %s (%v): %w",
+			sched.downloadTimeout, err, context.DeadlineExceeded)
+	}
+	sched.reportHealth(m.ID(), startTime, err)
+	// 响应体的读取同样受上下文的约束，因此要等到响应体被关闭时再释放上下文。
+	if resp != nil && resp.HTTPResp() != nil && resp.HTTPResp().Body != nil {
+		httpResp := resp.HTTPResp()
+		httpResp.Body = &cancelOnCloseBody{
+			ReadCloser: httpResp.Body,
+			cancel:     func() { cancel(nil) },
+		}
+	} else {
+		cancel(nil)
+	}
+	if resp != nil && err == nil {
+		resp, err = sched.inspectResponse(req, resp)
+	}
+	if resp != nil {
+		resp = sched.processResponse(resp)
+	}
+	// 响应在响应缓冲池中等待以及被分析的时间不计入下载的超时时间。
+	stop()
 	if resp != nil {
-		sendResp(resp, sched.respBufferPool)
+		sched.sendTracked(func() bool { return sendResp(sched.ctx, resp, sched.respOverflow) })
 	}
 	if err != nil {
-		sendError(err, m.ID(), sched.errorBufferPool)
+		errCtx := genErrorContext(m.ID(), module.STAGE_DOWNLOAD, req)
+		crawlerError := genCrawlerError(err, errCtx)
+		sched.reportError(crawlerError, errCtx)
+		sched.handleFailedRequest(req, crawlerError)
+	} else {
+		sched.forgetRequest(req)
 	}
+	sched.completeLease(req)
 }
 
 // analyze 会从响应缓冲池取出响应并解析，
@@ -415,17 +628,20 @@ func (sched *myScheduler) analyze() {
 			if sched.canceled() {
 				break
 			}
-			datum, err := sched.respBufferPool.Get()
+			datum, err := sched.respBufferPool.GetContext(sched.ctx)
 			if err != nil {
-				logger.Warnln("The response buffer pool was closed. Break response reception.")
+				if !sched.canceled() {
+					logger.Warnln("The response buffer pool was closed. Break response reception.")
+				}
 				break
 			}
 			resp, ok := datum.(*module.Response)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect response type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sched.reportError(errors.New(errMsg), genErrorContext("", module.STAGE_ANALYZE, nil))
 			}
 			sched.analyzeOne(resp)
+			sched.tracker.done()
 		}
 	}()
 }
@@ -440,20 +656,37 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 	}
 	m, err := sched.registrar.Get(module.TYPE_ANALYZER)
 	if err != nil || m == nil {
-		errMsg := fmt.Sprintf("couldn't get an analyzer: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
-		sendResp(resp, sched.respBufferPool)
+		if !sched.waitForHealthy(err) {
+			err = fmt.Errorf("couldn't get an analyzer: %w", err)
+			sched.reportError(err, genErrorContext("", module.STAGE_ANALYZE, resp))
+		}
+		sched.sendTracked(func() bool { return sendResp(sched.ctx, resp, sched.respOverflow) })
 		return
 	}
 	analyzer, ok := m.(module.Analyzer)
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect analyzer type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sendResp(resp, sched.respBufferPool)
+		sched.reportError(errors.New(errMsg), genErrorContext(m.ID(), module.STAGE_ANALYZE, resp))
+		sched.sendTracked(func() bool { return sendResp(sched.ctx, resp, sched.respOverflow) })
 		return
 	}
-	dataList, errs := analyzer.Analyze(resp)
+	ctx, cancel := sched.stageContext(sched.analyzeTimeout)
+	defer cancel()
+	// 分析器读取响应体的时间计入分析的超时时间。
+	if httpResp := resp.HTTPResp(); httpResp != nil {
+		if body, ok := httpResp.Body.(*cancelOnCloseBody); ok {
+			defer context.AfterFunc(ctx, body.cancel)()
+		}
+	}
+	startTime := time.Now()
+	dataList, errs := module.AdaptAnalyzer(analyzer).AnalyzeContext(ctx, resp)
+	// 只有在没有任何产出时才认为分析失败，以免个别解析错误导致分析器被隔离。
+	var analyzeErr error
+	if len(errs) > 0 && len(dataList) == 0 {
+		analyzeErr = errs[0]
+	}
+	sched.reportHealth(m.ID(), startTime, analyzeErr)
 	if dataList != nil {
 		for _, data := range dataList {
 			if data == nil {
@@ -461,18 +694,22 @@ func (sched *myScheduler) analyzeOne(resp *module.Response) {
 			}
 			switch d := data.(type) {
 			case *module.Request:
-				sched.sendReq(d)
+				if req := sched.filterRequest(d); req != nil {
+					sched.sendReq(req)
+				}
 			case module.Item:
-				sendItem(d, sched.itemBufferPool)
+				if item := sched.filterItem(d); item != nil {
+					sched.sendTracked(func() bool { return sendItem(sched.ctx, item, sched.itemOverflow) })
+				}
 			default:
 				errMsg := fmt.Sprintf("Unsupported data type %T! (data: %#v)", d, d)
-				sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
+				sched.reportError(errors.New(errMsg), genErrorContext(m.ID(), module.STAGE_ANALYZE, resp))
 			}
 		}
 	}
 	if errs != nil {
 		for _, err := range errs {
-			sendError(err, m.ID(), sched.errorBufferPool)
+			sched.reportError(err, genErrorContext(m.ID(), module.STAGE_ANALYZE, resp))
 		}
 	}
 }
@@ -484,17 +721,20 @@ func (sched *myScheduler) pick() {
 			if sched.canceled() {
 				break
 			}
-			datum, err := sched.itemBufferPool.Get()
+			datum, err := sched.itemBufferPool.GetContext(sched.ctx)
 			if err != nil {
-				logger.Warnln("The item buffer pool was closed. Break item reception.")
+				if !sched.canceled() {
+					logger.Warnln("The item buffer pool was closed. Break item reception.")
+				}
 				break
 			}
 			item, ok := datum.(module.Item)
 			if !ok {
 				errMsg := fmt.Sprintf("incorrect item type: %T", datum)
-				sendError(errors.New(errMsg), "", sched.errorBufferPool)
+				sched.reportError(errors.New(errMsg), genErrorContext("", module.STAGE_PIPELINE, nil))
 			}
 			sched.pickOne(item)
+			sched.tracker.done()
 		}
 	}()
 }
@@ -506,24 +746,77 @@ func (sched *myScheduler) pickOne(item module.Item) {
 	}
 	m, err := sched.registrar.Get(module.TYPE_PIPELINE)
 	if err != nil || m == nil {
-		errMsg := fmt.Sprintf("couldn't get a pipeline: %s", err)
-		sendError(errors.New(errMsg), "", sched.errorBufferPool)
-		sendItem(item, sched.itemBufferPool)
+		if !sched.waitForHealthy(err) {
+			err = fmt.Errorf("couldn't get a pipeline: %w", err)
+			sched.reportError(err, genErrorContext("", module.STAGE_PIPELINE, nil))
+		}
+		sched.sendTracked(func() bool { return sendItem(sched.ctx, item, sched.itemOverflow) })
 		return
 	}
 	pipeline, ok := m.(module.Pipeline)
 	if !ok {
 		errMsg := fmt.Sprintf("incorrect pipeline type: %T (MID: %s)",
 			m, m.ID())
-		sendError(errors.New(errMsg), m.ID(), sched.errorBufferPool)
-		sendItem(item, sched.itemBufferPool)
+		sched.reportError(errors.New(errMsg), genErrorContext(m.ID(), module.STAGE_PIPELINE, nil))
+		sched.sendTracked(func() bool { return sendItem(sched.ctx, item, sched.itemOverflow) })
 		return
 	}
-	errs := pipeline.Send(item)
-	if errs != nil {
-		for _, err := range errs {
-			sendError(err, m.ID(), sched.errorBufferPool)
+	ctx, cancel := sched.stageContext(sched.pipelineTimeout)
+	defer cancel()
+	startTime := time.Now()
+	errs := module.AdaptPipeline(pipeline).SendContext(ctx, item)
+	// 条目字段的校验错误源于条目本身，因此不会影响条目处理管道的健康状态。
+	// 未通过校验的条目已由条目处理管道放入了它的死信接收器，所以也不再放入死信存储。
+	var pipelineErr error
+	var failedErrors []werrors.CrawlerError
+	errCtx := genErrorContext(m.ID(), module.STAGE_PIPELINE, nil)
+	for _, err := range errs {
+		crawlerError := genCrawlerError(err, errCtx)
+		sched.reportError(crawlerError, errCtx)
+		if module.IsFieldError(err) {
+			continue
 		}
+		if pipelineErr == nil {
+			pipelineErr = err
+		}
+		failedErrors = append(failedErrors, crawlerError)
+	}
+	sched.reportHealth(m.ID(), startTime, pipelineErr)
+	if len(failedErrors) > 0 {
+		sched.handleFailedItem(item, failedErrors)
+	}
+}
+
+// healthRetryInterval 代表所有组件实例都被隔离时重试之前的等待时间。
+const healthRetryInterval = 100 * time.Millisecond
+
+// waitForHealthy 会在所有组件实例都被隔离时等待一小段时间，
+// 以免调度器空转，并返回true。对于其他错误会直接返回false。
+func (sched *myScheduler) waitForHealthy(err error) bool {
+	if err != module.ErrNoHealthyModuleInstance {
+		return false
+	}
+	select {
+	case <-sched.ctx.Done():
+	case <-time.After(healthRetryInterval):
+	}
+	return true
+}
+
+// reportHealth 用于向健康检查器报告组件实例的一次调用的结果。
+func (sched *myScheduler) reportHealth(mid module.MID, startTime time.Time, err error) {
+	if checker := sched.registrar.HealthChecker(); checker != nil {
+		checker.Report(mid, time.Since(startTime), err)
+	}
+}
+
+// onHealthEvent 用于处理组件实例的熔断器状态变化的事件。
+// 组件实例被隔离的事件会被发送到错误缓冲池。
+func (sched *myScheduler) onHealthEvent(event module.HealthEvent) {
+	logger.Warnf("Health event: %s", event)
+	if event.To == module.CIRCUIT_OPEN {
+		errMsg := fmt.Sprintf("quarantined: %s", event)
+		sched.reportError(errors.New(errMsg), genErrorContext(event.MID, "", nil))
 	}
 }
 
@@ -552,6 +845,11 @@ func (sched *myScheduler) sendReq(req *module.Request) bool {
 			scheme, "http", "https", reqURL)
 		return false
 	}
+	// 租借到的请求已经通过了过滤。
+	// 它们需要重新排队（例如暂时没有可用的下载器）时会被直接放回本地的请求缓冲池。
+	if sched.leased(req) {
+		return sched.resendReq(req)
+	}
 	if v := sched.urlMap.Get(reqURL.String()); v != nil {
 		logger.Warnf("Ignore the request! Its URL is repeated. (URL: %s)\n", reqURL)
 		return false
@@ -570,114 +868,190 @@ func (sched *myScheduler) sendReq(req *module.Request) bool {
 			req.Depth(), sched.maxDepth, reqURL)
 		return false
 	}
-	go func(req *module.Request) {
-		if err := sched.reqBufferPool.Put(req); err != nil {
-			logger.Warnln("The request buffer pool was closed. Ignore request sending.")
+	if sched.skipRecrawl(reqURL.String()) {
+		logger.Infof("Ignore the request! Its page is not due for recrawl. (URL: %s)\n", reqURL)
+		sched.urlMap.Put(reqURL.String(), struct{}{})
+		return false
+	}
+	if sched.frontierWorker != nil {
+		// 由共享爬取边界集中去重，并由其决定请求被哪个工作者下载。
+		// 只有提交成功的URL才会被记录，以便提交失败的请求在之后被再次发现时仍能提交。
+		if !sched.submitToFrontier(req) {
+			return false
 		}
-	}(req)
+		sched.urlMap.Put(reqURL.String(), struct{}{})
+		return true
+	}
+	sent := sched.sendTracked(func() bool {
+		return sched.reqOverflow.put(sched.ctx, req)
+	})
+	if !sent {
+		return false
+	}
 	sched.urlMap.Put(reqURL.String(), struct{}{})
 	return true
 }
 
 // sendResp 会向响应缓冲池发送响应。
-func sendResp(resp *module.Response, respBufferPool buffer.Pool) bool {
-	if resp == nil || respBufferPool == nil || respBufferPool.Closed() {
+// 参数respOverflow代表响应缓冲池的溢出队列。
+func sendResp(ctx context.Context, resp *module.Response, respOverflow *overflowQueue) bool {
+	if resp == nil {
 		return false
 	}
-	go func(resp *module.Response) {
-		if err := respBufferPool.Put(resp); err != nil {
-			logger.Warnln("The response buffer pool was closed. Ignore response sending.")
-		}
-	}(resp)
-	return true
+	return respOverflow.put(ctx, resp)
 }
 
 // sendItem 会向条目缓冲池发送条目。
-func sendItem(item module.Item, itemBufferPool buffer.Pool) bool {
-	if item == nil || itemBufferPool == nil || itemBufferPool.Closed() {
+// 参数itemOverflow代表条目缓冲池的溢出队列。
+// 未能发送的条目会被丢弃并关闭。
+func sendItem(ctx context.Context, item module.Item, itemOverflow *overflowQueue) bool {
+	if item == nil {
 		return false
 	}
-	go func(item module.Item) {
-		if err := itemBufferPool.Put(item); err != nil {
-			logger.Warnln("The item buffer pool was closed. Ignore item sending.")
-		}
-	}(item)
-	return true
+	if itemOverflow.put(ctx, item) {
+		return true
+	}
+	releaseItem(item)
+	return false
 }
 
 // initBufferPool 用于按照给定的参数初始化缓冲池。
 // 如果某个缓冲池可用且未关闭，就先关闭该缓冲池。
-func (sched *myScheduler) initBufferPool(dataArgs DataArgs) {
+func (sched *myScheduler) initBufferPool(dataArgs DataArgs) (err error) {
 	// 初始化请求缓冲池。
 	if sched.reqBufferPool != nil && !sched.reqBufferPool.Closed() {
 		sched.reqBufferPool.Close()
 	}
-	sched.reqBufferPool, _ = buffer.NewPool(
-		dataArgs.ReqBufferCap, dataArgs.ReqMaxBufferNumber)
+	if sched.reqBufferPool, err = sched.newReqBufferPool(dataArgs); err != nil {
+		return
+	}
+	if dataArgs.ReqSpillDir != "" {
+		logger.Infof("-- Request spill dir: %s", dataArgs.ReqSpillDir)
+	}
 	logger.Infof("-- Request buffer pool: bufferCap: %d, maxBufferNumber: %d",
 		sched.reqBufferPool.BufferCap(), sched.reqBufferPool.MaxBufferNumber())
 	// 初始化响应缓冲池。
 	if sched.respBufferPool != nil && !sched.respBufferPool.Closed() {
 		sched.respBufferPool.Close()
 	}
-	sched.respBufferPool, _ = buffer.NewPool(
-		dataArgs.RespBufferCap, dataArgs.RespMaxBufferNumber)
+	sched.respBufferPool, err = newBufferPool(
+		dataArgs.RespBufferCap, dataArgs.RespMaxBufferNumber, dataArgs.PoolPolicy)
+	if err != nil {
+		return
+	}
 	logger.Infof("-- Response buffer pool: bufferCap: %d, maxBufferNumber: %d",
 		sched.respBufferPool.BufferCap(), sched.respBufferPool.MaxBufferNumber())
 	// 初始化条目缓冲池。
 	if sched.itemBufferPool != nil && !sched.itemBufferPool.Closed() {
 		sched.itemBufferPool.Close()
 	}
-	sched.itemBufferPool, _ = buffer.NewPool(
-		dataArgs.ItemBufferCap, dataArgs.ItemMaxBufferNumber)
+	sched.itemBufferPool, err = newBufferPool(
+		dataArgs.ItemBufferCap, dataArgs.ItemMaxBufferNumber, dataArgs.PoolPolicy)
+	if err != nil {
+		return
+	}
 	logger.Infof("-- Item buffer pool: bufferCap: %d, maxBufferNumber: %d",
 		sched.itemBufferPool.BufferCap(), sched.itemBufferPool.MaxBufferNumber())
 	// 初始化错误缓冲池。
 	if sched.errorBufferPool != nil && !sched.errorBufferPool.Closed() {
 		sched.errorBufferPool.Close()
 	}
-	sched.errorBufferPool, _ = buffer.NewPool(
-		dataArgs.ErrorBufferCap, dataArgs.ErrorMaxBufferNumber)
+	sched.errorBufferPool, err = newBufferPool(
+		dataArgs.ErrorBufferCap, dataArgs.ErrorMaxBufferNumber, dataArgs.PoolPolicy)
+	if err != nil {
+		return
+	}
 	logger.Infof("-- Error buffer pool: bufferCap: %d, maxBufferNumber: %d",
 		sched.errorBufferPool.BufferCap(), sched.errorBufferPool.MaxBufferNumber())
+	sched.dataArgs = dataArgs
+	sched.initOverflowQueues()
+	return nil
+}
+
+// newReqBufferPool 用于按照给定的参数创建请求缓冲池。
+// 若参数中指定了请求溢出文件的目录，则创建的是溢出缓冲池，
+// 其中无法被读回的请求会被跳过，相应的错误会被报告。
+func (sched *myScheduler) newReqBufferPool(dataArgs DataArgs) (buffer.Pool, error) {
+	if dataArgs.ReqSpillDir == "" {
+		return newBufferPool(
+			dataArgs.ReqBufferCap, dataArgs.ReqMaxBufferNumber, dataArgs.PoolPolicy)
+	}
+	spillOpts := buffer.SpillOptions{
+		Dir:         dataArgs.ReqSpillDir,
+		Codec:       module.RequestCodec{},
+		SegmentSize: dataArgs.ReqSpillSegmentSize,
+		ErrorHandler: func(err error) {
+			sched.reportError(err, genErrorContext("", module.STAGE_DOWNLOAD, nil))
+		},
+	}
+	if dataArgs.PoolPolicy != nil {
+		spillOpts.Policy = *dataArgs.PoolPolicy
+	}
+	return buffer.NewSpillPool(
+		dataArgs.ReqBufferCap, dataArgs.ReqMaxBufferNumber, spillOpts)
+}
+
+// newBufferPool 用于按照给定的容量和伸缩策略创建缓冲池。
+// 若参数policy为nil，则使用默认的伸缩策略。
+func newBufferPool(
+	bufferCap uint32,
+	maxBufferNumber uint32,
+	policy *buffer.PoolPolicy) (buffer.Pool, error) {
+	var opts []buffer.PoolOption
+	if policy != nil {
+		opts = append(opts, buffer.WithPolicy(*policy))
+	}
+	return buffer.NewPool(bufferCap, maxBufferNumber, opts...)
 }
 
 // checkBufferPoolForStart 会检查缓冲池是否已为调度器的启动准备就绪。
 // 如果某个缓冲池不可用，就直接返回错误值报告此情况。
-// 如果某个缓冲池已关闭，就按照原先的参数重新初始化它。
-func (sched *myScheduler) checkBufferPoolForStart() error {
+// 如果某个缓冲池已关闭，就按照初始化时的数据参数重新创建它，
+// 因此请求缓冲池的溢出文件目录和各缓冲池的伸缩策略都会被保留。
+func (sched *myScheduler) checkBufferPoolForStart() (err error) {
 	// 检查请求缓冲池。
 	if sched.reqBufferPool == nil {
 		return genError("nil request buffer pool")
 	}
-	if sched.reqBufferPool != nil && sched.reqBufferPool.Closed() {
-		sched.reqBufferPool, _ = buffer.NewPool(
-			sched.reqBufferPool.BufferCap(), sched.reqBufferPool.MaxBufferNumber())
+	if sched.reqBufferPool.Closed() {
+		if sched.reqBufferPool, err = sched.newReqBufferPool(sched.dataArgs); err != nil {
+			return
+		}
 	}
 	// 检查响应缓冲池。
 	if sched.respBufferPool == nil {
 		return genError("nil response buffer pool")
 	}
-	if sched.respBufferPool != nil && sched.respBufferPool.Closed() {
-		sched.respBufferPool, _ = buffer.NewPool(
-			sched.respBufferPool.BufferCap(), sched.respBufferPool.MaxBufferNumber())
+	if sched.respBufferPool.Closed() {
+		sched.respBufferPool, err = newBufferPool(sched.dataArgs.RespBufferCap,
+			sched.dataArgs.RespMaxBufferNumber, sched.dataArgs.PoolPolicy)
+		if err != nil {
+			return
+		}
 	}
 	// 检查条目缓冲池。
 	if sched.itemBufferPool == nil {
 		return genError("nil item buffer pool")
 	}
-	if sched.itemBufferPool != nil && sched.itemBufferPool.Closed() {
-		sched.itemBufferPool, _ = buffer.NewPool(
-			sched.itemBufferPool.BufferCap(), sched.itemBufferPool.MaxBufferNumber())
+	if sched.itemBufferPool.Closed() {
+		sched.itemBufferPool, err = newBufferPool(sched.dataArgs.ItemBufferCap,
+			sched.dataArgs.ItemMaxBufferNumber, sched.dataArgs.PoolPolicy)
+		if err != nil {
+			return
+		}
 	}
 	// 检查错误缓冲池。
 	if sched.errorBufferPool == nil {
 		return genError("nil error buffer pool")
 	}
-	if sched.errorBufferPool != nil && sched.errorBufferPool.Closed() {
-		sched.errorBufferPool, _ = buffer.NewPool(
-			sched.errorBufferPool.BufferCap(), sched.errorBufferPool.MaxBufferNumber())
+	if sched.errorBufferPool.Closed() {
+		sched.errorBufferPool, err = newBufferPool(sched.dataArgs.ErrorBufferCap,
+			sched.dataArgs.ErrorMaxBufferNumber, sched.dataArgs.PoolPolicy)
+		if err != nil {
+			return
+		}
 	}
+	sched.initOverflowQueues()
 	return nil
 }
 
@@ -686,6 +1060,45 @@ func (sched *myScheduler) resetContext() {
 	sched.ctx, sched.cancelFunc = context.WithCancel(context.Background())
 }
 
+// stageContext 用于生成某个处理阶段专用的上下文。
+// 该上下文派生自调度器的上下文，并在timeout大于0时带有超时时间。
+func (sched *myScheduler) stageContext(
+	timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(sched.ctx, timeout)
+	}
+	return context.WithCancel(sched.ctx)
+}
+
+// downloadContext 用于生成下载阶段专用的上下文。
+// 该上下文派生自调度器的上下文，并在downloadTimeout大于0时按时被取消，
+// 取消的原因为context.DeadlineExceeded。与stageContext不同的是，
+// 计时可以通过调用stop提前停止，以便下载阶段结束后仍能通过该上下文读取响应体。
+func (sched *myScheduler) downloadContext() (
+	ctx context.Context, stop func(), cancel context.CancelCauseFunc) {
+	ctx, cancel = context.WithCancelCause(sched.ctx)
+	if sched.downloadTimeout <= 0 {
+		return ctx, func() {}, cancel
+	}
+	timer := time.AfterFunc(sched.downloadTimeout, func() {
+		cancel(context.DeadlineExceeded)
+	})
+	return ctx, func() { timer.Stop() }, cancel
+}
+
+// cancelOnCloseBody 代表会在关闭时释放上下文的HTTP响应体。
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	// cancel 代表上下文的取消函数。
+	cancel context.CancelFunc
+}
+
+func (body *cancelOnCloseBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	return err
+}
+
 // canceled 用于判断调度器的上下文是否已被取消。
 func (sched *myScheduler) canceled() bool {
 	select {
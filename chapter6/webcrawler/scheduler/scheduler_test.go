@@ -1,7 +1,11 @@
 package scheduler
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"runtime"
 	"testing"
 	"time"
@@ -383,10 +387,42 @@ func TestSchedSendReq(t *testing.T) {
 	}
 }
 
+func TestSchedDownloadContext(t *testing.T) {
+	sched := &myScheduler{downloadTimeout: 50 * time.Millisecond}
+	sched.resetContext()
+	defer sched.cancelFunc()
+	// 超时后上下文会被取消，且取消的原因为context.DeadlineExceeded。
+	ctx, stop, cancel := sched.downloadContext()
+	defer cancel(nil)
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The download context is not canceled after timeout!")
+	}
+	if cause := context.Cause(ctx); cause != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent cancel cause: expected: %v, actual: %v",
+			context.DeadlineExceeded, cause)
+	}
+	// 停止计时之后，上下文只会因调度器的上下文或cancel而被取消。
+	ctx, stop, cancel = sched.downloadContext()
+	stop()
+	time.Sleep(100 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("The download context is canceled after stopping the timer: %s", err)
+	}
+	cancel(nil)
+	if cause := context.Cause(ctx); cause != context.Canceled {
+		t.Fatalf("Inconsistent cancel cause: expected: %v, actual: %v",
+			context.Canceled, cause)
+	}
+}
+
 func TestSendResp(t *testing.T) {
 	// 测试响应无效的情况。
 	buffer, _ := buffer.NewPool(10, 2)
-	if sendResp(nil, buffer) {
+	queue := newOverflowQueue(buffer, "response")
+	if sendResp(context.Background(), nil, queue) {
 		t.Fatalf("It still can send nil response!")
 	}
 	// 测试响应无效的情况。
@@ -398,7 +434,7 @@ func TestSendResp(t *testing.T) {
 	}
 	resp := module.NewResponse(httpResp, 0)
 	buffer.Close()
-	done := sendResp(resp, buffer)
+	done := sendResp(context.Background(), resp, queue)
 	runtime.Gosched()
 	if done {
 		t.Fatalf("It still can send response with closed buffer!")
@@ -408,15 +444,99 @@ func TestSendResp(t *testing.T) {
 func TestSendItem(t *testing.T) {
 	// 测试响应无效的情况。
 	buffer, _ := buffer.NewPool(10, 2)
-	if sendItem(nil, buffer) {
+	queue := newOverflowQueue(buffer, "item")
+	if sendItem(context.Background(), nil, queue) {
 		t.Fatalf("It still can send nil item!")
 	}
 	// 测试响应无效的情况。
 	item := module.Item(map[string]interface{}{})
 	buffer.Close()
-	done := sendItem(item, buffer)
+	done := sendItem(context.Background(), item, queue)
 	runtime.Gosched()
 	if done {
 		t.Fatalf("It still can send item with closed buffer!")
 	}
 }
+
+func TestSchedCheckBufferPoolForStart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reqspill")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	dataArgs := genDataArgs(1, 2, 1)
+	dataArgs.ReqSpillDir = dir
+	dataArgs.PoolPolicy = &buffer.PoolPolicy{MinBufferNumber: 2}
+	sched := NewScheduler()
+	err = sched.Init(genRequestArgs([]string{"example.com"}, 1),
+		dataArgs, genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	ms.reqBufferPool.Close()
+	ms.respBufferPool.Close()
+	ms.itemBufferPool.Close()
+	ms.errorBufferPool.Close()
+	// 已关闭的缓冲池会按照初始化时的数据参数被重新创建。
+	if err := ms.checkBufferPoolForStart(); err != nil {
+		t.Fatalf("An error occurs when checking buffer pools for start: %s", err)
+	}
+	defer ms.reqBufferPool.Close()
+	if _, ok := ms.reqBufferPool.(buffer.Spiller); !ok {
+		t.Fatalf("Inconsistent request buffer pool type: expected: %s, actual: %T",
+			"spill pool", ms.reqBufferPool)
+	}
+	pools := []buffer.Pool{
+		ms.reqBufferPool, ms.respBufferPool, ms.itemBufferPool, ms.errorBufferPool}
+	for _, pool := range pools {
+		if pool.Closed() {
+			t.Fatal("The buffer pool is still closed!")
+		}
+		if number := pool.Policy().MinBufferNumber; number != 2 {
+			t.Fatalf("Inconsistent min buffer number: expected: %d, actual: %d", 2, number)
+		}
+	}
+	if ms.reqOverflow.pool != ms.reqBufferPool {
+		t.Fatal("The request overflow queue is not bound to the new buffer pool!")
+	}
+}
+
+func TestSchedReqSpill(t *testing.T) {
+	dir, err := ioutil.TempDir("", "reqspill")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	dataArgs := genDataArgs(1, 1, 1)
+	dataArgs.ReqSpillDir = dir
+	sched := NewScheduler()
+	err = sched.Init(genRequestArgs([]string{"example.com"}, 1),
+		dataArgs, genSimpleModuleArgs(1, 1, 1, t))
+	if err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	defer ms.reqBufferPool.Close()
+	// 请求缓冲池已满时，请求会被溢出到磁盘，而不会阻塞。
+	for i := 0; i < 5; i++ {
+		httpReq, _ := http.NewRequest("GET", fmt.Sprintf("http://example.com/%d", i), nil)
+		if !ms.sendReq(module.NewRequest(httpReq, 1)) {
+			t.Fatalf("Couldn't send request! (URL: %s)", httpReq.URL)
+		}
+	}
+	summary := sched.Summary().Struct().ReqBufferPool
+	if summary.Total != 5 || summary.Spilled != 4 {
+		t.Fatalf("Inconsistent request buffer pool summary: %#v", summary)
+	}
+	for i := 0; i < 5; i++ {
+		datum, err := ms.reqBufferPool.Get()
+		if err != nil {
+			t.Fatalf("An error occurs when getting request: %s", err)
+		}
+		expectedURL := fmt.Sprintf("http://example.com/%d", i)
+		if url := datum.(*module.Request).HTTPReq().URL.String(); url != expectedURL {
+			t.Fatalf("Inconsistent request URL: expected: %s, actual: %s", expectedURL, url)
+		}
+	}
+}
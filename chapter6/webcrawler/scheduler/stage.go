@@ -0,0 +1,152 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+)
+
+// genStageTypeMap 用于根据给定的自定义组件生成阶段与组件类型的映射。
+// 同一阶段中的组件类型会按照注册顺序排列。
+func genStageTypeMap(extras []module.Module) map[module.Stage][]module.Type {
+	typeSet := map[module.Type]bool{}
+	for _, m := range extras {
+		if ok, mt := module.GetType(m.ID()); ok {
+			typeSet[mt] = true
+		}
+	}
+	stageTypeMap := map[module.Stage][]module.Type{}
+	for _, mt := range module.Types() {
+		if !typeSet[mt] {
+			continue
+		}
+		spec, _ := module.GetTypeSpec(mt)
+		stageTypeMap[spec.Stage] = append(stageTypeMap[spec.Stage], mt)
+	}
+	return stageTypeMap
+}
+
+// handleData 代表让单个组件实例处理数据的函数的类型。
+// 结果值为nil即代表数据被丢弃。
+type handleData func(ctx context.Context, m module.Module, data interface{}) (interface{}, error)
+
+// runStage 会让给定阶段的各个自定义组件类型依次处理数据。
+// 每个类型都会基于负载均衡策略选出一个组件实例。
+// 若无法获取组件实例或处理出错，则会发送错误值并丢弃数据。
+// 结果值为nil即代表数据被丢弃。
+func (sched *myScheduler) runStage(
+	stage module.Stage, data interface{}, handle handleData) interface{} {
+	for _, mt := range sched.stageTypeMap[stage] {
+		if sched.canceled() {
+			return nil
+		}
+		m, err := sched.registrar.Get(mt)
+		if err != nil || m == nil {
+			errMsg := fmt.Sprintf("couldn't get a module of type %s: %s", mt, err)
+			sched.reportError(genError(errMsg), genErrorContext("", stage, data))
+			return nil
+		}
+		ctx, cancel := sched.stageContext(0)
+		startTime := time.Now()
+		data, err = handle(ctx, m, data)
+		cancel()
+		sched.reportHealth(m.ID(), startTime, err)
+		if err != nil {
+			sched.reportError(err, genErrorContext(m.ID(), stage, data))
+			return nil
+		}
+		if data == nil {
+			return nil
+		}
+	}
+	return data
+}
+
+// processResponse 会让响应处理阶段的组件依次处理给定的响应。
+// 若响应被丢弃，则其响应体会被关闭，并且结果值为nil。
+func (sched *myScheduler) processResponse(resp *module.Response) *module.Response {
+	if len(sched.stageTypeMap[module.STAGE_RESPONSE]) == 0 {
+		return resp
+	}
+	current := resp
+	result := sched.runStage(module.STAGE_RESPONSE, resp,
+		func(ctx context.Context, m module.Module, data interface{}) (interface{}, error) {
+			processor, ok := m.(module.ResponseProcessor)
+			if !ok {
+				return nil, fmt.Errorf("incorrect response processor type: %T (MID: %s)",
+					m, m.ID())
+			}
+			newResp, err := processor.ProcessResponse(ctx, data.(*module.Response))
+			if newResp == nil {
+				return nil, err
+			}
+			current = newResp
+			return newResp, err
+		})
+	if result == nil {
+		closeResponse(current)
+		return nil
+	}
+	return result.(*module.Response)
+}
+
+// filterRequest 会让请求过滤阶段的组件依次过滤给定的请求。
+// 若请求被丢弃，则结果值为nil。
+func (sched *myScheduler) filterRequest(req *module.Request) *module.Request {
+	if len(sched.stageTypeMap[module.STAGE_REQUEST]) == 0 {
+		return req
+	}
+	result := sched.runStage(module.STAGE_REQUEST, req,
+		func(ctx context.Context, m module.Module, data interface{}) (interface{}, error) {
+			filter, ok := m.(module.RequestFilter)
+			if !ok {
+				return nil, fmt.Errorf("incorrect request filter type: %T (MID: %s)",
+					m, m.ID())
+			}
+			newReq, err := filter.FilterRequest(ctx, data.(*module.Request))
+			if newReq == nil {
+				return nil, err
+			}
+			return newReq, err
+		})
+	if result == nil {
+		return nil
+	}
+	return result.(*module.Request)
+}
+
+// filterItem 会让条目过滤阶段的组件依次过滤给定的条目。
+// 若条目被丢弃，则结果值为nil，并且条目会被关闭。
+func (sched *myScheduler) filterItem(item module.Item) module.Item {
+	if len(sched.stageTypeMap[module.STAGE_ITEM]) == 0 {
+		return item
+	}
+	result := sched.runStage(module.STAGE_ITEM, item,
+		func(ctx context.Context, m module.Module, data interface{}) (interface{}, error) {
+			filter, ok := m.(module.ItemFilter)
+			if !ok {
+				return nil, fmt.Errorf("incorrect item filter type: %T (MID: %s)",
+					m, m.ID())
+			}
+			newItem, err := filter.FilterItem(ctx, data.(module.Item))
+			if newItem == nil {
+				return nil, err
+			}
+			return newItem, err
+		})
+	if result == nil {
+		releaseItem(item)
+		return nil
+	}
+	return result.(module.Item)
+}
+
+// closeResponse 用于关闭给定响应的响应体。
+func closeResponse(resp *module.Response) {
+	if resp == nil || resp.HTTPResp() == nil || resp.HTTPResp().Body == nil {
+		return
+	}
+	resp.HTTPResp().Body.Close()
+}
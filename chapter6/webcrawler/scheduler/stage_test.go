@@ -0,0 +1,201 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gopcp.v2/chapter6/webcrawler/module"
+	"gopcp.v2/chapter6/webcrawler/module/stub"
+)
+
+// 测试用的自定义组件类型。
+const (
+	testTypeRenderer      module.Type = "test_renderer"
+	testTypeRequestFilter module.Type = "test_request_filter"
+	testTypeItemFilter    module.Type = "test_item_filter"
+)
+
+func init() {
+	specs := []module.TypeSpec{
+		{Type: testTypeRenderer, Letter: "R", Stage: module.STAGE_RESPONSE},
+		{Type: testTypeRequestFilter, Letter: "Q", Stage: module.STAGE_REQUEST},
+		{Type: testTypeItemFilter, Letter: "I", Stage: module.STAGE_ITEM},
+	}
+	for _, spec := range specs {
+		if err := module.RegisterType(spec); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// testRenderer 代表测试用的响应处理器。
+// 它会丢弃状态码不是200的响应。
+type testRenderer struct {
+	stub.ModuleInternal
+}
+
+func (renderer *testRenderer) ProcessResponse(
+	ctx context.Context, resp *module.Response) (*module.Response, error) {
+	if resp.HTTPResp().StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+// testRequestFilter 代表测试用的请求过滤器。
+// 它会丢弃深度大于maxDepth的请求。
+type testRequestFilter struct {
+	stub.ModuleInternal
+	maxDepth uint32
+}
+
+func (filter *testRequestFilter) FilterRequest(
+	ctx context.Context, req *module.Request) (*module.Request, error) {
+	if req.Depth() > filter.maxDepth {
+		return nil, nil
+	}
+	return req, nil
+}
+
+// testItemFilter 代表测试用的条目过滤器。
+// 它会为条目加上标记，并对包含“invalid”键的条目报告错误。
+type testItemFilter struct {
+	stub.ModuleInternal
+}
+
+func (filter *testItemFilter) FilterItem(
+	ctx context.Context, item module.Item) (module.Item, error) {
+	if _, ok := item["invalid"]; ok {
+		return nil, errors.New("invalid item")
+	}
+	result := module.Item{"filtered": true}
+	for key, value := range item {
+		result[key] = value
+	}
+	return result, nil
+}
+
+// trackingBody 代表可以记录是否已被关闭的响应体。
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (body *trackingBody) Close() error {
+	body.closed = true
+	return nil
+}
+
+// genTestExtras 用于生成测试用的自定义组件实例。
+func genTestExtras(t *testing.T) []module.Module {
+	var extras []module.Module
+	for _, mid := range []module.MID{"R1", "Q1", "I1"} {
+		mi, err := stub.NewModuleInternal(mid, nil)
+		if err != nil {
+			t.Fatalf("An error occurs when creating an internal module: %s (mid: %s)",
+				err, mid)
+		}
+		switch mid[0] {
+		case 'R':
+			extras = append(extras, &testRenderer{ModuleInternal: mi})
+		case 'Q':
+			extras = append(extras, &testRequestFilter{ModuleInternal: mi, maxDepth: 1})
+		case 'I':
+			extras = append(extras, &testItemFilter{ModuleInternal: mi})
+		}
+	}
+	return extras
+}
+
+func TestArgsModuleExtras(t *testing.T) {
+	moduleArgs := genSimpleModuleArgs(1, 1, 1, t)
+	// 类型为请求过滤器，但却没有实现相应的接口。
+	mi, _ := stub.NewModuleInternal("Q2", nil)
+	invalidExtrasList := [][]module.Module{
+		{nil},
+		{moduleArgs.Downloaders[0]},
+		{&testItemFilter{ModuleInternal: mi}},
+	}
+	for _, extras := range invalidExtrasList {
+		moduleArgs.Extras = extras
+		if err := moduleArgs.Check(); err == nil {
+			t.Fatalf("No error when check module arguments! (extras: %#v)", extras)
+		}
+	}
+	moduleArgs.Extras = genTestExtras(t)
+	if err := moduleArgs.Check(); err != nil {
+		t.Fatalf("An error occurs when checking module arguments: %s", err)
+	}
+	if size := moduleArgs.Summary().ExtraListSize; size != 3 {
+		t.Fatalf("Inconsistent extra list size: expected: %d, actual: %d", 3, size)
+	}
+}
+
+func TestSchedStages(t *testing.T) {
+	moduleArgs := genSimpleModuleArgs(1, 1, 1, t)
+	moduleArgs.Extras = genTestExtras(t)
+	sched := NewScheduler()
+	if err := sched.Init(genRequestArgs([]string{}, 0), genDataArgs(10, 2, 1), moduleArgs); err != nil {
+		t.Fatalf("An error occurs when initializing scheduler: %s", err)
+	}
+	ms := sched.(*myScheduler)
+	// 请求过滤阶段。
+	httpReq, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if req := ms.filterRequest(module.NewRequest(httpReq, 1)); req == nil {
+		t.Fatal("The request has been dropped by mistake!")
+	}
+	if req := ms.filterRequest(module.NewRequest(httpReq, 2)); req != nil {
+		t.Fatal("The request which is too deep has not been dropped!")
+	}
+	// 条目过滤阶段。
+	item := ms.filterItem(module.Item{"name": "crawler"})
+	if item == nil || item["filtered"] != true || item["name"] != "crawler" {
+		t.Fatalf("Inconsistent filtered item: %#v", item)
+	}
+	body := &trackingBody{Reader: strings.NewReader("body")}
+	if item := ms.filterItem(module.Item{"invalid": true, "body": body}); item != nil {
+		t.Fatalf("The invalid item has not been dropped: %#v", item)
+	}
+	if !body.closed {
+		t.Fatal("The body in the dropped item has not been closed!")
+	}
+	// 响应处理阶段。
+	for _, statusCode := range []int{http.StatusOK, http.StatusNotFound} {
+		body := &trackingBody{Reader: strings.NewReader("body")}
+		httpResp := &http.Response{
+			StatusCode: statusCode,
+			Body:       body,
+			Request:    httpReq,
+		}
+		resp := ms.processResponse(module.NewResponse(httpResp, 0))
+		if statusCode == http.StatusOK {
+			if resp == nil {
+				t.Fatal("The response has been dropped by mistake!")
+			}
+			content, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+			if string(content) != "body" {
+				t.Fatalf("Inconsistent response body: expected: %q, actual: %q",
+					"body", content)
+			}
+			continue
+		}
+		if resp != nil {
+			t.Fatal("The response has not been dropped!")
+		}
+		if !body.closed {
+			t.Fatal("The body of dropped response has not been closed!")
+		}
+	}
+	// 摘要。
+	extras := sched.Summary().Struct().Extras
+	for _, mt := range []module.Type{testTypeRenderer, testTypeRequestFilter, testTypeItemFilter} {
+		if len(extras[mt]) != 1 {
+			t.Fatalf("Inconsistent extra module summaries of type %s: %#v", mt, extras[mt])
+		}
+	}
+}
@@ -2,9 +2,14 @@ package scheduler
 
 import (
 	"encoding/json"
+	"reflect"
 	"sort"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
 	"gopcp.v2/chapter6/webcrawler/module"
 	"gopcp.v2/chapter6/webcrawler/toolkit/buffer"
+	"gopcp.v2/chapter6/webcrawler/toolkit/dedup"
 )
 
 // SchedSummary 代表调度器摘要的接口类型。
@@ -60,6 +65,20 @@ type SummaryStruct struct {
 	ItemBufferPool  BufferPoolSummaryStruct `json:"item_buffer_pool"`
 	ErrorBufferPool BufferPoolSummaryStruct `json:"error_buffer_pool"`
 	NumURL          uint64                  `json:"url_number"`
+	// Health 代表各组件实例的健康状况。仅在启用了健康检查时才有值。
+	Health []module.HealthSummaryStruct `json:"health,omitempty"`
+	// Extras 代表自定义类型与其组件实例的摘要的映射。
+	Extras map[module.Type][]module.SummaryStruct `json:"extras,omitempty"`
+	// Dedup 代表内容去重的计数。仅在启用了内容去重时才有值。
+	Dedup *dedup.Counts `json:"dedup,omitempty"`
+	// DeadLetters 代表本次追加的死信的数量。
+	DeadLetters uint64 `json:"dead_letters,omitempty"`
+	// Recrawl 代表重新爬取的计数。仅在启用了重新爬取时才有值。
+	Recrawl *RecrawlCounts `json:"recrawl,omitempty"`
+	// Frontier 代表使用共享爬取边界的计数。仅在使用了共享爬取边界时才有值。
+	Frontier *FrontierCounts `json:"frontier,omitempty"`
+	// Errors 代表按照类型和原因类别分组的错误统计信息。
+	Errors []errors.ErrorStat `json:"errors,omitempty"`
 }
 
 // Same 用于判断当前的调度器摘要与另一份是否相同。
@@ -76,30 +95,18 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 	if another.Status != one.Status {
 		return false
 	}
-	if another.Downloaders == nil || len(another.Downloaders) != len(one.Downloaders) {
+	if another.Downloaders == nil ||
+		!sameModuleSummaries(another.Downloaders, one.Downloaders) {
 		return false
 	}
-	for i, ds := range another.Downloaders {
-		if ds != one.Downloaders[i] {
-			return false
-		}
-	}
-	if another.Analyzers == nil || len(another.Analyzers) != len(one.Analyzers) {
+	if another.Analyzers == nil ||
+		!sameModuleSummaries(another.Analyzers, one.Analyzers) {
 		return false
 	}
-	for i, as := range another.Analyzers {
-		if as != one.Analyzers[i] {
-			return false
-		}
-	}
-	if another.Pipelines == nil || len(another.Pipelines) != len(one.Pipelines) {
+	if another.Pipelines == nil ||
+		!sameModuleSummaries(another.Pipelines, one.Pipelines) {
 		return false
 	}
-	for i, ps := range another.Pipelines {
-		if ps != one.Pipelines[i] {
-			return false
-		}
-	}
 	if another.ReqBufferPool != one.ReqBufferPool {
 		return false
 	}
@@ -115,6 +122,41 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 	if another.NumURL != one.NumURL {
 		return false
 	}
+	if !reflect.DeepEqual(another.Health, one.Health) {
+		return false
+	}
+	if !reflect.DeepEqual(another.Extras, one.Extras) {
+		return false
+	}
+	if !reflect.DeepEqual(another.Dedup, one.Dedup) {
+		return false
+	}
+	if another.DeadLetters != one.DeadLetters {
+		return false
+	}
+	if !reflect.DeepEqual(another.Recrawl, one.Recrawl) {
+		return false
+	}
+	if !reflect.DeepEqual(another.Frontier, one.Frontier) {
+		return false
+	}
+	if !reflect.DeepEqual(another.Errors, one.Errors) {
+		return false
+	}
+	return true
+}
+
+// sameModuleSummaries 用于判断两组组件摘要是否相同。
+// 组件摘要中的额外信息可能包含切片等不可比较的值，所以需要进行深度比较。
+func sameModuleSummaries(one, another []module.SummaryStruct) bool {
+	if len(one) != len(another) {
+		return false
+	}
+	for i, summary := range one {
+		if !reflect.DeepEqual(summary, another[i]) {
+			return false
+		}
+	}
 	return true
 }
 
@@ -133,6 +175,13 @@ func (ss *mySchedSummary) Struct() SummaryStruct {
 		ItemBufferPool:  getBufferPoolSummary(ss.sched.itemBufferPool),
 		ErrorBufferPool: getBufferPoolSummary(ss.sched.errorBufferPool),
 		NumURL:          ss.sched.urlMap.Len(),
+		Health:          getHealthSummaries(registrar),
+		Extras:          getExtraModuleSummaries(registrar),
+		Dedup:           getDedupSummary(ss.sched.detector),
+		DeadLetters:     getDeadLetterCount(ss.sched.deadLetters),
+		Recrawl:         getRecrawlSummary(ss.sched.recrawler),
+		Frontier:        getFrontierSummary(ss.sched.frontierWorker),
+		Errors:          getErrorStats(ss.sched.errorStats),
 	}
 }
 
@@ -151,16 +200,67 @@ type BufferPoolSummaryStruct struct {
 	MaxBufferNumber uint32 `json:"max_buffer_number"`
 	BufferNumber    uint32 `json:"buffer_number"`
 	Total           uint64 `json:"total"`
+	// Spilled 代表被溢出到磁盘的数据的数量。
+	Spilled uint64 `json:"spilled,omitempty"`
+	// HighWaterMark 代表池中数据总数的历史最大值。
+	HighWaterMark uint64 `json:"high_water_mark,omitempty"`
+	// GrowCount 代表扩容的次数。
+	GrowCount uint64 `json:"grow_count,omitempty"`
+	// ShrinkCount 代表缩容的次数。
+	ShrinkCount uint64 `json:"shrink_count,omitempty"`
+	// BlockedPutTime 代表放入操作因缓冲池已满而等待的总时间。
+	BlockedPutTime time.Duration `json:"blocked_put_time,omitempty"`
+	// BlockedGetTime 代表获取操作因缓冲池已空而等待的总时间。
+	BlockedGetTime time.Duration `json:"blocked_get_time,omitempty"`
 }
 
 // getBufferPoolSummary 用于生成和返回某个数据缓冲池的摘要信息。
 func getBufferPoolSummary(bufferPool buffer.Pool) BufferPoolSummaryStruct {
-	return BufferPoolSummaryStruct{
+	summary := BufferPoolSummaryStruct{
 		BufferCap:       bufferPool.BufferCap(),
 		MaxBufferNumber: bufferPool.MaxBufferNumber(),
 		BufferNumber:    bufferPool.BufferNumber(),
 		Total:           bufferPool.Total(),
 	}
+	stats := bufferPool.Stats()
+	summary.HighWaterMark = stats.HighWaterMark
+	summary.GrowCount = stats.GrowCount
+	summary.ShrinkCount = stats.ShrinkCount
+	summary.BlockedPutTime = stats.BlockedPutTime
+	summary.BlockedGetTime = stats.BlockedGetTime
+	if spiller, ok := bufferPool.(buffer.Spiller); ok {
+		summary.Spilled = spiller.Spilled()
+	}
+	return summary
+}
+
+// getHealthSummaries 用于获取组件实例的健康状况摘要。
+func getHealthSummaries(registrar module.Registrar) []module.HealthSummaryStruct {
+	checker := registrar.HealthChecker()
+	if checker == nil {
+		return nil
+	}
+	return checker.Summary()
+}
+
+// getExtraModuleSummaries 用于获取已注册的自定义类型的组件的摘要。
+// 若没有自定义类型的组件，则返回nil。
+func getExtraModuleSummaries(registrar module.Registrar) map[module.Type][]module.SummaryStruct {
+	var extras map[module.Type][]module.SummaryStruct
+	for _, mType := range module.Types() {
+		if module.BuiltinType(mType) {
+			continue
+		}
+		summaries := getModuleSummaries(registrar, mType)
+		if len(summaries) == 0 {
+			continue
+		}
+		if extras == nil {
+			extras = map[module.Type][]module.SummaryStruct{}
+		}
+		extras[mType] = summaries
+	}
+	return extras
 }
 
 // getModuleSummaries 用于获取已注册的某类组件的摘要。
@@ -180,3 +280,15 @@ func getModuleSummaries(registrar module.Registrar, mType module.Type) []module.
 	}
 	return summaries
 }
+
+// getErrorStats 用于获取错误统计信息。
+func getErrorStats(errorStats errors.Aggregator) []errors.ErrorStat {
+	if errorStats == nil {
+		return nil
+	}
+	stats := errorStats.Stats()
+	if len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
@@ -94,6 +94,18 @@ func TestSummaryStruct(t *testing.T) {
 	}
 	another.Downloaders = make([]module.SummaryStruct, len(one.Downloaders))
 	copy(another.Downloaders, one.Downloaders)
+	// 包含不可比较的额外信息的下载器摘要。
+	one.Downloaders[0].Extra = []string{"extra"}
+	another.Downloaders[0].Extra = []string{"extra"}
+	if !one.Same(another) {
+		t.Fatalf("Different scheduler summaries with same downloader extra summary!")
+	}
+	another.Downloaders[0].Extra = []string{"another"}
+	if one.Same(another) {
+		t.Fatalf("Same scheduler summaries with different downloader extra summary!")
+	}
+	one.Downloaders[0].Extra = nil
+	another.Downloaders[0].Extra = nil
 	// 不同的分析器摘要。
 	another.Analyzers = nil
 	if one.Same(another) {
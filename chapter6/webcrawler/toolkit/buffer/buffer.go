@@ -1,9 +1,11 @@
 package buffer
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 	"gopcp.v2/chapter6/webcrawler/errors"
 )
 
@@ -21,6 +23,24 @@ type Buffer interface {
 	// 注意！本方法应该是非阻塞的。
 	// 若缓冲器已关闭则会直接返回非nil的错误值。
 	Get() (interface{}, error)
+	// PutContext 用于向缓冲器放入数据。
+	// 本方法会一直阻塞，直到数据被放入、缓冲器被关闭或上下文被取消。
+	// 若上下文已被取消则返回其错误值。
+	PutContext(ctx context.Context, datum interface{}) error
+	// GetContext 用于从缓冲器获取数据。
+	// 本方法会一直阻塞，直到获取到数据、缓冲器被关闭或上下文被取消。
+	// 若上下文已被取消则返回其错误值。
+	GetContext(ctx context.Context) (interface{}, error)
+	// TryPut 用于尝试向缓冲器放入数据，其行为与Put相同。
+	TryPut(datum interface{}) (bool, error)
+	// TryGet 用于尝试从缓冲器获取数据，其行为与Get相同。
+	TryGet() (interface{}, error)
+	// PutN 用于向缓冲器依次放入多个数据。
+	// 结果值中的数量代表已被放入的数据的数量。
+	PutN(ctx context.Context, data []interface{}) (int, error)
+	// GetN 用于从缓冲器获取最多max个数据。
+	// 本方法会阻塞到获取到第一个数据为止，之后只会获取当时已有的数据。
+	GetN(ctx context.Context, max uint32) ([]interface{}, error)
 	// Close 用于关闭缓冲器。
 	// 若缓冲器之前已关闭则返回false，否则返回true。
 	Close() bool
@@ -34,6 +54,10 @@ type myBuffer struct {
 	ch chan interface{}
 	// closed 代表缓冲器的关闭状态：0-未关闭；1-已关闭。
 	closed uint32
+	// closedCh 代表在缓冲器关闭时被关闭的通道，用于唤醒阻塞中的放入操作。
+	closedCh chan struct{}
+	// lastActive 代表最近一次成功放入或取出数据的时间，以纳秒为单位。
+	lastActive int64
 	// closingLock 代表为了消除因关闭缓冲器而产生的竞态条件的读写锁。
 	closingLock sync.RWMutex
 }
@@ -46,7 +70,9 @@ func NewBuffer(size uint32) (Buffer, error) {
 		return nil, errors.NewIllegalParameterError(errMsg)
 	}
 	return &myBuffer{
-		ch: make(chan interface{}, size),
+		ch:         make(chan interface{}, size),
+		closedCh:   make(chan struct{}),
+		lastActive: time.Now().UnixNano(),
 	}, nil
 }
 
@@ -66,6 +92,7 @@ func (buf *myBuffer) Put(datum interface{}) (ok bool, err error) {
 	}
 	select {
 	case buf.ch <- datum:
+		buf.touch()
 		ok = true
 	default:
 		ok = false
@@ -79,14 +106,83 @@ func (buf *myBuffer) Get() (interface{}, error) {
 		if !ok {
 			return nil, ErrClosedBuffer
 		}
+		buf.touch()
 		return datum, nil
 	default:
 		return nil, nil
 	}
 }
 
+func (buf *myBuffer) PutContext(ctx context.Context, datum interface{}) error {
+	buf.closingLock.RLock()
+	defer buf.closingLock.RUnlock()
+	if buf.Closed() {
+		return ErrClosedBuffer
+	}
+	select {
+	case buf.ch <- datum:
+		buf.touch()
+		return nil
+	case <-buf.closedCh:
+		return ErrClosedBuffer
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (buf *myBuffer) GetContext(ctx context.Context) (interface{}, error) {
+	select {
+	case datum, ok := <-buf.ch:
+		if !ok {
+			return nil, ErrClosedBuffer
+		}
+		buf.touch()
+		return datum, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (buf *myBuffer) TryPut(datum interface{}) (bool, error) {
+	return buf.Put(datum)
+}
+
+func (buf *myBuffer) TryGet() (interface{}, error) {
+	return buf.Get()
+}
+
+func (buf *myBuffer) PutN(ctx context.Context, data []interface{}) (int, error) {
+	for i, datum := range data {
+		if err := buf.PutContext(ctx, datum); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
+}
+
+func (buf *myBuffer) GetN(ctx context.Context, max uint32) ([]interface{}, error) {
+	if max == 0 {
+		return nil, nil
+	}
+	datum, err := buf.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := []interface{}{datum}
+	for uint32(len(data)) < max {
+		datum, err := buf.Get()
+		if datum == nil || err != nil {
+			break
+		}
+		data = append(data, datum)
+	}
+	return data, nil
+}
+
 func (buf *myBuffer) Close() bool {
 	if atomic.CompareAndSwapUint32(&buf.closed, 0, 1) {
+		// 先唤醒阻塞中的放入操作，以便它们释放读锁。
+		close(buf.closedCh)
 		buf.closingLock.Lock()
 		close(buf.ch)
 		buf.closingLock.Unlock()
@@ -100,4 +196,18 @@ func (buf *myBuffer) Closed() bool {
 		return false
 	}
 	return true
-}
\ No newline at end of file
+}
+
+// touch 用于记录最近一次成功放入或取出数据的时间。
+func (buf *myBuffer) touch() {
+	atomic.StoreInt64(&buf.lastActive, time.Now().UnixNano())
+}
+
+// idleTime 用于获取缓冲器自最近一次成功放入或取出数据以来的空闲时间。
+func idleTime(buf Buffer) time.Duration {
+	b, ok := buf.(*myBuffer)
+	if !ok {
+		return 0
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&b.lastActive)))
+}
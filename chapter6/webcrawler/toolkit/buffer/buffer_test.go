@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -392,3 +393,58 @@ func TestBufferCloseInParallel(t *testing.T) {
 		}
 	})
 }
+
+func TestBufferContext(t *testing.T) {
+	size := uint32(2)
+	buf, err := NewBuffer(size)
+	if err != nil {
+		t.Fatalf("An error occurs when new a buffer: %s (size: %d)",
+			err, size)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := buf.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error when getting from the empty buffer: expected: %v, actual: %v",
+			context.DeadlineExceeded, err)
+	}
+	n, err := buf.PutN(context.Background(), []interface{}{1, 2})
+	if err != nil || n != 2 {
+		t.Fatalf("Couldn't put data to the buffer! (number: %d, error: %v)", n, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	n, err = buf.PutN(ctx, []interface{}{3})
+	if err != context.DeadlineExceeded || n != 0 {
+		t.Fatalf("Inconsistent result when putting to the full buffer: number: %d, error: %v",
+			n, err)
+	}
+	if ok, err := buf.TryPut(3); ok || err != nil {
+		t.Fatalf("Inconsistent result when trying to put to the full buffer: ok: %v, error: %v",
+			ok, err)
+	}
+	data, err := buf.GetN(context.Background(), 5)
+	if err != nil || len(data) != 2 || data[0] != 1 || data[1] != 2 {
+		t.Fatalf("Inconsistent data: expected: %v, actual: %v (error: %v)",
+			[]interface{}{1, 2}, data, err)
+	}
+	if datum, err := buf.TryGet(); datum != nil || err != nil {
+		t.Fatalf("Inconsistent result when trying to get from the empty buffer: datum: %v, error: %v",
+			datum, err)
+	}
+	// 关闭缓冲器会唤醒阻塞中的放入操作。
+	buf.PutN(context.Background(), []interface{}{1, 2})
+	sign := make(chan error, 1)
+	go func() {
+		sign <- buf.PutContext(context.Background(), 3)
+	}()
+	time.Sleep(time.Millisecond)
+	buf.Close()
+	select {
+	case err := <-sign:
+		if err != ErrClosedBuffer {
+			t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBuffer, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The blocked putting has not been woken up after closing!")
+	}
+}
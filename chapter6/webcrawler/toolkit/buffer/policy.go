@@ -0,0 +1,133 @@
+package buffer
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// 伸缩策略的默认值。
+const (
+	// DEFAULT_GROW_FACTOR 代表默认的扩容因子。
+	DEFAULT_GROW_FACTOR = 5
+	// DEFAULT_SHRINK_FACTOR 代表默认的缩容因子。
+	DEFAULT_SHRINK_FACTOR = 10
+)
+
+// PoolPolicy 代表缓冲池的伸缩策略。
+// 字段值为0时会使用相应的默认值。
+type PoolPolicy struct {
+	// GrowFactor 代表扩容因子。
+	// 在一次放入操作中，因缓冲器已满而失败的次数达到缓冲器数量的GrowFactor倍时，
+	// 缓冲池会尝试创建一个新的缓冲器。
+	GrowFactor uint32 `json:"grow_factor,omitempty"`
+	// ShrinkFactor 代表缩容因子。
+	// 在一次获取操作中，因缓冲器已空而失败的次数达到缓冲器数量的ShrinkFactor倍时，
+	// 缓冲池会尝试关闭当前的空缓冲器。
+	ShrinkFactor uint32 `json:"shrink_factor,omitempty"`
+	// MinBufferNumber 代表缓冲器的最小数量，也是初始的缓冲器数量。默认为1。
+	MinBufferNumber uint32 `json:"min_buffer_number,omitempty"`
+	// IdleTimeout 代表空缓冲器可被关闭之前的最短空闲时间。
+	// 值为0时，空缓冲器在满足缩容条件时会被立即关闭。
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+}
+
+// DefaultPoolPolicy 用于获取默认的伸缩策略。
+func DefaultPoolPolicy() PoolPolicy {
+	return PoolPolicy{
+		GrowFactor:      DEFAULT_GROW_FACTOR,
+		ShrinkFactor:    DEFAULT_SHRINK_FACTOR,
+		MinBufferNumber: 1,
+	}
+}
+
+// normalize 用于把未设置的字段替换为默认值。
+func (policy PoolPolicy) normalize() PoolPolicy {
+	defaultPolicy := DefaultPoolPolicy()
+	if policy.GrowFactor == 0 {
+		policy.GrowFactor = defaultPolicy.GrowFactor
+	}
+	if policy.ShrinkFactor == 0 {
+		policy.ShrinkFactor = defaultPolicy.ShrinkFactor
+	}
+	if policy.MinBufferNumber == 0 {
+		policy.MinBufferNumber = defaultPolicy.MinBufferNumber
+	}
+	return policy
+}
+
+// Check 用于检查伸缩策略对于给定的缓冲器最大数量是否有效。
+func (policy PoolPolicy) Check(maxBufferNumber uint32) error {
+	if policy.MinBufferNumber > maxBufferNumber {
+		errMsg := fmt.Sprintf("illegal min buffer number for buffer pool: %d (max: %d)",
+			policy.MinBufferNumber, maxBufferNumber)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	if policy.IdleTimeout < 0 {
+		errMsg := fmt.Sprintf("illegal idle timeout for buffer pool: %s", policy.IdleTimeout)
+		return errors.NewIllegalParameterError(errMsg)
+	}
+	return nil
+}
+
+// PoolStats 代表缓冲池的统计信息。
+type PoolStats struct {
+	// HighWaterMark 代表池中数据总数的历史最大值。
+	HighWaterMark uint64 `json:"high_water_mark"`
+	// GrowCount 代表扩容的次数。
+	GrowCount uint64 `json:"grow_count"`
+	// ShrinkCount 代表缩容的次数。
+	ShrinkCount uint64 `json:"shrink_count"`
+	// BlockedPutTime 代表放入操作因缓冲池已满而等待的总时间。
+	BlockedPutTime time.Duration `json:"blocked_put_time"`
+	// BlockedGetTime 代表获取操作因缓冲池已空而等待的总时间。
+	BlockedGetTime time.Duration `json:"blocked_get_time"`
+}
+
+// poolCounters 代表缓冲池的统计计数器。
+type poolCounters struct {
+	// highWaterMark 代表池中数据总数的历史最大值。
+	highWaterMark uint64
+	// growCount 代表扩容的次数。
+	growCount uint64
+	// shrinkCount 代表缩容的次数。
+	shrinkCount uint64
+	// blockedPutNanos 代表放入操作等待的总纳秒数。
+	blockedPutNanos int64
+	// blockedGetNanos 代表获取操作等待的总纳秒数。
+	blockedGetNanos int64
+}
+
+// updateHighWaterMark 用于在必要时更新数据总数的历史最大值。
+func (counters *poolCounters) updateHighWaterMark(total uint64) {
+	for {
+		mark := atomic.LoadUint64(&counters.highWaterMark)
+		if total <= mark ||
+			atomic.CompareAndSwapUint64(&counters.highWaterMark, mark, total) {
+			return
+		}
+	}
+}
+
+// addBlockedPut 用于累加放入操作等待的时间。
+func (counters *poolCounters) addBlockedPut(start time.Time) {
+	atomic.AddInt64(&counters.blockedPutNanos, int64(time.Since(start)))
+}
+
+// addBlockedGet 用于累加获取操作等待的时间。
+func (counters *poolCounters) addBlockedGet(start time.Time) {
+	atomic.AddInt64(&counters.blockedGetNanos, int64(time.Since(start)))
+}
+
+// stats 用于生成统计信息。
+func (counters *poolCounters) stats() PoolStats {
+	return PoolStats{
+		HighWaterMark:  atomic.LoadUint64(&counters.highWaterMark),
+		GrowCount:      atomic.LoadUint64(&counters.growCount),
+		ShrinkCount:    atomic.LoadUint64(&counters.shrinkCount),
+		BlockedPutTime: time.Duration(atomic.LoadInt64(&counters.blockedPutNanos)),
+		BlockedGetTime: time.Duration(atomic.LoadInt64(&counters.blockedGetNanos)),
+	}
+}
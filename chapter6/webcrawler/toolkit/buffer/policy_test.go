@@ -0,0 +1,99 @@
+package buffer
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPoolPolicy(t *testing.T) {
+	pool, err := NewPool(2, 4, WithPolicy(PoolPolicy{MinBufferNumber: 3}))
+	if err != nil {
+		t.Fatalf("An error occurs when new a buffer pool with policy: %s", err)
+	}
+	policy := pool.Policy()
+	if policy.GrowFactor != DEFAULT_GROW_FACTOR || policy.ShrinkFactor != DEFAULT_SHRINK_FACTOR {
+		t.Fatalf("Inconsistent policy: expected default factors, actual: %#v", policy)
+	}
+	if pool.BufferNumber() != 3 {
+		t.Fatalf("Inconsistent buffer number: expected: %d, actual: %d",
+			3, pool.BufferNumber())
+	}
+	if _, err := NewPool(2, 4, WithPolicy(PoolPolicy{MinBufferNumber: 5})); err == nil {
+		t.Fatal("No error when new a buffer pool with too large min buffer number!")
+	}
+	if _, err := NewPool(2, 4, WithPolicy(PoolPolicy{IdleTimeout: -time.Second})); err == nil {
+		t.Fatal("No error when new a buffer pool with negative idle timeout!")
+	}
+	pool, _ = NewPool(2, 4)
+	if pool.Policy() != DefaultPoolPolicy() {
+		t.Fatalf("Inconsistent policy: expected: %#v, actual: %#v",
+			DefaultPoolPolicy(), pool.Policy())
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	policy := PoolPolicy{GrowFactor: 1, ShrinkFactor: 1, MinBufferNumber: 1}
+	pool, err := NewPool(1, 3, WithPolicy(policy))
+	if err != nil {
+		t.Fatalf("An error occurs when new a buffer pool with policy: %s", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := pool.Put(i); err != nil {
+			t.Fatalf("An error occurs when putting a datum to the buffer pool: %s", err)
+		}
+	}
+	stats := pool.Stats()
+	if stats.GrowCount != 2 || stats.HighWaterMark != 3 || pool.BufferNumber() != 3 {
+		t.Fatalf("Inconsistent stats: %#v (buffer number: %d)", stats, pool.BufferNumber())
+	}
+	// 放入操作会因缓冲池已满而等待。
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		pool.Get()
+	}()
+	if err := pool.Put(4); err != nil {
+		t.Fatalf("An error occurs when putting a datum to the buffer pool: %s", err)
+	}
+	if pool.Stats().BlockedPutTime <= 0 {
+		t.Fatal("The blocked put time has not been counted!")
+	}
+	for i := 0; i < 3; i++ {
+		pool.Get()
+	}
+	// 获取操作会因缓冲池已空而等待，并在此期间关闭多余的空缓冲器。
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", context.DeadlineExceeded, err)
+	}
+	stats = pool.Stats()
+	if stats.BlockedGetTime <= 0 {
+		t.Fatal("The blocked get time has not been counted!")
+	}
+	if stats.ShrinkCount != 2 || pool.BufferNumber() != 1 {
+		t.Fatalf("Inconsistent shrink count: %d (buffer number: %d)",
+			stats.ShrinkCount, pool.BufferNumber())
+	}
+	if stats.HighWaterMark != 3 {
+		t.Fatalf("Inconsistent high water mark: expected: %d, actual: %d",
+			3, stats.HighWaterMark)
+	}
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	policy := PoolPolicy{GrowFactor: 1, ShrinkFactor: 1, IdleTimeout: time.Hour}
+	pool, _ := NewPool(1, 2, WithPolicy(policy))
+	pool.Put(1)
+	pool.Put(2)
+	pool.Get()
+	pool.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	pool.GetContext(ctx)
+	// 缓冲器的空闲时间还未达到IdleTimeout，所以不会被关闭。
+	if pool.BufferNumber() != 2 || pool.Stats().ShrinkCount != 0 {
+		t.Fatalf("The buffer has been closed before idle timeout! (buffer number: %d)",
+			pool.BufferNumber())
+	}
+}
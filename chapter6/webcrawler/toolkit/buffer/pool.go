@@ -1,9 +1,11 @@
 package buffer
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 	"gopcp.v2/chapter6/webcrawler/errors"
 )
 
@@ -25,6 +27,30 @@ type Pool interface {
 	// 注意！本方法应该是阻塞的。
 	// 若缓冲池已关闭则会直接返回非nil的错误值。
 	Get() (datum interface{}, err error)
+	// PutContext 用于向缓冲池放入数据。
+	// 本方法会一直阻塞，直到数据被放入、缓冲池被关闭或上下文被取消。
+	// 若上下文已被取消则返回其错误值。
+	PutContext(ctx context.Context, datum interface{}) error
+	// GetContext 用于从缓冲池获取数据。
+	// 本方法会一直阻塞，直到获取到数据、缓冲池被关闭或上下文被取消。
+	// 若上下文已被取消则返回其错误值。
+	GetContext(ctx context.Context) (datum interface{}, err error)
+	// TryPut 用于尝试向缓冲池放入数据。
+	// 注意！本方法是非阻塞的。若缓冲池已满，则第一个结果值为false。
+	TryPut(datum interface{}) (bool, error)
+	// TryGet 用于尝试从缓冲池获取数据。
+	// 注意！本方法是非阻塞的。若缓冲池已空，则结果值中的数据为nil。
+	TryGet() (datum interface{}, err error)
+	// PutN 用于向缓冲池依次放入多个数据。
+	// 结果值中的数量代表已被放入的数据的数量。
+	PutN(ctx context.Context, data []interface{}) (int, error)
+	// GetN 用于从缓冲池获取最多max个数据。
+	// 本方法会阻塞到获取到第一个数据为止，之后只会获取当时已有的数据。
+	GetN(ctx context.Context, max uint32) ([]interface{}, error)
+	// Policy 用于获取缓冲池的伸缩策略。
+	Policy() PoolPolicy
+	// Stats 用于获取缓冲池的统计信息。
+	Stats() PoolStats
 	// Close 用于关闭缓冲池。
 	// 若缓冲池之前已关闭则返回false，否则返回true。
 	Close() bool
@@ -48,14 +74,35 @@ type myPool struct {
 	closed uint32
 	// lock 代表保护内部共享资源的读写锁。
 	rwlock sync.RWMutex
+	// policy 代表伸缩策略。
+	policy PoolPolicy
+	// counters 代表统计计数器。
+	counters poolCounters
+}
+
+// PoolOption 代表创建数据缓冲池时的可选项。
+type PoolOption func(policy *PoolPolicy)
+
+// WithPolicy 用于生成指定伸缩策略的可选项。
+func WithPolicy(policy PoolPolicy) PoolOption {
+	return func(p *PoolPolicy) {
+		*p = policy
+	}
 }
 
 // NewPool 用于创建一个数据缓冲池。
 // 参数bufferCap  代表池内缓冲器的统一容量。
 // 参数maxBufferNumber  代表池中最多包含的缓冲器的数量。
+// 参数opts 代表可选项。未指定伸缩策略时会使用默认的伸缩策略。
+// 池中初始的缓冲器数量等于伸缩策略中的缓冲器最小数量。
 func NewPool(
 	bufferCap uint32,
-	maxBufferNumber uint32) (Pool, error) {
+	maxBufferNumber uint32,
+	opts ...PoolOption) (Pool, error) {
+	policy := DefaultPoolPolicy()
+	for _, opt := range opts {
+		opt(&policy)
+	}
 	if bufferCap == 0 {
 		errMsg := fmt.Sprintf("illegal buffer cap for buffer pool: %d", bufferCap)
 		return nil, errors.NewIllegalParameterError(errMsg)
@@ -64,14 +111,21 @@ func NewPool(
 		errMsg := fmt.Sprintf("illegal max buffer number for buffer pool: %d", maxBufferNumber)
 		return nil, errors.NewIllegalParameterError(errMsg)
 	}
+	policy = policy.normalize()
+	if err := policy.Check(maxBufferNumber); err != nil {
+		return nil, err
+	}
 	bufCh := make(chan Buffer, maxBufferNumber)
-	buf, _ := NewBuffer(bufferCap)
-	bufCh <- buf
+	for i := uint32(0); i < policy.MinBufferNumber; i++ {
+		buf, _ := NewBuffer(bufferCap)
+		bufCh <- buf
+	}
 	return &myPool{
 		bufferCap:       bufferCap,
 		maxBufferNumber: maxBufferNumber,
-		bufferNumber:    1,
+		bufferNumber:    policy.MinBufferNumber,
 		bufCh:           bufCh,
+		policy:          policy,
 	}, nil
 }
 
@@ -91,20 +145,82 @@ func (pool *myPool) Total() uint64 {
 	return atomic.LoadUint64(&pool.total)
 }
 
-func (pool *myPool) Put(datum interface{}) (err error) {
+func (pool *myPool) Policy() PoolPolicy {
+	return pool.policy
+}
+
+func (pool *myPool) Stats() PoolStats {
+	return pool.counters.stats()
+}
+
+func (pool *myPool) Put(datum interface{}) error {
+	return pool.PutContext(context.Background(), datum)
+}
+
+func (pool *myPool) PutContext(ctx context.Context, datum interface{}) (err error) {
 	if pool.Closed() {
 		return ErrClosedBufferPool
 	}
 	var count uint32
-	maxCount := pool.BufferNumber() * 5
+	maxCount := pool.BufferNumber() * pool.policy.GrowFactor
 	var ok bool
-	for buf := range pool.bufCh {
-		ok, err = pool.putData(buf, datum, &count, maxCount)
-		if ok || err != nil {
-			break
+	// 若第一次尝试未能放入数据，就累计之后等待的时间。
+	start := time.Now()
+	waited := false
+	defer func() {
+		if waited {
+			pool.counters.addBlockedPut(start)
+		}
+	}()
+	for {
+		select {
+		case buf, open := <-pool.bufCh:
+			if !open {
+				return ErrClosedBufferPool
+			}
+			ok, err = pool.putData(buf, datum, &count, maxCount)
+			if ok || err != nil {
+				return
+			}
+			waited = true
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
-	return
+}
+
+func (pool *myPool) TryPut(datum interface{}) (ok bool, err error) {
+	if pool.Closed() {
+		return false, ErrClosedBufferPool
+	}
+	// 每个缓冲器最多尝试一次，都已满时会尝试创建新的缓冲器。
+	var count uint32
+	maxCount := pool.BufferNumber()
+	for i := uint32(0); i < maxCount; i++ {
+		select {
+		case buf, open := <-pool.bufCh:
+			if !open {
+				return false, ErrClosedBufferPool
+			}
+			ok, err = pool.putData(buf, datum, &count, maxCount)
+			if ok || err != nil {
+				return
+			}
+		default:
+			// 所有缓冲器都正在被使用。
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+func (pool *myPool) PutN(ctx context.Context, data []interface{}) (int, error) {
+	for i, datum := range data {
+		if err := pool.PutContext(ctx, datum); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
 }
 
 // putData 用于向给定的缓冲器放入数据，并在必要时把缓冲器归还给池。
@@ -129,7 +245,7 @@ func (pool *myPool) putData(
 
 	ok, err = buf.Put(datum)
 	if ok {
-		atomic.AddUint64(&pool.total, 1)
+		pool.counters.updateHighWaterMark(atomic.AddUint64(&pool.total, 1))
 		return
 	}
 	if err != nil {
@@ -154,7 +270,8 @@ func (pool *myPool) putData(
 			newBuf.Put(datum)
 			pool.bufCh <- newBuf
 			atomic.AddUint32(&pool.bufferNumber, 1)
-			atomic.AddUint64(&pool.total, 1)
+			atomic.AddUint64(&pool.counters.growCount, 1)
+			pool.counters.updateHighWaterMark(atomic.AddUint64(&pool.total, 1))
 			ok = true
 		}
 		pool.rwlock.Unlock()
@@ -164,18 +281,82 @@ func (pool *myPool) putData(
 }
 
 func (pool *myPool) Get() (datum interface{}, err error) {
+	return pool.GetContext(context.Background())
+}
+
+func (pool *myPool) GetContext(ctx context.Context) (datum interface{}, err error) {
 	if pool.Closed() {
 		return nil, ErrClosedBufferPool
 	}
 	var count uint32
-	maxCount := pool.BufferNumber() * 10
-	for buf := range pool.bufCh {
-		datum, err = pool.getData(buf, &count, maxCount)
-		if datum != nil || err != nil {
+	maxCount := pool.BufferNumber() * pool.policy.ShrinkFactor
+	// 若第一次尝试未能获取到数据，就累计之后等待的时间。
+	start := time.Now()
+	waited := false
+	defer func() {
+		if waited {
+			pool.counters.addBlockedGet(start)
+		}
+	}()
+	for {
+		select {
+		case buf, open := <-pool.bufCh:
+			if !open {
+				return nil, ErrClosedBufferPool
+			}
+			datum, err = pool.getData(buf, &count, maxCount)
+			if datum != nil || err != nil {
+				return
+			}
+			waited = true
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (pool *myPool) TryGet() (datum interface{}, err error) {
+	if pool.Closed() {
+		return nil, ErrClosedBufferPool
+	}
+	// 每个缓冲器最多尝试一次。
+	var count uint32
+	bufferNumber := pool.BufferNumber()
+	maxCount := bufferNumber * pool.policy.ShrinkFactor
+	for i := uint32(0); i < bufferNumber; i++ {
+		select {
+		case buf, open := <-pool.bufCh:
+			if !open {
+				return nil, ErrClosedBufferPool
+			}
+			datum, err = pool.getData(buf, &count, maxCount)
+			if datum != nil || err != nil {
+				return
+			}
+		default:
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+func (pool *myPool) GetN(ctx context.Context, max uint32) ([]interface{}, error) {
+	if max == 0 {
+		return nil, nil
+	}
+	datum, err := pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := []interface{}{datum}
+	for uint32(len(data)) < max {
+		datum, err := pool.TryGet()
+		if datum == nil || err != nil {
 			break
 		}
+		data = append(data, datum)
 	}
-	return
+	return data, nil
 }
 
 // getData 用于从给定的缓冲器获取数据，并在必要时把缓冲器归还给池。
@@ -186,13 +367,15 @@ func (pool *myPool) getData(
 	}
 	defer func() {
 		// 如果尝试从缓冲器获取数据的失败次数达到阈值，
-		// 同时当前缓冲器已空且池中缓冲器的数量大于1，
+		// 同时当前缓冲器已空且空闲了足够长的时间，
+		// 并且池中缓冲器的数量大于最小数量，
 		// 那么就直接关掉当前缓冲器，并不归还给池。
 		if *count >= maxCount &&
 			buf.Len() == 0 &&
-			pool.BufferNumber() > 1 {
+			idleTime(buf) >= pool.policy.IdleTimeout &&
+			pool.decrBufferNumber() {
 			buf.Close()
-			atomic.AddUint32(&pool.bufferNumber, ^uint32(0))
+			atomic.AddUint64(&pool.counters.shrinkCount, 1)
 			*count = 0
 			return
 		}
@@ -219,6 +402,20 @@ func (pool *myPool) getData(
 	return
 }
 
+// decrBufferNumber 用于在缓冲器数量大于最小数量时把它减1。
+// 若缓冲器数量已不大于最小数量，则返回false。
+func (pool *myPool) decrBufferNumber() bool {
+	for {
+		number := pool.BufferNumber()
+		if number <= pool.policy.MinBufferNumber {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(&pool.bufferNumber, number, number-1) {
+			return true
+		}
+	}
+}
+
 func (pool *myPool) Close() bool {
 	if !atomic.CompareAndSwapUint32(&pool.closed, 0, 1) {
 		return false
@@ -1,6 +1,7 @@
 package buffer
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"sync"
@@ -508,3 +509,83 @@ func TestPoolCloseInParallel(t *testing.T) {
 		}
 	})
 }
+
+func TestPoolContext(t *testing.T) {
+	bufferCap := uint32(2)
+	maxBufferNumber := uint32(2)
+	pool, err := NewPool(bufferCap, maxBufferNumber)
+	if err != nil {
+		t.Fatalf("An error occurs when new a buffer pool: %s "+
+			"(bufferCap: %d, maxBufferNumber: %d)",
+			err, bufferCap, maxBufferNumber)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error when getting from the empty pool: expected: %v, actual: %v",
+			context.DeadlineExceeded, err)
+	}
+	if datum, err := pool.TryGet(); datum != nil || err != nil {
+		t.Fatalf("Inconsistent result when trying to get from the empty pool: datum: %v, error: %v",
+			datum, err)
+	}
+	// 缓冲器都已满时，TryPut会创建新的缓冲器。
+	for i := 0; i < 4; i++ {
+		ok, err := pool.TryPut(i)
+		if !ok || err != nil {
+			t.Fatalf("Couldn't try to put datum to the pool! (datum: %d, error: %v)", i, err)
+		}
+	}
+	if pool.BufferNumber() != maxBufferNumber || pool.Total() != 4 {
+		t.Fatalf("Inconsistent pool: buffer number: %d, total: %d",
+			pool.BufferNumber(), pool.Total())
+	}
+	if ok, err := pool.TryPut(4); ok || err != nil {
+		t.Fatalf("Inconsistent result when trying to put to the full pool: ok: %v, error: %v",
+			ok, err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	n, err := pool.PutN(ctx, []interface{}{4, 5})
+	if err != context.DeadlineExceeded || n != 0 {
+		t.Fatalf("Inconsistent result when putting to the full pool: number: %d, error: %v",
+			n, err)
+	}
+	data, err := pool.GetN(context.Background(), 3)
+	if err != nil || len(data) != 3 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d (error: %v)",
+			3, len(data), err)
+	}
+	data, err = pool.GetN(context.Background(), 3)
+	if err != nil || len(data) != 1 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d (error: %v)",
+			1, len(data), err)
+	}
+	if pool.Total() != 0 {
+		t.Fatalf("Inconsistent data total: expected: %d, actual: %d", 0, pool.Total())
+	}
+	n, err = pool.PutN(context.Background(), []interface{}{1, 2})
+	if err != nil || n != 2 {
+		t.Fatalf("Couldn't put data to the pool! (number: %d, error: %v)", n, err)
+	}
+	// 关闭缓冲池会唤醒阻塞中的获取操作。
+	pool.GetN(context.Background(), 2)
+	sign := make(chan error, 1)
+	go func() {
+		_, err := pool.GetContext(context.Background())
+		sign <- err
+	}()
+	time.Sleep(time.Millisecond)
+	pool.Close()
+	select {
+	case err := <-sign:
+		if err != ErrClosedBufferPool {
+			t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBufferPool, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The blocked getting has not been woken up after closing!")
+	}
+	if _, err := pool.TryPut(1); err != ErrClosedBufferPool {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBufferPool, err)
+	}
+}
@@ -0,0 +1,486 @@
+package buffer
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopcp.v2/chapter6/webcrawler/errors"
+)
+
+// DEFAULT_SEGMENT_SIZE 代表默认的溢出文件的最大字节数。
+const DEFAULT_SEGMENT_SIZE = 16 << 20
+
+// spillPollInterval 代表等待数据时检查缓冲池的时间间隔。
+const spillPollInterval = 10 * time.Millisecond
+
+// Codec 代表数据编解码器的接口类型。
+type Codec interface {
+	// Encode 用于把数据编码为字节序列。
+	Encode(datum interface{}) ([]byte, error)
+	// Decode 用于从字节序列解码出数据。
+	Decode(p []byte) (interface{}, error)
+}
+
+// SpillOptions 代表溢出缓冲池的选项。
+type SpillOptions struct {
+	// Dir 代表存放溢出文件的目录。每个溢出缓冲池都会在其中创建自己的子目录。
+	Dir string
+	// Codec 代表数据编解码器。
+	Codec Codec
+	// SegmentSize 代表单个溢出文件的最大字节数。
+	// 值为0时使用DEFAULT_SEGMENT_SIZE。
+	SegmentSize int64
+	// Policy 代表内存中的缓冲池的伸缩策略。
+	Policy PoolPolicy
+	// ErrorHandler 代表处理读回数据时发生的错误的函数。
+	// 这些错误不会由获取操作返回，无法被读回的数据会被跳过。值为nil时错误会被忽略。
+	ErrorHandler func(err error)
+}
+
+// Spiller 代表可以把数据溢出到磁盘的缓冲池的接口类型。
+type Spiller interface {
+	// Spilled 用于获取当前被溢出到磁盘的数据的数量。
+	Spilled() uint64
+}
+
+// mySpillPool 代表溢出缓冲池的实现类型。
+// 在内存中的缓冲池已满时，它会把数据依次写入溢出文件，并在之后按顺序读回。
+type mySpillPool struct {
+	// mem 代表内存中的缓冲池。
+	mem Pool
+	// codec 代表数据编解码器。
+	codec Codec
+	// errorHandler 代表处理读回数据时发生的错误的函数。
+	errorHandler func(err error)
+	// dir 代表本缓冲池专用的溢出文件目录。
+	dir string
+	// segmentSize 代表单个溢出文件的最大字节数。
+	segmentSize int64
+	// lock 代表保护溢出文件的互斥锁。
+	lock sync.Mutex
+	// spilled 代表溢出文件中尚未被读回的数据的数量。
+	spilled uint64
+	// counts 代表各个溢出文件中尚未被读回的数据的数量。
+	counts map[uint64]uint64
+	// writeSeq 代表正在写入的溢出文件的序号。
+	writeSeq uint64
+	// writeFile 代表正在写入的溢出文件。
+	writeFile *os.File
+	// writer 代表正在写入的溢出文件的写入器。
+	writer *bufio.Writer
+	// writeSize 代表正在写入的溢出文件的字节数。
+	writeSize int64
+	// readSeq 代表正在读取的溢出文件的序号。
+	readSeq uint64
+	// readFile 代表正在读取的溢出文件。
+	readFile *os.File
+	// reader 代表正在读取的溢出文件的读取器。
+	reader *bufio.Reader
+	// notifyCh 代表在放入数据后发出通知的通道。
+	notifyCh chan struct{}
+	// closedCh 代表在缓冲池关闭时被关闭的通道。
+	closedCh chan struct{}
+	// closed 代表缓冲池的关闭状态：0-未关闭；1-已关闭。
+	closed uint32
+	// counters 代表统计计数器。扩容和缩容的次数由内存中的缓冲池统计。
+	counters poolCounters
+}
+
+// NewSpillPool 用于创建一个溢出缓冲池。
+// 参数bufferCap和maxBufferNumber的含义与NewPool中的相同。
+// 内存中的缓冲池已满时，放入的数据会被编码并写入溢出文件，因此放入操作不会阻塞。
+// 缓冲池关闭时会删除其溢出文件，其中尚未被读回的数据也会随之丢失。
+func NewSpillPool(
+	bufferCap uint32,
+	maxBufferNumber uint32,
+	opts SpillOptions) (Pool, error) {
+	if opts.Dir == "" {
+		return nil, errors.NewIllegalParameterError("empty spill directory")
+	}
+	if opts.Codec == nil {
+		return nil, errors.NewIllegalParameterError("nil codec for spill pool")
+	}
+	if opts.SegmentSize < 0 {
+		errMsg := fmt.Sprintf("illegal segment size for spill pool: %d", opts.SegmentSize)
+		return nil, errors.NewIllegalParameterError(errMsg)
+	}
+	mem, err := NewPool(bufferCap, maxBufferNumber, WithPolicy(opts.Policy))
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	dir, err := ioutil.TempDir(opts.Dir, "spill-")
+	if err != nil {
+		return nil, err
+	}
+	segmentSize := opts.SegmentSize
+	if segmentSize == 0 {
+		segmentSize = DEFAULT_SEGMENT_SIZE
+	}
+	return &mySpillPool{
+		mem:          mem,
+		codec:        opts.Codec,
+		errorHandler: opts.ErrorHandler,
+		counts:       map[uint64]uint64{},
+		dir:          dir,
+		segmentSize:  segmentSize,
+		notifyCh:     make(chan struct{}, 1),
+		closedCh:     make(chan struct{}),
+	}, nil
+}
+
+func (pool *mySpillPool) BufferCap() uint32 {
+	return pool.mem.BufferCap()
+}
+
+func (pool *mySpillPool) MaxBufferNumber() uint32 {
+	return pool.mem.MaxBufferNumber()
+}
+
+func (pool *mySpillPool) BufferNumber() uint32 {
+	return pool.mem.BufferNumber()
+}
+
+func (pool *mySpillPool) Total() uint64 {
+	return pool.mem.Total() + pool.Spilled()
+}
+
+func (pool *mySpillPool) Policy() PoolPolicy {
+	return pool.mem.Policy()
+}
+
+func (pool *mySpillPool) Stats() PoolStats {
+	stats := pool.mem.Stats()
+	ownStats := pool.counters.stats()
+	stats.HighWaterMark = ownStats.HighWaterMark
+	stats.BlockedGetTime = ownStats.BlockedGetTime
+	return stats
+}
+
+func (pool *mySpillPool) Spilled() uint64 {
+	return atomic.LoadUint64(&pool.spilled)
+}
+
+func (pool *mySpillPool) Put(datum interface{}) error {
+	if pool.Closed() {
+		return ErrClosedBufferPool
+	}
+	pool.lock.Lock()
+	// 只要还有数据未被读回，新的数据就要继续写入溢出文件，以保证顺序。
+	if atomic.LoadUint64(&pool.spilled) == 0 {
+		ok, err := pool.mem.TryPut(datum)
+		if ok || err != nil {
+			pool.lock.Unlock()
+			if ok {
+				pool.counters.updateHighWaterMark(pool.Total())
+				pool.notify()
+			}
+			return err
+		}
+	}
+	err := pool.spill(datum)
+	pool.lock.Unlock()
+	if err == nil {
+		pool.counters.updateHighWaterMark(pool.Total())
+		pool.notify()
+	}
+	return err
+}
+
+func (pool *mySpillPool) PutContext(ctx context.Context, datum interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return pool.Put(datum)
+}
+
+func (pool *mySpillPool) TryPut(datum interface{}) (bool, error) {
+	if err := pool.Put(datum); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (pool *mySpillPool) PutN(ctx context.Context, data []interface{}) (int, error) {
+	for i, datum := range data {
+		if err := pool.PutContext(ctx, datum); err != nil {
+			return i, err
+		}
+	}
+	return len(data), nil
+}
+
+func (pool *mySpillPool) Get() (interface{}, error) {
+	return pool.GetContext(context.Background())
+}
+
+func (pool *mySpillPool) GetContext(ctx context.Context) (interface{}, error) {
+	var ticker *time.Ticker
+	var start time.Time
+	for {
+		datum, err := pool.TryGet()
+		if datum != nil || err != nil {
+			if ticker != nil {
+				ticker.Stop()
+				pool.counters.addBlockedGet(start)
+			}
+			return datum, err
+		}
+		if ticker == nil {
+			// 第一次尝试未能获取到数据，开始等待。
+			ticker = time.NewTicker(spillPollInterval)
+			start = time.Now()
+		}
+		select {
+		case <-pool.notifyCh:
+		case <-ticker.C:
+		case <-pool.closedCh:
+			ticker.Stop()
+			pool.counters.addBlockedGet(start)
+			return nil, ErrClosedBufferPool
+		case <-ctx.Done():
+			ticker.Stop()
+			pool.counters.addBlockedGet(start)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (pool *mySpillPool) TryGet() (interface{}, error) {
+	if pool.Closed() {
+		return nil, ErrClosedBufferPool
+	}
+	datum, err := pool.mem.TryGet()
+	if datum != nil || err != nil {
+		return datum, err
+	}
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	if pool.Closed() {
+		return nil, ErrClosedBufferPool
+	}
+	return pool.unspill()
+}
+
+func (pool *mySpillPool) GetN(ctx context.Context, max uint32) ([]interface{}, error) {
+	if max == 0 {
+		return nil, nil
+	}
+	datum, err := pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data := []interface{}{datum}
+	for uint32(len(data)) < max {
+		datum, err := pool.TryGet()
+		if datum == nil || err != nil {
+			break
+		}
+		data = append(data, datum)
+	}
+	return data, nil
+}
+
+func (pool *mySpillPool) Close() bool {
+	if !atomic.CompareAndSwapUint32(&pool.closed, 0, 1) {
+		return false
+	}
+	close(pool.closedCh)
+	pool.mem.Close()
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	pool.closeWriter()
+	pool.closeReader()
+	os.RemoveAll(pool.dir)
+	atomic.StoreUint64(&pool.spilled, 0)
+	pool.counts = map[uint64]uint64{}
+	return true
+}
+
+func (pool *mySpillPool) Closed() bool {
+	return atomic.LoadUint32(&pool.closed) == 1
+}
+
+// notify 用于通知等待中的获取操作。
+func (pool *mySpillPool) notify() {
+	select {
+	case pool.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// segmentPath 用于获取给定序号的溢出文件的路径。
+func (pool *mySpillPool) segmentPath(seq uint64) string {
+	return filepath.Join(pool.dir, fmt.Sprintf("%08d.spill", seq))
+}
+
+// spill 用于把数据写入溢出文件。调用方需持有锁。
+// 每条记录都由长度前缀和编码后的数据组成。
+func (pool *mySpillPool) spill(datum interface{}) error {
+	p, err := pool.codec.Encode(datum)
+	if err != nil {
+		return err
+	}
+	if pool.writeFile == nil {
+		file, err := os.OpenFile(pool.segmentPath(pool.writeSeq),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return err
+		}
+		pool.writeFile = file
+		pool.writer = bufio.NewWriter(file)
+		pool.writeSize = 0
+	}
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(p)))
+	_, err = pool.writer.Write(lenBuf[:n])
+	if err == nil {
+		_, err = pool.writer.Write(p)
+	}
+	if err != nil {
+		// 不完整的记录之后不再写入数据，以免其后的记录无法被读回。
+		pool.closeWriter()
+		pool.writeSeq++
+		return err
+	}
+	pool.writeSize += int64(n + len(p))
+	pool.counts[pool.writeSeq]++
+	atomic.AddUint64(&pool.spilled, 1)
+	if pool.writeSize >= pool.segmentSize {
+		err = pool.closeWriter()
+		pool.writeSeq++
+	}
+	return err
+}
+
+// unspill 用于从溢出文件中按顺序读回一个数据。调用方需持有锁。
+// 若没有被溢出的数据，则结果值中的数据为nil。
+// 无法被解码的数据会被跳过，无法被读取的溢出文件中的剩余数据会被丢弃，
+// 相应的错误会被交给错误处理函数，因此结果值中的错误总是nil。
+func (pool *mySpillPool) unspill() (interface{}, error) {
+	for atomic.LoadUint64(&pool.spilled) > 0 {
+		if pool.counts[pool.readSeq] == 0 {
+			// 当前溢出文件已被读完。
+			pool.closeReader()
+			os.Remove(pool.segmentPath(pool.readSeq))
+			delete(pool.counts, pool.readSeq)
+			pool.readSeq++
+			continue
+		}
+		p, err := pool.readRecord()
+		if err != nil {
+			pool.dropSegment(err)
+			continue
+		}
+		pool.counts[pool.readSeq]--
+		if atomic.AddUint64(&pool.spilled, ^uint64(0)) == 0 {
+			pool.reset()
+		}
+		datum, err := pool.codec.Decode(p)
+		if err != nil {
+			pool.handleError(fmt.Errorf("skip undecodable spilled datum: %w", err))
+			continue
+		}
+		return datum, nil
+	}
+	return nil, nil
+}
+
+// readRecord 用于从正在读取的溢出文件中读出一条记录。调用方需持有锁。
+func (pool *mySpillPool) readRecord() ([]byte, error) {
+	if pool.readSeq == pool.writeSeq && pool.writer != nil {
+		if err := pool.writer.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	if pool.readFile == nil {
+		file, err := os.Open(pool.segmentPath(pool.readSeq))
+		if err != nil {
+			return nil, err
+		}
+		pool.readFile = file
+		pool.reader = bufio.NewReader(file)
+	}
+	length, err := binary.ReadUvarint(pool.reader)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, length)
+	if _, err := io.ReadFull(pool.reader, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// dropSegment 用于在溢出文件无法被读取时丢弃其中剩余的数据。调用方需持有锁。
+func (pool *mySpillPool) dropSegment(err error) {
+	dropped := pool.counts[pool.readSeq]
+	pool.handleError(fmt.Errorf("drop %d spilled data in segment %d: %w",
+		dropped, pool.readSeq, err))
+	if pool.readSeq == pool.writeSeq {
+		pool.closeWriter()
+		pool.writeSeq++
+	}
+	pool.counts[pool.readSeq] = 0
+	if atomic.AddUint64(&pool.spilled, ^(dropped-1)) == 0 {
+		pool.reset()
+	}
+}
+
+// handleError 用于把读回数据时发生的错误交给错误处理函数。
+func (pool *mySpillPool) handleError(err error) {
+	if pool.errorHandler != nil {
+		pool.errorHandler(err)
+	}
+}
+
+// reset 用于在所有被溢出的数据都已读回后删除溢出文件。调用方需持有锁。
+func (pool *mySpillPool) reset() {
+	pool.closeReader()
+	os.Remove(pool.segmentPath(pool.readSeq))
+	if pool.writeFile != nil {
+		pool.closeWriter()
+		os.Remove(pool.segmentPath(pool.writeSeq))
+	}
+	pool.writeSeq++
+	pool.readSeq = pool.writeSeq
+	pool.counts = map[uint64]uint64{}
+}
+
+// closeWriter 用于关闭正在写入的溢出文件。
+func (pool *mySpillPool) closeWriter() error {
+	if pool.writeFile == nil {
+		return nil
+	}
+	err := pool.writer.Flush()
+	if closeErr := pool.writeFile.Close(); err == nil {
+		err = closeErr
+	}
+	pool.writeFile = nil
+	pool.writer = nil
+	return err
+}
+
+// closeReader 用于关闭正在读取的溢出文件。
+func (pool *mySpillPool) closeReader() {
+	if pool.readFile == nil {
+		return
+	}
+	pool.readFile.Close()
+	pool.readFile = nil
+	pool.reader = nil
+}
@@ -0,0 +1,298 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// intCodec 代表测试专用的整数编解码器。
+type intCodec struct{}
+
+func (intCodec) Encode(datum interface{}) ([]byte, error) {
+	return []byte(strconv.Itoa(datum.(int))), nil
+}
+
+func (intCodec) Decode(p []byte) (interface{}, error) {
+	return strconv.Atoi(string(p))
+}
+
+// badCodec 代表测试专用的无法解码13的整数编解码器。
+type badCodec struct {
+	intCodec
+}
+
+func (badCodec) Decode(p []byte) (interface{}, error) {
+	if string(p) == "13" {
+		return nil, errors.New("unlucky number")
+	}
+	return intCodec{}.Decode(p)
+}
+
+// genSpillPool 用于生成测试专用的溢出缓冲池。
+func genSpillPool(t *testing.T, segmentSize int64) (Pool, string) {
+	dir, err := ioutil.TempDir("", "spillpool")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	pool, err := NewSpillPool(2, 1,
+		SpillOptions{Dir: dir, Codec: intCodec{}, SegmentSize: segmentSize})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("An error occurs when new a spill pool: %s", err)
+	}
+	return pool, dir
+}
+
+func TestSpillPoolNew(t *testing.T) {
+	if _, err := NewSpillPool(2, 1, SpillOptions{Codec: intCodec{}}); err == nil {
+		t.Fatal("No error when new a spill pool with empty dir!")
+	}
+	if _, err := NewSpillPool(2, 1, SpillOptions{Dir: os.TempDir()}); err == nil {
+		t.Fatal("No error when new a spill pool with nil codec!")
+	}
+	if _, err := NewSpillPool(2, 1,
+		SpillOptions{Dir: os.TempDir(), Codec: intCodec{}, SegmentSize: -1}); err == nil {
+		t.Fatal("No error when new a spill pool with negative segment size!")
+	}
+	if _, err := NewSpillPool(0, 1,
+		SpillOptions{Dir: os.TempDir(), Codec: intCodec{}}); err == nil {
+		t.Fatal("No error when new a spill pool with zero buffer cap!")
+	}
+}
+
+func TestSpillPoolOrder(t *testing.T) {
+	// 很小的溢出文件，以便测试溢出文件的切换。
+	pool, dir := genSpillPool(t, 8)
+	defer os.RemoveAll(dir)
+	total := 100
+	for i := 0; i < total; i++ {
+		if err := pool.Put(i); err != nil {
+			t.Fatalf("An error occurs when putting a datum to the spill pool: %s (datum: %d)",
+				err, i)
+		}
+	}
+	spiller := pool.(Spiller)
+	if spiller.Spilled() != uint64(total-2) {
+		t.Fatalf("Inconsistent spilled number: expected: %d, actual: %d",
+			total-2, spiller.Spilled())
+	}
+	if pool.Total() != uint64(total) {
+		t.Fatalf("Inconsistent data total: expected: %d, actual: %d", total, pool.Total())
+	}
+	for i := 0; i < total/2; i++ {
+		datum, err := pool.Get()
+		if err != nil {
+			t.Fatalf("An error occurs when getting a datum from the spill pool: %s", err)
+		}
+		if datum != i {
+			t.Fatalf("Inconsistent datum: expected: %d, actual: %v", i, datum)
+		}
+	}
+	// 在读回的过程中继续放入的数据依然会排在后面。
+	for i := total; i < total+10; i++ {
+		pool.Put(i)
+	}
+	data, err := pool.GetN(context.Background(), uint32(total))
+	if err != nil {
+		t.Fatalf("An error occurs when getting data from the spill pool: %s", err)
+	}
+	if len(data) != total/2+10 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d", total/2+10, len(data))
+	}
+	for i, datum := range data {
+		if datum != total/2+i {
+			t.Fatalf("Inconsistent datum: expected: %d, actual: %v", total/2+i, datum)
+		}
+	}
+	if spiller.Spilled() != 0 || pool.Total() != 0 {
+		t.Fatalf("Inconsistent pool: spilled: %d, total: %d", spiller.Spilled(), pool.Total())
+	}
+	// 所有数据都被读回之后，溢出文件会被删除。
+	files, _ := filepath.Glob(filepath.Join(dir, "spill-*", "*.spill"))
+	if len(files) != 0 {
+		t.Fatalf("The spill files have not been removed: %v", files)
+	}
+	// 之后放入的数据会先进入内存。
+	pool.Put(1)
+	if spiller.Spilled() != 0 {
+		t.Fatalf("Inconsistent spilled number: expected: %d, actual: %d", 0, spiller.Spilled())
+	}
+	pool.Close()
+	if _, err := pool.Get(); err != ErrClosedBufferPool {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBufferPool, err)
+	}
+	if err := pool.Put(1); err != ErrClosedBufferPool {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBufferPool, err)
+	}
+	dirs, _ := filepath.Glob(filepath.Join(dir, "spill-*"))
+	if len(dirs) != 0 {
+		t.Fatalf("The spill dir has not been removed: %v", dirs)
+	}
+}
+
+func TestSpillPoolContext(t *testing.T) {
+	pool, dir := genSpillPool(t, 0)
+	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error when getting from the empty pool: expected: %v, actual: %v",
+			context.DeadlineExceeded, err)
+	}
+	if _, err := pool.PutN(ctx, []interface{}{1}); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error when putting with done context: expected: %v, actual: %v",
+			context.DeadlineExceeded, err)
+	}
+	// 放入数据会唤醒等待中的获取操作。
+	result := make(chan interface{}, 1)
+	go func() {
+		datum, _ := pool.Get()
+		result <- datum
+	}()
+	time.Sleep(time.Millisecond)
+	if ok, err := pool.TryPut(7); !ok || err != nil {
+		t.Fatalf("Couldn't try to put datum to the spill pool! (error: %v)", err)
+	}
+	select {
+	case datum := <-result:
+		if datum != 7 {
+			t.Fatalf("Inconsistent datum: expected: %d, actual: %v", 7, datum)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The waiting getting has not been woken up!")
+	}
+	// 关闭缓冲池会唤醒等待中的获取操作。
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := pool.Get()
+		errCh <- err
+	}()
+	time.Sleep(time.Millisecond)
+	pool.Close()
+	select {
+	case err := <-errCh:
+		if err != ErrClosedBufferPool {
+			t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrClosedBufferPool, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The waiting getting has not been woken up after closing!")
+	}
+}
+
+func TestSpillPoolBadRecords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spillpool")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	var errs []error
+	pool, err := NewSpillPool(2, 1, SpillOptions{
+		Dir:          dir,
+		Codec:        badCodec{},
+		ErrorHandler: func(err error) { errs = append(errs, err) },
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when new a spill pool: %s", err)
+	}
+	defer pool.Close()
+	// getAll 用于获取给定数量的数据。
+	getAll := func(number int) []interface{} {
+		var data []interface{}
+		for i := 0; i < number; i++ {
+			datum, err := pool.Get()
+			if err != nil {
+				t.Fatalf("An error occurs when getting datum: %s", err)
+			}
+			data = append(data, datum)
+		}
+		return data
+	}
+	// 无法被解码的数据会被跳过。
+	for _, datum := range []int{1, 2, 3, 13, 4} {
+		pool.Put(datum)
+	}
+	data := getAll(4)
+	expected := []interface{}{1, 2, 3, 4}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("Inconsistent data: expected: %v, actual: %v", expected, data)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	// 无法被读取的溢出文件中的数据会被丢弃，而获取操作不会因此返回错误。
+	for _, datum := range []int{5, 6, 7, 8} {
+		pool.Put(datum)
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*", "*.spill"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	data = getAll(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Inconsistent error when getting dropped data: expected: %v, actual: %v",
+			context.DeadlineExceeded, err)
+	}
+	if len(errs) != 2 || pool.Total() != 0 {
+		t.Fatalf("Inconsistent state: error number: %d, total: %d", len(errs), pool.Total())
+	}
+	// 之后被溢出的数据仍能被正常读回。
+	for _, datum := range []int{9, 10, 11} {
+		pool.Put(datum)
+	}
+	data = append(data, getAll(3)...)
+	expected = []interface{}{5, 6, 9, 10, 11}
+	if !reflect.DeepEqual(data, expected) {
+		t.Fatalf("Inconsistent data: expected: %v, actual: %v", expected, data)
+	}
+}
+
+func TestSpillPoolInParallel(t *testing.T) {
+	pool, dir := genSpillPool(t, 64)
+	defer os.RemoveAll(dir)
+	defer pool.Close()
+	number := 200
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				pool.Put(g*number + i)
+			}
+		}(g)
+	}
+	marks := make([]int, 4*number)
+	var lock sync.Mutex
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < number; i++ {
+				datum, err := pool.Get()
+				if err != nil {
+					t.Errorf("An error occurs when getting a datum from the spill pool: %s", err)
+					return
+				}
+				lock.Lock()
+				marks[datum.(int)]++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	for i, m := range marks {
+		if m != 1 {
+			t.Fatalf("Inconsistent count of datum %d: expected: %d, actual: %d", i, 1, m)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package charset
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// UTF8 代表UTF-8字符集的规范名称。
+const UTF8 = "utf-8"
+
+// 字符集的来源。
+const (
+	// SOURCE_BOM 代表字符集来自字节顺序标记。
+	SOURCE_BOM = "bom"
+	// SOURCE_HEADER 代表字符集来自HTTP响应头中的Content-Type。
+	SOURCE_HEADER = "header"
+	// SOURCE_META 代表字符集来自HTML中的meta标签。
+	SOURCE_META = "meta"
+)
+
+// ErrUnsupportedCharset 代表不支持的字符集的错误。
+var ErrUnsupportedCharset = errors.New("unsupported charset")
+
+// Decoder 代表解码器的类型。
+// 它需要返回一个读取器，从该读取器读出的数据都应该是UTF-8编码的。
+type Decoder func(reader io.Reader) io.Reader
+
+// aliasMap 代表字符集别名与规范名称的映射。
+var aliasMap = map[string]string{
+	"utf8":              UTF8,
+	"unicode-1-1-utf-8": UTF8,
+	"utf-16":            "utf-16le",
+	"utf16":             "utf-16le",
+	"utf-16le":          "utf-16le",
+	"utf-16be":          "utf-16be",
+	"latin1":            "iso-8859-1",
+	"latin-1":           "iso-8859-1",
+	"l1":                "iso-8859-1",
+	"iso8859-1":         "iso-8859-1",
+	"iso_8859-1":        "iso-8859-1",
+	"iso-8859-1":        "iso-8859-1",
+	"us-ascii":          "windows-1252",
+	"ascii":             "windows-1252",
+	"cp1252":            "windows-1252",
+	"x-cp1252":          "windows-1252",
+	"windows-1252":      "windows-1252",
+	"gb2312":            "gbk",
+	"x-gbk":             "gbk",
+	"cp936":             "gbk",
+	"windows-936":       "gbk",
+	"gbk":               "gbk",
+	"gb18030":           "gb18030",
+	"big5":              "big5",
+	"big5-hkscs":        "big5",
+	"x-x-big5":          "big5",
+	"cn-big5":           "big5",
+	"shift_jis":         "shift_jis",
+	"shift-jis":         "shift_jis",
+	"sjis":              "shift_jis",
+	"x-sjis":            "shift_jis",
+	"ms_kanji":          "shift_jis",
+	"windows-31j":       "shift_jis",
+	"csshiftjis":        "shift_jis",
+}
+
+// decoderMap 代表字符集规范名称与解码器的映射。
+// 多字节字符集的解码器见multibyte.go。
+var decoderMap = map[string]Decoder{
+	UTF8:           newUTF8Reader,
+	"utf-16le":     func(r io.Reader) io.Reader { return newUTF16Reader(r, false) },
+	"utf-16be":     func(r io.Reader) io.Reader { return newUTF16Reader(r, true) },
+	"iso-8859-1":   func(r io.Reader) io.Reader { return newSingleByteReader(r, nil) },
+	"windows-1252": func(r io.Reader) io.Reader { return newSingleByteReader(r, &windows1252Table) },
+}
+
+// rwlock 代表解码器映射的专用读写锁。
+var rwlock sync.RWMutex
+
+// Normalize 用于获取给定字符集名称的规范形式。
+// 未知的字符集名称会被转换为小写后返回。
+func Normalize(charset string) string {
+	name := strings.ToLower(strings.Trim(strings.TrimSpace(charset), `"'`))
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	if canonical, ok := aliasMap[name]; ok {
+		return canonical
+	}
+	return name
+}
+
+// RegisterDecoder 用于注册某个字符集的解码器。
+// 已内置的解码器包括UTF-8、UTF-16、ISO-8859-1、Windows-1252、GBK、GB18030、Big5和Shift_JIS，
+// 使用方可以借助golang.org/x/text/encoding等库注册其他字符集的解码器，或替换内置的解码器。
+// 参数aliases代表该字符集的别名列表，可以为nil。
+func RegisterDecoder(charset string, aliases []string, decoder Decoder) error {
+	name := Normalize(charset)
+	if name == "" {
+		return fmt.Errorf("charset: empty charset name")
+	}
+	if decoder == nil {
+		return fmt.Errorf("charset: nil decoder (charset: %s)", name)
+	}
+	rwlock.Lock()
+	defer rwlock.Unlock()
+	decoderMap[name] = decoder
+	aliasMap[name] = name
+	for _, alias := range aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if alias != "" {
+			aliasMap[alias] = name
+		}
+	}
+	return nil
+}
+
+// Supported 用于判断给定的字符集是否受支持。
+func Supported(charset string) bool {
+	name := Normalize(charset)
+	rwlock.RLock()
+	defer rwlock.RUnlock()
+	_, ok := decoderMap[name]
+	return ok
+}
+
+// NewReader 用于创建一个把给定字符集的数据转换为UTF-8数据的读取器。
+func NewReader(reader io.Reader, charset string) (io.Reader, error) {
+	name := Normalize(charset)
+	rwlock.RLock()
+	decoder, ok := decoderMap[name]
+	rwlock.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%s: %s", ErrUnsupportedCharset, charset)
+	}
+	return decoder(reader), nil
+}
+
+// regexpForMeta 代表用于在HTML中查找字符集声明的正则表达式。
+// 可匹配<meta charset="...">和<meta http-equiv="Content-Type" content="...; charset=...">两种形式。
+var regexpForMeta = regexp.MustCompile(
+	`(?i)<meta\s[^>]*?charset\s*=\s*["']?\s*([a-zA-Z0-9_:.\-]+)`)
+
+// Detect 用于检测数据的字符集。
+// 检测的依据依次是字节顺序标记、Content-Type以及HTML中的meta标签。
+// 参数head代表数据的开头部分，一般取前1024个字节即可。
+// 结果值依次代表字符集的规范名称和它的来源。若未检测到，则都为空字符串。
+func Detect(contentType string, head []byte) (charset string, source string) {
+	if bomCharset, _ := detectBOM(head); bomCharset != "" {
+		return bomCharset, SOURCE_BOM
+	}
+	if contentType != "" {
+		if _, params, err := mime.ParseMediaType(contentType); err == nil {
+			if cs := params["charset"]; cs != "" {
+				return Normalize(cs), SOURCE_HEADER
+			}
+		}
+	}
+	if matches := regexpForMeta.FindSubmatch(head); matches != nil {
+		return Normalize(string(matches[1])), SOURCE_META
+	}
+	return "", ""
+}
+
+// detectBOM 用于根据字节顺序标记检测字符集。
+// 第二个结果值代表字节顺序标记的长度。
+func detectBOM(head []byte) (string, int) {
+	switch {
+	case bytes.HasPrefix(head, []byte{0xEF, 0xBB, 0xBF}):
+		return UTF8, 3
+	case bytes.HasPrefix(head, []byte{0xFF, 0xFE}):
+		return "utf-16le", 2
+	case bytes.HasPrefix(head, []byte{0xFE, 0xFF}):
+		return "utf-16be", 2
+	}
+	return "", 0
+}
+
+// IsText 用于判断给定的内容类型是否代表需要转码的文本。
+func IsText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/xhtml+xml", "application/xml", "application/json",
+		"application/javascript":
+		return true
+	}
+	return false
+}
+
+// ReplaceCharset 用于把给定的内容类型中的字符集参数替换为指定的字符集。
+func ReplaceCharset(contentType string, charset string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	params["charset"] = charset
+	return mime.FormatMediaType(mediaType, params)
+}
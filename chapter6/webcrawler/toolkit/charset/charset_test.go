@@ -0,0 +1,145 @@
+package charset
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"UTF-8":        UTF8,
+		" utf8 ":       UTF8,
+		`"GB2312"`:     "gbk",
+		"Latin1":       "iso-8859-1",
+		"Shift_JIS":    "shift_jis",
+		"x-sjis":       "shift_jis",
+		"Big5":         "big5",
+		"x-unknown-cs": "x-unknown-cs",
+	}
+	for name, expected := range cases {
+		if actual := Normalize(name); actual != expected {
+			t.Fatalf("Inconsistent normalized charset for %q: expected: %s, actual: %s",
+				name, expected, actual)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		contentType    string
+		head           string
+		expectedCS     string
+		expectedSource string
+	}{
+		{"text/html; charset=GBK", "<html>", "gbk", SOURCE_HEADER},
+		{"text/html", `<html><head><meta charset="big5"></head>`, "big5", SOURCE_META},
+		{"text/html",
+			`<meta http-equiv="Content-Type" content="text/html; charset=Shift_JIS">`,
+			"shift_jis", SOURCE_META},
+		{"text/html; charset=gbk", "\xEF\xBB\xBF<html>", UTF8, SOURCE_BOM},
+		{"text/html", "\xFF\xFE<\x00", "utf-16le", SOURCE_BOM},
+		{"text/html", "<html></html>", "", ""},
+	}
+	for _, c := range cases {
+		cs, source := Detect(c.contentType, []byte(c.head))
+		if cs != c.expectedCS || source != c.expectedSource {
+			t.Fatalf("Inconsistent detection for %q and %q: expected: %s (%s), actual: %s (%s)",
+				c.contentType, c.head, c.expectedCS, c.expectedSource, cs, source)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	cases := []struct {
+		charset  string
+		data     []byte
+		expected string
+	}{
+		{"utf-8", []byte("\xEF\xBB\xBFhello, 世界"), "hello, 世界"},
+		{"iso-8859-1", []byte("caf\xE9 na\xEFve"), "café naïve"},
+		{"windows-1252", []byte("\x93quoted\x94 \x80"), "“quoted” €"},
+		{"utf-16le", []byte{0xFF, 0xFE, 'h', 0, 'i', 0, 0x16, 0x4E, 0x3D, 0xD8, 0x00, 0xDE},
+			"hi世😀"},
+		{"utf-16be", []byte{0, 'h', 0, 'i', 0x4E, 0x16}, "hi世"},
+		{"gbk", []byte("\xD6\xD0\xCE\xC4 abc"), "中文 abc"},
+		{"gb2312", []byte("\xC4\xE3\xBA\xC3"), "你好"},
+		{"gb18030", []byte("\xD6\xD0\x81\x30\x81\x30"), "中\u0080"},
+		{"big5", []byte("\xA4\xA4\xA4\xE5 abc"), "中文 abc"},
+		{"shift_jis", []byte("\x93\xFA\x96\x7B\x8C\xEA abc"), "日本語 abc"},
+		{"sjis", []byte("\x82\xA0\xB1"), "あｱ"},
+	}
+	for _, c := range cases {
+		r, err := NewReader(bytes.NewReader(c.data), c.charset)
+		if err != nil {
+			t.Fatalf("An error occurs when creating reader for charset %s: %s",
+				c.charset, err)
+		}
+		// 使用很小的缓冲区读取，以覆盖多字节字符被截断的情况。
+		var buf bytes.Buffer
+		p := make([]byte, 1)
+		for {
+			n, err := r.Read(p)
+			buf.Write(p[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("An error occurs when reading data (charset: %s): %s",
+					c.charset, err)
+			}
+		}
+		if buf.String() != c.expected {
+			t.Fatalf("Inconsistent decoded data for charset %s: expected: %q, actual: %q",
+				c.charset, c.expected, buf.String())
+		}
+	}
+	if _, err := NewReader(strings.NewReader(""), "euc-kr"); err == nil {
+		t.Fatal("No error when creating reader for unregistered charset!")
+	}
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	if err := RegisterDecoder("", nil, newUTF8Reader); err == nil {
+		t.Fatal("No error when registering decoder with empty charset!")
+	}
+	if err := RegisterDecoder("x-test", nil, nil); err == nil {
+		t.Fatal("No error when registering nil decoder!")
+	}
+	upper := func(r io.Reader) io.Reader {
+		data, _ := ioutil.ReadAll(r)
+		return strings.NewReader(strings.ToUpper(string(data)))
+	}
+	if err := RegisterDecoder("x-test", []string{"x-test-alias"}, upper); err != nil {
+		t.Fatalf("An error occurs when registering decoder: %s", err)
+	}
+	if !Supported("X-Test-Alias") {
+		t.Fatal("The registered charset is unsupported!")
+	}
+	r, _ := NewReader(strings.NewReader("abc"), "x-test-alias")
+	data, _ := ioutil.ReadAll(r)
+	if string(data) != "ABC" {
+		t.Fatalf("Inconsistent decoded data: expected: %s, actual: %s", "ABC", data)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	textTypes := []string{"text/html; charset=gbk", "text/plain", "application/xhtml+xml"}
+	for _, ct := range textTypes {
+		if !IsText(ct) {
+			t.Fatalf("%q should be a text content type!", ct)
+		}
+	}
+	nonTextTypes := []string{"image/png", "application/octet-stream", ""}
+	for _, ct := range nonTextTypes {
+		if IsText(ct) {
+			t.Fatalf("%q should not be a text content type!", ct)
+		}
+	}
+	expected := "text/html; charset=utf-8"
+	if actual := ReplaceCharset("text/html; charset=GBK", UTF8); actual != expected {
+		t.Fatalf("Inconsistent content type: expected: %s, actual: %s", expected, actual)
+	}
+}
@@ -0,0 +1,127 @@
+package charset
+
+import (
+	"bufio"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodeReader 代表逐个字符解码的读取器。
+type decodeReader struct {
+	// src 代表源数据的读取器。
+	src *bufio.Reader
+	// next 代表用于解码下一个字符的函数。
+	next func(src *bufio.Reader) (rune, error)
+	// pending 代表已解码但尚未被读取的UTF-8数据。
+	pending []byte
+	// err 代表读取源数据时遇到的错误。
+	err error
+}
+
+func (dr *decodeReader) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		if len(dr.pending) > 0 {
+			c := copy(p[n:], dr.pending)
+			dr.pending = dr.pending[c:]
+			n += c
+			continue
+		}
+		if dr.err != nil {
+			break
+		}
+		r, err := dr.next(dr.src)
+		if err != nil {
+			dr.err = err
+			continue
+		}
+		var buf [utf8.UTFMax]byte
+		size := utf8.EncodeRune(buf[:], r)
+		c := copy(p[n:], buf[:size])
+		n += c
+		if c < size {
+			dr.pending = append(dr.pending[:0], buf[c:size]...)
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, dr.err
+}
+
+// newUTF8Reader 用于创建去除了字节顺序标记的UTF-8读取器。
+func newUTF8Reader(reader io.Reader) io.Reader {
+	br := bufio.NewReader(reader)
+	if head, err := br.Peek(3); err == nil {
+		if _, size := detectBOM(head); size == 3 {
+			br.Discard(size)
+		}
+	}
+	return br
+}
+
+// newUTF16Reader 用于创建把UTF-16数据转换为UTF-8数据的读取器。
+// 字节顺序标记会被去除，并且它指示的字节序会优先于参数bigEndian。
+func newUTF16Reader(reader io.Reader, bigEndian bool) io.Reader {
+	br := bufio.NewReader(reader)
+	if head, err := br.Peek(2); err == nil {
+		if cs, size := detectBOM(head); size == 2 {
+			bigEndian = cs == "utf-16be"
+			br.Discard(size)
+		}
+	}
+	readUnit := func(src *bufio.Reader) (uint16, error) {
+		var b [2]byte
+		if _, err := io.ReadFull(src, b[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				return utf8.RuneError, nil
+			}
+			return 0, err
+		}
+		if bigEndian {
+			return uint16(b[0])<<8 | uint16(b[1]), nil
+		}
+		return uint16(b[1])<<8 | uint16(b[0]), nil
+	}
+	next := func(src *bufio.Reader) (rune, error) {
+		unit, err := readUnit(src)
+		if err != nil {
+			return 0, err
+		}
+		r := rune(unit)
+		if !utf16.IsSurrogate(r) {
+			return r, nil
+		}
+		unit2, err := readUnit(src)
+		if err != nil {
+			return utf8.RuneError, nil
+		}
+		return utf16.DecodeRune(r, rune(unit2)), nil
+	}
+	return &decodeReader{src: br, next: next}
+}
+
+// newSingleByteReader 用于创建把单字节字符集的数据转换为UTF-8数据的读取器。
+// 参数table代表0x80~0x9F之间字节的对照表。若它为nil，则按照ISO-8859-1处理。
+func newSingleByteReader(reader io.Reader, table *[32]rune) io.Reader {
+	next := func(src *bufio.Reader) (rune, error) {
+		b, err := src.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if table != nil && b >= 0x80 && b <= 0x9F {
+			return table[b-0x80], nil
+		}
+		return rune(b), nil
+	}
+	return &decodeReader{src: bufio.NewReader(reader), next: next}
+}
+
+// windows1252Table 代表Windows-1252中0x80~0x9F之间字节的对照表。
+var windows1252Table = [32]rune{
+	'€', '�', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '�', 'Ž', '�',
+	'�', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '�', 'ž', 'Ÿ',
+}
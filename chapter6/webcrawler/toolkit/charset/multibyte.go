@@ -0,0 +1,26 @@
+package charset
+
+import (
+	"io"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+	"golang.org/x/text/transform"
+)
+
+// newEncodingDecoder 用于生成基于给定编码的解码器。
+// GBK、GB18030、Big5和Shift_JIS等多字节字符集的解码器都由它生成。
+func newEncodingDecoder(enc encoding.Encoding) Decoder {
+	return func(reader io.Reader) io.Reader {
+		return transform.NewReader(reader, enc.NewDecoder())
+	}
+}
+
+func init() {
+	decoderMap["gbk"] = newEncodingDecoder(simplifiedchinese.GBK)
+	decoderMap["gb18030"] = newEncodingDecoder(simplifiedchinese.GB18030)
+	decoderMap["big5"] = newEncodingDecoder(traditionalchinese.Big5)
+	decoderMap["shift_jis"] = newEncodingDecoder(japanese.ShiftJIS)
+}
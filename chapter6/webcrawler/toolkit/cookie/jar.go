@@ -0,0 +1,213 @@
+package cookie
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry 代表可持久化的cookie条目。
+// 它也是cookie文件中的条目格式，详见Manager的说明。
+type Entry struct {
+	// Name 代表cookie的名称。
+	Name string `json:"name"`
+	// Value 代表cookie的值。
+	Value string `json:"value"`
+	// Domain 代表cookie所属的域名，不含开头的点。
+	Domain string `json:"domain"`
+	// Path 代表cookie的路径。
+	Path string `json:"path"`
+	// Expires 代表过期时间。若为零值，则代表会话cookie。
+	Expires time.Time `json:"expires,omitempty"`
+	// Secure 代表是否仅通过HTTPS发送。
+	Secure bool `json:"secure,omitempty"`
+	// HttpOnly 代表是否禁止脚本访问。
+	HttpOnly bool `json:"http_only,omitempty"`
+	// HostOnly 代表是否仅发送给Domain本身而不包括其子域名。
+	HostOnly bool `json:"host_only,omitempty"`
+}
+
+// key 用于获取条目的唯一标识。
+func (entry Entry) key() string {
+	return entry.Domain + ";" + entry.Path + ";" + entry.Name
+}
+
+// url 用于获取可以设置和获取该条目的URL。
+func (entry Entry) url() *url.URL {
+	scheme := "http"
+	if entry.Secure {
+		scheme = "https"
+	}
+	path := entry.Path
+	if path == "" {
+		path = "/"
+	}
+	return &url.URL{Scheme: scheme, Host: entry.Domain, Path: path}
+}
+
+// expired 用于判断条目在给定时间是否已过期。
+func (entry Entry) expired(now time.Time) bool {
+	return !entry.Expires.IsZero() && !entry.Expires.After(now)
+}
+
+// Jar 代表可导出和导入cookie的http.CookieJar。
+// 该接口的实现类型必须是并发安全的！
+type Jar interface {
+	http.CookieJar
+	// Entries 用于获取所有未过期的cookie条目。
+	Entries() []Entry
+	// Load 用于把给定的cookie条目加入到当前的cookie jar中。
+	// 已过期的条目会被忽略。
+	Load(entries []Entry)
+}
+
+// NewJar 用于创建一个可导出和导入cookie的Jar。
+func NewJar() Jar {
+	return &myJar{
+		jar:     NewCookiejar(),
+		entries: map[string]Entry{},
+	}
+}
+
+// myJar 代表Jar接口的实现类型。
+// 它在标准库的cookie jar之外记录了所有被其接受的cookie以便导出。
+type myJar struct {
+	// jar 代表实际使用的cookie jar。
+	jar http.CookieJar
+	// entries 代表已记录的cookie条目。
+	entries map[string]Entry
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (j *myJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.jar.SetCookies(u, cookies)
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, cookie := range cookies {
+		entry, ok := newEntry(u, cookie, now)
+		if !ok {
+			continue
+		}
+		if entry.expired(now) {
+			// 只有在实际使用的cookie jar确实删除了该cookie时才删除条目。
+			if existing, ok := j.entries[entry.key()]; ok && !j.accepted(existing) {
+				delete(j.entries, entry.key())
+			}
+			continue
+		}
+		if !j.accepted(entry) {
+			continue
+		}
+		j.entries[entry.key()] = entry
+	}
+}
+
+// accepted 用于判断实际使用的cookie jar是否持有给定的条目。
+// 被拒绝的cookie（比如其Domain属性与请求URL的域名不匹配或是公共后缀）不会被记录，
+// 否则它们在被导出并重新载入之后就会被当作Domain所属的站点设置的cookie。
+func (j *myJar) accepted(entry Entry) bool {
+	for _, cookie := range j.jar.Cookies(entry.url()) {
+		if cookie.Name == entry.Name && cookie.Value == entry.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *myJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.jar.Cookies(u)
+}
+
+func (j *myJar) Entries() []Entry {
+	now := time.Now()
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	entries := make([]Entry, 0, len(j.entries))
+	for key, entry := range j.entries {
+		if entry.expired(now) {
+			delete(j.entries, key)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, k int) bool {
+		return entries[i].key() < entries[k].key()
+	})
+	return entries
+}
+
+func (j *myJar) Load(entries []Entry) {
+	now := time.Now()
+	for _, entry := range entries {
+		if entry.Name == "" || entry.Domain == "" || entry.expired(now) {
+			continue
+		}
+		u := entry.url()
+		cookie := &http.Cookie{
+			Name:     entry.Name,
+			Value:    entry.Value,
+			Path:     u.Path,
+			Expires:  entry.Expires,
+			Secure:   entry.Secure,
+			HttpOnly: entry.HttpOnly,
+		}
+		if !entry.HostOnly {
+			cookie.Domain = entry.Domain
+		}
+		j.SetCookies(u, []*http.Cookie{cookie})
+	}
+}
+
+// newEntry 用于根据请求URL和响应中的cookie生成条目。
+// 第二个结果值为false即代表该cookie无效。
+func newEntry(u *url.URL, cookie *http.Cookie, now time.Time) (Entry, bool) {
+	if u == nil || cookie == nil || cookie.Name == "" {
+		return Entry{}, false
+	}
+	entry := Entry{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+	}
+	domain := strings.ToLower(strings.TrimPrefix(cookie.Domain, "."))
+	if domain == "" {
+		entry.Domain = strings.ToLower(u.Hostname())
+		entry.HostOnly = true
+	} else {
+		entry.Domain = domain
+	}
+	if entry.Domain == "" {
+		return Entry{}, false
+	}
+	entry.Path = cookie.Path
+	if entry.Path == "" || entry.Path[0] != '/' {
+		entry.Path = defaultPath(u.Path)
+	}
+	switch {
+	case cookie.MaxAge < 0:
+		entry.Expires = time.Unix(1, 0)
+	case cookie.MaxAge > 0:
+		entry.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	default:
+		entry.Expires = cookie.Expires
+	}
+	return entry, true
+}
+
+// defaultPath 用于获取给定URL路径对应的默认cookie路径。
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
@@ -0,0 +1,91 @@
+package cookie
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestJar(t *testing.T) {
+	jar := NewJar()
+	u, _ := url.Parse("http://www.example.com/account/login")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "sid", Value: "abc", HttpOnly: true},
+		{Name: "lang", Value: "zh", Domain: ".example.com", Path: "/",
+			Expires: time.Now().Add(time.Hour)},
+		{Name: "tmp", Value: "1", MaxAge: 60},
+	})
+	entries := jar.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("Inconsistent entry number: expected: %d, actual: %d", 3, len(entries))
+	}
+	for _, entry := range entries {
+		switch entry.Name {
+		case "sid":
+			if entry.Domain != "www.example.com" || !entry.HostOnly ||
+				entry.Path != "/account" || !entry.HttpOnly || !entry.Expires.IsZero() {
+				t.Fatalf("Inconsistent entry: %#v", entry)
+			}
+		case "lang":
+			if entry.Domain != "example.com" || entry.HostOnly || entry.Path != "/" {
+				t.Fatalf("Inconsistent entry: %#v", entry)
+			}
+		case "tmp":
+			if entry.Expires.IsZero() {
+				t.Fatalf("Inconsistent expiration for max-age cookie: %#v", entry)
+			}
+		}
+	}
+	// 删除cookie。
+	jar.SetCookies(u, []*http.Cookie{{Name: "tmp", Value: "", MaxAge: -1}})
+	if len(jar.Entries()) != 2 {
+		t.Fatalf("Inconsistent entry number: expected: %d, actual: %d", 2, len(jar.Entries()))
+	}
+	// 导入到新的cookie jar后，cookie应该能被正常发送。
+	jar2 := NewJar()
+	jar2.Load(jar.Entries())
+	subURL, _ := url.Parse("http://img.example.com/")
+	cookies := jar2.Cookies(subURL)
+	if len(cookies) != 1 || cookies[0].Name != "lang" {
+		t.Fatalf("Inconsistent cookies for %s: %v", subURL, cookies)
+	}
+	accountURL, _ := url.Parse("http://www.example.com/account/profile")
+	if cookies := jar2.Cookies(accountURL); len(cookies) != 2 {
+		t.Fatalf("Inconsistent cookie number for %s: expected: %d, actual: %d",
+			accountURL, 2, len(cookies))
+	}
+	jar2.Load([]Entry{{Name: "old", Value: "1", Domain: "example.com",
+		Expires: time.Now().Add(-time.Hour)}})
+	if len(jar2.Entries()) != 2 {
+		t.Fatal("The expired entry has been loaded!")
+	}
+}
+
+func TestJarRejectedCookies(t *testing.T) {
+	jar := NewJar()
+	u, _ := url.Parse("http://evil.example.org/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "sid", Value: "evil", Domain: "bank.com", Path: "/"},
+		{Name: "suffix", Value: "1", Domain: "org", Path: "/"},
+		{Name: "lang", Value: "zh", Domain: "example.org", Path: "/"},
+	})
+	entries := jar.Entries()
+	if len(entries) != 1 || entries[0].Name != "lang" {
+		t.Fatalf("Inconsistent entries: expected: [lang], actual: %v", entries)
+	}
+	// 被拒绝的cookie在导出并重新载入后也不会被发送给Domain所属的站点。
+	jar2 := NewJar()
+	jar2.Load(entries)
+	bankURL, _ := url.Parse("http://bank.com/")
+	if cookies := jar2.Cookies(bankURL); len(cookies) != 0 {
+		t.Fatalf("Inconsistent cookies for %s: expected: [], actual: %v", bankURL, cookies)
+	}
+	// 被拒绝的删除操作不会删除已记录的条目。
+	other, _ := url.Parse("http://other.net/")
+	jar.SetCookies(other, []*http.Cookie{
+		{Name: "lang", Value: "", Domain: "example.org", Path: "/", MaxAge: -1}})
+	if len(jar.Entries()) != 1 {
+		t.Fatalf("Inconsistent entry number: expected: %d, actual: %d", 1, len(jar.Entries()))
+	}
+}
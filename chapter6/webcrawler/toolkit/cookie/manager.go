@@ -0,0 +1,242 @@
+package cookie
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FILE_VERSION 代表cookie文件格式的版本。
+const FILE_VERSION = 1
+
+// FileStruct 代表cookie文件的内容结构。
+// cookie文件是JSON格式的，例如：
+//
+//	{
+//	  "version": 1,
+//	  "session": "alice",
+//	  "saved_at": "2017-01-01T08:00:00Z",
+//	  "cookies": [
+//	    {"name": "sid", "value": "abc", "domain": "example.com", "path": "/",
+//	     "expires": "2017-02-01T08:00:00Z", "secure": true, "http_only": true}
+//	  ]
+//	}
+//
+// 其中，会话cookie（没有expires字段的条目）也会被保存，
+// 以便在重启之后沿用已登录的会话。
+type FileStruct struct {
+	Version int       `json:"version"`
+	Session string    `json:"session"`
+	SavedAt time.Time `json:"saved_at"`
+	Cookies []Entry   `json:"cookies"`
+}
+
+// ErrIllegalSession 代表非法的会话名称的错误。
+var ErrIllegalSession = errors.New("illegal session name")
+
+// Manager 代表cookie jar管理器的接口类型。
+// 它为每个爬取会话（或身份）维护一个独立的cookie jar，
+// 并可以把它们保存到目录中，每个会话对应一个名为“<会话名称>.json”的文件。
+// 该接口的实现类型必须是并发安全的！
+type Manager interface {
+	// Dir 用于获取保存cookie文件的目录。若为空，则不进行持久化。
+	Dir() string
+	// Jar 用于获取给定会话的cookie jar。
+	// 若该会话尚不存在，则会创建它，并在有对应文件的情况下从文件中载入cookie。
+	Jar(session string) (Jar, error)
+	// Sessions 用于获取所有会话的名称。
+	Sessions() []string
+	// Seed 用于向给定会话的cookie jar中预置cookie，常用于通过配置提供登录凭证。
+	Seed(session string, entries []Entry) error
+	// Save 用于把给定会话的cookie保存到文件中。
+	Save(session string) error
+	// SaveAll 用于保存所有会话的cookie。
+	SaveAll() error
+	// Remove 用于删除给定的会话及其对应的文件。
+	Remove(session string) error
+}
+
+// NewManager 用于创建一个cookie jar管理器。
+// 参数dir代表保存cookie文件的目录，若它不存在则会被创建。
+// 若参数dir为空，则只在内存中管理cookie jar。
+func NewManager(dir string) (Manager, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &myManager{
+		dir:  dir,
+		jars: map[string]Jar{},
+	}, nil
+}
+
+// myManager 代表cookie jar管理器的实现类型。
+type myManager struct {
+	// dir 代表保存cookie文件的目录。
+	dir string
+	// jars 代表会话名称与cookie jar的映射。
+	jars map[string]Jar
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (manager *myManager) Dir() string {
+	return manager.dir
+}
+
+func (manager *myManager) Jar(session string) (Jar, error) {
+	if err := checkSession(session); err != nil {
+		return nil, err
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	if jar, ok := manager.jars[session]; ok {
+		return jar, nil
+	}
+	jar := NewJar()
+	if manager.dir != "" {
+		file, err := readFile(manager.path(session))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if file != nil {
+			jar.Load(file.Cookies)
+		}
+	}
+	manager.jars[session] = jar
+	return jar, nil
+}
+
+func (manager *myManager) Sessions() []string {
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+	sessions := make([]string, 0, len(manager.jars))
+	for session := range manager.jars {
+		sessions = append(sessions, session)
+	}
+	sort.Strings(sessions)
+	return sessions
+}
+
+func (manager *myManager) Seed(session string, entries []Entry) error {
+	jar, err := manager.Jar(session)
+	if err != nil {
+		return err
+	}
+	jar.Load(entries)
+	return nil
+}
+
+func (manager *myManager) Save(session string) error {
+	if err := checkSession(session); err != nil {
+		return err
+	}
+	manager.lock.Lock()
+	jar, ok := manager.jars[session]
+	manager.lock.Unlock()
+	if !ok {
+		return fmt.Errorf("cookie: session not found: %s", session)
+	}
+	if manager.dir == "" {
+		return nil
+	}
+	file := FileStruct{
+		Version: FILE_VERSION,
+		Session: session,
+		SavedAt: time.Now(),
+		Cookies: jar.Entries(),
+	}
+	return writeFile(manager.path(session), file)
+}
+
+func (manager *myManager) SaveAll() error {
+	for _, session := range manager.Sessions() {
+		if err := manager.Save(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (manager *myManager) Remove(session string) error {
+	if err := checkSession(session); err != nil {
+		return err
+	}
+	manager.lock.Lock()
+	delete(manager.jars, session)
+	manager.lock.Unlock()
+	if manager.dir == "" {
+		return nil
+	}
+	err := os.Remove(manager.path(session))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path 用于获取给定会话对应的cookie文件的路径。
+func (manager *myManager) path(session string) string {
+	return filepath.Join(manager.dir, session+".json")
+}
+
+// checkSession 用于检查会话名称的合法性。
+func checkSession(session string) error {
+	if session == "" || session == "." || session == ".." ||
+		strings.ContainsAny(session, `/\`) {
+		return fmt.Errorf("%s: %q", ErrIllegalSession, session)
+	}
+	return nil
+}
+
+// readFile 用于读取cookie文件。
+func readFile(path string) (*FileStruct, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file FileStruct
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cookie: illegal cookie file %s: %s", path, err)
+	}
+	if file.Version != FILE_VERSION {
+		return nil, fmt.Errorf("cookie: unsupported cookie file version %d (file: %s)",
+			file.Version, path)
+	}
+	return &file, nil
+}
+
+// writeFile 用于写入cookie文件。
+// 数据会先被写入临时文件，然后再替换目标文件。
+func writeFile(path string, file FileStruct) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), ".cookie-")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	_, err = tempFile.Write(data)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package cookie
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookie-test-")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	manager, err := NewManager(dir)
+	if err != nil {
+		t.Fatalf("An error occurs when creating cookie manager: %s", err)
+	}
+	for _, session := range []string{"", "..", "a/b"} {
+		if _, err := manager.Jar(session); err == nil {
+			t.Fatalf("No error when getting jar with illegal session %q!", session)
+		}
+	}
+	alice, _ := manager.Jar("alice")
+	bob, _ := manager.Jar("bob")
+	if alice == bob {
+		t.Fatal("The jars of different sessions are the same!")
+	}
+	u, _ := url.Parse("https://example.com/")
+	alice.SetCookies(u, []*http.Cookie{{Name: "sid", Value: "alice"}})
+	if len(bob.Cookies(u)) != 0 {
+		t.Fatal("The cookies are shared between sessions!")
+	}
+	err = manager.Seed("bob", []Entry{{Name: "sid", Value: "bob", Domain: "example.com", Path: "/"}})
+	if err != nil {
+		t.Fatalf("An error occurs when seeding cookies: %s", err)
+	}
+	if err := manager.SaveAll(); err != nil {
+		t.Fatalf("An error occurs when saving cookies: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice.json")); err != nil {
+		t.Fatalf("The cookie file has not been saved: %s", err)
+	}
+	// 新的管理器会从文件中载入cookie。
+	manager2, _ := NewManager(dir)
+	for _, session := range []string{"alice", "bob"} {
+		jar, err := manager2.Jar(session)
+		if err != nil {
+			t.Fatalf("An error occurs when loading jar: %s (session: %s)", err, session)
+		}
+		cookies := jar.Cookies(u)
+		if len(cookies) != 1 || cookies[0].Value != session {
+			t.Fatalf("Inconsistent cookies for session %s: %v", session, cookies)
+		}
+	}
+	expectedSessions := []string{"alice", "bob"}
+	sessions := manager2.Sessions()
+	if len(sessions) != len(expectedSessions) || sessions[0] != "alice" {
+		t.Fatalf("Inconsistent sessions: expected: %v, actual: %v", expectedSessions, sessions)
+	}
+	if err := manager2.Remove("alice"); err != nil {
+		t.Fatalf("An error occurs when removing session: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice.json")); !os.IsNotExist(err) {
+		t.Fatal("The cookie file has not been removed!")
+	}
+	if err := manager2.Save("alice"); err == nil {
+		t.Fatal("No error when saving removed session!")
+	}
+	ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600)
+	if _, err := manager2.Jar("broken"); err == nil {
+		t.Fatal("No error when loading broken cookie file!")
+	}
+}
@@ -0,0 +1,80 @@
+package cookie
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpOnlyPrefix 代表cookies.txt中HttpOnly条目的行前缀。
+const httpOnlyPrefix = "#HttpOnly_"
+
+// ParseNetscape 用于解析Netscape格式（即cookies.txt）的cookie数据。
+// 每行代表一个cookie，由7个以制表符分隔的字段组成，依次是：
+// 域名、是否包含子域名、路径、是否仅限HTTPS、过期时间（Unix时间戳）、名称和值。
+// 以“#”开头的行和空行会被忽略，但以“#HttpOnly_”开头的行代表HttpOnly的cookie。
+func ParseNetscape(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, httpOnlyPrefix) {
+			line = line[len(httpOnlyPrefix):]
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 {
+			// 值为空的cookie可能缺少最后一个字段。
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("cookie: illegal cookies.txt line %d: %d fields",
+				lineNumber, len(fields))
+		}
+		expiresUnix, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cookie: illegal expiration in cookies.txt line %d: %s",
+				lineNumber, err)
+		}
+		entry := Entry{
+			Name:     fields[5],
+			Value:    fields[6],
+			Domain:   strings.ToLower(strings.TrimPrefix(fields[0], ".")),
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			HttpOnly: httpOnly,
+			HostOnly: !strings.EqualFold(fields[1], "TRUE"),
+		}
+		if expiresUnix > 0 {
+			entry.Expires = time.Unix(expiresUnix, 0)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ImportNetscape 用于把Netscape格式的cookie数据导入到给定的cookie jar中。
+// 结果值代表导入的条目数量（包括已过期而被忽略的条目）。
+func ImportNetscape(jar Jar, reader io.Reader) (int, error) {
+	if jar == nil {
+		return 0, fmt.Errorf("cookie: nil jar")
+	}
+	entries, err := ParseNetscape(reader)
+	if err != nil {
+		return 0, err
+	}
+	jar.Load(entries)
+	return len(entries), nil
+}
@@ -0,0 +1,49 @@
+package cookie
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseNetscape(t *testing.T) {
+	data := "# Netscape HTTP Cookie File\n" +
+		"\n" +
+		".example.com\tTRUE\t/\tFALSE\t4102444800\tlang\tzh\n" +
+		"#HttpOnly_www.example.com\tFALSE\t/\tTRUE\t0\tsid\tabc\n" +
+		"www.example.com\tFALSE\t/\tFALSE\t1\told\t1\n" +
+		"www.example.com\tFALSE\t/\tFALSE\t0\tempty\n"
+	entries, err := ParseNetscape(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing cookies.txt: %s", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Inconsistent entry number: expected: %d, actual: %d", 4, len(entries))
+	}
+	lang := entries[0]
+	if lang.Domain != "example.com" || lang.HostOnly || lang.Expires.Unix() != 4102444800 {
+		t.Fatalf("Inconsistent entry: %#v", lang)
+	}
+	sid := entries[1]
+	if !sid.HttpOnly || !sid.Secure || !sid.HostOnly || !sid.Expires.IsZero() {
+		t.Fatalf("Inconsistent entry: %#v", sid)
+	}
+	jar := NewJar()
+	n, err := ImportNetscape(jar, strings.NewReader(data))
+	if err != nil || n != 4 {
+		t.Fatalf("Inconsistent import result: %d (error: %v)", n, err)
+	}
+	u, _ := url.Parse("https://www.example.com/")
+	if cookies := jar.Cookies(u); len(cookies) != 3 {
+		t.Fatalf("Inconsistent cookie number: expected: %d, actual: %d", 3, len(cookies))
+	}
+	invalidDataList := []string{
+		"example.com\tTRUE\t/\n",
+		"example.com\tTRUE\t/\tFALSE\tnever\tname\tvalue\n",
+	}
+	for _, invalidData := range invalidDataList {
+		if _, err := ParseNetscape(strings.NewReader(invalidData)); err == nil {
+			t.Fatalf("No error when parsing illegal cookies.txt %q!", invalidData)
+		}
+	}
+}
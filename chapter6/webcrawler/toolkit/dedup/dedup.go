@@ -0,0 +1,239 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// MAX_DISTANCE 代表检测器支持的最大海明距离。
+const MAX_DISTANCE = 15
+
+// ErrIllegalDistance 是表示海明距离超出范围的错误的变量。
+var ErrIllegalDistance = fmt.Errorf("illegal distance: should be in [0, %d]", MAX_DISTANCE)
+
+// Fingerprint 代表内容的指纹。
+type Fingerprint struct {
+	// Hash 代表原始内容的SHA-256摘要。
+	Hash [sha256.Size]byte
+	// SimHash 代表规范化文本的SimHash指纹。
+	SimHash uint64
+	// Text 代表内容是否是文本。仅在其值为true时SimHash才有效。
+	Text bool
+}
+
+// NewFingerprint 用于计算内容的指纹。
+// 参数contentType代表内容的MIME类型。
+// 只有HTML和其他文本类型的内容才会计算SimHash指纹。
+func NewFingerprint(content []byte, contentType string) Fingerprint {
+	fp, _ := ReadFingerprint(bytes.NewReader(content), contentType)
+	return fp
+}
+
+// ReadFingerprint 用于以流的方式读取内容并计算其指纹。
+// 内容不会被完整地保存在内存中。参数contentType代表内容的MIME类型。
+// 若读取内容时发生错误，则返回该错误。
+func ReadFingerprint(r io.Reader, contentType string) (Fingerprint, error) {
+	hash := sha256.New()
+	r = io.TeeReader(r, hash)
+	var hasher simHasher
+	splitter := wordSplitter{emit: hasher.addWord}
+	var err error
+	switch mediaType(contentType) {
+	case "text/html", "application/xhtml+xml":
+		err = splitHTML(r, &splitter)
+	case "text/plain", "text/xml", "application/xml", "application/json":
+		err = splitText(r, &splitter)
+	}
+	if err == nil {
+		// 读完剩余的内容，以便计算完整的摘要。
+		_, err = io.Copy(ioutil.Discard, r)
+	}
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	var fp Fingerprint
+	copy(fp.Hash[:], hash.Sum(nil))
+	if hasher.count > 0 {
+		fp.SimHash = hasher.sum()
+		fp.Text = true
+	}
+	return fp, nil
+}
+
+// mediaType 用于从Content-Type中解析出小写的MIME类型。
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return mt
+}
+
+// Result 代表检测结果。
+type Result struct {
+	// Fingerprint 代表内容的指纹。
+	Fingerprint Fingerprint
+	// Exact 代表是否与已见过的内容完全相同。
+	Exact bool
+	// Near 代表是否与已见过的内容近似重复。
+	Near bool
+	// Distance 代表近似重复时与最接近的SimHash指纹的海明距离。
+	Distance int
+}
+
+// Duplicate 用于判断内容是否重复。
+func (result Result) Duplicate() bool {
+	return result.Exact || result.Near
+}
+
+// Counts 代表检测计数的类型。
+type Counts struct {
+	// Checked 代表已检测的内容的数量。
+	Checked uint64 `json:"checked"`
+	// Exact 代表完全重复的内容的数量。
+	Exact uint64 `json:"exact"`
+	// Near 代表近似重复的内容的数量。
+	Near uint64 `json:"near"`
+	// Unique 代表不重复的内容的数量。
+	Unique uint64 `json:"unique"`
+}
+
+// Detector 代表重复内容检测器的接口类型。
+// 该接口的实现类型必须是并发安全的！
+type Detector interface {
+	// MaxDistance 用于获取判定为近似重复的最大海明距离。
+	MaxDistance() int
+	// Check 用于检测内容是否与已见过的内容重复。
+	// 不重复的内容的指纹会被记录下来。
+	Check(content []byte, contentType string) Result
+	// CheckFingerprint 用于检测给定指纹的内容是否与已见过的内容重复。
+	// 不重复的内容的指纹会被记录下来。
+	CheckFingerprint(fp Fingerprint) Result
+	// Counts 用于获取检测计数。
+	Counts() Counts
+	// Clear 用于清除所有已记录的指纹和计数。
+	Clear()
+}
+
+// myDetector 代表重复内容检测器的实现类型。
+// 它利用抽屉原理对SimHash指纹进行分块索引：
+// 若两个指纹的海明距离不大于k，则把它们分为k+1块后至少有一块是相同的。
+type myDetector struct {
+	// maxDistance 代表判定为近似重复的最大海明距离。
+	maxDistance int
+	// blocks 代表SimHash指纹的各个分块的掩码。
+	blocks []uint64
+	// lock 代表互斥锁。
+	lock sync.Mutex
+	// hashes 代表已记录的内容摘要的集合。
+	hashes map[[sha256.Size]byte]struct{}
+	// index 代表各个分块的索引。
+	// 其中的键为分块的值，值为包含该分块的SimHash指纹的列表。
+	index []map[uint64][]uint64
+	// counts 代表检测计数。
+	counts Counts
+}
+
+// NewDetector 用于创建一个重复内容检测器。
+// 参数maxDistance代表判定为近似重复的最大海明距离，其取值范围是[0, MAX_DISTANCE]。
+func NewDetector(maxDistance int) (Detector, error) {
+	if maxDistance < 0 || maxDistance > MAX_DISTANCE {
+		return nil, ErrIllegalDistance
+	}
+	blockNumber := maxDistance + 1
+	blocks := make([]uint64, blockNumber)
+	for i := 0; i < blockNumber; i++ {
+		start := uint(i * 64 / blockNumber)
+		end := uint((i + 1) * 64 / blockNumber)
+		var mask uint64
+		for bit := start; bit < end; bit++ {
+			mask |= 1 << bit
+		}
+		blocks[i] = mask
+	}
+	detector := &myDetector{
+		maxDistance: maxDistance,
+		blocks:      blocks,
+	}
+	detector.Clear()
+	return detector, nil
+}
+
+func (detector *myDetector) MaxDistance() int {
+	return detector.maxDistance
+}
+
+func (detector *myDetector) Check(content []byte, contentType string) Result {
+	return detector.CheckFingerprint(NewFingerprint(content, contentType))
+}
+
+func (detector *myDetector) CheckFingerprint(fp Fingerprint) Result {
+	result := Result{Fingerprint: fp}
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	detector.counts.Checked++
+	if _, ok := detector.hashes[fp.Hash]; ok {
+		result.Exact = true
+		detector.counts.Exact++
+		return result
+	}
+	if fp.Text {
+		if distance, ok := detector.nearest(fp.SimHash); ok {
+			result.Near = true
+			result.Distance = distance
+			detector.counts.Near++
+			return result
+		}
+	}
+	detector.hashes[fp.Hash] = struct{}{}
+	if fp.Text {
+		for i, mask := range detector.blocks {
+			key := fp.SimHash & mask
+			detector.index[i][key] = append(detector.index[i][key], fp.SimHash)
+		}
+	}
+	detector.counts.Unique++
+	return result
+}
+
+// nearest 用于查找与给定指纹最接近的已记录指纹，
+// 并在其海明距离不大于最大海明距离时返回该距离。
+func (detector *myDetector) nearest(simHash uint64) (int, bool) {
+	minDistance := -1
+	for i, mask := range detector.blocks {
+		for _, candidate := range detector.index[i][simHash&mask] {
+			distance := HammingDistance(simHash, candidate)
+			if distance <= detector.maxDistance &&
+				(minDistance < 0 || distance < minDistance) {
+				minDistance = distance
+			}
+		}
+	}
+	return minDistance, minDistance >= 0
+}
+
+func (detector *myDetector) Counts() Counts {
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	return detector.counts
+}
+
+func (detector *myDetector) Clear() {
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	detector.hashes = map[[sha256.Size]byte]struct{}{}
+	detector.index = make([]map[uint64][]uint64, len(detector.blocks))
+	for i := range detector.index {
+		detector.index[i] = map[uint64][]uint64{}
+	}
+	detector.counts = Counts{}
+}
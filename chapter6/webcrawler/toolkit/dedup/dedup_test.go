@@ -0,0 +1,161 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// genTestingPage 用于生成测试用的HTML页面。
+func genTestingPage(body string) []byte {
+	return []byte(fmt.Sprintf("<html><body><p>%s</p></body></html>", body))
+}
+
+func TestDetectorNew(t *testing.T) {
+	for _, distance := range []int{-1, MAX_DISTANCE + 1} {
+		if _, err := NewDetector(distance); err == nil {
+			t.Fatalf("No error when creating detector with max distance %d!", distance)
+		}
+	}
+	for distance := 0; distance <= MAX_DISTANCE; distance++ {
+		detector, err := NewDetector(distance)
+		if err != nil {
+			t.Fatalf("An error occurs when creating detector: %s", err)
+		}
+		if detector.MaxDistance() != distance {
+			t.Fatalf("Inconsistent max distance: expected: %d, actual: %d",
+				distance, detector.MaxDistance())
+		}
+		// 各分块的掩码应该覆盖所有的位且互不重叠。
+		var union uint64
+		for _, mask := range detector.(*myDetector).blocks {
+			if union&mask != 0 {
+				t.Fatalf("Overlapped block masks with max distance %d!", distance)
+			}
+			union |= mask
+		}
+		if union != ^uint64(0) {
+			t.Fatalf("Incomplete block masks with max distance %d!", distance)
+		}
+	}
+}
+
+func TestReadFingerprint(t *testing.T) {
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20)
+	testCases := []struct {
+		content     []byte
+		contentType string
+		text        bool
+	}{
+		{genTestingPage(text), "text/html; charset=utf-8", true},
+		{[]byte("Hello, 世界"), "text/plain", true},
+		{[]byte("two words"), "application/json", true},
+		{[]byte("<html><script>x</script></html>"), "text/html", false},
+		{[]byte{0x89, 'P', 'N', 'G'}, "image/png", false},
+		{[]byte{}, "", false},
+	}
+	for _, tc := range testCases {
+		fp, err := ReadFingerprint(bytes.NewReader(tc.content), tc.contentType)
+		if err != nil {
+			t.Fatalf("An error occurs when reading fingerprint: %s", err)
+		}
+		expected := Fingerprint{Hash: sha256.Sum256(tc.content), Text: tc.text}
+		if tc.text {
+			expected.SimHash = SimHash(NormalizeText(string(tc.content)))
+			if strings.HasPrefix(tc.contentType, "text/html") {
+				expected.SimHash = SimHash(NormalizeHTML(tc.content))
+			}
+		}
+		if fp != expected {
+			t.Fatalf("Inconsistent fingerprint for %q: expected: %#v, actual: %#v",
+				tc.content, expected, fp)
+		}
+		if fp != NewFingerprint(tc.content, tc.contentType) {
+			t.Fatalf("Inconsistent fingerprint for %q with NewFingerprint!", tc.content)
+		}
+	}
+	// 读取内容时发生的错误会被返回。
+	r := io.MultiReader(strings.NewReader("<p>text"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := ReadFingerprint(r, "text/html"); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", io.ErrUnexpectedEOF, err)
+	}
+	r = io.MultiReader(strings.NewReader("data"), iotest.ErrReader(io.ErrUnexpectedEOF))
+	if _, err := ReadFingerprint(r, "image/png"); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestDetectorCheck(t *testing.T) {
+	detector, err := NewDetector(3)
+	if err != nil {
+		t.Fatalf("An error occurs when creating detector: %s", err)
+	}
+	text := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20) +
+		"and then runs into the forest to find some food for the winter"
+	page := genTestingPage(text)
+	contentType := "text/html; charset=utf-8"
+	if result := detector.Check(page, contentType); result.Duplicate() {
+		t.Fatalf("The first page is duplicate: %#v", result)
+	}
+	if result := detector.Check(page, contentType); !result.Exact {
+		t.Fatalf("The same page is not exact duplicate: %#v", result)
+	}
+	// 只有标记不同的页面。
+	printView := []byte(fmt.Sprintf(
+		`<html><head><script>print()</script></head><body><div class="print">%s</div></body></html>`,
+		text))
+	result := detector.Check(printView, "text/html")
+	if result.Exact || !result.Near || result.Distance != 0 {
+		t.Fatalf("The print view is not near duplicate: %#v", result)
+	}
+	nearPage := genTestingPage(strings.Replace(text, "winter", "summer", 1))
+	if result := detector.Check(nearPage, contentType); !result.Near {
+		t.Fatalf("The near page is not near duplicate: %#v", result)
+	}
+	farPage := genTestingPage(strings.Repeat("lorem ipsum dolor sit amet ", 20))
+	if result := detector.Check(farPage, contentType); result.Duplicate() {
+		t.Fatalf("The far page is duplicate: %#v", result)
+	}
+	// 非文本的内容只进行精确去重。
+	image := []byte{0x89, 'P', 'N', 'G'}
+	if result := detector.Check(image, "image/png"); result.Duplicate() || result.Fingerprint.Text {
+		t.Fatalf("Unexpected result for image: %#v", result)
+	}
+	if result := detector.Check(image, "image/png"); !result.Exact {
+		t.Fatalf("The same image is not exact duplicate: %#v", result)
+	}
+	expectedCounts := Counts{Checked: 7, Exact: 2, Near: 2, Unique: 3}
+	if counts := detector.Counts(); counts != expectedCounts {
+		t.Fatalf("Inconsistent counts: expected: %#v, actual: %#v", expectedCounts, counts)
+	}
+	detector.Clear()
+	if counts := detector.Counts(); counts != (Counts{}) {
+		t.Fatalf("Inconsistent counts after clearing: %#v", counts)
+	}
+	if result := detector.Check(page, contentType); result.Duplicate() {
+		t.Fatalf("The page is duplicate after clearing: %#v", result)
+	}
+}
+
+func TestDetectorCheckInParallel(t *testing.T) {
+	detector, _ := NewDetector(0)
+	number := 100
+	var wg sync.WaitGroup
+	for i := 0; i < number*2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			detector.Check(genTestingPage(fmt.Sprintf("page %d", i%number)), "text/html")
+		}(i)
+	}
+	wg.Wait()
+	counts := detector.Counts()
+	if counts.Unique != uint64(number) || counts.Exact != uint64(number) {
+		t.Fatalf("Inconsistent counts: %#v", counts)
+	}
+}
@@ -0,0 +1,211 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// SHINGLE_SIZE 代表计算SimHash时每个特征包含的词的数量。
+const SHINGLE_SIZE = 3
+
+// SimHash 用于计算已规范化的文本的SimHash指纹。
+// 特征是由相邻的若干个词组成的片段，汉字等表意文字的每个字都会被当作一个词。
+func SimHash(text string) uint64 {
+	var hasher simHasher
+	for _, word := range tokenize(text) {
+		hasher.addWord(word)
+	}
+	return hasher.sum()
+}
+
+// simHasher 代表以流的方式计算SimHash指纹的工具。
+// 它会依次接收词，并把相邻的SHINGLE_SIZE个词作为一个特征。
+type simHasher struct {
+	// weights 代表各个位的权重。
+	weights [64]int
+	// window 代表最近接收的至多SHINGLE_SIZE个词。
+	window []string
+	// count 代表已接收的词的数量。
+	count int
+}
+
+// addWord 用于接收一个词。
+func (hasher *simHasher) addWord(word string) {
+	hasher.count++
+	if len(hasher.window) == SHINGLE_SIZE {
+		hasher.window = append(hasher.window[:0], hasher.window[1:]...)
+	}
+	hasher.window = append(hasher.window, word)
+	if len(hasher.window) == SHINGLE_SIZE {
+		addFeature(&hasher.weights, strings.Join(hasher.window, " "))
+	}
+}
+
+// sum 用于根据已接收的词计算SimHash指纹。
+// 词的数量不足SHINGLE_SIZE时，所有的词会被当作一个特征。
+func (hasher *simHasher) sum() uint64 {
+	if hasher.count == 0 {
+		return 0
+	}
+	weights := hasher.weights
+	if hasher.count < SHINGLE_SIZE {
+		addFeature(&weights, strings.Join(hasher.window, " "))
+	}
+	var fingerprint uint64
+	for i, weight := range weights {
+		if weight > 0 {
+			fingerprint |= 1 << uint(i)
+		}
+	}
+	return fingerprint
+}
+
+// addFeature 用于把一个特征的哈希值累加到各个位的权重上。
+func addFeature(weights *[64]int, feature string) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	for i := uint(0); i < 64; i++ {
+		if sum&(1<<i) != 0 {
+			weights[i]++
+		} else {
+			weights[i]--
+		}
+	}
+}
+
+// HammingDistance 用于计算两个指纹之间的海明距离。
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// NormalizeText 用于规范化文本。
+// 它会把字母转换为小写，并把所有的标点和空白都替换为单个空格。
+func NormalizeText(text string) string {
+	return strings.Join(tokenize(text), " ")
+}
+
+// NormalizeHTML 用于提取HTML中的可见文本并规范化。
+// 脚本、样式等不可见元素的内容会被忽略。
+func NormalizeHTML(content []byte) string {
+	var words []string
+	splitter := wordSplitter{emit: func(word string) { words = append(words, word) }}
+	if err := splitHTML(bytes.NewReader(content), &splitter); err != nil {
+		return ""
+	}
+	return strings.Join(words, " ")
+}
+
+// splitHTML 用于从读取器中读取HTML，并把其中的可见文本拆分为词。
+func splitHTML(r io.Reader, splitter *wordSplitter) error {
+	tokenizer := html.NewTokenizer(r)
+	skipDepth := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if invisibleTags[string(name)] {
+				skipDepth++
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if invisibleTags[string(name)] && skipDepth > 0 {
+				skipDepth--
+			}
+		case html.TextToken:
+			if skipDepth == 0 {
+				splitter.write(tokenizer.Text())
+				splitter.flush()
+			}
+		}
+	}
+}
+
+// splitText 用于从读取器中读取文本并把它拆分为词。
+func splitText(r io.Reader, splitter *wordSplitter) error {
+	br := bufio.NewReader(r)
+	for {
+		ch, _, err := br.ReadRune()
+		if err == io.EOF {
+			splitter.flush()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		splitter.writeRune(ch)
+	}
+}
+
+// invisibleTags 代表内容不可见的HTML元素的名称的字典。
+var invisibleTags = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"head":     true,
+}
+
+// tokenize 用于把文本拆分为小写的词。
+func tokenize(text string) []string {
+	var words []string
+	splitter := wordSplitter{emit: func(word string) { words = append(words, word) }}
+	for _, r := range text {
+		splitter.writeRune(r)
+	}
+	splitter.flush()
+	return words
+}
+
+// wordSplitter 代表以流的方式把文本拆分为小写的词的工具。
+type wordSplitter struct {
+	// word 代表尚未结束的词。
+	word strings.Builder
+	// emit 代表接收拆分出的词的函数。
+	emit func(word string)
+}
+
+// write 用于写入一段UTF-8编码的文本。
+func (splitter *wordSplitter) write(text []byte) {
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		splitter.writeRune(r)
+		text = text[size:]
+	}
+}
+
+// writeRune 用于写入一个字符。
+func (splitter *wordSplitter) writeRune(r rune) {
+	switch {
+	case unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r):
+		splitter.flush()
+		splitter.emit(string(r))
+	case unicode.IsLetter(r) || unicode.IsDigit(r):
+		splitter.word.WriteRune(unicode.ToLower(r))
+	default:
+		splitter.flush()
+	}
+}
+
+// flush 用于结束当前的词。
+func (splitter *wordSplitter) flush() {
+	if splitter.word.Len() > 0 {
+		splitter.emit(splitter.word.String())
+		splitter.word.Reset()
+	}
+}
@@ -0,0 +1,50 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	text := NormalizeText("Hello,  World!\n第二行\tGo1.27")
+	expectedText := "hello world 第 二 行 go1 27"
+	if text != expectedText {
+		t.Fatalf("Inconsistent normalized text: expected: %q, actual: %q",
+			expectedText, text)
+	}
+	page := `<html><head><title>T</title><style>p {}</style></head>
+<body><script>var x = "<p>";</script><p>Hello <b>World</b></p><noscript>no</noscript></body></html>`
+	text = NormalizeHTML([]byte(page))
+	expectedText = "hello world"
+	if text != expectedText {
+		t.Fatalf("Inconsistent normalized HTML: expected: %q, actual: %q",
+			expectedText, text)
+	}
+}
+
+func TestSimHash(t *testing.T) {
+	if SimHash("") != 0 {
+		t.Fatal("The SimHash of empty text is not zero!")
+	}
+	base := strings.Repeat("the quick brown fox jumps over the lazy dog ", 20) +
+		"and then runs into the forest to find some food for the winter"
+	near := strings.Replace(base, "winter", "summer", 1)
+	far := strings.Repeat("lorem ipsum dolor sit amet consectetur adipiscing elit ", 20)
+	baseHash, nearHash, farHash := SimHash(base), SimHash(near), SimHash(far)
+	if SimHash(base) != baseHash {
+		t.Fatal("The SimHash is not deterministic!")
+	}
+	nearDistance := HammingDistance(baseHash, nearHash)
+	farDistance := HammingDistance(baseHash, farHash)
+	if nearDistance >= farDistance {
+		t.Fatalf("The near text is not closer than the far text: near: %d, far: %d",
+			nearDistance, farDistance)
+	}
+	if nearDistance > 3 {
+		t.Fatalf("The distance of near texts is too large: %d", nearDistance)
+	}
+	if HammingDistance(0, 0xff) != 8 {
+		t.Fatalf("Inconsistent hamming distance: expected: %d, actual: %d",
+			8, HammingDistance(0, 0xff))
+	}
+}
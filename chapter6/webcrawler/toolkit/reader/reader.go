@@ -12,6 +12,9 @@ type MultipleReader interface {
 	// Reader 用于获取一个可关闭读取器的实例。
 	// 后者会持有本多重读取器中的数据。
 	Reader() io.ReadCloser
+	// Close 用于关闭本多重读取器并释放相关的资源。
+	// 已获取的读取器在被关闭之前仍然可用。
+	Close() error
 }
 
 // myMultipleReader 代表多重读取器的实现类型。
@@ -39,3 +42,7 @@ func NewMultipleReader(reader io.Reader) (MultipleReader, error) {
 func (rr *myMultipleReader) Reader() io.ReadCloser {
 	return ioutil.NopCloser(bytes.NewReader(rr.data))
 }
+
+func (rr *myMultipleReader) Close() error {
+	return nil
+}
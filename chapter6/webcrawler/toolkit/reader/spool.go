@@ -0,0 +1,248 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// DefaultMemoryThreshold 代表默认的内存阈值，单位：字节。
+const DefaultMemoryThreshold int64 = 1 << 20
+
+// ErrTooLarge 代表数据超出最大尺寸的错误。
+var ErrTooLarge = errors.New("multiple reader: data too large")
+
+// Options 代表多重读取器的选项。
+type Options struct {
+	// MaxSize 代表允许读取的最大字节数。
+	// 若该值为0，则不限制。超出部分不会被读取，并且读取器会返回ErrTooLarge。
+	MaxSize int64
+	// MemoryThreshold 代表在内存中保存的最大字节数。
+	// 超出部分会被写入临时文件。若该值为0，则使用DefaultMemoryThreshold。
+	MemoryThreshold int64
+	// TempDir 代表临时文件所在的目录。若该值为空，则使用系统默认的临时目录。
+	TempDir string
+}
+
+// NewSpoolingMultipleReader 用于新建并返回一个按需读取的多重读取器的实例。
+// 该多重读取器只有在它的读取器被读取时才会读取底层数据，
+// 并会把超出内存阈值的数据写入临时文件。
+// 该多重读取器被关闭并且它的所有读取器都被关闭之后，临时文件会被删除。
+func NewSpoolingMultipleReader(reader io.Reader, opts Options) (MultipleReader, error) {
+	if opts.MaxSize < 0 {
+		return nil, fmt.Errorf("multiple reader: negative max size: %d", opts.MaxSize)
+	}
+	if opts.MemoryThreshold < 0 {
+		return nil, fmt.Errorf("multiple reader: negative memory threshold: %d",
+			opts.MemoryThreshold)
+	}
+	if opts.MemoryThreshold == 0 {
+		opts.MemoryThreshold = DefaultMemoryThreshold
+	}
+	if opts.MaxSize > 0 && opts.MemoryThreshold > opts.MaxSize {
+		opts.MemoryThreshold = opts.MaxSize
+	}
+	spool := &mySpoolingMultipleReader{
+		src:  reader,
+		opts: opts,
+	}
+	if reader == nil {
+		spool.srcErr = io.EOF
+	}
+	return spool, nil
+}
+
+// mySpoolingMultipleReader 代表按需读取的多重读取器的实现类型。
+type mySpoolingMultipleReader struct {
+	// src 代表底层数据的读取器。
+	src io.Reader
+	// opts 代表选项。
+	opts Options
+	// mem 代表保存在内存中的数据。
+	mem []byte
+	// file 代表保存超出内存阈值的数据的临时文件。
+	file *os.File
+	// size 代表已读取的数据的总字节数。
+	size int64
+	// srcErr 代表读取底层数据时遇到的错误，包括io.EOF。
+	srcErr error
+	// refs 代表尚未关闭的读取器的数量。
+	refs int
+	// closed 代表本多重读取器是否已关闭。
+	closed bool
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (spool *mySpoolingMultipleReader) Reader() io.ReadCloser {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	spool.refs++
+	return &spoolReader{spool: spool}
+}
+
+// Close 用于关闭本多重读取器。
+// 若仍有读取器未被关闭，则会先读完底层数据，以使这些读取器在底层数据源关闭后仍然可用。
+func (spool *mySpoolingMultipleReader) Close() error {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	if spool.closed {
+		return nil
+	}
+	spool.closed = true
+	var err error
+	if spool.refs > 0 {
+		for spool.srcErr == nil {
+			spool.fill()
+		}
+		if spool.srcErr != io.EOF && spool.srcErr != ErrTooLarge {
+			err = spool.srcErr
+		}
+	}
+	spool.src = nil
+	if spool.refs == 0 {
+		spool.cleanup()
+	}
+	return err
+}
+
+// readAt 用于从给定的偏移量开始读取数据。必要时会读取更多的底层数据。
+func (spool *mySpoolingMultipleReader) readAt(p []byte, off int64) (int, error) {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	for off >= spool.size {
+		if spool.srcErr != nil {
+			return 0, spool.srcErr
+		}
+		spool.fill()
+	}
+	memLen := int64(len(spool.mem))
+	if off < memLen {
+		return copy(p, spool.mem[off:]), nil
+	}
+	max := spool.size - off
+	if int64(len(p)) > max {
+		p = p[:max]
+	}
+	return spool.file.ReadAt(p, off-memLen)
+}
+
+// fill 用于读取一块底层数据并保存起来。调用方需持有锁。
+func (spool *mySpoolingMultipleReader) fill() {
+	chunk := make([]byte, 32*1024)
+	if max := spool.opts.MaxSize; max > 0 && int64(len(chunk)) > max-spool.size+1 {
+		// 多读一个字节，以便判断数据是否超出了最大尺寸。
+		chunk = chunk[:max-spool.size+1]
+	}
+	n, err := spool.src.Read(chunk)
+	if n > 0 {
+		data := chunk[:n]
+		if max := spool.opts.MaxSize; max > 0 && spool.size+int64(n) > max {
+			data = data[:max-spool.size]
+			err = ErrTooLarge
+		}
+		if werr := spool.store(data); werr != nil {
+			err = werr
+		}
+	}
+	if err != nil {
+		spool.srcErr = err
+	}
+}
+
+// store 用于保存数据。超出内存阈值的部分会被写入临时文件。调用方需持有锁。
+func (spool *mySpoolingMultipleReader) store(data []byte) error {
+	if room := spool.opts.MemoryThreshold - int64(len(spool.mem)); room > 0 && spool.file == nil {
+		if int64(len(data)) <= room {
+			spool.mem = append(spool.mem, data...)
+			spool.size += int64(len(data))
+			return nil
+		}
+		spool.mem = append(spool.mem, data[:room]...)
+		spool.size += room
+		data = data[room:]
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if spool.file == nil {
+		file, err := ioutil.TempFile(spool.opts.TempDir, "webcrawler-reader-")
+		if err != nil {
+			return fmt.Errorf("multiple reader: couldn't create temp file: %s", err)
+		}
+		spool.file = file
+	}
+	n, err := spool.file.Write(data)
+	spool.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("multiple reader: couldn't write temp file: %s", err)
+	}
+	return nil
+}
+
+// release 用于在某个读取器关闭时减少引用计数，并在必要时清理资源。
+func (spool *mySpoolingMultipleReader) release() {
+	spool.lock.Lock()
+	defer spool.lock.Unlock()
+	spool.refs--
+	if spool.closed && spool.refs == 0 {
+		spool.cleanup()
+	}
+}
+
+// cleanup 用于删除临时文件并释放内存。调用方需持有锁。
+func (spool *mySpoolingMultipleReader) cleanup() {
+	if spool.file != nil {
+		name := spool.file.Name()
+		spool.file.Close()
+		os.Remove(name)
+		spool.file = nil
+	}
+	spool.mem = nil
+	if spool.srcErr == nil {
+		spool.srcErr = io.ErrClosedPipe
+	}
+}
+
+// spoolReader 代表按需读取的多重读取器所提供的读取器。
+type spoolReader struct {
+	// spool 代表所属的多重读取器。
+	spool *mySpoolingMultipleReader
+	// off 代表当前的读取位置。
+	off int64
+	// closed 代表本读取器是否已关闭。
+	closed bool
+	// lock 代表互斥锁。
+	lock sync.Mutex
+}
+
+func (r *spoolReader) Read(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.spool.readAt(p, r.off)
+	r.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *spoolReader) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.spool.release()
+	return nil
+}
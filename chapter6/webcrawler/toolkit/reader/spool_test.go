@@ -0,0 +1,131 @@
+package reader
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// countingReader 代表会记录读取次数的读取器。
+type countingReader struct {
+	r     io.Reader
+	count int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	cr.count++
+	return cr.r.Read(p)
+}
+
+func TestSpoolingReaderNew(t *testing.T) {
+	invalidOptsList := []Options{
+		{MaxSize: -1},
+		{MemoryThreshold: -1},
+	}
+	for _, opts := range invalidOptsList {
+		if _, err := NewSpoolingMultipleReader(strings.NewReader(""), opts); err == nil {
+			t.Fatalf("No error when new spooling multiple reader with illegal options %#v!", opts)
+		}
+	}
+	rr, err := NewSpoolingMultipleReader(nil, Options{})
+	if err != nil {
+		t.Fatalf("An error occurs when new spooling multiple reader: %s", err)
+	}
+	data, err := ioutil.ReadAll(rr.Reader())
+	if err != nil || len(data) != 0 {
+		t.Fatalf("Inconsistent data for nil reader: %q (error: %v)", data, err)
+	}
+}
+
+func TestSpoolingReaderLazy(t *testing.T) {
+	src := &countingReader{r: strings.NewReader("lazy data")}
+	rr, err := NewSpoolingMultipleReader(src, Options{})
+	if err != nil {
+		t.Fatalf("An error occurs when new spooling multiple reader: %s", err)
+	}
+	r := rr.Reader()
+	if src.count != 0 {
+		t.Fatalf("The underlying reader was read before reading! (count: %d)", src.count)
+	}
+	r.Close()
+	if err := rr.Close(); err != nil {
+		t.Fatalf("An error occurs when closing spooling multiple reader: %s", err)
+	}
+	if src.count != 0 {
+		t.Fatalf("The underlying reader was read without any reading! (count: %d)", src.count)
+	}
+}
+
+func TestSpoolingReaderSpill(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "reader-test-")
+	if err != nil {
+		t.Fatalf("An error occurs when creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+	expectedData := strings.Repeat("0987dcba", 20000)
+	opts := Options{MemoryThreshold: 1000, TempDir: tempDir}
+	rr, err := NewSpoolingMultipleReader(strings.NewReader(expectedData), opts)
+	if err != nil {
+		t.Fatalf("An error occurs when new spooling multiple reader: %s", err)
+	}
+	for i := 0; i < 3; i++ {
+		r := rr.Reader()
+		buffer := new(bytes.Buffer)
+		if _, err := io.Copy(buffer, r); err != nil {
+			t.Fatalf("An error occurs when copying data: %s", err)
+		}
+		if buffer.String() != expectedData {
+			t.Fatalf("Inconsistent data: expected length: %d, actual length: %d",
+				len(expectedData), buffer.Len())
+		}
+		r.Close()
+	}
+	files, _ := ioutil.ReadDir(tempDir)
+	if len(files) != 1 {
+		t.Fatalf("Inconsistent temp file number: expected: %d, actual: %d", 1, len(files))
+	}
+	// 未关闭的读取器在多重读取器关闭后仍然可用。
+	r := rr.Reader()
+	rr.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("An error occurs when reading data after closing: %s", err)
+	}
+	if string(data) != expectedData {
+		t.Fatalf("Inconsistent data after closing: expected length: %d, actual length: %d",
+			len(expectedData), len(data))
+	}
+	r.Close()
+	files, _ = ioutil.ReadDir(tempDir)
+	if len(files) != 0 {
+		t.Fatalf("The temp files have not been removed! (number: %d)", len(files))
+	}
+}
+
+func TestSpoolingReaderMaxSize(t *testing.T) {
+	expectedData := "0123456789"
+	rr, err := NewSpoolingMultipleReader(
+		strings.NewReader(expectedData+"abcdef"), Options{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("An error occurs when new spooling multiple reader: %s", err)
+	}
+	data, err := ioutil.ReadAll(rr.Reader())
+	if err != ErrTooLarge {
+		t.Fatalf("Inconsistent error: expected: %v, actual: %v", ErrTooLarge, err)
+	}
+	if string(data) != expectedData {
+		t.Fatalf("Inconsistent data: expected: %s, actual: %s", expectedData, data)
+	}
+	rr, _ = NewSpoolingMultipleReader(
+		strings.NewReader(expectedData), Options{MaxSize: 10})
+	data, err = ioutil.ReadAll(rr.Reader())
+	if err != nil {
+		t.Fatalf("An error occurs when reading data within max size: %s", err)
+	}
+	if string(data) != expectedData {
+		t.Fatalf("Inconsistent data: expected: %s, actual: %s", expectedData, data)
+	}
+}